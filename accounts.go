@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// accountToken is one YNAB account of a --token-file
+type accountToken struct {
+	name  string // subdirectory of the output; empty for a plain token file
+	token string
+}
+
+// accountName is what a --token-file may call an account: a plain
+// directory name
+var accountName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// readTokenFile parses a --token-file. Each line holds a token, preceded by
+// the account's name when the file holds several; blank lines and lines
+// starting with # are skipped. A file with a single unnamed token is a
+// plain token file.
+func readTokenFile(path string) ([]accountToken, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read token file: %w", err)
+	}
+	var accounts []accountToken
+	seen := map[string]bool{}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// Errors name the line, never its content, which holds a token
+		var a accountToken
+		switch fields := strings.Fields(line); len(fields) {
+		case 1:
+			a.token = fields[0]
+		case 2:
+			a.name, a.token = fields[0], fields[1]
+			if !accountName.MatchString(a.name) {
+				return nil, fmt.Errorf("token file %s line %d: account name must be letters, digits, '.', '_' or '-'", path, n)
+			}
+			if seen[strings.ToLower(a.name)] {
+				return nil, fmt.Errorf("token file %s line %d: account %s is listed twice", path, n, a.name)
+			}
+			seen[strings.ToLower(a.name)] = true
+		default:
+			return nil, fmt.Errorf("token file %s line %d: want a token, or an account name and a token", path, n)
+		}
+		accounts = append(accounts, a)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read token file: %w", err)
+	}
+	if len(accounts) == 0 {
+		return nil, fmt.Errorf("token file %s holds no token", path)
+	}
+	for _, a := range accounts {
+		if a.name == "" && len(accounts) > 1 {
+			return nil, fmt.Errorf("token file %s holds several tokens; name each account, e.g. \"family <token>\"", path)
+		}
+	}
+	return accounts, nil
+}
+
+// accountOutput is the subdirectory or key prefix of output for an account
+func accountOutput(output, name string) string {
+	return strings.TrimSuffix(output, "/") + "/" + name
+}
+
+// backupAccounts backs up every account of a --token-file in parallel, each
+// into its own subdirectory of opts.output. Each run has its own transport,
+// so each token is rate limited on its own. The first failure, in file
+// order, sets the exit code. stderr must already be safe for concurrent use,
+// as cmdBackup makes it.
+func backupAccounts(ctx context.Context, opts backupOptions, accounts []accountToken, common commonFlags, l Localizer, logger *slog.Logger, report io.Writer, stderr io.Writer) int {
+	if report != nil {
+		report = &lockedWriter{w: report}
+	}
+	codes := make([]int, len(accounts))
+	var g errgroup.Group
+	for i, a := range accounts {
+		aopts := opts
+		aopts.token, aopts.account, aopts.output = a.token, a.name, accountOutput(opts.output, a.name)
+		g.Go(func() error {
+			codes[i] = backupOnce(ctx, aopts, common, l, logger, report, stderr)
+			return nil
+		})
+	}
+	_ = g.Wait()
+	return cmp.Or(codes...)
+}
+
+// lockedWriter serialises writes from parallel runs, so lines of the log
+// and the --json report do not interleave
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestReadTokenFile reads a plain token or named accounts and never quotes
+// a token in its errors
+func TestReadTokenFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []accountToken
+		wantErr bool
+	}{
+		{"plain", "tok-1\n", []accountToken{{"", "tok-1"}}, false},
+		{"named", "# household\nalice tok-1\n\nbob.smith  tok-2\n", []accountToken{{"alice", "tok-1"}, {"bob.smith", "tok-2"}}, false},
+		{"one named", "alice tok-1", []accountToken{{"alice", "tok-1"}}, false},
+		{"unnamed several", "tok-1\ntok-2\n", nil, true},
+		{"mixed", "alice tok-1\ntok-2\n", nil, true},
+		{"bad name", "../x tok-1\n", nil, true},
+		{"duplicate", "alice tok-1\nAlice tok-2\n", nil, true},
+		{"too many fields", "alice tok-1 extra\n", nil, true},
+		{"empty", "# nothing\n", nil, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tokens.txt")
+			if err := os.WriteFile(path, []byte(tc.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			got, err := readTokenFile(path)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("readTokenFile = %v, %v; want error %v", got, err, tc.wantErr)
+			}
+			if err != nil && strings.Contains(err.Error(), "tok-") {
+				t.Errorf("error quotes a token: %v", err)
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("accounts = %+v; want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestBackupTokenFile backs up each account with its own token into its
+// own subdirectory and reports them separately
+func TestBackupTokenFile(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer tok-")
+		if r.URL.Path == "/" {
+			fmt.Fprintf(w, `{"data":{"budgets":[{"id":"%s1","name":"Budget","last_modified_on":"2025-01-01T00:00:00Z"}]}}`, user)
+			return
+		}
+		fmt.Fprintf(w, `{"data":{"budget":{"id":%q},"server_knowledge":1}}`, strings.TrimPrefix(r.URL.Path, "/"))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	tokens := filepath.Join(t.TempDir(), "tokens.txt")
+	if err := os.WriteFile(tokens, []byte("alice tok-a\nbob tok-b\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	args := []string{"backup", "--url", srv.URL, "--output", dir, "--token-file", tokens, "--json"}
+	if code := runCLI(args, &stdout, &stderr); code != 0 {
+		t.Fatalf("backup exit code = %d; stderr: %s", code, stderr.String())
+	}
+	for _, want := range []string{"alice/Budget_a1_20250101T000000Z.json", "bob/Budget_b1_20250101T000000Z.json"} {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(want))); err != nil {
+			t.Errorf("%s not saved: %v", want, err)
+		}
+	}
+	var accounts []string
+	dec := json.NewDecoder(&stdout)
+	for {
+		var rep runReportJSON
+		if err := dec.Decode(&rep); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		accounts = append(accounts, rep.Account)
+	}
+	slices.Sort(accounts)
+	if want := []string{"alice", "bob"}; !slices.Equal(accounts, want) {
+		t.Errorf("reported accounts = %v; want %v", accounts, want)
+	}
+
+	args = []string{"backup", "--url", srv.URL, "--output", dir, "--token-file", tokens, "--token", "tok-x"}
+	if code := runCLI(args, io.Discard, io.Discard); code != 2 {
+		t.Errorf("--token-file with --token exit code = %d; want 2", code)
+	}
+}
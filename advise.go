@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// apiHourlyLimit is YNAB's documented per-token request quota
+const apiHourlyLimit = 200
+
+// cadences are the backup intervals advise chooses from, shortest first
+var cadences = []struct {
+	every time.Duration
+	label string
+}{
+	{time.Hour, "hourly"},
+	{3 * time.Hour, "every 3 hours"},
+	{6 * time.Hour, "every 6 hours"},
+	{12 * time.Hour, "every 12 hours"},
+	{24 * time.Hour, "daily"},
+	{7 * 24 * time.Hour, "weekly"},
+}
+
+// budgetAdvice is the cadence recommendation for one budget
+type budgetAdvice struct {
+	Name      string
+	ID        string
+	Snapshots int
+	Median    time.Duration // 0 when there is too little history
+	Cadence   time.Duration
+	Label     string
+}
+
+// adviseCadence recommends a backup cadence per budget from how often its
+// stored snapshots changed: roughly twice per typical change interval
+func adviseCadence(snaps []snapshotInfo) []budgetAdvice {
+	byID := map[string][]snapshotInfo{}
+	for _, s := range snaps {
+		byID[s.ID] = append(byID[s.ID], s)
+	}
+	var out []budgetAdvice
+	for id, list := range byID {
+		sort.Slice(list, func(a, b int) bool { return list[a].Time.Before(list[b].Time) })
+		var gaps []time.Duration
+		for i := 1; i < len(list); i++ {
+			if gap := list[i].Time.Sub(list[i-1].Time); gap > 0 {
+				gaps = append(gaps, gap)
+			}
+		}
+		adv := budgetAdvice{Name: list[len(list)-1].Name, ID: id, Snapshots: len(list)}
+		if len(gaps) == 0 {
+			adv.Cadence, adv.Label = 24*time.Hour, "daily (not enough history)"
+		} else {
+			sort.Slice(gaps, func(a, b int) bool { return gaps[a] < gaps[b] })
+			adv.Median = gaps[len(gaps)/2]
+			adv.Cadence, adv.Label = cadences[0].every, cadences[0].label
+			for _, c := range cadences {
+				if c.every <= adv.Median/2 {
+					adv.Cadence, adv.Label = c.every, c.label
+				}
+			}
+		}
+		out = append(out, adv)
+	}
+	sort.Slice(out, func(a, b int) bool {
+		if out[a].Name != out[b].Name {
+			return out[a].Name < out[b].Name
+		}
+		return out[a].ID < out[b].ID
+	})
+	return out
+}
+
+// requestsPerBudget estimates API requests per downloaded budget from the
+// most recent successful run that downloaded any, defaulting to one (the
+// budget export itself)
+func requestsPerBudget(runs []runRecord) float64 {
+	for i := len(runs) - 1; i >= 0; i-- {
+		r := runs[i]
+		// Records from before unchanged budgets were skipped lack Downloaded
+		n := r.Downloaded
+		if n == 0 && r.Skipped == 0 {
+			n = r.Budgets
+		}
+		if r.Error == "" && n > 0 {
+			// One request per run lists the budgets
+			return float64(r.totalRequests()-1) / float64(n)
+		}
+	}
+	return 1
+}
+
+// printAdvice writes the per-budget table and the expected hourly API use
+func printAdvice(w io.Writer, advice []budgetAdvice, perBudget float64) {
+	fmt.Fprintln(w, "BUDGET\tID\tSNAPSHOTS\tTYPICAL CHANGE\tRECOMMENDED")
+	hourly := 0.0
+	for _, a := range advice {
+		median := "-"
+		if a.Median > 0 {
+			median = "every " + a.Median.Round(time.Minute).String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", a.Name, a.ID, a.Snapshots, median, a.Label)
+		hourly += perBudget * float64(time.Hour) / float64(a.Cadence)
+	}
+	fmt.Fprintf(w, "\nEstimated API use at these cadences: %.1f requests/hour (limit %d) at %.1f requests per budget per run.\n", hourly, apiHourlyLimit, perBudget)
+	if hourly > apiHourlyLimit {
+		fmt.Fprintln(w, "This exceeds the rate limit: back up less often or collect fewer --resources.")
+	} else if perBudget > 1 {
+		fmt.Fprintln(w, "Sub-resources cost one request each; drop --resources you don't restore from to save quota.")
+	}
+}
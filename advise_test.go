@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestAdviseCadence maps typical change intervals onto cadences
+func TestAdviseCadence(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	var snaps []snapshotInfo
+	// Busy changes about every 4 hours, Quiet every 10 days, New has one snapshot
+	for i := 0; i < 5; i++ {
+		snaps = append(snaps, snapshotInfo{Name: "Busy", ID: "b", Time: base.Add(time.Duration(i) * 4 * time.Hour)})
+		snaps = append(snaps, snapshotInfo{Name: "Quiet", ID: "q", Time: base.Add(time.Duration(i) * 240 * time.Hour)})
+	}
+	snaps = append(snaps, snapshotInfo{Name: "New", ID: "n", Time: base})
+
+	advice := adviseCadence(snaps)
+	want := map[string]string{"b": "hourly", "q": "daily", "n": "daily (not enough history)"}
+	if len(advice) != len(want) {
+		t.Fatalf("got %d recommendations; want %d", len(advice), len(want))
+	}
+	for _, a := range advice {
+		if a.Label != want[a.ID] {
+			t.Errorf("budget %s: cadence %q; want %q (median %v)", a.ID, a.Label, want[a.ID], a.Median)
+		}
+	}
+	if advice[0].Name != "Busy" || advice[2].Name != "Quiet" {
+		t.Errorf("advice not sorted by name: %+v", advice)
+	}
+}
+
+// TestRequestsPerBudget derives per-budget cost from the last good run
+func TestRequestsPerBudget(t *testing.T) {
+	if got := requestsPerBudget(nil); got != 1 {
+		t.Errorf("no history = %v; want 1", got)
+	}
+	runs := []runRecord{
+		{Budgets: 2, APIRequests: map[string]int{"/budgets": 1, "/budgets/{id}": 2, "/budgets/{id}/accounts": 2}},
+		{Budgets: 0, Error: "fetch budgets: bad status: 500", APIRequests: map[string]int{"/budgets": 1}},
+	}
+	if got := requestsPerBudget(runs); got != 2 {
+		t.Errorf("requestsPerBudget = %v; want 2", got)
+	}
+}
+
+// TestPrintAdviceQuotaWarning flags cadences that would exceed the rate limit
+func TestPrintAdviceQuotaWarning(t *testing.T) {
+	var advice []budgetAdvice
+	for i := 0; i < 30; i++ {
+		advice = append(advice, budgetAdvice{Name: "B", ID: "x", Cadence: time.Hour, Label: "hourly"})
+	}
+	var buf bytes.Buffer
+	printAdvice(&buf, advice, 8)
+	if !strings.Contains(buf.String(), "240.0 requests/hour") || !strings.Contains(buf.String(), "exceeds the rate limit") {
+		t.Errorf("unexpected advice output:\n%s", buf.String())
+	}
+}
+
+// TestAdviseCommandBudget advises on the selected budget only, and fails
+// for a budget without snapshots
+func TestAdviseCommandBudget(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"Busy_b_20250101T000000Z.json",
+		"Busy_b_20250101T040000Z.json",
+		"Quiet_q_20250101T000000Z.json",
+		"Quiet_q_20250111T000000Z.json",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var stdout, stderr strings.Builder
+	if code := runCLI([]string{"advise", "--output", dir, "--budget", "Quiet"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit code = %d; stderr: %s", code, stderr.String())
+	}
+	if out := stdout.String(); !strings.Contains(out, "Quiet") || !strings.Contains(out, "daily") || strings.Contains(out, "Busy") {
+		t.Errorf("advise --budget Quiet:\n%s", out)
+	}
+	if code := runCLI([]string{"advise", "--output", dir, "--budget", "missing"}, &strings.Builder{}, &strings.Builder{}); code != exitNotFound {
+		t.Errorf("advise --budget missing exit code = %d; want %d", code, exitNotFound)
+	}
+}
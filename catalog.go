@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// catalogFileName is the index of every snapshot ever saved, one JSON
+// object per line, kept in the output directory
+const catalogFileName = ".ynabvault-catalog.jsonl"
+
+// catalogEntry describes one saved snapshot. Entries outlive their files:
+// prune marks them instead of dropping them.
+type catalogEntry struct {
+	BudgetID string    `json:"budget_id"`
+	Budget   string    `json:"budget"`
+	Time     time.Time `json:"time"` // the budget's last modification
+	File     string    `json:"file"`
+	Size     int       `json:"size"`   // bytes of JSON before compression or encryption
+	SHA256   string    `json:"sha256"` // of those bytes
+	RunID    string    `json:"run_id"`
+	Pruned   time.Time `json:"pruned,omitzero"`
+}
+
+// runID names a run by the second it started, in UTC
+func runID(started time.Time) string {
+	return started.UTC().Format(ynabvault.TimeFormat)
+}
+
+// loadCatalog reads the catalog in store, oldest entry first
+func loadCatalog(ctx context.Context, store ynabvault.Store) ([]catalogEntry, error) {
+	data, err := store.Get(ctx, catalogFileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read catalog: %w: %w", ynabvault.ErrBackend, err)
+	}
+	var entries []catalogEntry
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var e catalogEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, fmt.Errorf("catalog line %d: %w: %w", i+1, ynabvault.ErrCorrupt, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// saveCatalog replaces the catalog in store with entries
+func saveCatalog(ctx context.Context, store ynabvault.Store, entries []catalogEntry) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	if err := store.Put(ctx, catalogFileName, buf.Bytes()); err != nil {
+		return fmt.Errorf("write catalog: %w: %w", ynabvault.ErrBackend, err)
+	}
+	return nil
+}
+
+// catalogRun adds the snapshots a backup saved to the catalog. Digests come
+// from the manifest, budget names from the run's results.
+func catalogRun(ctx context.Context, store ynabvault.Store, rec runRecord, results []ynabvault.BudgetReport) error {
+	if len(rec.Snapshots) == 0 {
+		return nil
+	}
+	m, err := ynabvault.LoadManifest(ctx, store)
+	if err != nil {
+		return err
+	}
+	names := map[string]string{}
+	for _, r := range results {
+		names[r.ID] = r.Name
+	}
+	entries, err := loadCatalog(ctx, store)
+	if err != nil {
+		return err
+	}
+	for _, file := range rec.Snapshots {
+		d := m.Files[file]
+		e := catalogEntry{BudgetID: d.BudgetID, Budget: names[d.BudgetID], Time: d.ServerTime, File: file, Size: d.Size, SHA256: d.SHA256, RunID: runID(rec.Started)}
+		if s, ok := parseSnapshotName(file); ok && e.BudgetID == "" {
+			e.BudgetID, e.Time = s.ID, s.Time
+		}
+		entries = append(entries, e)
+	}
+	return saveCatalog(ctx, store, entries)
+}
+
+// catalogPrune marks the catalog entries of removed files as pruned at when
+func catalogPrune(ctx context.Context, store ynabvault.Store, removed []string, when time.Time) error {
+	entries, err := loadCatalog(ctx, store)
+	if err != nil || len(entries) == 0 {
+		return err
+	}
+	changed := false
+	for i, e := range entries {
+		if e.Pruned.IsZero() && slices.Contains(removed, e.File) {
+			entries[i].Pruned, changed = when, true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return saveCatalog(ctx, store, entries)
+}
+
+// catalogFor returns the entries of the budget with this ID or name,
+// oldest first
+func catalogFor(entries []catalogEntry, budget string) []catalogEntry {
+	var out []catalogEntry
+	for _, e := range entries {
+		if e.BudgetID == budget || ynabvault.SanitizeFileName(e.Budget) == ynabvault.SanitizeFileName(budget) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// printCatalog writes catalog entries as a table; the last line that is not
+// pruned is the newest snapshot still in the vault
+func printCatalog(w io.Writer, entries []catalogEntry) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "BUDGET\tID\tMODIFIED\tFILE\tSIZE\tSHA256\tRUN\tSTATUS")
+	for _, e := range entries {
+		status := "stored"
+		if !e.Pruned.IsZero() {
+			status = "pruned " + e.Pruned.Local().Format("2006-01-02")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%.12s\t%s\t%s\n", cmp.Or(e.Budget, "-"), e.BudgetID, e.Time.Format("2006-01-02 15:04:05"),
+			e.File, e.Size, cmp.Or(e.SHA256, "-"), e.RunID, status)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// TestCatalog records each backup's snapshots, marks pruned ones and answers
+// list --budget from the record
+func TestCatalog(t *testing.T) {
+	modified := ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			fmt.Fprintf(w, `{"data":{"budgets":[{"id":"b1","name":"Home Budget","last_modified_on":%q},{"id":"b2","name":"Other"}]}}`, modified)
+			return
+		}
+		_, _ = io.WriteString(w, `{"data":{"budget":{"id":"b1"}}}`)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	for _, m := range []string{"2025-01-01T00:00:00Z", "2025-01-02T00:00:00Z"} {
+		modified = m
+		args := []string{"backup", "--token", "tok", "--url", srv.URL, "--output", dir}
+		var stderr bytes.Buffer
+		if code := runCLI(args, io.Discard, &stderr); code != 0 {
+			t.Fatalf("backup exit code = %d; stderr: %s", code, stderr.String())
+		}
+	}
+	if code := runCLI([]string{"prune", "--output", dir, "--keep-daily", "1"}, io.Discard, io.Discard); code != 0 {
+		t.Fatalf("prune exit code = %d", code)
+	}
+
+	entries, err := loadCatalog(t.Context(), ynabvault.DirStore(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	history := catalogFor(entries, "Home Budget")
+	if len(history) != 2 {
+		t.Fatalf("catalog of Home Budget = %+v; want 2 entries", history)
+	}
+	old, last := history[0], history[1]
+	if old.File != "Home_Budget_b1_20250101T000000Z.json" || old.Pruned.IsZero() || old.SHA256 == "" || old.Size == 0 || old.RunID == "" {
+		t.Errorf("first entry = %+v; want a pruned snapshot with digest and run", old)
+	}
+	if last.File != "Home_Budget_b1_20250102T000000Z.json" || !last.Pruned.IsZero() || last.Budget != "Home Budget" {
+		t.Errorf("last entry = %+v; want the stored snapshot", last)
+	}
+	if got := catalogFor(entries, "b1"); len(got) != 2 {
+		t.Errorf("catalog of b1 has %d entries; want 2", len(got))
+	}
+
+	var stdout bytes.Buffer
+	if code := runCLI([]string{"list", "--output", dir, "--budget", "b1"}, &stdout, io.Discard); code != 0 {
+		t.Fatalf("list --budget exit code = %d", code)
+	}
+	out := stdout.String()
+	if !strings.Contains(out, "pruned ") || !strings.Contains(out, "stored") || strings.Contains(out, "Other") {
+		t.Errorf("list --budget output:\n%s", out)
+	}
+}
+
+// TestListBudgetWithoutCatalog filters the files present when the vault has
+// no catalog yet
+func TestListBudgetWithoutCatalog(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"A_a1_20250101T000000Z.json", "B_b1_20250101T000000Z.json"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var stdout bytes.Buffer
+	if code := runCLI([]string{"list", "--output", dir, "--budget", "A"}, &stdout, io.Discard); code != 0 {
+		t.Fatalf("list --budget exit code = %d", code)
+	}
+	if out := stdout.String(); !strings.Contains(out, "A_a1_") || strings.Contains(out, "B_b1_") {
+		t.Errorf("list --budget A output:\n%s", out)
+	}
+}
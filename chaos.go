@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// chaosSettings are parsed from --chaos, e.g. "p=0.1,latency=2s"
+type chaosSettings struct {
+	p       float64       // chance that a request fails
+	latency time.Duration // upper bound of the delay added to every request
+}
+
+// enabled reports whether --chaos asks for anything
+func (c chaosSettings) enabled() bool {
+	return c.p > 0 || c.latency > 0
+}
+
+// parseChaos parses comma-separated key=value settings for --chaos
+func parseChaos(s string) (chaosSettings, error) {
+	var c chaosSettings
+	for part := range strings.SplitSeq(s, ",") {
+		key, val, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return c, fmt.Errorf("--chaos setting %q is not key=value", part)
+		}
+		switch key {
+		case "p":
+			p, err := strconv.ParseFloat(val, 64)
+			if err != nil || p < 0 || p > 1 {
+				return c, fmt.Errorf("--chaos p must be a probability between 0 and 1, got %q", val)
+			}
+			c.p = p
+		case "latency":
+			d, err := time.ParseDuration(val)
+			if err != nil || d < 0 {
+				return c, fmt.Errorf("--chaos latency must be a duration such as 2s, got %q", val)
+			}
+			c.latency = d
+		default:
+			return c, fmt.Errorf("unknown --chaos setting %q, want p or latency", key)
+		}
+	}
+	return c, nil
+}
+
+// chaosFailures are the failures chaosTransport picks from: a dropped
+// connection or a status the retry transport treats as transient
+var chaosFailures = []int{0, http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable}
+
+// chaosTransport delays requests and fails some of them on purpose, so
+// retries, alerts and wrapper scripts can be rehearsed against a healthy API
+type chaosTransport struct {
+	base     http.RoundTripper
+	settings chaosSettings
+	log      *slog.Logger
+	rand     func() float64
+}
+
+// newChaosTransport wraps base (http.DefaultTransport when nil)
+func newChaosTransport(base http.RoundTripper, settings chaosSettings, logger *slog.Logger) *chaosTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &chaosTransport{base: base, settings: settings, log: logger, rand: rand.Float64}
+}
+
+func (t *chaosTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.settings.latency > 0 {
+		d := time.Duration(t.rand() * float64(t.settings.latency))
+		if err := ynabvault.SleepContext(req.Context(), d); err != nil {
+			return nil, err
+		}
+	}
+	roll := t.rand()
+	if roll >= t.settings.p {
+		return t.base.RoundTrip(req)
+	}
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+	// Below p the roll is uniform again once scaled, so it picks the failure too
+	i := min(int(roll/t.settings.p*float64(len(chaosFailures))), len(chaosFailures)-1)
+	status := chaosFailures[i]
+	if status == 0 {
+		t.log.Debug("chaos: dropping request", "url", req.URL.Redacted())
+		return nil, fmt.Errorf("chaos: %w", syscall.ECONNRESET)
+	}
+	t.log.Debug("chaos: failing request", "url", req.URL.Redacted(), "status", status)
+	resp := &http.Response{
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode: status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}
+	if status == http.StatusTooManyRequests {
+		resp.Header.Set("Retry-After", "1")
+	}
+	return resp, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestParseChaos accepts a probability and a latency bound
+func TestParseChaos(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    chaosSettings
+		wantErr string
+	}{
+		{"p=0.1", chaosSettings{p: 0.1}, ""},
+		{"p=1, latency=2s", chaosSettings{p: 1, latency: 2 * time.Second}, ""},
+		{"latency=500ms", chaosSettings{latency: 500 * time.Millisecond}, ""},
+		{"p=1.5", chaosSettings{}, "between 0 and 1"},
+		{"latency=soon", chaosSettings{}, "duration"},
+		{"0.1", chaosSettings{}, "key=value"},
+		{"seed=1", chaosSettings{}, "unknown --chaos setting"},
+	}
+	for _, tc := range tests {
+		got, err := parseChaos(tc.in)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("parseChaos(%q) error = %v; want %q", tc.in, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("parseChaos(%q) = %+v, %v; want %+v", tc.in, got, err, tc.want)
+		}
+	}
+}
+
+// TestChaosTransport fails requests below p and passes the rest through
+func TestChaosTransport(t *testing.T) {
+	var hits int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+	}))
+	defer srv.Close()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	tests := []struct {
+		name       string
+		roll       float64 // every random draw returns this
+		wantStatus int
+		wantErr    error
+		wantHits   int
+	}{
+		{"passes", 0.5, http.StatusOK, nil, 1},
+		{"drops", 0.0, 0, syscall.ECONNRESET, 0},
+		{"fails", 0.2, http.StatusInternalServerError, nil, 0},
+		{"rate limits", 0.1, http.StatusTooManyRequests, nil, 0},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			hits = 0
+			tr := newChaosTransport(nil, chaosSettings{p: 0.4}, logger)
+			tr.rand = func() float64 { return tc.roll }
+			req, _ := http.NewRequestWithContext(t.Context(), http.MethodGet, srv.URL, nil)
+			resp, err := tr.RoundTrip(req)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("RoundTrip error = %v; want %v", err, tc.wantErr)
+			}
+			if err == nil {
+				resp.Body.Close()
+				if resp.StatusCode != tc.wantStatus {
+					t.Errorf("status = %d; want %d", resp.StatusCode, tc.wantStatus)
+				}
+			}
+			if hits != tc.wantHits {
+				t.Errorf("server saw %d requests; want %d", hits, tc.wantHits)
+			}
+		})
+	}
+}
+
+// TestRunCLIBackupChaos fails a backup whose every request is failed on purpose
+func TestRunCLIBackupChaos(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"data":{"budgets":[]}}`)
+	}))
+	defer srv.Close()
+	var stderr bytes.Buffer
+	args := []string{"backup", "--token", "tok", "--url", srv.URL, "--output", t.TempDir(), "--retries", "0", "--chaos", "p=1"}
+	if code := runCLI(args, io.Discard, &stderr); code == 0 {
+		t.Errorf("backup with --chaos p=1 succeeded; stderr: %s", stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "chaos mode") {
+		t.Errorf("stderr %q does not warn about chaos mode", stderr.String())
+	}
+	if code := runCLI([]string{"backup", "--chaos", "p=2"}, io.Discard, io.Discard); code != 2 {
+		t.Errorf("invalid --chaos exit code = %d; want 2", code)
+	}
+}
@@ -0,0 +1,2010 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"filippo.io/age"
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// commonFlags are registered on every subcommand's flag set
+type commonFlags struct {
+	verbose  bool
+	lang     string
+	logJSON  bool
+	logLevel slog.Level
+	levelSet bool // --log-level was given, overriding --verbose
+	timeout  time.Duration
+	readOnly bool
+	offline  bool
+	network  string // tcp4 or tcp6 from --ip-version; empty dials both
+	// logFile, when set, receives the log instead of stderr; see type logFile
+	logFile    string
+	logMaxSize int64
+	logMaxAge  time.Duration
+	logKeep    int
+	// logOutput is stderr, syslog or journald; see logsink.go
+	logOutput string
+}
+
+// readOnlyEnv, when set to a true value, makes --read-only the default
+const readOnlyEnv = "YNABVAULT_READ_ONLY"
+
+// offlineEnv, when set to a true value, makes --offline the default
+const offlineEnv = "YNABVAULT_OFFLINE"
+
+func (c *commonFlags) register(fs *flag.FlagSet) {
+	fs.BoolVar(&c.verbose, "verbose", false, "Enable verbose logging (same as --log-level info)")
+	fs.StringVar(&c.lang, "lang", "", "Language for CLI messages (en, de, nl, es); defaults to the LANG environment")
+	fs.Func("log-format", "Log format: text or json (default text)", func(s string) error {
+		switch s {
+		case "text", "json":
+			c.logJSON = s == "json"
+			return nil
+		}
+		return fmt.Errorf("want text or json")
+	})
+	fs.Func("log-level", "Minimum log level: debug, info, warn or error (default warn, info with --verbose)", func(s string) error {
+		c.levelSet = true
+		return c.logLevel.UnmarshalText([]byte(s))
+	})
+	fs.Func("log-file", "Write the log to this file instead of stderr, rotating it by size", func(s string) error {
+		if c.logOutput != "" && c.logOutput != logOutputStderr {
+			return fmt.Errorf("cannot be combined with --log-output %s", c.logOutput)
+		}
+		c.logFile = s
+		return nil
+	})
+	c.logMaxSize = 10 << 20
+	fs.Func("log-max-size", "Rotate the log file once it would grow past this size (default 10M)", func(s string) error {
+		n, err := parseByteSize(s)
+		if err != nil || n == 0 {
+			return cmp.Or(err, errors.New("want a size such as 10M"))
+		}
+		c.logMaxSize = n
+		return nil
+	})
+	fs.DurationVar(&c.logMaxAge, "log-max-age", 0, "Delete rotated log files older than this (0 keeps them by --log-keep only)")
+	fs.IntVar(&c.logKeep, "log-keep", 5, "Number of rotated log files to keep")
+	fs.Func("log-output", "Send the log to stderr (the default), syslog or journald", func(s string) error {
+		switch s {
+		case logOutputStderr, logOutputSyslog, logOutputJournald:
+		default:
+			return errors.New("want stderr, syslog or journald")
+		}
+		if s != logOutputStderr && c.logFile != "" {
+			return errors.New("cannot be combined with --log-file")
+		}
+		c.logOutput = s
+		return nil
+	})
+	fs.DurationVar(&c.timeout, "timeout", 0, "Abort the command after this long (0 means no limit)")
+	readOnly, _ := strconv.ParseBool(os.Getenv(readOnlyEnv))
+	fs.BoolVar(&c.readOnly, "read-only", readOnly, "Refuse to write to or delete from the vault or a YNAB budget (or set "+readOnlyEnv+")")
+	offline, _ := strconv.ParseBool(os.Getenv(offlineEnv))
+	fs.BoolVar(&c.offline, "offline", offline, "Refuse commands that need the YNAB API; commands reading the vault run as usual (or set "+offlineEnv+")")
+	fs.Func("ip-version", "Connect over IPv4 (4) or IPv6 (6) only, or both with fallback (auto, the default)", func(s string) error {
+		switch s {
+		case "4", "6":
+			c.network = "tcp" + s
+		case "auto":
+			c.network = ""
+		default:
+			return errors.New("want 4, 6 or auto")
+		}
+		return nil
+	})
+}
+
+// transport returns base, or a copy of it dialling only the IP version
+// --ip-version asks for; base must be an *http.Transport to be changed
+func (c *commonFlags) transport(base http.RoundTripper) http.RoundTripper {
+	t, ok := base.(*http.Transport)
+	if !ok || c.network == "" {
+		return base
+	}
+	t = t.Clone()
+	dial := t.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	}
+	network := c.network
+	t.DialContext = func(ctx context.Context, _, addr string) (net.Conn, error) {
+		return dial(ctx, network, addr)
+	}
+	return t
+}
+
+// refuseWrite reports, with the error message id formatted with args on
+// stderr, whether --read-only forbids what the command is about to do
+func (c *commonFlags) refuseWrite(stderr io.Writer, l Localizer, id string, args ...interface{}) bool {
+	if c.readOnly {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), l.T(id, args...))
+	}
+	return c.readOnly
+}
+
+// refuseOnline reports, with an error on stderr, whether --offline forbids
+// the YNAB API request command, as typed, is about to make
+func (c *commonFlags) refuseOnline(stderr io.Writer, l Localizer, command string) bool {
+	if c.offline {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), l.T(msgOffline, command))
+	}
+	return c.offline
+}
+
+// context returns the command's context, cancelled by SIGINT/SIGTERM and
+// once --timeout expires
+func (c *commonFlags) context() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	if c.timeout <= 0 {
+		return ctx, stop
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// logger returns a structured logger at the selected level and format,
+// writing to stderr, --log-file or the --log-output service, and a func
+// closing the connection to that service. Commands build it once and defer
+// the close. When the file or service cannot be opened, the error is
+// reported and stderr used. Credentials and payee and memo contents are
+// always redacted.
+func (c *commonFlags) logger(stderr io.Writer) (*slog.Logger, func()) {
+	level := slog.LevelWarn
+	switch {
+	case c.levelSet:
+		level = c.logLevel
+	case c.verbose:
+		level = slog.LevelInfo
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	switch c.logOutput {
+	case logOutputSyslog:
+		w, err := openSyslog()
+		if err == nil {
+			return slog.New(ynabvault.NewRedactHandler(newSyslogHandler(w, c.logJSON, opts))), func() { _ = w.Close() }
+		}
+		fmt.Fprintln(stderr, newLocalizer(c.lang).T(msgErrorPrefix), "syslog:", err)
+	case logOutputJournald:
+		h, err := newJournalHandler(opts)
+		if err == nil {
+			return slog.New(ynabvault.NewRedactHandler(h)), func() { _ = h.conn.Close() }
+		}
+		fmt.Fprintln(stderr, newLocalizer(c.lang).T(msgErrorPrefix), err)
+	}
+	if c.logFile != "" {
+		f, err := newLogFile(c.logFile, c.logMaxSize, c.logMaxAge, max(c.logKeep, 0))
+		if err != nil {
+			fmt.Fprintln(stderr, newLocalizer(c.lang).T(msgErrorPrefix), err)
+		} else {
+			stderr = f
+		}
+	}
+	var h slog.Handler = slog.NewTextHandler(stderr, opts)
+	if c.logJSON {
+		h = slog.NewJSONHandler(stderr, opts)
+	}
+	return slog.New(ynabvault.NewRedactHandler(h)), func() {}
+}
+
+// parseFlags parses args into fs, reporting whether the command should continue
+// and the exit code to use when it should not
+func parseFlags(fs *flag.FlagSet, args []string) (bool, int) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return false, 0
+		}
+		return false, 2
+	}
+	return true, 0
+}
+
+// cmdBackup implements "ynabvault backup"
+func cmdBackup(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var common commonFlags
+	common.register(fs)
+	var conf configFlags
+	conf.register(fs)
+	allProfiles := fs.Bool("all-profiles", false, "Back up every profile in the config file, one after another")
+	asJSON := fs.Bool("json", false, "Print a report of each run as one JSON object per line")
+	var opts backupOptions
+	fs.StringVar(&opts.token, "token", "", "YNAB API bearer token (or set YNAB_BEARER_TOKEN env var)")
+	opts.tokenFrom.register(fs)
+	fs.StringVar(&opts.tokenFile, "token-file", "", "File with the token, or a line \"<account> <token>\" per YNAB account to back up each in parallel into its own subdirectory")
+	fs.StringVar(&opts.output, "output", "budgets", "Directory, s3://bucket/prefix or sftp://user@host/path to save budget JSON files")
+	opts.api.register(fs)
+	fs.BoolVar(&opts.full, "full", false, "Ignore saved server knowledge and download every budget in full")
+	fs.BoolVar(&opts.force, "force", false, "Download budgets even when unchanged since the last run")
+	fs.BoolVar(&opts.resume, "resume", false, "Skip the budgets an interrupted or failed run already saved")
+	fs.DurationVar(&opts.minInterval, "min-interval", 0, "Skip the backup when the last successful one finished less than this long ago, e.g. 6h")
+	fs.IntVar(&opts.minIntervalExit, "min-interval-exit", 0, "Exit code when --min-interval skips the backup")
+	fs.BoolVar(&opts.strict, "strict", false, "Exit non-zero, listing them, when any budget could not be saved")
+	fs.BoolVar(&opts.failFast, "fail-fast", false, "Stop at the first budget that cannot be saved and exit non-zero")
+	fs.StringVar(&opts.resources, "resources", "", "Comma-separated per-budget sub-resources to save ("+strings.Join(ynabvault.BudgetResources, ", ")+")")
+	fs.Func("include", "Deprecated alias for --resources", func(s string) error {
+		opts.resources = s
+		return nil
+	})
+	fs.StringVar(&opts.since, "transactions-since", "", "Only save transactions on or after this date (YYYY-MM-DD) in the transactions resource")
+	fs.StringVar(&opts.maxSize, "max-budget-size", "", "Refuse to save budget exports larger than this, e.g. 50M; checked before full downloads")
+	fs.IntVar(&opts.concurrency, "concurrency", 1, "Number of budgets to download in parallel")
+	fs.IntVar(&opts.retries, "retries", 3, "Retries for network errors, 429 and 5xx responses")
+	fs.DurationVar(&opts.retryBackoff, "retry-backoff", time.Second, "Initial retry delay, doubled (with jitter) on each attempt")
+	fs.StringVar(&opts.notifyURL, "notify-url", "", "Webhook to POST a summary of each run to")
+	fs.StringVar(&opts.notifyFormat, "notify-format", "auto", "Webhook payload: "+strings.Join(notifyFormats, ", "))
+	fs.StringVar(&opts.message, "m", "", "Message describing this backup, shown by list and runs")
+	fs.BoolFunc("pretty", "Save budget JSON with sorted keys and two-space indentation, for diffing", func(string) error {
+		opts.jsonStyle = ynabvault.JSONPretty
+		return nil
+	})
+	fs.BoolFunc("canonical", "Save budget JSON with sorted keys and no whitespace, so equal budgets are equal bytes", func(string) error {
+		opts.jsonStyle = ynabvault.JSONCanonical
+		return nil
+	})
+	fs.Func("normalize", "Store budget JSON as pretty (sorted, indented), minified (sorted, no whitespace) or as-is", func(s string) error {
+		style, ok := normalizeStyles[s]
+		if !ok {
+			return errors.New("want pretty, minified or as-is")
+		}
+		opts.jsonStyle = style
+		return nil
+	})
+	fs.StringVar(&opts.layout, "layout", "", "Output layout: flat (the default), or nested for <name>_<id>/<timestamp>/budget.json")
+	fs.StringVar(&opts.filenameTemplate, "filename-template", "", "Name budget files from {name}, {id}, {date} and {ts}, or \"latest\" to overwrite {name}_{id}.json and link latest to it")
+	fs.StringVar(&opts.dohURL, "doh-url", "", "Resolve API host names with this DNS-over-HTTPS server, e.g. https://1.1.1.1/dns-query")
+	fs.Func("chaos", "Testing only: fail a share of API requests and delay them, e.g. p=0.1,latency=2s", func(s string) error {
+		var err error
+		opts.chaos, err = parseChaos(s)
+		return err
+	})
+	opts.retention.register(fs)
+	opts.lock.register(fs)
+	fs.Func("encrypt-recipient", "Encrypt budget files with age for this public key (repeatable)", func(s string) error {
+		opts.recipients = append(opts.recipients, s)
+		return nil
+	})
+	fs.Func("budget", "Only back up budgets whose name matches this glob or whose ID is this (repeatable)", func(s string) error {
+		opts.budgets = append(opts.budgets, s)
+		return nil
+	})
+	fs.Func("exclude-budget", "Skip budgets whose name matches this glob or whose ID is this (repeatable)", func(s string) error {
+		opts.exclude = append(opts.exclude, s)
+		return nil
+	})
+	if ok, code := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	l := newLocalizer(common.lang)
+	if common.refuseWrite(stderr, l, msgReadOnly, "backup") || common.refuseOnline(stderr, l, "backup") {
+		return 2
+	}
+	if flagSet(fs, "include") {
+		if flagSet(fs, "resources") {
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), "--include and --resources cannot be combined")
+			return 2
+		}
+		fmt.Fprintln(stderr, l.T(msgDeprecatedFlag, "--include", "--resources"))
+	}
+	if opts.retries < 0 || opts.retryBackoff < 0 {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), "--retries and --retry-backoff must not be negative")
+		return 2
+	}
+	if opts.lock.ttl <= 0 {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), "--lock-ttl must be positive")
+		return 2
+	}
+	if opts.tokenFile != "" && (flagSet(fs, "token") || flagSet(fs, "token-source")) {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), "--token-file cannot be combined with --token or --token-source")
+		return 2
+	}
+	if opts.minInterval < 0 {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), "--min-interval must not be negative")
+		return 2
+	}
+	styles := 0
+	for _, name := range []string{"pretty", "canonical", "normalize"} {
+		if flagSet(fs, name) {
+			styles++
+		}
+	}
+	if styles > 1 {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), "--pretty, --canonical and --normalize cannot be combined")
+		return 2
+	}
+	file, err := conf.load()
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 2
+	}
+	profiles := []string{conf.profile}
+	if *allProfiles {
+		if file == nil || conf.profile != "" {
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), "--all-profiles requires --config and cannot be combined with --profile")
+			return 2
+		}
+		if profiles = file.profileNames(); len(profiles) == 0 {
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), "config file defines no profiles")
+			return 2
+		}
+	}
+
+	// Cancelling stops in-flight requests; budgets already saved are kept
+	ctx, stop := common.context()
+	defer stop()
+	// Parallel --token-file runs share the logger, so its writes are
+	// serialised with their error messages
+	stderr = &lockedWriter{w: stderr}
+	logger, closeLog := common.logger(stderr)
+	defer closeLog()
+
+	// Every profile is attempted; the first failure decides the exit code
+	var report io.Writer
+	if *asJSON {
+		report = stdout
+	}
+	code := 0
+	for _, name := range profiles {
+		popts := opts
+		popts.profile = name
+		if file != nil {
+			if err := popts.merge(fs, file, name); err != nil {
+				fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+				code = cmp.Or(code, 2)
+				continue
+			}
+		}
+		if len(profiles) > 1 {
+			logger.Info("backing up profile", "profile", name)
+		}
+		if popts.tokenFile == "" {
+			code = cmp.Or(code, backupOnce(ctx, popts, common, l, logger, report, stderr))
+			continue
+		}
+		accounts, err := readTokenFile(popts.tokenFile)
+		switch {
+		case err != nil:
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+			code = cmp.Or(code, 2)
+		case len(accounts) == 1 && accounts[0].name == "":
+			popts.token = accounts[0].token
+			code = cmp.Or(code, backupOnce(ctx, popts, common, l, logger, report, stderr))
+		default:
+			code = cmp.Or(code, backupAccounts(ctx, popts, accounts, common, l, logger, report, stderr))
+		}
+	}
+	return code
+}
+
+// normalizeStyles maps --normalize values to how budget JSON is stored
+var normalizeStyles = map[string]ynabvault.JSONStyle{
+	"pretty":   ynabvault.JSONPretty,
+	"minified": ynabvault.JSONCanonical,
+	"as-is":    ynabvault.JSONAsFetched,
+}
+
+// backupOptions are the settings for one backup after merging the config
+// file and command-line flags
+type backupOptions struct {
+	profile          string // config profile, for reports
+	account          string // --token-file account, for logs and reports
+	token            string
+	tokenFrom        tokenFlags // where to look when token is empty
+	tokenFile        string     // --token-file or token_file, read per profile
+	output           string
+	api              apiFlags
+	endpoints        map[string]string   // per-endpoint URL overrides, config file only
+	gatewayAuth      []gatewayAuth       // config file only
+	proxy            proxyConfig         // config file only
+	dohURL           string              // --doh-url
+	jsonStyle        ynabvault.JSONStyle // --pretty, --canonical or --normalize
+	filenameTemplate string
+	layout           string
+	full             bool
+	force            bool
+	resume           bool
+	minInterval      time.Duration // skip when the last success is more recent
+	minIntervalExit  int
+	strict           bool
+	failFast         bool
+	resources        string
+	concurrency      int
+	retries          int
+	retryBackoff     time.Duration
+	message          string
+	recipients       []string
+	budgets          []string
+	exclude          []string
+	since            string // --transactions-since
+	maxSize          string // --max-budget-size
+	notifyURL        string
+	notifyFormat     string
+	retention        retention // prune after a successful backup when enabled
+	lock             lockFlags
+	chaos            chaosSettings
+}
+
+// apiFlags choose the YNAB API a command talks to
+type apiFlags struct {
+	host string // --api-host; every endpoint is derived from it
+	url  string // --url, the budgets endpoint itself
+}
+
+func (a *apiFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&a.host, "api-host", "", "Host serving the YNAB API, e.g. http://localhost:8080 for a mock or proxy")
+	fs.StringVar(&a.url, "url", ynabvault.DefaultBaseURL, "Base API URL for budgets endpoint; --api-host is usually simpler")
+}
+
+// budgetsURL returns the budgets endpoint, derived from --api-host when set
+func (a apiFlags) budgetsURL() (string, error) {
+	if a.host == "" {
+		return a.url, nil
+	}
+	if a.url != ynabvault.DefaultBaseURL {
+		return "", fmt.Errorf("--api-host and --url cannot be combined")
+	}
+	return ynabvault.BudgetsURL(a.host)
+}
+
+// merge fills in settings from the named profile that were not given as flags
+func (o *backupOptions) merge(fs *flag.FlagSet, file *configFile, name string) error {
+	p, err := file.profile(name)
+	if err != nil {
+		return err
+	}
+	switch {
+	case flagSet(fs, "token") || flagSet(fs, "token-source") || flagSet(fs, "token-file"):
+	case p.Token == "" && p.TokenEnv == "" && p.TokenFile != "":
+		// Read by the caller, as it may list several accounts
+		o.tokenFile = p.TokenFile
+	default:
+		if o.token, err = p.token(); err != nil {
+			return err
+		}
+	}
+	if p.Output != "" && !flagSet(fs, "output") {
+		o.output = p.Output
+	}
+	if !flagSet(fs, "url") && !flagSet(fs, "api-host") {
+		o.api.url = cmp.Or(p.URL, o.api.url)
+		o.api.host = p.APIHost
+	}
+	if p.Resources != nil && !flagSet(fs, "resources") && !flagSet(fs, "include") {
+		o.resources = strings.Join(p.Resources, ",")
+	}
+	if p.Concurrency != 0 && !flagSet(fs, "concurrency") {
+		o.concurrency = p.Concurrency
+	}
+	if p.EncryptRecipients != nil && !flagSet(fs, "encrypt-recipient") {
+		o.recipients = p.EncryptRecipients
+	}
+	if p.KeepDaily != 0 && !flagSet(fs, "keep-daily") {
+		o.retention.Daily = p.KeepDaily
+	}
+	if p.KeepWeekly != 0 && !flagSet(fs, "keep-weekly") {
+		o.retention.Weekly = p.KeepWeekly
+	}
+	if p.KeepMonthly != 0 && !flagSet(fs, "keep-monthly") {
+		o.retention.Monthly = p.KeepMonthly
+	}
+	if p.Budgets != nil && !flagSet(fs, "budget") {
+		o.budgets = p.Budgets
+	}
+	if p.ExcludeBudgets != nil && !flagSet(fs, "exclude-budget") {
+		o.exclude = p.ExcludeBudgets
+	}
+	if p.TransactionsSince != "" && !flagSet(fs, "transactions-since") {
+		o.since = p.TransactionsSince
+	}
+	if p.MaxBudgetSize != "" && !flagSet(fs, "max-budget-size") {
+		o.maxSize = p.MaxBudgetSize
+	}
+	if p.NotifyURL != "" && !flagSet(fs, "notify-url") {
+		o.notifyURL = p.NotifyURL
+	}
+	if p.NotifyFormat != "" && !flagSet(fs, "notify-format") {
+		o.notifyFormat = p.NotifyFormat
+	}
+	if p.Endpoints != nil {
+		o.endpoints = p.Endpoints
+	}
+	if p.GatewayAuth != nil {
+		o.gatewayAuth = p.GatewayAuth
+	}
+	o.proxy = p.Proxy
+	if p.DoHURL != "" && !flagSet(fs, "doh-url") {
+		o.dohURL = p.DoHURL
+	}
+	if p.JSONStyle != "" && !flagSet(fs, "pretty") && !flagSet(fs, "canonical") && !flagSet(fs, "normalize") {
+		o.jsonStyle = ynabvault.JSONStyle(p.JSONStyle)
+	}
+	if p.FilenameTemplate != "" && !flagSet(fs, "filename-template") {
+		o.filenameTemplate = p.FilenameTemplate
+	}
+	if p.Layout != "" && !flagSet(fs, "layout") {
+		o.layout = p.Layout
+	}
+	if p.MinInterval != "" && !flagSet(fs, "min-interval") {
+		if o.minInterval, err = time.ParseDuration(p.MinInterval); err != nil || o.minInterval < 0 {
+			return fmt.Errorf("min_interval %q: want a duration such as 6h", p.MinInterval)
+		}
+	}
+	if p.MinIntervalExit != 0 && !flagSet(fs, "min-interval-exit") {
+		o.minIntervalExit = p.MinIntervalExit
+	}
+	return nil
+}
+
+// runReportJSON is the --json report of one backup run
+type runReportJSON struct {
+	Profile    string                   `json:"profile,omitempty"`
+	Account    string                   `json:"account,omitempty"`
+	Started    time.Time                `json:"started"`
+	Finished   time.Time                `json:"finished"`
+	Duration   float64                  `json:"duration_seconds"`
+	Budgets    int                      `json:"budgets"`
+	Downloaded int                      `json:"downloaded"`
+	Skipped    int                      `json:"skipped"`
+	Failed     int                      `json:"failed"`
+	Error      string                   `json:"error,omitempty"`
+	Results    []ynabvault.BudgetReport `json:"results"`
+}
+
+// backupOnce runs a single backup and records it in the run history. When
+// report is not nil a runReportJSON is written to it.
+func backupOnce(ctx context.Context, opts backupOptions, common commonFlags, l Localizer, logger *slog.Logger, report io.Writer, stderr io.Writer) int {
+	// Resolve token
+	tok, err := opts.tokenFrom.resolve(ctx, opts.token)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 1
+	}
+	if tok == "" {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), l.T(msgTokenRequired))
+		return 1
+	}
+	if err := opts.proxy.check(); err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 2
+	}
+	storeOpts, _ := opts.proxy.storeOptions()
+	storeOpts.Network = common.network
+	store, err := ynabvault.OpenStoreWith(opts.output, storeOpts)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 2
+	}
+	if err := checkNotFrozen(ctx, store); err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return exitCode(err)
+	}
+	vault, err := loadVaultSettings(ctx, store)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return exitCode(err)
+	}
+	if err := vault.apply(&opts); err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 2
+	}
+
+	apiURL, err := opts.api.budgetsURL()
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 2
+	}
+	extras, err := ynabvault.ParseResources(opts.resources)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 2
+	}
+	if opts.concurrency < 1 {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), "--concurrency must be at least 1")
+		return 2
+	}
+	recipients, err := ynabvault.ParseRecipients(opts.recipients)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 2
+	}
+	if opts.since != "" {
+		if _, err := time.Parse(time.DateOnly, opts.since); err != nil {
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), "--transactions-since must be a date like 2015-01-01")
+			return 2
+		}
+		if !slices.Contains(extras, "transactions") {
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), "--transactions-since needs --resources transactions")
+			return 2
+		}
+	}
+	maxSize, err := parseByteSize(opts.maxSize)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), "--max-budget-size:", err)
+		return 2
+	}
+	if !slices.Contains(notifyFormats, opts.notifyFormat) {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), fmt.Sprintf("unknown --notify-format %q (supported: %s)", opts.notifyFormat, strings.Join(notifyFormats, ", ")))
+		return 2
+	}
+	if err := ynabvault.CheckBudgetPatterns(append(slices.Clone(opts.budgets), opts.exclude...)); err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 2
+	}
+	if err := ynabvault.CheckEndpoints(opts.endpoints); err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), "config endpoints:", err)
+		return 2
+	}
+	if err := opts.jsonStyle.Check(); err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), "json_style:", err)
+		return 2
+	}
+	if err := ynabvault.CheckFilenameTemplate(opts.filenameTemplate); err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 2
+	}
+	if err := ynabvault.CheckLayout(opts.layout, opts.filenameTemplate); err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 2
+	}
+	if err := checkGatewayAuth(opts.gatewayAuth); err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 2
+	}
+	if opts.account != "" {
+		logger = logger.With("account", opts.account)
+	}
+	// Retries wrap the rate limiter so every attempt waits for quota; usage
+	// counting sits close to the network so it sees each request sent, with
+	// only the gateway headers, which must be fresh per attempt, below it
+	network := proxyTransport("api", opts.proxy.API)
+	if opts.dohURL != "" {
+		resolver, err := newDoHResolver(opts.dohURL)
+		if err != nil {
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+			return 2
+		}
+		network = resolver.transport(network)
+	}
+	network = common.transport(network)
+	if len(opts.gatewayAuth) > 0 {
+		network = newGatewayTransport(network, opts.gatewayAuth)
+	}
+	usage := newUsageTransport(network, apiURL)
+	var api http.RoundTripper = usage
+	if opts.chaos.enabled() {
+		logger.Warn("chaos mode: failing and delaying API requests on purpose", "p", opts.chaos.p, "latency", opts.chaos.latency)
+		api = newChaosTransport(usage, opts.chaos, logger)
+	}
+	transport := ynabvault.NewRetryTransport(ynabvault.NewRateLimitTransport(api, logger), opts.retries, opts.retryBackoff, logger)
+	cfg := ynabvault.Config{
+		Token:             tok,
+		BaseURL:           apiURL,
+		Endpoints:         opts.endpoints,
+		JSONStyle:         opts.jsonStyle,
+		FilenameTemplate:  opts.filenameTemplate,
+		Layout:            opts.layout,
+		OutputDir:         opts.output,
+		Verbose:           common.verbose,
+		Full:              opts.full,
+		Force:             opts.force,
+		Resume:            opts.resume,
+		Resources:         extras,
+		Concurrency:       opts.concurrency,
+		Recipients:        recipients,
+		Budgets:           opts.budgets,
+		ExcludeBudgets:    opts.exclude,
+		TransactionsSince: opts.since,
+		MaxBudgetSize:     maxSize,
+		Strict:            opts.strict,
+		FailFast:          opts.failFast,
+		Store:             store,
+		Client:            &http.Client{Transport: transport},
+		Logger:            logger,
+	}
+
+	// The lock keeps another machine from updating state, manifest and
+	// history at the same time; it is held through the prune below
+	lock, err := acquireLock(ctx, store, "backup", opts.lock, logger)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return exitCode(err)
+	}
+	defer lock.release(context.WithoutCancel(ctx))
+
+	// Checked under the lock, so of two runs scheduled together the second
+	// sees the first one's result
+	if opts.minInterval > 0 {
+		runs, err := loadRuns(ctx, store)
+		if err != nil {
+			logger.Warn("run history unreadable, ignoring --min-interval", "error", err)
+		}
+		if last, ok := lastSuccess(runs); ok && time.Since(last.Finished) < opts.minInterval {
+			fmt.Fprintln(stderr, l.T(msgMinIntervalSkip,
+				time.Since(last.Finished).Round(time.Second), last.Finished.Local().Format("2006-01-02 15:04:05"), opts.minInterval))
+			return opts.minIntervalExit
+		}
+	}
+
+	// State before and after the run tells which snapshots this run wrote
+	before, _ := ynabvault.LoadState(ctx, store)
+	started := time.Now()
+	result, err := ynabvault.Run(ctx, cfg)
+	stats := result.Stats
+	rec := runRecord{Command: "backup", Client: currentClient(), Started: started, Finished: time.Now(), Budgets: stats.Budgets, Downloaded: stats.Downloaded,
+		Skipped: stats.Skipped, Failed: stats.Failed, Message: opts.message, APIRequests: usage.snapshot()}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	if after, serr := ynabvault.LoadState(context.WithoutCancel(ctx), store); serr == nil {
+		rec.Snapshots = savedSnapshots(before, after)
+	}
+	if herr := appendRun(context.WithoutCancel(ctx), store, rec); herr != nil {
+		logger.Warn("run history not updated", "error", herr)
+	}
+	if cerr := catalogRun(context.WithoutCancel(ctx), store, rec, result.Results); cerr != nil {
+		logger.Warn("catalog not updated", "error", cerr)
+	}
+	if opts.notifyURL != "" {
+		client := &http.Client{Transport: ynabvault.NewRetryTransport(common.transport(proxyTransport("notify", opts.proxy.Notify)), opts.retries, opts.retryBackoff, logger)}
+		if nerr := sendNotification(ctx, client, opts.notifyURL, opts.notifyFormat, rec); nerr != nil {
+			logger.Warn("notification not sent", "error", nerr)
+		}
+	}
+	if report != nil {
+		out := runReportJSON{Profile: opts.profile, Account: opts.account, Started: rec.Started, Finished: rec.Finished,
+			Duration: rec.Finished.Sub(rec.Started).Seconds(), Budgets: stats.Budgets, Downloaded: stats.Downloaded,
+			Skipped: stats.Skipped, Failed: stats.Failed, Error: rec.Error, Results: result.Results}
+		if out.Results == nil {
+			out.Results = []ynabvault.BudgetReport{}
+		}
+		if jerr := json.NewEncoder(report).Encode(out); jerr != nil {
+			logger.Warn("run report not written", "error", jerr)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return exitCode(err)
+	}
+	if cfg.Verbose {
+		fmt.Fprintln(stderr, l.T(msgProcessedBudgets, stats.Budgets, stats.Downloaded, stats.Skipped))
+	}
+	if opts.retention.enabled() {
+		pruneStarted := time.Now()
+		snaps, err := listSnapshots(ctx, store)
+		if err == nil {
+			var removed []string
+			removed, err = pruneSnapshots(ctx, store, snaps, opts.retention.keep(snaps), false)
+			logger.Info("pruned snapshots", "files", len(removed))
+			if len(removed) > 0 || err != nil {
+				if herr := appendPrune(context.WithoutCancel(ctx), store, pruneStarted, removed, err); herr != nil {
+					logger.Warn("run history not updated", "error", herr)
+				}
+			}
+		}
+		if err != nil {
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), "prune:", err)
+			return exitCode(err)
+		}
+	}
+	return 0
+}
+
+// cmdList implements "ynabvault list"
+func cmdList(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var common commonFlags
+	common.register(fs)
+	var conf configFlags
+	conf.register(fs)
+	output := fs.String("output", "budgets", "Directory, s3://bucket/prefix or sftp://user@host/path holding budget JSON files")
+	budget := fs.String("budget", "", "Show every snapshot of the budget with this name or ID from the catalog, pruned ones too")
+	if ok, code := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	l := newLocalizer(common.lang)
+	store, dir, err := conf.store(fs, *output, common.network)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 2
+	}
+
+	ctx, stop := common.context()
+	defer stop()
+	if *budget != "" {
+		entries, err := loadCatalog(ctx, store)
+		if err != nil {
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+			return exitCode(err)
+		}
+		// Vaults from before the catalog fall back to the files present
+		if history := catalogFor(entries, *budget); len(history) > 0 {
+			if err := printCatalog(stdout, history); err != nil {
+				fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+				return 1
+			}
+			return 0
+		}
+	}
+	snaps, err := listSnapshots(ctx, store)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return exitCode(err)
+	}
+	if *budget != "" {
+		snaps = slices.DeleteFunc(snaps, func(s snapshotInfo) bool {
+			return s.ID != *budget && s.Name != ynabvault.SanitizeFileName(*budget)
+		})
+	}
+	if len(snaps) == 0 {
+		fmt.Fprintln(stderr, l.T(msgNoSnapshots, dir))
+		return 0
+	}
+	runs, err := loadRuns(ctx, store)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return exitCode(err)
+	}
+	writers := snapshotRuns(runs)
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "BUDGET\tID\tMODIFIED\tFILE\tHOST\tMESSAGE")
+	for _, s := range snaps {
+		w := writers[s.File]
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", s.Name, s.ID, s.Time.Format("2006-01-02 15:04:05"), s.File,
+			cmp.Or(w.Client.Host, "-"), w.Message)
+	}
+	if err := tw.Flush(); err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 1
+	}
+	return 0
+}
+
+// cmdRuns implements "ynabvault runs"
+func cmdRuns(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("runs", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var common commonFlags
+	common.register(fs)
+	var conf configFlags
+	conf.register(fs)
+	output := fs.String("output", "budgets", "Directory, s3://bucket/prefix or sftp://user@host/path holding budget JSON files")
+	apiUsage := fs.Bool("api-usage", false, "Break down API requests per endpoint for each run")
+	if ok, code := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	l := newLocalizer(common.lang)
+	store, dir, err := conf.store(fs, *output, common.network)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 2
+	}
+
+	ctx, stop := common.context()
+	defer stop()
+	runs, err := loadRuns(ctx, store)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return exitCode(err)
+	}
+	if len(runs) == 0 {
+		fmt.Fprintln(stderr, l.T(msgNoRuns, dir))
+		return 0
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	if *apiUsage {
+		printAPIUsage(tw, runs)
+	} else {
+		fmt.Fprintln(tw, "STARTED\tDURATION\tCOMMAND\tCLIENT\tBUDGETS\tSKIPPED\tREQUESTS\tSTATUS\tMESSAGE")
+		for _, r := range runs {
+			status := "ok"
+			if r.Error != "" {
+				status = "failed: " + r.Error
+			}
+			msg := r.Message
+			if !r.isBackup() {
+				msg = fmt.Sprintf("removed %d files", len(r.Pruned))
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\t%d\t%s\t%s\n", r.Started.Format("2006-01-02 15:04:05"),
+				r.Finished.Sub(r.Started).Round(time.Second), cmp.Or(r.Command, "backup"), r.Client,
+				r.Budgets, r.Skipped, r.totalRequests(), status, msg)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 1
+	}
+	return 0
+}
+
+// printAPIUsage writes per-run, per-endpoint request counts followed by totals
+func printAPIUsage(w io.Writer, runs []runRecord) {
+	totals := map[string]int{}
+	fmt.Fprintln(w, "STARTED\tENDPOINT\tREQUESTS")
+	for _, r := range runs {
+		for _, ep := range sortedKeys(r.APIRequests) {
+			fmt.Fprintf(w, "%s\t%s\t%d\n", r.Started.Format("2006-01-02 15:04:05"), ep, r.APIRequests[ep])
+			totals[ep] += r.APIRequests[ep]
+		}
+	}
+	for _, ep := range sortedKeys(totals) {
+		fmt.Fprintf(w, "TOTAL\t%s\t%d\n", ep, totals[ep])
+	}
+}
+
+// sortedKeys returns the map's keys in sorted order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// cmdAdvise implements "ynabvault advise"
+func cmdAdvise(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("advise", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var common commonFlags
+	common.register(fs)
+	var conf configFlags
+	conf.register(fs)
+	output := fs.String("output", "budgets", "Directory, s3://bucket/prefix or sftp://user@host/path holding budget JSON files")
+	budget := fs.String("budget", "", "Only advise on the budget with this name or ID")
+	if ok, code := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	l := newLocalizer(common.lang)
+	store, dir, err := conf.store(fs, *output, common.network)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 2
+	}
+
+	ctx, stop := common.context()
+	defer stop()
+	snaps, err := listSnapshots(ctx, store)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return exitCode(err)
+	}
+	if *budget != "" {
+		snaps = slices.DeleteFunc(snaps, func(s snapshotInfo) bool {
+			return s.ID != *budget && s.Name != ynabvault.SanitizeFileName(*budget)
+		})
+		if len(snaps) == 0 {
+			err := fmt.Errorf("%w: no snapshots of budget %q", ynabvault.ErrNotFound, *budget)
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+			return exitCode(err)
+		}
+	}
+	if len(snaps) == 0 {
+		fmt.Fprintln(stderr, l.T(msgNoSnapshots, dir))
+		return 0
+	}
+	runs, err := loadRuns(ctx, store)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return exitCode(err)
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	printAdvice(tw, adviseCadence(snaps), requestsPerBudget(runs))
+	if err := tw.Flush(); err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 1
+	}
+	return 0
+}
+
+// cmdDecrypt implements "ynabvault decrypt"
+func cmdDecrypt(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("decrypt", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var common commonFlags
+	common.register(fs)
+	identity := fs.String("identity", "", "age identity file holding the private key")
+	toStdout := fs.Bool("stdout", false, "Write the decrypted JSON to stdout instead of next to each file")
+	if ok, code := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	l := newLocalizer(common.lang)
+	if !*toStdout && common.refuseWrite(stderr, l, msgReadOnlyDecrypt) {
+		return 2
+	}
+	if *identity == "" || fs.NArg() == 0 {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), "usage: ynabvault decrypt --identity KEYFILE FILE.age...")
+		return 2
+	}
+	ids, err := ynabvault.LoadIdentities(*identity)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 2
+	}
+	logger, closeLog := common.logger(stderr)
+	defer closeLog()
+	code := 0
+	for _, path := range fs.Args() {
+		out, err := decryptFile(path, ids, *toStdout, stdout)
+		if err != nil {
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+			code = cmp.Or(code, exitCode(err))
+			continue
+		}
+		if out != "" {
+			logger.Info("decrypted file", "file", path, "output", out)
+		}
+	}
+	return code
+}
+
+// decryptFile decrypts one .age file, either to stdout or next to the
+// original without the suffix, and returns the path written
+func decryptFile(path string, ids []age.Identity, toStdout bool, stdout io.Writer) (string, error) {
+	out, ok := strings.CutSuffix(path, ynabvault.AgeSuffix)
+	if !ok {
+		return "", fmt.Errorf("%s: not an %s file", path, ynabvault.AgeSuffix)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read %s: %w: %w", path, ynabvault.ErrBackend, err)
+	}
+	plain, err := ynabvault.Decrypt(data, ids)
+	if err != nil {
+		return "", fmt.Errorf("decrypt %s: %w", path, err)
+	}
+	if toStdout {
+		_, err := stdout.Write(plain)
+		return "", err
+	}
+	if err := ynabvault.WriteFile(out, plain); err != nil {
+		return "", fmt.Errorf("write %s: %w: %w", out, ynabvault.ErrBackend, err)
+	}
+	return out, nil
+}
+
+// cmdDrTest implements "ynabvault dr-test"
+func cmdDrTest(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("dr-test", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var common commonFlags
+	common.register(fs)
+	var conf configFlags
+	conf.register(fs)
+	output := fs.String("output", "budgets", "Directory, s3://bucket/prefix or sftp://user@host/path holding budget JSON files")
+	identity := fs.String("identity", "", "age identity file for encrypted snapshots")
+	if ok, code := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	l := newLocalizer(common.lang)
+	store, dir, err := conf.store(fs, *output, common.network)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 2
+	}
+	var ids []age.Identity
+	if *identity != "" {
+		if ids, err = ynabvault.LoadIdentities(*identity); err != nil {
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+			return 2
+		}
+	}
+
+	ctx, stop := common.context()
+	defer stop()
+	snaps, err := listSnapshots(ctx, store)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return exitCode(err)
+	}
+	if len(snaps) == 0 {
+		fmt.Fprintln(stderr, l.T(msgNoSnapshots, dir))
+		return exitCorrupt
+	}
+
+	m, err := ynabvault.LoadManifest(ctx, store)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return exitCode(err)
+	}
+
+	scratch, err := os.MkdirTemp("", "ynabvault-dr-test-*")
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return exitBackend
+	}
+	defer os.RemoveAll(scratch)
+
+	snap := snaps[rand.N(len(snaps))]
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	passed := printRehearsal(tw, snap, drRehearse(ctx, store, snap, ids, m, scratch))
+	if err := tw.Flush(); err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 1
+	}
+	if !passed {
+		return exitCorrupt
+	}
+	return 0
+}
+
+// cmdVerify implements "ynabvault verify"
+func cmdVerify(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var common commonFlags
+	common.register(fs)
+	var conf configFlags
+	conf.register(fs)
+	output := fs.String("output", "budgets", "Directory, s3://bucket/prefix or sftp://user@host/path holding budget JSON files")
+	identity := fs.String("identity", "", "age identity file for encrypted snapshots")
+	concurrency := fs.Int("concurrency", runtime.NumCPU(), "Number of snapshots to verify in parallel")
+	sample := fs.String("sample", "", "Verify only a random percentage of snapshots, e.g. 10%")
+	newest := fs.String("newest", "", "Verify only snapshots modified within this long, e.g. 30d or 12h")
+	deep := fs.Bool("deep", false, "Also check sub-resources and compare contents with the hashes pinned at backup time")
+	if ok, code := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	l := newLocalizer(common.lang)
+	fraction, err := parseSample(*sample)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 2
+	}
+	window, err := parseAge(*newest)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), "--newest:", err)
+		return 2
+	}
+	if *concurrency < 1 {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), "--concurrency must be at least 1")
+		return 2
+	}
+	store, dir, err := conf.store(fs, *output, common.network)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 2
+	}
+	var ids []age.Identity
+	if *identity != "" {
+		if ids, err = ynabvault.LoadIdentities(*identity); err != nil {
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+			return 2
+		}
+	}
+
+	ctx, stop := common.context()
+	defer stop()
+	snaps, unknown, err := scanSnapshots(ctx, store)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return exitCode(err)
+	}
+	for _, name := range unknown {
+		fmt.Fprintf(stdout, "UNKNOWN\t%s\n", name)
+	}
+	if len(snaps) == 0 {
+		fmt.Fprintln(stderr, l.T(msgNoSnapshots, dir))
+		return 0
+	}
+
+	var m *ynabvault.Manifest
+	if *deep {
+		if m, err = ynabvault.LoadManifest(ctx, store); err != nil {
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+			return exitCode(err)
+		}
+	}
+
+	selected := selectSnapshots(snaps, time.Now(), window, fraction)
+	failed, unpinned := 0, 0
+	for _, r := range verifySnapshots(ctx, store, selected, ids, m, *concurrency) {
+		unpinned += r.Unpinned
+		if r.Err != nil {
+			failed++
+			fmt.Fprintf(stdout, "FAIL\t%s: %v\n", r.Snap.File, r.Err)
+		}
+	}
+	// Every pinned file must still exist, whichever snapshots were selected
+	var missing []string
+	if m != nil {
+		names, err := store.List(ctx, "")
+		if err != nil {
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+			return exitBackend
+		}
+		missing = m.Missing(names)
+		for _, name := range missing {
+			fmt.Fprintf(stdout, "MISSING\t%s\n", name)
+		}
+	}
+	fmt.Fprintf(stdout, "Verified %d of %d snapshots, %d failed\n", len(selected), len(snaps), failed)
+	if len(missing) > 0 {
+		fmt.Fprintf(stdout, "%d pinned files are missing from the vault\n", len(missing))
+	}
+	if unpinned > 0 {
+		fmt.Fprintf(stdout, "%d files have no pinned hash; they were saved before hashes were recorded\n", unpinned)
+	}
+	if len(unknown) > 0 {
+		fmt.Fprintf(stdout, "%d files were not verified; neither their names nor the catalog say which budget they hold\n", len(unknown))
+	}
+	if failed > 0 || len(missing) > 0 {
+		return exitCorrupt
+	}
+	return 0
+}
+
+// cmdPrune implements "ynabvault prune"
+func cmdPrune(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("prune", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var common commonFlags
+	common.register(fs)
+	var conf configFlags
+	conf.register(fs)
+	output := fs.String("output", "budgets", "Directory, s3://bucket/prefix or sftp://user@host/path holding budget JSON files")
+	var keep retention
+	keep.register(fs)
+	dryRun := fs.Bool("dry-run", false, "Show what would be deleted without deleting anything")
+	var lockOpts lockFlags
+	lockOpts.register(fs)
+	if ok, code := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	l := newLocalizer(common.lang)
+	if !*dryRun && common.refuseWrite(stderr, l, msgReadOnlyDryRun, "prune") {
+		return 2
+	}
+	store, dir, err := conf.store(fs, *output, common.network)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 2
+	}
+
+	ctx, stop := common.context()
+	defer stop()
+	logger, closeLog := common.logger(stderr)
+	defer closeLog()
+	if !keep.enabled() {
+		vault, err := loadVaultSettings(ctx, store)
+		if err != nil {
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+			return exitCode(err)
+		}
+		keep = vault.retention()
+	}
+	if !keep.enabled() {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), "prune needs at least one of --keep-daily, --keep-weekly or --keep-monthly, or keep_* in "+vaultSettingsFile)
+		return 2
+	}
+	if !*dryRun {
+		if lockOpts.ttl <= 0 {
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), "--lock-ttl must be positive")
+			return 2
+		}
+		if err := checkNotFrozen(ctx, store); err != nil {
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+			return exitCode(err)
+		}
+		lock, err := acquireLock(ctx, store, "prune", lockOpts, logger)
+		if err != nil {
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+			return exitCode(err)
+		}
+		defer lock.release(context.WithoutCancel(ctx))
+	}
+
+	snaps, unknown, err := scanSnapshots(ctx, store)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return exitCode(err)
+	}
+	// Retention cannot place these files, so they are never deleted
+	for _, name := range unknown {
+		logger.Warn("not a recognized snapshot, left alone", "file", name)
+	}
+	if len(snaps) == 0 {
+		fmt.Fprintln(stderr, l.T(msgNoSnapshots, dir))
+		return 0
+	}
+
+	kept := keep.keep(snaps)
+	started := time.Now()
+	removed, err := pruneSnapshots(ctx, store, snaps, kept, *dryRun)
+	if !*dryRun && (len(removed) > 0 || err != nil) {
+		if herr := appendPrune(context.WithoutCancel(ctx), store, started, removed, err); herr != nil {
+			logger.Warn("run history not updated", "error", herr)
+		}
+	}
+	verb := "removed"
+	if *dryRun {
+		verb = "would remove"
+	}
+	for _, name := range removed {
+		fmt.Fprintf(stdout, "%s %s\n", verb, name)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return exitCode(err)
+	}
+	fmt.Fprintf(stdout, "Kept %d of %d snapshots, %s %d files\n", len(kept), len(snaps), verb, len(removed))
+	return 0
+}
+
+// cmdCost implements "ynabvault cost"
+func cmdCost(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("cost", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var common commonFlags
+	common.register(fs)
+	var conf configFlags
+	conf.register(fs)
+	output := fs.String("output", "budgets", "Directory, s3://bucket/prefix or sftp://user@host/path holding budget JSON files")
+	pricesFile := fs.String("prices", "", "YAML file adding or replacing backend prices")
+	if ok, code := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	l := newLocalizer(common.lang)
+	prices, err := loadPrices(*pricesFile)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 2
+	}
+	store, _, err := conf.store(fs, *output, common.network)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 2
+	}
+
+	ctx, stop := common.context()
+	defer stop()
+	sizes, err := storeSizes(ctx, store)
+	if err != nil {
+		err = fmt.Errorf("size vault: %w: %w", ynabvault.ErrBackend, err)
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return exitCode(err)
+	}
+	runs, err := loadRuns(ctx, store)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return exitCode(err)
+	}
+
+	usage := measureUsage(sizes, runs, time.Now())
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	printCosts(tw, usage, estimateCosts(usage, prices))
+	if err := tw.Flush(); err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 1
+	}
+	return 0
+}
+
+// cmdDiff implements "ynabvault diff"
+func cmdDiff(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var common commonFlags
+	common.register(fs)
+	var conf configFlags
+	conf.register(fs)
+	output := fs.String("output", "budgets", "Directory, s3://bucket/prefix or sftp://user@host/path holding budget JSON files")
+	identity := fs.String("identity", "", "age identity file for encrypted snapshots")
+	budget := fs.String("budget", "", "Compare snapshots of this budget (name or ID) instead of two named files")
+	last := fs.Int("last", 2, "With --budget, compare the Nth newest snapshot with the newest")
+	asJSON := fs.Bool("json", false, "Print the changes as JSON")
+	if ok, code := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	l := newLocalizer(common.lang)
+	if (*budget == "") == (fs.NArg() != 2) || *last < 2 {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), "usage: ynabvault diff [flags] OLD.json NEW.json, or ynabvault diff --budget NAME [--last N] with N >= 2")
+		return 2
+	}
+	store, _, err := conf.store(fs, *output, common.network)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 2
+	}
+	var ids []age.Identity
+	if *identity != "" {
+		if ids, err = ynabvault.LoadIdentities(*identity); err != nil {
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+			return 2
+		}
+	}
+
+	ctx, stop := common.context()
+	defer stop()
+	oldName, newName := fs.Arg(0), fs.Arg(1)
+	if *budget != "" {
+		snaps, err := listSnapshots(ctx, store)
+		if err != nil {
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+			return exitCode(err)
+		}
+		older, newer, err := pickDiffSnapshots(snaps, *budget, *last)
+		if err != nil {
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+			return exitCode(err)
+		}
+		oldName, newName = older.File, newer.File
+	}
+	oldBudget, err := loadSnapshotBudget(ctx, store, oldName, ids)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return exitCode(err)
+	}
+	newBudget, err := loadSnapshotBudget(ctx, store, newName, ids)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return exitCode(err)
+	}
+
+	changes := diffBudgets(oldBudget, newBudget)
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if changes == nil {
+			changes = []entityChange{}
+		}
+		err = enc.Encode(struct {
+			Old     string         `json:"old"`
+			New     string         `json:"new"`
+			Changes []entityChange `json:"changes"`
+		}{oldName, newName, changes})
+	} else {
+		tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+		printDiff(tw, oldName, newName, changes)
+		err = tw.Flush()
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 1
+	}
+	return 0
+}
+
+// cmdSync implements "ynabvault sync"
+func cmdSync(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("sync", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var common commonFlags
+	common.register(fs)
+	var conf configFlags
+	conf.register(fs)
+	output := fs.String("output", "budgets", "Directory, s3://bucket/prefix or sftp://user@host/path holding budget JSON files")
+	to := fs.String("to", "", "Destination directory, s3://bucket/prefix or sftp://user@host/path to compare with")
+	repair := fs.Bool("repair", false, "Copy the files missing from the destination and replace those that differ")
+	bwlimit := fs.String("bwlimit", "", "Limit repair bandwidth, e.g. 512K or 2M bytes per second")
+	var lockOpts lockFlags
+	lockOpts.register(fs)
+	if ok, code := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	l := newLocalizer(common.lang)
+	if *repair && common.refuseWrite(stderr, l, msgReadOnly, "sync --repair") {
+		return 2
+	}
+	rate, err := parseByteRate(*bwlimit)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), "--bwlimit:", err)
+		return 2
+	}
+	if *repair && lockOpts.ttl <= 0 {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), "--lock-ttl must be positive")
+		return 2
+	}
+	if *to == "" {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), l.T(msgSyncNeedsTo))
+		return 2
+	}
+	src, _, err := conf.store(fs, *output, common.network)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 2
+	}
+	p, _ := conf.settings() // already loaded without error by conf.store
+	storeOpts, err := p.Proxy.storeOptions()
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 2
+	}
+	storeOpts.Network = common.network
+	dst, err := ynabvault.OpenStoreWith(*to, storeOpts)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 2
+	}
+
+	// An interrupted repair keeps what it copied; the next run resumes
+	ctx, stop := common.context()
+	defer stop()
+	logger, closeLog := common.logger(stderr)
+	defer closeLog()
+	// The repair writes snapshots and the destination's manifest and
+	// catalog, so it holds the destination's lock like a backup
+	if *repair {
+		if err := checkNotFrozen(ctx, dst); err != nil {
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+			return exitCode(err)
+		}
+		lock, err := acquireLock(ctx, dst, "sync", lockOpts, logger)
+		if err != nil {
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+			return exitCode(err)
+		}
+		defer lock.release(context.WithoutCancel(ctx))
+	}
+	missing, differ, err := compareStores(ctx, src, dst)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return exitCode(err)
+	}
+	if !*repair {
+		for _, name := range missing {
+			fmt.Fprintln(stdout, l.T(msgSyncMissing, name))
+		}
+		for _, name := range differ {
+			fmt.Fprintln(stdout, l.T(msgSyncDiffers, name))
+		}
+		fmt.Fprintln(stdout, l.T(msgSyncSummary, len(missing), *to, len(differ)))
+		return 0
+	}
+	logger.Info("repairing destination", "destination", *to, "missing", len(missing), "differ", len(differ))
+	names := append(missing, differ...)
+	copied, bytes, err := repairFiles(ctx, src, dst, names, newThrottle(rate))
+	fmt.Fprintln(stdout, l.T(msgSyncCopied, copied, len(names), bytes, *to))
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return exitCode(err)
+	}
+	pinned, err := mergeIndexes(ctx, src, dst)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return exitCode(err)
+	}
+	if pinned > 0 {
+		fmt.Fprintln(stdout, l.T(msgSyncPinned, pinned, *to))
+	}
+	return 0
+}
+
+// cmdRestore implements "ynabvault restore"
+func cmdRestore(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var common commonFlags
+	common.register(fs)
+	var conf configFlags
+	conf.register(fs)
+	output := fs.String("output", "budgets", "Directory, s3://bucket/prefix or sftp://user@host/path holding budget JSON files")
+	identity := fs.String("identity", "", "age identity file for encrypted snapshots")
+	token := fs.String("token", "", "YNAB API bearer token (or set YNAB_BEARER_TOKEN env var)")
+	var tokenFrom tokenFlags
+	tokenFrom.register(fs)
+	var api apiFlags
+	api.register(fs)
+	target := fs.String("to", "", "ID of the YNAB budget to restore into")
+	var opts restoreOptions
+	fs.BoolVar(&opts.TransactionsOnly, "transactions-only", false, "Only import transactions into accounts that already exist, by name")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "Show what would be restored without writing to YNAB")
+	if ok, code := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	l := newLocalizer(common.lang)
+	if !opts.DryRun && common.refuseWrite(stderr, l, msgReadOnlyDryRun, "restore") {
+		return 2
+	}
+	// Even a dry run reads the target budget
+	if common.refuseOnline(stderr, l, "restore") {
+		return 2
+	}
+	if *target == "" || fs.NArg() != 1 {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), "usage: ynabvault restore --to BUDGET_ID [flags] SNAPSHOT.json")
+		return 2
+	}
+	apiURL, err := api.budgetsURL()
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 2
+	}
+	tok := *token
+	var gateway []gatewayAuth
+	var proxies proxyConfig
+	if file, err := conf.load(); err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 2
+	} else if file != nil {
+		p, err := file.profile(conf.profile)
+		if err == nil && tok == "" && !flagSet(fs, "token-source") {
+			tok, err = p.token()
+		}
+		if err == nil {
+			err = checkGatewayAuth(p.GatewayAuth)
+		}
+		if err == nil {
+			err = p.Proxy.check()
+		}
+		if err != nil {
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+			return 2
+		}
+		gateway, proxies = p.GatewayAuth, p.Proxy
+	}
+	ctx, stop := common.context()
+	defer stop()
+	tok, err = tokenFrom.resolve(ctx, tok)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 1
+	}
+	if tok == "" {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), l.T(msgTokenRequired))
+		return 1
+	}
+	store, _, err := conf.store(fs, *output, common.network)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 2
+	}
+	var ids []age.Identity
+	if *identity != "" {
+		if ids, err = ynabvault.LoadIdentities(*identity); err != nil {
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+			return 2
+		}
+	}
+
+	budget, err := loadSnapshotBudget(ctx, store, fs.Arg(0), ids)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return exitCode(err)
+	}
+	logger, closeLog := common.logger(stderr)
+	defer closeLog()
+	network := common.transport(proxyTransport("api", proxies.API))
+	if len(gateway) > 0 {
+		network = newGatewayTransport(network, gateway)
+	}
+	res, err := restoreBudget(ctx, newYNABWriter(network, logger, apiURL, tok, *target), budget, opts)
+	verb := "created"
+	if opts.DryRun {
+		verb = "to create"
+	}
+	fmt.Fprintf(stdout, "Accounts: %d matched, %d %s, %d skipped\n", res.AccountsMatched, res.AccountsCreated, verb, res.AccountsSkipped)
+	if opts.DryRun {
+		fmt.Fprintf(stdout, "Transactions: %d to import, %d skipped\n", res.Imported, res.Skipped)
+	} else {
+		fmt.Fprintf(stdout, "Transactions: %d imported, %d already present, %d skipped\n", res.Imported, res.Duplicates, res.Skipped)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return exitCode(err)
+	}
+	return 0
+}
+
+// cmdExport implements "ynabvault export"
+func cmdExport(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var common commonFlags
+	common.register(fs)
+	var conf configFlags
+	conf.register(fs)
+	output := fs.String("output", "budgets", "Directory, s3://bucket/prefix or sftp://user@host/path holding budget JSON files")
+	identity := fs.String("identity", "", "age identity file for encrypted snapshots")
+	format := fs.String("format", "sqlite", "Export format: sqlite, csv for one transactions file per snapshot, beancount or ledger for one ledger per snapshot, qif or ofx for one file per account, sankey or sankey-csv for monthly flows, hugo-data for static site data files, or pyproject for a pandas package")
+	dataFormat := fs.String("data-format", "json", "File type of hugo-data files: json or yaml")
+	out := fs.String("out", "", "Database file to write, or the directory for the files of other formats")
+	budget := fs.String("budget", "", "Only export snapshots of this budget (name or ID)")
+	all := fs.Bool("all", false, "Export every snapshot instead of the newest per budget")
+	if ok, code := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	l := newLocalizer(common.lang)
+	if *out == "" || (fs.NArg() > 0 && (*budget != "" || *all)) {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), "usage: ynabvault export --out PATH [--budget NAME] [--all] [SNAPSHOT.json...]")
+		return 2
+	}
+	if !slices.Contains([]string{"sqlite", "csv", "beancount", "ledger", "qif", "ofx", "sankey", "sankey-csv", "hugo-data", "pyproject"}, *format) {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), fmt.Sprintf("unknown export format %q; want sqlite, csv, beancount, ledger, qif, ofx, sankey, sankey-csv, hugo-data or pyproject", *format))
+		return 2
+	}
+	if *dataFormat != "json" && *dataFormat != "yaml" {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), fmt.Sprintf("unknown --data-format %q; want json or yaml", *dataFormat))
+		return 2
+	}
+	if *format != "hugo-data" && flagSet(fs, "data-format") {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), "--data-format only applies to --format hugo-data")
+		return 2
+	}
+	if *format == "hugo-data" && *all {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), "--format hugo-data writes the newest snapshot of each budget and cannot be combined with --all")
+		return 2
+	}
+	store, _, err := conf.store(fs, *output, common.network)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 2
+	}
+	settings, err := conf.settings()
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 2
+	}
+	rollup, err := newRollups(settings.Rollups)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 2
+	}
+	ledger, err := newLedgerAccounts(settings.LedgerAccounts)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 2
+	}
+	var ids []age.Identity
+	if *identity != "" {
+		if ids, err = ynabvault.LoadIdentities(*identity); err != nil {
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+			return 2
+		}
+	}
+
+	ctx, stop := common.context()
+	defer stop()
+	names := fs.Args()
+	if len(names) == 0 {
+		snaps, err := listSnapshots(ctx, store)
+		if err != nil {
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+			return exitCode(err)
+		}
+		for _, s := range selectExportSnapshots(snaps, *budget, *all) {
+			names = append(names, s.File)
+		}
+		if len(names) == 0 {
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), "no snapshots to export")
+			return 1
+		}
+	}
+	snaps, err := loadExportSnapshots(ctx, store, names, ids)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return exitCode(err)
+	}
+	files := map[string]func() ([]string, error){
+		"csv":        func() ([]string, error) { return exportCSV(*out, snaps, rollup) },
+		"beancount":  func() ([]string, error) { return exportBeancount(*out, snaps, rollup) },
+		"ledger":     func() ([]string, error) { return exportLedger(*out, snaps, rollup, ledger) },
+		"qif":        func() ([]string, error) { return exportQIF(*out, snaps, rollup) },
+		"ofx":        func() ([]string, error) { return exportOFX(*out, snaps) },
+		"sankey":     func() ([]string, error) { return exportSankey(*out, snaps, rollup) },
+		"sankey-csv": func() ([]string, error) { return exportSankeyCSV(*out, snaps, rollup) },
+		"hugo-data":  func() ([]string, error) { return exportHugoData(*out, snaps, rollup, *dataFormat) },
+		"pyproject":  func() ([]string, error) { return exportPyProject(*out, snaps, rollup) },
+	}
+	if export := files[*format]; export != nil {
+		written, err := export()
+		for _, name := range written {
+			fmt.Fprintln(stdout, filepath.Join(*out, name))
+		}
+		if err != nil {
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+			return 1
+		}
+		return 0
+	}
+	n, err := exportSQLite(ctx, *out, snaps, rollup)
+	fmt.Fprintf(stdout, "Exported %d of %d snapshots to %s\n", n, len(snaps), *out)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 1
+	}
+	return 0
+}
+
+// cmdAuth implements "ynabvault auth set", "auth login" and "auth delete"
+func cmdAuth(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || !slices.Contains([]string{"set", "login", "delete"}, args[0]) {
+		fmt.Fprintln(stderr, newLocalizer("").T(msgErrorPrefix), "usage: ynabvault auth set|login|delete [--keyring-account NAME]")
+		return 2
+	}
+	action := args[0]
+	fs := flag.NewFlagSet("auth "+action, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var common commonFlags
+	common.register(fs)
+	account := fs.String("keyring-account", defaultKeyringAccount, "OS keyring entry for the token")
+	var creds oauthCredentials
+	if action == "login" {
+		fs.StringVar(&creds.ClientID, "client-id", "", "Client ID of your YNAB OAuth application")
+		fs.StringVar(&creds.ClientSecret, "client-secret", "", "Client secret of the OAuth application (or set YNAB_CLIENT_SECRET)")
+		fs.StringVar(&creds.RedirectURI, "redirect-uri", "http://localhost:8765/callback", "Redirect URI registered for the application; ynabvault listens on it")
+	}
+	if ok, code := parseFlags(fs, args[1:]); !ok {
+		return code
+	}
+
+	l := newLocalizer(common.lang)
+	if action == "login" {
+		if common.refuseOnline(stderr, l, "auth login") {
+			return 2
+		}
+		creds.ClientSecret = cmp.Or(creds.ClientSecret, os.Getenv("YNAB_CLIENT_SECRET"))
+		if creds.ClientID == "" || creds.ClientSecret == "" {
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), "auth login needs --client-id and --client-secret (or YNAB_CLIENT_SECRET)")
+			return 2
+		}
+		// Without --timeout the user gets a few minutes to approve
+		if common.timeout <= 0 {
+			common.timeout = 5 * time.Minute
+		}
+		ctx, stop := common.context()
+		defer stop()
+		tok, err := oauthLogin(ctx, creds, stderr)
+		if err == nil {
+			creds.Token = tok
+			err = saveOAuth(*account, creds)
+		}
+		if err != nil {
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+			return exitCode(err)
+		}
+		fmt.Fprintf(stdout, "Logged in; use --token-source oauth --keyring-account %s\n", *account)
+		return 0
+	}
+	if action == "delete" {
+		if err := deleteKeyringToken(*account); err != nil {
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+			return 1
+		}
+		fmt.Fprintf(stdout, "Removed the token for %q from the OS keyring\n", *account)
+		return 0
+	}
+	// The token is read from stdin so it never appears in shell history
+	tok, err := readToken(stdin, stderr)
+	if err == nil && tok == "" {
+		err = errors.New("no token given on stdin")
+	}
+	if err == nil {
+		err = setKeyringToken(*account, tok)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "Stored the token for %q in the OS keyring\n", *account)
+	return 0
+}
+
+// cmdFreeze implements "ynabvault freeze"
+func cmdFreeze(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("freeze", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var common commonFlags
+	common.register(fs)
+	var conf configFlags
+	conf.register(fs)
+	output := fs.String("output", "budgets", "Directory, s3://bucket/prefix or sftp://user@host/path holding budget JSON files")
+	reason := fs.String("reason", "", "Why the vault is frozen, shown to commands that refuse to run")
+	if ok, code := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	l := newLocalizer(common.lang)
+	if common.refuseWrite(stderr, l, msgReadOnly, "freeze") {
+		return 2
+	}
+	store, dir, err := conf.store(fs, *output, common.network)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 2
+	}
+
+	ctx, stop := common.context()
+	defer stop()
+	frozen, err := loadFreeze(ctx, store)
+	if err == nil && frozen != nil {
+		fmt.Fprintln(stdout, l.T(msgAlreadyFrozen, dir, frozen.describe(l)))
+		return 0
+	}
+	if err == nil {
+		err = freezeVault(ctx, store, *reason)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return exitCode(err)
+	}
+	fmt.Fprintln(stdout, l.T(msgFroze, dir))
+	return 0
+}
+
+// cmdUnfreeze implements "ynabvault unfreeze"
+func cmdUnfreeze(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("unfreeze", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var common commonFlags
+	common.register(fs)
+	var conf configFlags
+	conf.register(fs)
+	output := fs.String("output", "budgets", "Directory, s3://bucket/prefix or sftp://user@host/path holding budget JSON files")
+	yes := fs.Bool("yes", false, "Confirm lifting the freeze")
+	if ok, code := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	l := newLocalizer(common.lang)
+	if common.refuseWrite(stderr, l, msgReadOnly, "unfreeze") {
+		return 2
+	}
+	store, dir, err := conf.store(fs, *output, common.network)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 2
+	}
+
+	ctx, stop := common.context()
+	defer stop()
+	frozen, err := loadFreeze(ctx, store)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return exitCode(err)
+	}
+	if frozen == nil {
+		fmt.Fprintln(stdout, l.T(msgNotFrozen, dir))
+		return 0
+	}
+	if !*yes {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), l.T(msgUnfreezeUnconfirmed, dir, frozen.describe(l)))
+		return 2
+	}
+	if err := unfreezeVault(ctx, store); err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return exitCode(err)
+	}
+	fmt.Fprintln(stdout, l.T(msgUnfroze, dir))
+	return 0
+}
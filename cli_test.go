@@ -0,0 +1,674 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"github.com/bad33ndj3/ynabvault/internal/s3test"
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// TestRunCLIDispatch covers help, unknown commands and flag errors
+func TestRunCLIDispatch(t *testing.T) {
+	t.Setenv("LANG", "")
+	t.Setenv("LC_ALL", "")
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+		wantOut  string
+		wantErr  string
+	}{
+		{"help", []string{"help"}, 0, "Commands:", ""},
+		{"unknown", []string{"frobnicate"}, 2, "", `unknown command "frobnicate"`},
+		{"bad flag", []string{"list", "--nope"}, 2, "", "flag provided but not defined"},
+		{"flag help", []string{"backup", "-h"}, 0, "", "-resources"},
+		{"bad log level", []string{"list", "--log-level", "loud"}, 2, "", "invalid value"},
+		{"bad log format", []string{"list", "--log-format", "xml"}, 2, "", "want text or json"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := runCLI(tc.args, &stdout, &stderr); code != tc.wantCode {
+				t.Errorf("exit code = %d; want %d (stderr: %s)", code, tc.wantCode, stderr.String())
+			}
+			if !strings.Contains(stdout.String(), tc.wantOut) {
+				t.Errorf("stdout %q does not contain %q", stdout.String(), tc.wantOut)
+			}
+			if !strings.Contains(stderr.String(), tc.wantErr) {
+				t.Errorf("stderr %q does not contain %q", stderr.String(), tc.wantErr)
+			}
+		})
+	}
+}
+
+// TestRunCLIBackup runs the default command with and without the backup name
+func TestRunCLIBackup(t *testing.T) {
+	t.Setenv("YNAB_BEARER_TOKEN", "")
+	var stderr bytes.Buffer
+	if code := runCLI([]string{"--output", t.TempDir()}, io.Discard, &stderr); code != 1 {
+		t.Errorf("missing token exit code = %d; want 1", code)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			_, _ = io.WriteString(w, `{"data":{"budgets":[{"id":"b1","name":"Budget","last_modified_on":"2025-01-01T00:00:00Z"}]}}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"data":{"budget":{"id":"b1"}}}`)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	t.Setenv("YNAB_BEARER_TOKEN", "tok")
+	for _, args := range [][]string{
+		{"--url", srv.URL, "--output", dir},
+		{"backup", "--url", srv.URL, "--output", dir},
+	} {
+		if code := runCLI(args, io.Discard, &stderr); code != 0 {
+			t.Fatalf("runCLI(%v) = %d; stderr: %s", args, code, stderr.String())
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Budget_b1_20250101T000000Z.json")); err != nil {
+		t.Errorf("snapshot not written: %v", err)
+	}
+
+	// JSON logs are one object per line with a level and message
+	stderr.Reset()
+	args := []string{"backup", "--url", srv.URL, "--output", dir, "--force", "--log-format", "json", "--log-level", "debug"}
+	if code := runCLI(args, io.Discard, &stderr); code != 0 {
+		t.Fatalf("runCLI(%v) = %d; stderr: %s", args, code, stderr.String())
+	}
+	levels := map[string]bool{}
+	for _, line := range strings.Split(strings.TrimSpace(stderr.String()), "\n") {
+		var rec struct {
+			Level string `json:"level"`
+			Msg   string `json:"msg"`
+		}
+		if err := json.Unmarshal([]byte(line), &rec); err != nil || rec.Msg == "" {
+			t.Fatalf("log line %q is not a JSON record: %v", line, err)
+		}
+		levels[rec.Level] = true
+	}
+	if !levels["DEBUG"] || !levels["INFO"] {
+		t.Errorf("debug logging produced levels %v; want DEBUG and INFO", levels)
+	}
+}
+
+// TestRunCLIList prints the stored snapshots
+func TestRunCLIList(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"My_Budget_b1_20250101T000000Z.json", ynabvault.StateFileName, "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var stdout bytes.Buffer
+	if code := runCLI([]string{"list", "--output", dir}, &stdout, io.Discard); code != 0 {
+		t.Fatalf("list exit code = %d", code)
+	}
+	out := stdout.String()
+	if !strings.Contains(out, "My_Budget") || !strings.Contains(out, "2025-01-01 00:00:00") {
+		t.Errorf("unexpected list output:\n%s", out)
+	}
+	if strings.Contains(out, "notes.txt") || strings.Contains(out, ynabvault.StateFileName) {
+		t.Errorf("list output includes non-snapshot files:\n%s", out)
+	}
+}
+
+// TestCommonTimeout cancels the command context once --timeout expires
+func TestCommonTimeout(t *testing.T) {
+	common := commonFlags{timeout: time.Millisecond}
+	ctx, stop := common.context()
+	defer stop()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("context not cancelled after --timeout")
+	}
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		t.Errorf("ctx.Err() = %v; want DeadlineExceeded", ctx.Err())
+	}
+
+	// Without a timeout only a signal or stop ends it
+	ctx, stop = (&commonFlags{}).context()
+	if ctx.Err() != nil {
+		t.Fatalf("ctx.Err() = %v before stop", ctx.Err())
+	}
+	stop()
+	if ctx.Err() == nil {
+		t.Error("ctx not cancelled by stop")
+	}
+}
+
+// TestIPVersion parses --ip-version and dials only the chosen IP version
+func TestIPVersion(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	port := srv.URL[strings.LastIndex(srv.URL, ":"):]
+
+	tests := []struct {
+		value   string
+		network string
+		wantErr bool
+		wantOK  bool // the IPv4-only test server answers
+	}{
+		{"4", "tcp4", false, true},
+		{"6", "tcp6", false, false},
+		{"auto", "", false, true},
+		{"5", "", true, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.value, func(t *testing.T) {
+			var common commonFlags
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			common.register(fs)
+			if err := fs.Parse([]string{"--ip-version", tc.value}); (err != nil) != tc.wantErr {
+				t.Fatalf("Parse error = %v; want error %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			if common.network != tc.network {
+				t.Errorf("network = %q; want %q", common.network, tc.network)
+			}
+			// 127.0.0.1 cannot be reached over tcp6
+			client := &http.Client{Transport: common.transport(http.DefaultTransport)}
+			req, _ := http.NewRequestWithContext(t.Context(), http.MethodGet, "http://127.0.0.1"+port, nil)
+			resp, err := client.Do(req)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err == nil) != tc.wantOK {
+				t.Errorf("request error = %v; want success %v", err, tc.wantOK)
+			}
+		})
+	}
+}
+
+// TestRunCLIBackupJSON prints a run report to stdout
+func TestRunCLIBackupJSON(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			_, _ = io.WriteString(w, `{"data":{"budgets":[{"id":"b1","name":"Budget"}]}}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"data":{"budget":{"id":"b1"}}}`)
+	}))
+	defer srv.Close()
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"backup", "--token", "tok", "--url", srv.URL, "--output", t.TempDir(), "--json"}
+	if code := runCLI(args, &stdout, &stderr); code != 0 {
+		t.Fatalf("runCLI(%v) = %d; stderr: %s", args, code, stderr.String())
+	}
+	var report runReportJSON
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatalf("stdout %q is not a JSON report: %v", stdout.String(), err)
+	}
+	if report.Downloaded != 1 || len(report.Results) != 1 || report.Results[0].Status != "downloaded" {
+		t.Errorf("report = %+v", report)
+	}
+}
+
+// TestReadOnly refuses commands that would write and lets inspection run
+func TestReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name     string
+		env      string
+		args     []string
+		wantCode int
+	}{
+		{"backup", "", []string{"backup", "--read-only", "--token", "tok", "--output", dir}, 2},
+		{"prune", "", []string{"prune", "--read-only", "--output", dir, "--keep-daily", "1"}, 2},
+		{"prune dry run", "", []string{"prune", "--read-only", "--output", dir, "--keep-daily", "1", "--dry-run"}, 0},
+		{"sync repair", "", []string{"sync", "--read-only", "--output", dir, "--to", t.TempDir(), "--repair"}, 2},
+		{"restore", "", []string{"restore", "--read-only", "--to", "b1", "snap.json"}, 2},
+		{"list", "", []string{"list", "--read-only", "--output", dir}, 0},
+		{"from env", "1", []string{"prune", "--output", dir, "--keep-daily", "1"}, 2},
+		{"env overridden", "true", []string{"list", "--read-only=false", "--output", dir}, 0},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(readOnlyEnv, tc.env)
+			var stderr bytes.Buffer
+			code := runCLI(tc.args, io.Discard, &stderr)
+			if code != tc.wantCode {
+				t.Fatalf("exit code = %d; want %d (stderr: %s)", code, tc.wantCode, stderr.String())
+			}
+			if refused := strings.Contains(stderr.String(), "--read-only"); refused != (tc.wantCode == 2) {
+				t.Errorf("stderr %q; want a --read-only refusal %v", stderr.String(), tc.wantCode == 2)
+			}
+		})
+	}
+	var stderr bytes.Buffer
+	runCLI([]string{"prune", "--read-only", "--lang", "de", "--output", dir, "--keep-daily", "1"}, io.Discard, &stderr)
+	if want := "Fehler: prune ist mit --read-only nicht erlaubt"; !strings.HasPrefix(stderr.String(), want) {
+		t.Errorf("German refusal %q; want it to start with %q", stderr.String(), want)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("read-only commands wrote to the vault: %v", entries)
+	}
+}
+
+// TestOffline refuses commands that need the YNAB API and runs vault commands
+func TestOffline(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("request to the API with --offline: %s", r.URL)
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+	tests := []struct {
+		name     string
+		env      string
+		args     []string
+		wantCode int
+	}{
+		{"backup", "", []string{"backup", "--offline", "--token", "tok", "--url", srv.URL, "--output", dir}, 2},
+		{"restore dry run", "", []string{"restore", "--offline", "--token", "tok", "--url", srv.URL, "--to", "b1", "--dry-run", "snap.json"}, 2},
+		{"auth login", "", []string{"auth", "login", "--offline", "--client-id", "id", "--client-secret", "secret"}, 2},
+		{"list", "", []string{"list", "--offline", "--output", dir}, 0},
+		{"verify", "", []string{"verify", "--offline", "--output", dir}, 0},
+		{"from env", "1", []string{"backup", "--token", "tok", "--url", srv.URL, "--output", dir}, 2},
+		{"env overridden", "true", []string{"list", "--offline=false", "--output", dir}, 0},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(offlineEnv, tc.env)
+			var stderr bytes.Buffer
+			code := runCLI(tc.args, io.Discard, &stderr)
+			if code != tc.wantCode {
+				t.Fatalf("exit code = %d; want %d (stderr: %s)", code, tc.wantCode, stderr.String())
+			}
+			if refused := strings.Contains(stderr.String(), "--offline"); refused != (tc.wantCode == 2) {
+				t.Errorf("stderr %q; want an --offline refusal %v", stderr.String(), tc.wantCode == 2)
+			}
+		})
+	}
+	var stderr bytes.Buffer
+	runCLI([]string{"auth", "login", "--offline", "--lang", "es", "--client-id", "id", "--client-secret", "secret"}, io.Discard, &stderr)
+	if want := "Error: auth login necesita la API de YNAB"; !strings.HasPrefix(stderr.String(), want) {
+		t.Errorf("Spanish refusal %q; want it to start with %q", stderr.String(), want)
+	}
+}
+
+// TestBackupEncryptAndDecrypt writes encrypted snapshots and recovers them
+func TestBackupEncryptAndDecrypt(t *testing.T) {
+	var deltaRequests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			_, _ = io.WriteString(w, `{"data":{"budgets":[{"id":"b1","name":"Budget","last_modified_on":"2025-01-01T00:00:00Z"}]}}`)
+			return
+		}
+		if r.URL.Query().Has("last_knowledge_of_server") {
+			deltaRequests++
+		}
+		_, _ = io.WriteString(w, `{"data":{"budget":{"id":"b1"},"server_knowledge":5}}`)
+	}))
+	defer srv.Close()
+
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	keyFile := filepath.Join(t.TempDir(), "key.txt")
+	if err := os.WriteFile(keyFile, []byte(id.String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("YNAB_BEARER_TOKEN", "tok")
+	var stderr bytes.Buffer
+	args := []string{"backup", "--url", srv.URL, "--output", dir, "--resources", "accounts", "--encrypt-recipient", id.Recipient().String()}
+	for i := 0; i < 2; i++ {
+		if code := runCLI(args, io.Discard, &stderr); code != 0 {
+			t.Fatalf("backup exit code = %d; stderr: %s", code, stderr.String())
+		}
+	}
+	if deltaRequests != 0 {
+		t.Errorf("made %d delta requests against an encrypted snapshot; want full downloads", deltaRequests)
+	}
+
+	snap := filepath.Join(dir, "Budget_b1_20250101T000000Z.json.age")
+	resource := filepath.Join(dir, "Budget_b1", "accounts_20250101T000000Z.json.age")
+	for _, p := range []string{snap, resource} {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("encrypted file missing: %v", err)
+		}
+	}
+	snaps, err := listSnapshots(t.Context(), ynabvault.DirStore(dir))
+	if err != nil || len(snaps) != 1 || !snaps[0].Encrypted {
+		t.Errorf("listSnapshots = %+v, %v; want one encrypted snapshot", snaps, err)
+	}
+
+	var stdout bytes.Buffer
+	if code := runCLI([]string{"decrypt", "--identity", keyFile, "--stdout", snap}, &stdout, &stderr); code != 0 {
+		t.Fatalf("decrypt exit code = %d; stderr: %s", code, stderr.String())
+	}
+	if !bytes.Contains(stdout.Bytes(), []byte(`"budget"`)) {
+		t.Errorf("decrypted output = %q", stdout.String())
+	}
+	if code := runCLI([]string{"decrypt", "--identity", keyFile, resource}, io.Discard, &stderr); code != 0 {
+		t.Fatalf("decrypt exit code = %d; stderr: %s", code, stderr.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Budget_b1", "accounts_20250101T000000Z.json")); err != nil {
+		t.Errorf("decrypted file not written: %v", err)
+	}
+
+	if code := runCLI([]string{"decrypt", "--identity", keyFile, filepath.Join(dir, ynabvault.StateFileName)}, io.Discard, io.Discard); code == 0 {
+		t.Error("decrypting a file without the .age suffix succeeded")
+	}
+	if code := runCLI([]string{"decrypt", snap}, io.Discard, io.Discard); code != 2 {
+		t.Errorf("decrypt without --identity exit code = %d; want 2", code)
+	}
+}
+
+// TestBackupToS3 runs a full backup into a bucket and lists it back
+func TestBackupToS3(t *testing.T) {
+	fake := s3test.New(t)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			_, _ = io.WriteString(w, `{"data":{"budgets":[{"id":"b1","name":"Budget","last_modified_on":"2025-01-01T00:00:00Z"}]}}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"data":{"budget":{"id":"b1","accounts":[],"months":[],"transactions":[]},"server_knowledge":1}}`)
+	}))
+	defer api.Close()
+
+	t.Setenv("YNAB_BEARER_TOKEN", "tok")
+	var stderr strings.Builder
+	args := []string{"backup", "--url", api.URL, "--output", "s3://vault", "--resources", "accounts"}
+	if code := runCLI(args, io.Discard, &stderr); code != 0 {
+		t.Fatalf("backup exit code = %d; stderr: %s", code, stderr.String())
+	}
+	for _, key := range []string{"vault/Budget_b1_20250101T000000Z.json", "vault/Budget_b1/accounts_20250101T000000Z.json", "vault/" + ynabvault.StateFileName, "vault/" + runsFileName} {
+		if _, ok := fake.Objects[key]; !ok {
+			t.Errorf("object %s not written", key)
+		}
+	}
+
+	var stdout strings.Builder
+	if code := runCLI([]string{"verify", "--output", "s3://vault"}, &stdout, &stderr); code != 0 {
+		t.Errorf("verify exit code = %d; output: %s %s", code, stdout.String(), stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "Verified 1 of 1") {
+		t.Errorf("unexpected verify output: %s", stdout.String())
+	}
+}
+
+// snapshotFiles lists the budget files in dir, skipping hidden bookkeeping files
+func snapshotFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Error reading output dir: %v", err)
+	}
+	var names []string
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), ".") {
+			names = append(names, e.Name())
+		}
+	}
+	return names
+}
+
+// TestRunCLIBackupAPIHost derives every endpoint from --api-host or api_host
+func TestRunCLIBackupAPIHost(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		switch r.URL.Path {
+		case "/mock/v1/budgets":
+			_, _ = io.WriteString(w, `{"data":{"budgets":[{"id":"b1","name":"Budget","last_modified_on":"2025-01-01T00:00:00Z"}]}}`)
+		case "/mock/v1/budgets/b1", "/mock/v1/budgets/b1/accounts":
+			_, _ = io.WriteString(w, `{"data":{"budget":{"id":"b1"},"accounts":[],"server_knowledge":1}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	var stderr bytes.Buffer
+	args := []string{"backup", "--token", "tok", "--api-host", srv.URL + "/mock/", "--output", t.TempDir(), "--resources", "accounts"}
+	if code := runCLI(args, io.Discard, &stderr); code != 0 {
+		t.Fatalf("backup exit code = %d; stderr: %s", code, stderr.String())
+	}
+	want := []string{"/mock/v1/budgets", "/mock/v1/budgets/b1", "/mock/v1/budgets/b1/accounts"}
+	if !slices.Equal(paths, want) {
+		t.Errorf("requested %v; want %v", paths, want)
+	}
+
+	paths = nil
+	cfg := writeConfig(t, t.TempDir(), "api_host: "+srv.URL+"/mock\n")
+	args = []string{"backup", "--token", "tok", "--config", cfg, "--output", t.TempDir(), "--force"}
+	if code := runCLI(args, io.Discard, &stderr); code != 0 || len(paths) != 2 {
+		t.Errorf("backup with api_host exit code = %d, requested %v; stderr: %s", code, paths, stderr.String())
+	}
+
+	for _, bad := range [][]string{
+		{"--api-host", "ftp://example.com"},
+		{"--api-host", srv.URL, "--url", srv.URL + "/v1/budgets"},
+	} {
+		args := append([]string{"backup", "--token", "tok", "--output", t.TempDir()}, bad...)
+		if code := runCLI(args, io.Discard, io.Discard); code != 2 {
+			t.Errorf("backup %v exit code = %d; want 2", bad, code)
+		}
+	}
+}
+
+// TestRunCLIBackupInclude still accepts the deprecated --include, with a
+// warning, and refuses it together with --resources
+func TestRunCLIBackupInclude(t *testing.T) {
+	t.Setenv("LANG", "")
+	t.Setenv("LC_ALL", "")
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		switch r.URL.Path {
+		case "/":
+			_, _ = io.WriteString(w, `{"data":{"budgets":[{"id":"b1","name":"Budget","last_modified_on":"2025-01-01T00:00:00Z"}]}}`)
+		default:
+			_, _ = io.WriteString(w, `{"data":{"budget":{"id":"b1"},"accounts":[],"server_knowledge":1}}`)
+		}
+	}))
+	defer srv.Close()
+
+	var stderr bytes.Buffer
+	args := []string{"backup", "--token", "tok", "--url", srv.URL, "--output", t.TempDir(), "--include", "accounts"}
+	if code := runCLI(args, io.Discard, &stderr); code != 0 {
+		t.Fatalf("backup exit code = %d; stderr: %s", code, stderr.String())
+	}
+	if want := []string{"/", "/b1", "/b1/accounts"}; !slices.Equal(paths, want) {
+		t.Errorf("requested %v; want %v", paths, want)
+	}
+	if !strings.Contains(stderr.String(), "Warning: --include is deprecated; use --resources instead") {
+		t.Errorf("stderr lacks the deprecation warning: %s", stderr.String())
+	}
+
+	args = append(args, "--resources", "accounts")
+	if code := runCLI(args, io.Discard, io.Discard); code != 2 {
+		t.Errorf("--include with --resources exit code = %d; want 2", code)
+	}
+}
+
+// TestRunCLIBackupPretty saves indented budget JSON and refuses both styles at once
+func TestRunCLIBackupPretty(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			_, _ = io.WriteString(w, `{"data":{"budgets":[{"id":"b1","name":"Budget","last_modified_on":"2025-01-01T00:00:00Z"}]}}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"data":{"server_knowledge":1,"budget":{"id":"b1"}}}`)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	var stderr bytes.Buffer
+	args := []string{"backup", "--token", "tok", "--url", srv.URL, "--output", dir, "--pretty"}
+	if code := runCLI(args, io.Discard, &stderr); code != 0 {
+		t.Fatalf("backup exit code = %d; stderr: %s", code, stderr.String())
+	}
+	files := snapshotFiles(t, dir)
+	if len(files) != 1 {
+		t.Fatalf("snapshots = %v; want 1", files)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, files[0]))
+	if want := "{\n  \"data\": {\n    \"budget\": {\n      \"id\": \"b1\"\n    },\n    \"server_knowledge\": 1\n  }\n}\n"; err != nil || string(data) != want {
+		t.Errorf("snapshot = %q, %v; want %q", data, err, want)
+	}
+
+	args = []string{"backup", "--token", "tok", "--url", srv.URL, "--output", t.TempDir(), "--pretty", "--canonical"}
+	if code := runCLI(args, io.Discard, io.Discard); code != 2 {
+		t.Errorf("backup --pretty --canonical exit code = %d; want 2", code)
+	}
+}
+
+// TestRunCLIBackupNormalize stores JSON as --normalize says, over the config
+// file's json_style, and pins the hash of the stored form
+func TestRunCLIBackupNormalize(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			_, _ = io.WriteString(w, `{"data":{"budgets":[{"id":"b1","name":"Budget","last_modified_on":"2025-01-01T00:00:00Z"}]}}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"data": {"server_knowledge": 1, "budget": {"id": "b1", "accounts": [], "months": [], "transactions": []}}}`)
+	}))
+	defer srv.Close()
+
+	cfg := writeConfig(t, t.TempDir(), "json_style: pretty\n")
+	tests := []struct {
+		value    string
+		wantCode int
+		want     string
+	}{
+		{"minified", 0, `{"data":{"budget":{"accounts":[],"id":"b1","months":[],"transactions":[]},"server_knowledge":1}}`},
+		{"as-is", 0, `{"data": {"server_knowledge": 1, "budget": {"id": "b1", "accounts": [], "months": [], "transactions": []}}}`},
+		{"pretty", 0, "{\n  \"data\": {\n    \"budget\": {\n      \"accounts\": [],\n      \"id\": \"b1\",\n      \"months\": [],\n      \"transactions\": []\n    },\n    \"server_knowledge\": 1\n  }\n}\n"},
+		{"sorted", 2, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.value, func(t *testing.T) {
+			dir := t.TempDir()
+			var stderr bytes.Buffer
+			args := []string{"backup", "--token", "tok", "--url", srv.URL, "--config", cfg, "--output", dir, "--normalize", tc.value}
+			if code := runCLI(args, io.Discard, &stderr); code != tc.wantCode {
+				t.Fatalf("backup exit code = %d; want %d (stderr: %s)", code, tc.wantCode, stderr.String())
+			}
+			if tc.wantCode != 0 {
+				return
+			}
+			files := snapshotFiles(t, dir)
+			if len(files) != 1 {
+				t.Fatalf("snapshots = %v; want 1", files)
+			}
+			if data, err := os.ReadFile(filepath.Join(dir, files[0])); err != nil || string(data) != tc.want {
+				t.Errorf("snapshot = %q, %v; want %q", data, err, tc.want)
+			}
+			if code := runCLI([]string{"verify", "--output", dir}, io.Discard, &stderr); code != 0 {
+				t.Errorf("verify exit code = %d; stderr: %s", code, stderr.String())
+			}
+		})
+	}
+
+	args := []string{"backup", "--token", "tok", "--url", srv.URL, "--output", t.TempDir(), "--normalize", "pretty", "--pretty"}
+	if code := runCLI(args, io.Discard, io.Discard); code != 2 {
+		t.Errorf("backup --normalize --pretty exit code = %d; want 2", code)
+	}
+}
+
+// TestRunCLIBackupNested backs up in the nested layout, which list, verify
+// and prune then work with
+func TestRunCLIBackupNested(t *testing.T) {
+	modified := "2025-01-01T00:00:00Z"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `{"data":{"budgets":[{"id":"b1","name":"Budget","last_modified_on":%q}]}}`, modified)
+		case "/b1/accounts":
+			_, _ = io.WriteString(w, `{"data":{"accounts":[]}}`)
+		default:
+			_, _ = io.WriteString(w, `{"data":{"budget":{"id":"b1","accounts":[],"months":[],"transactions":[]}}}`)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	for _, m := range []string{"2025-01-01T00:00:00Z", "2025-01-02T00:00:00Z"} {
+		modified = m
+		var stderr bytes.Buffer
+		args := []string{"backup", "--token", "tok", "--url", srv.URL, "--output", dir, "--layout", "nested", "--resources", "accounts"}
+		if code := runCLI(args, io.Discard, &stderr); code != 0 {
+			t.Fatalf("backup exit code = %d; stderr: %s", code, stderr.String())
+		}
+	}
+	var stdout, stderr bytes.Buffer
+	if code := runCLI([]string{"list", "--output", dir}, &stdout, &stderr); code != 0 || !strings.Contains(stdout.String(), "Budget_b1/20250101T000000Z/budget.json") || !strings.Contains(stdout.String(), "Budget_b1/20250102T000000Z/budget.json") {
+		t.Errorf("list exit code = %d, output:\n%s%s", code, stdout.String(), stderr.String())
+	}
+	if code := runCLI([]string{"verify", "--output", dir}, io.Discard, &stderr); code != 0 {
+		t.Errorf("verify exit code = %d; stderr: %s", code, stderr.String())
+	}
+	if code := runCLI([]string{"prune", "--output", dir, "--keep-daily", "1"}, io.Discard, &stderr); code != 0 {
+		t.Fatalf("prune exit code = %d; stderr: %s", code, stderr.String())
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, "Budget_b1"))
+	if err != nil || len(entries) != 1 || entries[0].Name() != "20250102T000000Z" {
+		t.Errorf("snapshot directories after prune = %v, %v; want only 20250102T000000Z", entries, err)
+	}
+
+	args := []string{"backup", "--token", "tok", "--url", srv.URL, "--output", t.TempDir(), "--layout", "nested", "--filename-template", "latest"}
+	if code := runCLI(args, io.Discard, io.Discard); code != 2 {
+		t.Errorf("backup --layout nested --filename-template exit code = %d; want 2", code)
+	}
+}
+
+// TestRunCLIBackupEndpoints routes one endpoint elsewhere through the config
+// file and rejects an invalid override before any request
+func TestRunCLIBackupEndpoints(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		switch r.URL.Path {
+		case "/v1/budgets":
+			_, _ = io.WriteString(w, `{"data":{"budgets":[{"id":"b1","name":"Budget","last_modified_on":"2025-01-01T00:00:00Z"}]}}`)
+		case "/v1/budgets/b1", "/cache/b1/accounts":
+			_, _ = io.WriteString(w, `{"data":{"budget":{"id":"b1"},"accounts":[],"server_knowledge":1}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := writeConfig(t, t.TempDir(), "api_host: "+srv.URL+"\nresources: [accounts]\nendpoints:\n  /budgets/{id}/accounts: "+srv.URL+"/cache/{id}/accounts\n")
+	var stderr bytes.Buffer
+	args := []string{"backup", "--token", "tok", "--config", cfg, "--output", t.TempDir()}
+	if code := runCLI(args, io.Discard, &stderr); code != 0 {
+		t.Fatalf("backup exit code = %d; stderr: %s", code, stderr.String())
+	}
+	if want := []string{"/v1/budgets", "/v1/budgets/b1", "/cache/b1/accounts"}; !slices.Equal(paths, want) {
+		t.Errorf("requested %v; want %v", paths, want)
+	}
+
+	paths = nil
+	cfg = writeConfig(t, t.TempDir(), "api_host: "+srv.URL+"\nendpoints:\n  /budgets/{id}: "+srv.URL+"/cache\n")
+	args = []string{"backup", "--token", "tok", "--config", cfg, "--output", t.TempDir()}
+	if code := runCLI(args, io.Discard, io.Discard); code != 2 || len(paths) != 0 {
+		t.Errorf("backup with an override lacking {id} exit code = %d, requested %v; want 2 and no requests", code, paths)
+	}
+}
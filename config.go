@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+	"gopkg.in/yaml.v3"
+)
+
+// profileConfig holds the backup settings a config file can set, either at
+// the top level or inside a named profile
+type profileConfig struct {
+	Token       string   `yaml:"token"`
+	TokenEnv    string   `yaml:"token_env"`  // environment variable holding the token
+	TokenFile   string   `yaml:"token_file"` // file holding the token
+	Output      string   `yaml:"output"`
+	URL         string   `yaml:"url"`
+	Resources   []string `yaml:"resources"`
+	Concurrency int      `yaml:"concurrency"`
+	// EncryptRecipients are age public keys budget files are encrypted for
+	EncryptRecipients []string `yaml:"encrypt_recipients"`
+	// Keep* prune old snapshots after each backup, see retention
+	KeepDaily   int `yaml:"keep_daily"`
+	KeepWeekly  int `yaml:"keep_weekly"`
+	KeepMonthly int `yaml:"keep_monthly"`
+	// Budgets and ExcludeBudgets select budgets by name glob or ID
+	Budgets        []string `yaml:"budgets"`
+	ExcludeBudgets []string `yaml:"exclude_budgets"`
+	// TransactionsSince limits the transactions resource, see --transactions-since
+	TransactionsSince string `yaml:"transactions_since"`
+	MaxBudgetSize     string `yaml:"max_budget_size"`
+	NotifyURL         string `yaml:"notify_url"`
+	NotifyFormat      string `yaml:"notify_format"`
+	// TokenKeyring is the OS keyring entry holding the token, see auth set
+	TokenKeyring string `yaml:"token_keyring"`
+	// APIHost derives every API endpoint, see --api-host
+	APIHost string `yaml:"api_host"`
+	// Endpoints overrides single endpoint URLs, keyed like --api-usage
+	// labels them, e.g. /budgets/{id}/transactions
+	Endpoints map[string]string `yaml:"endpoints"`
+	// GatewayAuth adds headers for an egress gateway to API requests
+	GatewayAuth []gatewayAuth `yaml:"gateway_auth"`
+	Proxy       proxyConfig   `yaml:"proxy"`
+	DoHURL      string        `yaml:"doh_url"`
+	// JSONStyle is pretty or canonical, see --pretty and --canonical
+	JSONStyle string `yaml:"json_style"`
+	// FilenameTemplate is --filename-template
+	FilenameTemplate string `yaml:"filename_template"`
+	// Layout is --layout
+	Layout string `yaml:"layout"`
+	// MinInterval is --min-interval as a duration such as 6h
+	MinInterval     string `yaml:"min_interval"`
+	MinIntervalExit int    `yaml:"min_interval_exit"`
+	// Rollups puts category groups into higher-level buckets for reports
+	// and exports, bucket name to group names
+	Rollups map[string][]string `yaml:"rollups"`
+	// LedgerAccounts names the Ledger account for YNAB accounts and
+	// categories in export --format ledger
+	LedgerAccounts map[string]string `yaml:"ledger_accounts"`
+}
+
+// configFile is the parsed --config file; top-level settings are shared
+// defaults that each profile may override
+type configFile struct {
+	profileConfig `yaml:",inline"`
+	Profiles      map[string]profileConfig `yaml:"profiles"`
+}
+
+// loadConfig reads and parses a YAML config file, rejecting unknown keys
+func loadConfig(path string) (*configFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	var cfg configFile
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// profile returns the settings for name merged over the top-level defaults;
+// an empty name selects the defaults alone
+func (c *configFile) profile(name string) (profileConfig, error) {
+	base := c.profileConfig
+	if name == "" {
+		return base, nil
+	}
+	p, ok := c.Profiles[name]
+	if !ok {
+		return base, fmt.Errorf("unknown profile %q in config", name)
+	}
+	if p.Token != "" || p.TokenEnv != "" || p.TokenFile != "" || p.TokenKeyring != "" {
+		base.Token, base.TokenEnv, base.TokenFile, base.TokenKeyring = p.Token, p.TokenEnv, p.TokenFile, p.TokenKeyring
+	}
+	if p.Output != "" {
+		base.Output = p.Output
+	}
+	if p.URL != "" {
+		base.URL, base.APIHost = p.URL, ""
+	}
+	if p.Resources != nil {
+		base.Resources = p.Resources
+	}
+	if p.Concurrency != 0 {
+		base.Concurrency = p.Concurrency
+	}
+	if p.EncryptRecipients != nil {
+		base.EncryptRecipients = p.EncryptRecipients
+	}
+	if p.KeepDaily != 0 {
+		base.KeepDaily = p.KeepDaily
+	}
+	if p.KeepWeekly != 0 {
+		base.KeepWeekly = p.KeepWeekly
+	}
+	if p.KeepMonthly != 0 {
+		base.KeepMonthly = p.KeepMonthly
+	}
+	if p.Budgets != nil {
+		base.Budgets = p.Budgets
+	}
+	if p.ExcludeBudgets != nil {
+		base.ExcludeBudgets = p.ExcludeBudgets
+	}
+	if p.TransactionsSince != "" {
+		base.TransactionsSince = p.TransactionsSince
+	}
+	if p.MaxBudgetSize != "" {
+		base.MaxBudgetSize = p.MaxBudgetSize
+	}
+	if p.NotifyURL != "" {
+		base.NotifyURL = p.NotifyURL
+	}
+	if p.NotifyFormat != "" {
+		base.NotifyFormat = p.NotifyFormat
+	}
+	if p.APIHost != "" {
+		base.URL, base.APIHost = "", p.APIHost
+	}
+	if p.Endpoints != nil {
+		base.Endpoints = p.Endpoints
+	}
+	if p.GatewayAuth != nil {
+		base.GatewayAuth = p.GatewayAuth
+	}
+	base.Proxy.merge(p.Proxy)
+	if p.DoHURL != "" {
+		base.DoHURL = p.DoHURL
+	}
+	if p.JSONStyle != "" {
+		base.JSONStyle = p.JSONStyle
+	}
+	if p.FilenameTemplate != "" {
+		base.FilenameTemplate = p.FilenameTemplate
+	}
+	if p.Layout != "" {
+		base.Layout = p.Layout
+	}
+	if p.MinInterval != "" {
+		base.MinInterval = p.MinInterval
+	}
+	if p.MinIntervalExit != 0 {
+		base.MinIntervalExit = p.MinIntervalExit
+	}
+	if p.Rollups != nil {
+		base.Rollups = p.Rollups
+	}
+	if p.LedgerAccounts != nil {
+		base.LedgerAccounts = p.LedgerAccounts
+	}
+	return base, nil
+}
+
+// profileNames returns the configured profile names in sorted order
+func (c *configFile) profileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// token resolves the configured token source, in order token, token_env,
+// token_file, token_keyring
+func (p profileConfig) token() (string, error) {
+	switch {
+	case p.Token != "":
+		return p.Token, nil
+	case p.TokenEnv != "":
+		return os.Getenv(p.TokenEnv), nil
+	case p.TokenFile != "":
+		data, err := os.ReadFile(p.TokenFile)
+		if err != nil {
+			return "", fmt.Errorf("read token file: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	case p.TokenKeyring != "":
+		return keyringToken(p.TokenKeyring)
+	}
+	return "", nil
+}
+
+// configFlags are the --config and --profile flags shared by commands that
+// read settings from a config file
+type configFlags struct {
+	path    string
+	profile string
+}
+
+func (c *configFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.path, "config", "", "YAML config file with settings and named profiles")
+	fs.StringVar(&c.profile, "profile", "", "Profile from the config file to use")
+}
+
+// load reads the config file; it returns nil when --config was not given
+func (c *configFlags) load() (*configFile, error) {
+	if c.path == "" {
+		if c.profile != "" {
+			return nil, errors.New("--profile requires --config")
+		}
+		return nil, nil
+	}
+	return loadConfig(c.path)
+}
+
+// settings returns the selected profile merged over the file's defaults;
+// without --config it is empty
+func (c *configFlags) settings() (profileConfig, error) {
+	file, err := c.load()
+	if err != nil || file == nil {
+		return profileConfig{}, err
+	}
+	return file.profile(c.profile)
+}
+
+// flagSet reports whether the named flag was given on the command line
+func flagSet(fs *flag.FlagSet, name string) bool {
+	found := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			found = true
+		}
+	})
+	return found
+}
+
+// store opens --output, or the profile's output when --output was left at its
+// default, and returns it with its name; network limits remote stores to
+// tcp4 or tcp6
+func (c *configFlags) store(fs *flag.FlagSet, output, network string) (ynabvault.Store, string, error) {
+	p, err := c.settings()
+	if err != nil {
+		return nil, output, err
+	}
+	if p.Output != "" && !flagSet(fs, "output") {
+		output = p.Output
+	}
+	opts, err := p.Proxy.storeOptions()
+	if err != nil {
+		return nil, output, err
+	}
+	opts.Network = network
+	store, err := ynabvault.OpenStoreWith(output, opts)
+	return store, output, err
+}
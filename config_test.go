@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testConfig = `
+url: https://example.test/v1/budgets
+token_env: YNAB_TEST_DEFAULT_TOKEN
+resources: [accounts]
+profiles:
+  personal:
+    output: personal
+  family:
+    output: family
+    token_file: family.token
+    resources: []
+    concurrency: 2
+  mock:
+    output: mock
+    api_host: http://localhost:8080
+`
+
+// writeConfig writes content to a config file in dir and returns its path
+func writeConfig(t *testing.T, dir, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, "ynabvault.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestConfigProfiles merges profiles over the top-level defaults
+func TestConfigProfiles(t *testing.T) {
+	dir := t.TempDir()
+	cfg, err := loadConfig(writeConfig(t, dir, testConfig))
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if got, want := cfg.profileNames(), []string{"family", "mock", "personal"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("profileNames = %v; want %v", got, want)
+	}
+
+	tests := []struct {
+		name string
+		want profileConfig
+	}{
+		{"", profileConfig{URL: "https://example.test/v1/budgets", TokenEnv: "YNAB_TEST_DEFAULT_TOKEN", Resources: []string{"accounts"}}},
+		{"personal", profileConfig{URL: "https://example.test/v1/budgets", TokenEnv: "YNAB_TEST_DEFAULT_TOKEN", Output: "personal", Resources: []string{"accounts"}}},
+		{"family", profileConfig{URL: "https://example.test/v1/budgets", TokenFile: "family.token", Output: "family", Resources: []string{}, Concurrency: 2}},
+		{"mock", profileConfig{APIHost: "http://localhost:8080", Output: "mock", TokenEnv: "YNAB_TEST_DEFAULT_TOKEN", Resources: []string{"accounts"}}},
+	}
+	for _, tc := range tests {
+		got, err := cfg.profile(tc.name)
+		if err != nil {
+			t.Fatalf("profile(%q): %v", tc.name, err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("profile(%q) = %+v; want %+v", tc.name, got, tc.want)
+		}
+	}
+	if _, err := cfg.profile("work"); err == nil {
+		t.Error("expected an error for an unknown profile")
+	}
+
+	if _, err := loadConfig(writeConfig(t, dir, "outptu: typo\n")); err == nil {
+		t.Error("expected an error for an unknown key")
+	}
+	if _, err := loadConfig(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+// TestProfileToken resolves each token source
+func TestProfileToken(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenFile, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("YNAB_TEST_TOKEN", "from-env")
+	tests := []struct {
+		p    profileConfig
+		want string
+	}{
+		{profileConfig{Token: "inline", TokenEnv: "YNAB_TEST_TOKEN"}, "inline"},
+		{profileConfig{TokenEnv: "YNAB_TEST_TOKEN", TokenFile: tokenFile}, "from-env"},
+		{profileConfig{TokenFile: tokenFile}, "from-file"},
+		{profileConfig{}, ""},
+	}
+	for _, tc := range tests {
+		if got, err := tc.p.token(); err != nil || got != tc.want {
+			t.Errorf("token(%+v) = %q, %v; want %q", tc.p, got, err, tc.want)
+		}
+	}
+	if _, err := (profileConfig{TokenFile: filepath.Join(dir, "missing")}).token(); err == nil {
+		t.Error("expected an error for a missing token file")
+	}
+}
+
+// TestBackupAllProfiles backs up every profile, with flags overriding the file
+func TestBackupAllProfiles(t *testing.T) {
+	tokens := map[string]bool{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokens[r.Header.Get("Authorization")] = true
+		if r.URL.Path == "/" {
+			_, _ = io.WriteString(w, `{"data":{"budgets":[{"id":"b1","name":"Budget","last_modified_on":"2025-01-01T00:00:00Z"}]}}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"data":{"budget":{"id":"b1"}}}`)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "family.token"), []byte("family-token"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	content := strings.ReplaceAll(testConfig, "family.token", filepath.Join(dir, "family.token"))
+	content = strings.ReplaceAll(content, "output: ", "output: "+dir+"/")
+	path := writeConfig(t, dir, content)
+	t.Setenv("YNAB_TEST_DEFAULT_TOKEN", "personal-token")
+
+	var stderr bytes.Buffer
+	args := []string{"backup", "--config", path, "--all-profiles", "--url", srv.URL, "--resources", ""}
+	if code := runCLI(args, io.Discard, &stderr); code != 0 {
+		t.Fatalf("backup exit code = %d; stderr: %s", code, stderr.String())
+	}
+	for _, profile := range []string{"personal", "family"} {
+		if got := snapshotFiles(t, filepath.Join(dir, profile)); len(got) != 1 {
+			t.Errorf("profile %s: expected 1 snapshot, got %v", profile, got)
+		}
+	}
+	for _, tok := range []string{"Bearer personal-token", "Bearer family-token"} {
+		if !tokens[tok] {
+			t.Errorf("no request authorized with %q; saw %v", tok, tokens)
+		}
+	}
+
+	var stdout bytes.Buffer
+	if code := runCLI([]string{"list", "--config", path, "--profile", "family"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("list exit code = %d; stderr: %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "Budget_b1") {
+		t.Errorf("list --profile family output lacks the snapshot:\n%s", stdout.String())
+	}
+
+	for _, bad := range [][]string{
+		{"backup", "--all-profiles"},
+		{"backup", "--profile", "personal"},
+		{"backup", "--config", path, "--profile", "work"},
+	} {
+		if code := runCLI(bad, io.Discard, io.Discard); code != 2 {
+			t.Errorf("runCLI(%v) = %d; want 2", bad, code)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+	"gopkg.in/yaml.v3"
+)
+
+// backendPrice is a storage backend's list prices in USD
+type backendPrice struct {
+	StorageGBMonth float64 `yaml:"storage_gb_month"` // per GB stored for a month
+	PutPer1000     float64 `yaml:"put_per_1000"`     // per 1000 uploads
+	GetPer1000     float64 `yaml:"get_per_1000"`     // per 1000 downloads
+}
+
+// defaultPrices are first-tier list prices, ignoring free tiers and egress;
+// override them with --prices when they drift
+var defaultPrices = map[string]backendPrice{
+	"s3":     {StorageGBMonth: 0.023, PutPer1000: 0.005, GetPer1000: 0.0004},
+	"b2":     {StorageGBMonth: 0.006, PutPer1000: 0, GetPer1000: 0.0004},
+	"r2":     {StorageGBMonth: 0.015, PutPer1000: 0.0045, GetPer1000: 0.00036},
+	"gdrive": {StorageGBMonth: 0.02}, // Google One 100 GB plan, no request fees
+}
+
+// loadPrices returns the built-in prices with the backends in the YAML file
+// at path added or replaced; an empty path keeps the built-ins
+func loadPrices(path string) (map[string]backendPrice, error) {
+	prices := map[string]backendPrice{}
+	for k, v := range defaultPrices {
+		prices[k] = v
+	}
+	if path == "" {
+		return prices, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read prices: %w", err)
+	}
+	var custom map[string]backendPrice
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&custom); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parse prices %s: %w", path, err)
+	}
+	for k, v := range custom {
+		prices[k] = v
+	}
+	return prices, nil
+}
+
+// costWindow is the period monthly request volumes are estimated over
+const costWindow = 30 * 24 * time.Hour
+
+// vaultUsage is what a vault stores and how often it is written and read
+type vaultUsage struct {
+	Files int
+	Bytes int64
+	// Per month, estimated from the run history and file timestamps
+	Runs   float64
+	Writes float64
+	Reads  float64
+}
+
+// sizer is implemented by stores that can report file sizes without
+// downloading the files
+type sizer interface {
+	Sizes(ctx context.Context, prefix string) (map[string]int64, error)
+}
+
+// storeSizes returns the size of every file in store
+func storeSizes(ctx context.Context, store ynabvault.Store) (map[string]int64, error) {
+	if s, ok := store.(sizer); ok {
+		return s.Sizes(ctx, "")
+	}
+	names, err := store.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	sizes := map[string]int64{}
+	for _, name := range names {
+		data, err := store.Get(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		sizes[name] = int64(len(data))
+	}
+	return sizes, nil
+}
+
+// fileTime parses the timestamp every snapshot and sub-resource name ends
+// in, or, in the nested layout, the name of the directory holding it
+func fileTime(name string) (time.Time, bool) {
+	base, _ := ynabvault.TrimStoredSuffixes(name)
+	base, ok := strings.CutSuffix(base, ".json")
+	if !ok {
+		return time.Time{}, false
+	}
+	if ts, err := time.Parse(ynabvault.TimeFormat, path.Base(path.Dir(base))); err == nil {
+		return ts, true
+	}
+	i := strings.LastIndex(base, "_")
+	if i < 0 {
+		return time.Time{}, false
+	}
+	ts, err := time.Parse(ynabvault.TimeFormat, base[i+1:])
+	return ts, err == nil
+}
+
+// measureUsage sizes the vault and estimates its monthly request volume.
+// Each run reads and rewrites the state, manifest and run history, uploads
+// the files it saves and reads back one snapshot per budget to merge deltas
+// into. A history shorter than the window is scaled up to a month.
+func measureUsage(sizes map[string]int64, runs []runRecord, now time.Time) vaultUsage {
+	var u vaultUsage
+	start := now.Add(-costWindow)
+	saved, snapshots := 0, 0
+	for name, size := range sizes {
+		u.Files++
+		u.Bytes += size
+		if ts, ok := fileTime(name); ok && !ts.Before(start) {
+			saved++
+			if s, ok := parseSnapshotName(name); ok && (s.Nested || !strings.Contains(name, "/")) {
+				snapshots++
+			}
+		}
+	}
+	oldest := now
+	n := 0
+	for _, r := range runs {
+		if !r.isBackup() || r.Started.Before(start) {
+			continue
+		}
+		n++
+		if r.Started.Before(oldest) {
+			oldest = r.Started
+		}
+	}
+	if n == 0 {
+		return u
+	}
+	scale := 1.0
+	if span := max(now.Sub(oldest), 24*time.Hour); span < costWindow {
+		scale = float64(costWindow) / float64(span)
+	}
+	const bookkeeping = 3 // state, manifest and run history
+	u.Runs = float64(n) * scale
+	u.Writes = float64(saved+bookkeeping*n) * scale
+	u.Reads = float64(snapshots+bookkeeping*n) * scale
+	return u
+}
+
+// backendCost is one backend's estimated monthly bill in USD
+type backendCost struct {
+	Backend  string
+	Storage  float64
+	Requests float64
+}
+
+func (c backendCost) total() float64 { return c.Storage + c.Requests }
+
+// estimateCosts prices u on every backend, cheapest first
+func estimateCosts(u vaultUsage, prices map[string]backendPrice) []backendCost {
+	gb := float64(u.Bytes) / (1 << 30)
+	var out []backendCost
+	for name, p := range prices {
+		out = append(out, backendCost{
+			Backend:  name,
+			Storage:  gb * p.StorageGBMonth,
+			Requests: u.Writes/1000*p.PutPer1000 + u.Reads/1000*p.GetPer1000,
+		})
+	}
+	sort.Slice(out, func(a, b int) bool {
+		if out[a].total() != out[b].total() {
+			return out[a].total() < out[b].total()
+		}
+		return out[a].Backend < out[b].Backend
+	})
+	return out
+}
+
+// printCosts writes the vault's usage followed by the per-backend table
+func printCosts(w io.Writer, u vaultUsage, costs []backendCost) {
+	fmt.Fprintf(w, "Vault: %d files, %.2f MiB; about %.0f runs, %.0f uploads and %.0f downloads per month\n\n",
+		u.Files, float64(u.Bytes)/(1<<20), u.Runs, u.Writes, u.Reads)
+	fmt.Fprintln(w, "BACKEND\tSTORAGE/MONTH\tREQUESTS/MONTH\tTOTAL/MONTH")
+	for _, c := range costs {
+		fmt.Fprintf(w, "%s\t$%.4f\t$%.4f\t$%.4f\n", c.Backend, c.Storage, c.Requests, c.total())
+	}
+}
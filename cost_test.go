@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMeasureUsage counts recent files and scales short histories to a month
+func TestMeasureUsage(t *testing.T) {
+	now := time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)
+	sizes := map[string]int64{
+		"B_b1_20250629T000000Z.json":          1000,
+		"B_b1_20250501T000000Z.json":          1000,
+		"B_b1/accounts_20250629T000000Z.json": 200,
+		".ynabvault-state.json":               50,
+		// A nested snapshot and its resource
+		"C_c1/20250629T000000Z/budget.json":   500,
+		"C_c1/20250629T000000Z/accounts.json": 100,
+	}
+	runs := []runRecord{
+		{Started: now.Add(-60 * 24 * time.Hour)},
+		{Started: now.Add(-24 * time.Hour)},
+	}
+	u := measureUsage(sizes, runs, now)
+	if u.Files != 6 || u.Bytes != 2850 {
+		t.Errorf("files %d, bytes %d; want 6, 2850", u.Files, u.Bytes)
+	}
+	// One run in one day of history, scaled to 30 days
+	if u.Runs != 30 || u.Writes != 30*(4+3) || u.Reads != 30*(2+3) {
+		t.Errorf("usage %+v; want 30 runs, 210 writes, 150 reads", u)
+	}
+	if u := measureUsage(sizes, nil, now); u.Runs != 0 || u.Writes != 0 {
+		t.Errorf("usage without runs %+v; want no requests", u)
+	}
+}
+
+// TestEstimateCosts prices usage and orders backends cheapest first
+func TestEstimateCosts(t *testing.T) {
+	u := vaultUsage{Bytes: 10 << 30, Writes: 2000, Reads: 1000}
+	costs := estimateCosts(u, map[string]backendPrice{
+		"a": {StorageGBMonth: 0.02, PutPer1000: 0.005, GetPer1000: 0.001},
+		"b": {StorageGBMonth: 0.01},
+	})
+	if len(costs) != 2 || costs[0].Backend != "b" {
+		t.Fatalf("costs = %+v; want b first", costs)
+	}
+	if got := costs[1].total(); math.Abs(got-(0.2+0.01+0.001)) > 1e-9 {
+		t.Errorf("total for a = %v; want 0.211", got)
+	}
+}
+
+// TestCostCommand overrides a built-in price from a file
+func TestCostCommand(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "B_b1_20250101T000000Z.json"), make([]byte, 1<<20), 0644); err != nil {
+		t.Fatal(err)
+	}
+	prices := filepath.Join(t.TempDir(), "prices.yaml")
+	if err := os.WriteFile(prices, []byte("s3:\n  storage_gb_month: 1024\nwasabi:\n  storage_gb_month: 0.007\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var stdout strings.Builder
+	if code := runCLI([]string{"cost", "--output", dir, "--prices", prices}, &stdout, io.Discard); code != 0 {
+		t.Fatalf("exit code = %d\n%s", code, stdout.String())
+	}
+	out := stdout.String()
+	for _, want := range []string{"Vault: 1 files, 1.00 MiB", "wasabi", "$1.0000"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+
+	if err := os.WriteFile(prices, []byte("s3:\n  storage: 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if code := runCLI([]string{"cost", "--output", dir, "--prices", prices}, io.Discard, io.Discard); code != 2 {
+		t.Errorf("unknown price key exit code = %d; want 2", code)
+	}
+}
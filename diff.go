@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// diffKinds are the budget entity lists diff compares
+var diffKinds = []string{"accounts", "categories", "transactions"}
+
+// entityChange is one added, removed or changed entity between two snapshots
+type entityChange struct {
+	Kind   string   `json:"kind"`
+	Change string   `json:"change"` // added, removed or changed
+	ID     string   `json:"id"`
+	Label  string   `json:"label"`
+	Fields []string `json:"fields,omitempty"` // changed fields, sorted
+}
+
+// diffBudgets compares the entity lists of two budgets. Entities are matched
+// by ID; those flagged deleted count as absent.
+func diffBudgets(old, cur map[string]interface{}) []entityChange {
+	var out []entityChange
+	for _, kind := range diffKinds {
+		before, after := entitiesByID(old[kind]), entitiesByID(cur[kind])
+		for _, id := range sortedKeys(after) {
+			e := after[id]
+			prev, ok := before[id]
+			if !ok {
+				out = append(out, entityChange{Kind: kind, Change: "added", ID: id, Label: entityLabel(kind, e)})
+				continue
+			}
+			if fields := changedFields(prev, e); len(fields) > 0 {
+				out = append(out, entityChange{Kind: kind, Change: "changed", ID: id, Label: entityLabel(kind, e), Fields: fields})
+			}
+		}
+		for _, id := range sortedKeys(before) {
+			if _, ok := after[id]; !ok {
+				out = append(out, entityChange{Kind: kind, Change: "removed", ID: id, Label: entityLabel(kind, before[id])})
+			}
+		}
+	}
+	return out
+}
+
+// entitiesByID indexes a budget's entity list, leaving out deleted entities
+func entitiesByID(list interface{}) map[string]map[string]interface{} {
+	out := map[string]map[string]interface{}{}
+	items, _ := list.([]interface{})
+	for _, item := range items {
+		obj, ok := item.(map[string]interface{})
+		if !ok || obj["deleted"] == true {
+			continue
+		}
+		if id, ok := obj["id"].(string); ok {
+			out[id] = obj
+		}
+	}
+	return out
+}
+
+// changedFields lists the fields whose values differ between two versions
+func changedFields(old, cur map[string]interface{}) []string {
+	var fields []string
+	for k, v := range cur {
+		if !reflect.DeepEqual(old[k], v) {
+			fields = append(fields, k)
+		}
+	}
+	for k := range old {
+		if _, ok := cur[k]; !ok {
+			fields = append(fields, k)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// entityLabel names an entity for people: its name, or for a transaction its
+// date, amount and memo
+func entityLabel(kind string, e map[string]interface{}) string {
+	if kind != "transactions" {
+		name, _ := e["name"].(string)
+		return name
+	}
+	parts := []string{}
+	if date, ok := e["date"].(string); ok {
+		parts = append(parts, date)
+	}
+	if amount, ok := e["amount"].(json.Number); ok {
+		if n, err := amount.Int64(); err == nil {
+			parts = append(parts, fixedAmount(n, 2))
+		}
+	}
+	if memo, ok := e["memo"].(string); ok && memo != "" {
+		parts = append(parts, memo)
+	}
+	return strings.Join(parts, " ")
+}
+
+// pickDiffSnapshots finds the budget named or identified by budget and
+// returns its n-th newest and newest snapshots
+func pickDiffSnapshots(snaps []snapshotInfo, budget string, n int) (snapshotInfo, snapshotInfo, error) {
+	var list []snapshotInfo
+	ids := map[string]bool{}
+	for _, s := range snaps {
+		if s.ID == budget || s.Name == ynabvault.SanitizeFileName(budget) {
+			list = append(list, s)
+			ids[s.ID] = true
+		}
+	}
+	switch {
+	case len(list) == 0:
+		return snapshotInfo{}, snapshotInfo{}, fmt.Errorf("%w: no snapshots of budget %q", ynabvault.ErrNotFound, budget)
+	case len(ids) > 1:
+		return snapshotInfo{}, snapshotInfo{}, fmt.Errorf("budget name %q is ambiguous (IDs %s); pass the ID instead", budget, strings.Join(sortedKeys(ids), ", "))
+	case len(list) < n:
+		return snapshotInfo{}, snapshotInfo{}, fmt.Errorf("%w: budget %q has %d snapshots, --last %d needs more", ynabvault.ErrNotFound, budget, len(list), n)
+	}
+	return list[len(list)-n], list[len(list)-1], nil
+}
+
+// printDiff writes the changes one per line followed by per-kind counts
+func printDiff(w io.Writer, oldName, newName string, changes []entityChange) {
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", oldName, newName)
+	symbols := map[string]string{"added": "+", "removed": "-", "changed": "~"}
+	counts := map[string]map[string]int{}
+	for _, c := range changes {
+		if counts[c.Kind] == nil {
+			counts[c.Kind] = map[string]int{}
+		}
+		counts[c.Kind][c.Change]++
+		line := fmt.Sprintf("%s %s\t%s\t%s", symbols[c.Change], c.Kind, c.ID, c.Label)
+		if len(c.Fields) > 0 {
+			line += "\t(" + strings.Join(c.Fields, ", ") + ")"
+		}
+		fmt.Fprintln(w, line)
+	}
+	if len(changes) == 0 {
+		fmt.Fprintln(w, "No differences")
+		return
+	}
+	fmt.Fprintln(w)
+	for _, kind := range diffKinds {
+		c := counts[kind]
+		fmt.Fprintf(w, "%s: %d added, %d removed, %d changed\n", kind, c["added"], c["removed"], c["changed"])
+	}
+}
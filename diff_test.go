@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// TestDiffBudgets reports added, removed and changed entities per kind
+func TestDiffBudgets(t *testing.T) {
+	old, err := ynabvault.DecodeEnvelope([]byte(`{"data":{"budget":{
+		"accounts":[{"id":"a1","name":"Checking","balance":1000},{"id":"a2","name":"Old"}],
+		"categories":[{"id":"c1","name":"Food"}],
+		"transactions":[{"id":"t1","date":"2025-01-02","amount":-12500,"memo":"Groceries"},{"id":"t2","deleted":true}]}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cur, err := ynabvault.DecodeEnvelope([]byte(`{"data":{"budget":{
+		"accounts":[{"id":"a1","name":"Checking","balance":2000},{"id":"a3","name":"Savings"}],
+		"categories":[{"id":"c1","name":"Food"}],
+		"transactions":[{"id":"t1","date":"2025-01-02","amount":-12500,"memo":"Groceries"},{"id":"t2","date":"2025-01-03","amount":5}]}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []entityChange{
+		{Kind: "accounts", Change: "changed", ID: "a1", Label: "Checking", Fields: []string{"balance"}},
+		{Kind: "accounts", Change: "added", ID: "a3", Label: "Savings"},
+		{Kind: "accounts", Change: "removed", ID: "a2", Label: "Old"},
+		{Kind: "transactions", Change: "added", ID: "t2", Label: "2025-01-03 0.005"},
+	}
+	if got := diffBudgets(old.Data.Budget, cur.Data.Budget); !reflect.DeepEqual(got, want) {
+		t.Errorf("diffBudgets =\n%+v\nwant\n%+v", got, want)
+	}
+	if got := entityLabel("transactions", map[string]interface{}{"date": "2025-01-03", "amount": json.Number("-12345")}); got != "2025-01-03 -12.345" {
+		t.Errorf("label of a transaction with a third decimal = %q", got)
+	}
+}
+
+// TestDiffCommand compares named files and the last snapshots of a budget
+func TestDiffCommand(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"Budget_b1_20250101T000000Z.json": `{"data":{"budget":{"id":"b1","accounts":[{"id":"a1","name":"Checking"}]}}}`,
+		"Budget_b1_20250102T000000Z.json": `{"data":{"budget":{"id":"b1","accounts":[]}}}`,
+		"Budget_b1_20250103T000000Z.json": `{"data":{"budget":{"id":"b1","accounts":[{"id":"a2","name":"Savings"}]}}}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stdout strings.Builder
+	args := []string{"diff", "--output", dir, "Budget_b1_20250101T000000Z.json", "Budget_b1_20250102T000000Z.json"}
+	if code := runCLI(args, &stdout, io.Discard); code != 0 {
+		t.Fatalf("exit code = %d", code)
+	}
+	for _, want := range []string{"- accounts", "Checking", "accounts: 0 added, 1 removed, 0 changed"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("output lacks %q:\n%s", want, stdout.String())
+		}
+	}
+
+	stdout.Reset()
+	if code := runCLI([]string{"diff", "--output", dir, "--budget", "Budget", "--last", "3", "--json"}, &stdout, io.Discard); code != 0 {
+		t.Fatalf("--budget exit code = %d", code)
+	}
+	var got struct {
+		Old     string
+		New     string
+		Changes []entityChange
+	}
+	if err := json.Unmarshal([]byte(stdout.String()), &got); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, stdout.String())
+	}
+	if got.Old != "Budget_b1_20250101T000000Z.json" || got.New != "Budget_b1_20250103T000000Z.json" || len(got.Changes) != 2 {
+		t.Errorf("JSON diff = %+v", got)
+	}
+
+	if code := runCLI([]string{"diff", "--output", dir, "--budget", "b1", "--last", "9"}, io.Discard, io.Discard); code != exitNotFound {
+		t.Errorf("--last beyond history exit code = %d; want %d", code, exitNotFound)
+	}
+	if code := runCLI([]string{"diff", "--output", dir, "only-one.json"}, io.Discard, io.Discard); code != 2 {
+		t.Errorf("single file exit code = %d; want 2", code)
+	}
+}
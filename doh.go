@@ -0,0 +1,186 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dohResolver resolves host names with DNS over HTTPS (RFC 8484), so API
+// lookups do not reach a DNS server on an untrusted network. The DoH
+// server's own name is resolved by the system, so give an IP address in
+// its URL to keep every lookup off local DNS.
+type dohResolver struct {
+	url    *url.URL
+	client *http.Client
+
+	mu    sync.Mutex
+	cache map[string]dohEntry
+}
+
+// dohEntry is a cached answer
+type dohEntry struct {
+	addrs   []netip.Addr
+	expires time.Time
+}
+
+// newDoHResolver checks the server URL, which must use https
+func newDoHResolver(rawURL string) (*dohResolver, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("--doh-url %q must be an https:// URL such as https://1.1.1.1/dns-query", rawURL)
+	}
+	return &dohResolver{
+		url:    u,
+		client: &http.Client{Timeout: 10 * time.Second},
+		cache:  map[string]dohEntry{},
+	}, nil
+}
+
+// lookup returns the IPv4 and IPv6 addresses of host, IPv4 first
+func (r *dohResolver) lookup(ctx context.Context, host string) ([]netip.Addr, error) {
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return []netip.Addr{ip}, nil
+	}
+	r.mu.Lock()
+	e, ok := r.cache[host]
+	r.mu.Unlock()
+	if ok && time.Now().Before(e.expires) {
+		return e.addrs, nil
+	}
+	var addrs []netip.Addr
+	ttl := uint32(300)
+	var firstErr error
+	for _, typ := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		got, t, err := r.query(ctx, host, typ)
+		if err != nil {
+			firstErr = cmp.Or(firstErr, err)
+			continue
+		}
+		addrs = append(addrs, got...)
+		ttl = min(ttl, t)
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("DoH lookup %s: %w", host, cmp.Or(firstErr, errors.New("no addresses")))
+	}
+	r.mu.Lock()
+	r.cache[host] = dohEntry{addrs: addrs, expires: time.Now().Add(time.Duration(ttl) * time.Second)}
+	r.mu.Unlock()
+	return addrs, nil
+}
+
+// query asks the DoH server for one record type and returns the addresses
+// found with the smallest TTL among them
+func (r *dohResolver) query(ctx context.Context, host string, typ dnsmessage.Type) ([]netip.Addr, uint32, error) {
+	name, err := dnsmessage.NewName(strings.TrimSuffix(host, ".") + ".")
+	if err != nil {
+		return nil, 0, err
+	}
+	// ID 0 keeps the GET cacheable, as RFC 8484 recommends
+	q := dnsmessage.Message{
+		Header:    dnsmessage.Header{RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: typ, Class: dnsmessage.ClassINET}},
+	}
+	wire, err := q.Pack()
+	if err != nil {
+		return nil, 0, err
+	}
+	u := *r.url
+	params := u.Query()
+	params.Set("dns", base64.RawURLEncoding.EncodeToString(wire))
+	u.RawQuery = params.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("DoH server answered %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return nil, 0, err
+	}
+	var m dnsmessage.Message
+	if err := m.Unpack(body); err != nil {
+		return nil, 0, fmt.Errorf("DoH answer: %w", err)
+	}
+	if m.RCode == dnsmessage.RCodeNameError {
+		return nil, 0, &net.DNSError{Err: "no such host", Name: host, Server: r.url.Host, IsNotFound: true}
+	}
+	if m.RCode != dnsmessage.RCodeSuccess {
+		return nil, 0, fmt.Errorf("DoH answer for %s: %s", typ, m.RCode)
+	}
+	var addrs []netip.Addr
+	ttl := uint32(300)
+	for _, a := range m.Answers {
+		switch b := a.Body.(type) {
+		case *dnsmessage.AResource:
+			addrs = append(addrs, netip.AddrFrom4(b.A))
+		case *dnsmessage.AAAAResource:
+			addrs = append(addrs, netip.AddrFrom16(b.AAAA))
+		default:
+			continue // CNAMEs come with the records they point to
+		}
+		ttl = min(ttl, a.Header.TTL)
+	}
+	return addrs, ttl, nil
+}
+
+// dialContext resolves addr's host over DoH and connects to the first
+// address that answers
+func (r *dohResolver) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := r.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var d net.Dialer
+	var errs []error
+	for _, ip := range addrs {
+		if (network == "tcp4" && !ip.Is4()) || (network == "tcp6" && !ip.Is6()) {
+			continue
+		}
+		conn, err := d.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("DoH lookup %s: no %s address", host, network)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// transport returns a copy of base that resolves names through r; base must
+// be an *http.Transport, anything else is returned unchanged
+func (r *dohResolver) transport(base http.RoundTripper) http.RoundTripper {
+	t, ok := base.(*http.Transport)
+	if !ok {
+		return base
+	}
+	t = t.Clone()
+	t.DialContext = r.dialContext
+	return t
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// newDoHServer answers A queries for the names in hosts with 127.0.0.1 and
+// everything else with NXDOMAIN; *queries counts the requests
+func newDoHServer(t *testing.T, hosts []string, queries *int) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*queries++
+		wire, err := base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		var q dnsmessage.Message
+		if err == nil {
+			err = q.Unpack(wire)
+		}
+		if err != nil || len(q.Questions) != 1 || r.Header.Get("Accept") != "application/dns-message" {
+			http.Error(w, "bad query", http.StatusBadRequest)
+			return
+		}
+		question := q.Questions[0]
+		resp := dnsmessage.Message{
+			Header:    dnsmessage.Header{Response: true, RCode: dnsmessage.RCodeNameError},
+			Questions: q.Questions,
+		}
+		for _, h := range hosts {
+			if question.Name.String() == h+"." {
+				resp.RCode = dnsmessage.RCodeSuccess
+				if question.Type == dnsmessage.TypeA {
+					resp.Answers = []dnsmessage.Resource{{
+						Header: dnsmessage.ResourceHeader{Name: question.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+						Body:   &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}},
+					}}
+				}
+			}
+		}
+		out, _ := resp.Pack()
+		w.Header().Set("Content-Type", "application/dns-message")
+		_, _ = w.Write(out)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// TestDoHResolver resolves names through the DoH server, caches answers and
+// dials the resolved address
+func TestDoHResolver(t *testing.T) {
+	var queries int
+	doh := newDoHServer(t, []string{"ynab.test"}, &queries)
+	r, err := newDoHResolver(doh.URL + "/dns-query")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.client = doh.Client()
+
+	addrs, err := r.lookup(t.Context(), "ynab.test")
+	if want := netip.MustParseAddr("127.0.0.1"); err != nil || len(addrs) != 1 || addrs[0] != want {
+		t.Fatalf("lookup = %v, %v; want [%s]", addrs, err, want)
+	}
+	if _, err := r.lookup(t.Context(), "ynab.test"); err != nil || queries != 2 {
+		t.Errorf("second lookup made %d queries in total, %v; want the cached 2 (A and AAAA)", queries, err)
+	}
+	if _, err := r.lookup(t.Context(), "missing.test"); err == nil || !strings.Contains(err.Error(), "no such host") {
+		t.Errorf("lookup of an unknown name error = %v; want no such host", err)
+	}
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Host)
+	}))
+	defer api.Close()
+	_, port, _ := strings.Cut(strings.TrimPrefix(api.URL, "http://"), ":")
+	client := &http.Client{Transport: r.transport(http.DefaultTransport)}
+	resp, err := client.Get("http://ynab.test:" + port + "/")
+	if err != nil {
+		t.Fatalf("GET through the DoH transport: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "ynab.test:"+port {
+		t.Errorf("server saw Host %q; want ynab.test:%s", body, port)
+	}
+}
+
+// TestNewDoHResolver insists on https
+func TestNewDoHResolver(t *testing.T) {
+	for _, bad := range []string{"http://1.1.1.1/dns-query", "1.1.1.1", "https://"} {
+		if _, err := newDoHResolver(bad); err == nil {
+			t.Errorf("newDoHResolver(%q) succeeded; want an error", bad)
+		}
+	}
+	args := []string{"backup", "--token", "tok", "--output", t.TempDir(), "--doh-url", "http://1.1.1.1/dns-query"}
+	if code := runCLI(args, io.Discard, io.Discard); code != 2 {
+		t.Errorf("backup with a plain http --doh-url exit code = %d; want 2", code)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+
+	"filippo.io/age"
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// drStep is one stage of a disaster-recovery rehearsal
+type drStep struct {
+	Name   string
+	Detail string
+	Err    error
+}
+
+// drRehearse restores snap from store into scratch the way a user would after
+// losing their machine: copy it out, decrypt it when needed, compare it with
+// the hash pinned in m at backup time and check that the budget inside is
+// complete. It stops at the first failing step.
+func drRehearse(ctx context.Context, store ynabvault.Store, snap snapshotInfo, ids []age.Identity, m *ynabvault.Manifest, scratch string) []drStep {
+	var steps []drStep
+	data, err := store.Get(ctx, snap.File)
+	if err == nil {
+		err = ynabvault.WriteFile(filepath.Join(scratch, snap.File), data)
+	}
+	steps = append(steps, drStep{Name: "copy", Detail: fmt.Sprintf("%d bytes", len(data)), Err: err})
+	if err != nil {
+		return steps
+	}
+
+	// Compressed snapshots are unpacked in the same step
+	data, err = ynabvault.OpenStored(data, ids)
+	switch {
+	case err != nil:
+		return append(steps, drStep{Name: "decrypt", Err: err})
+	case snap.Encrypted:
+		steps = append(steps, drStep{Name: "decrypt"})
+	default:
+		steps = append(steps, drStep{Name: "decrypt", Detail: "skipped, not encrypted"})
+	}
+
+	switch err := m.Check(snap.File, data); {
+	case errors.Is(err, ynabvault.ErrNotPinned):
+		steps = append(steps, drStep{Name: "hash", Detail: "skipped, no pinned hash"})
+	case err != nil:
+		return append(steps, drStep{Name: "hash", Err: err})
+	default:
+		steps = append(steps, drStep{Name: "hash", Detail: "matches " + m.Files[snap.File].SHA256[:12]})
+	}
+
+	detail, err := verifyBudget(data, snap.ID)
+	return append(steps, drStep{Name: "verify", Detail: detail, Err: err})
+}
+
+// verifyBudget checks that data is a budget export for the given (sanitized)
+// budget ID, shaped like YNAB's, and summarizes the entities it holds
+func verifyBudget(data []byte, id string) (string, error) {
+	env, err := ynabvault.DecodeEnvelope(data)
+	if err != nil {
+		return "", err
+	}
+	if env.Data.Budget == nil {
+		return "", fmt.Errorf("%w: no budget in snapshot", ynabvault.ErrCorrupt)
+	}
+	got, _ := env.Data.Budget["id"].(string)
+	if ynabvault.SanitizeFileName(got) != id {
+		return "", fmt.Errorf("%w: snapshot holds budget %q, file name says %q", ynabvault.ErrCorrupt, got, id)
+	}
+	if err := checkBudgetShape(env.Data.Budget); err != nil {
+		return "", err
+	}
+	var keys []string
+	for k, v := range env.Data.Budget {
+		if _, ok := v.([]interface{}); ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	detail := fmt.Sprintf("budget %s, server knowledge %d", got, env.Data.ServerKnowledge)
+	for _, k := range keys {
+		detail += fmt.Sprintf(", %d %s", len(env.Data.Budget[k].([]interface{})), k)
+	}
+	return detail, nil
+}
+
+// printRehearsal writes the steps of a rehearsal and reports whether all passed
+func printRehearsal(w io.Writer, snap snapshotInfo, steps []drStep) bool {
+	fmt.Fprintf(w, "snapshot\t%s\n", snap.File)
+	ok := true
+	for _, s := range steps {
+		status := "ok"
+		if s.Err != nil {
+			status, ok = "FAIL: "+s.Err.Error(), false
+		}
+		if s.Detail != "" {
+			status += " (" + s.Detail + ")"
+		}
+		fmt.Fprintf(w, "%s\t%s\n", s.Name, status)
+	}
+	if ok {
+		fmt.Fprintln(w, "result\tPASS")
+	} else {
+		fmt.Fprintln(w, "result\tFAIL")
+	}
+	return ok
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// TestVerifyBudget accepts complete budgets and rejects mismatched or empty ones
+func TestVerifyBudget(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+		detail  string
+	}{
+		{"ok", `{"data":{"budget":{"id":"b1","accounts":[{"id":"a"}],"months":[],"payees":[],"transactions":[]},"server_knowledge":3}}`, false, "budget b1, server knowledge 3, 1 accounts, 0 months, 0 payees, 0 transactions"},
+		{"wrong budget", `{"data":{"budget":{"id":"b2"}}}`, true, ""},
+		{"missing lists", `{"data":{"budget":{"id":"b1","accounts":[]}}}`, true, ""},
+		{"no budget", `{"data":{}}`, true, ""},
+		{"not json", `{`, true, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			detail, err := verifyBudget([]byte(tc.data), "b1")
+			if tc.wantErr {
+				if !errors.Is(err, ynabvault.ErrCorrupt) {
+					t.Errorf("err = %v; want ErrCorrupt", err)
+				}
+				return
+			}
+			if err != nil || detail != tc.detail {
+				t.Errorf("verifyBudget = %q, %v; want %q", detail, err, tc.detail)
+			}
+		})
+	}
+}
+
+// TestDrTest rehearses plain and encrypted vaults through the CLI
+func TestDrTest(t *testing.T) {
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "key.txt")
+	if err := os.WriteFile(keyFile, []byte(id.String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	budget := []byte(`{"data":{"budget":{"id":"b1","accounts":[],"months":[],"transactions":[]},"server_knowledge":1}}`)
+	enc, err := ynabvault.Encrypt(budget, []age.Recipient{id.Recipient()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		file     string
+		data     []byte
+		args     []string
+		wantCode int
+		wantOut  string
+	}{
+		{"plain", "Budget_b1_20250101T000000Z.json", budget, nil, 0, "PASS"},
+		{"encrypted", "Budget_b1_20250101T000000Z.json.age", enc, []string{"--identity", keyFile}, 0, "PASS"},
+		{"encrypted without identity", "Budget_b1_20250101T000000Z.json.age", enc, nil, exitCorrupt, "pass --identity"},
+		{"corrupt", "Budget_b1_20250101T000000Z.json", []byte("{"), nil, exitCorrupt, "FAIL"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, tc.file), tc.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			var stdout bytes.Buffer
+			args := append([]string{"dr-test", "--output", dir}, tc.args...)
+			if code := runCLI(args, &stdout, io.Discard); code != tc.wantCode {
+				t.Errorf("exit code = %d; want %d\n%s", code, tc.wantCode, stdout.String())
+			}
+			if !strings.Contains(stdout.String(), tc.wantOut) {
+				t.Errorf("output lacks %q:\n%s", tc.wantOut, stdout.String())
+			}
+		})
+	}
+
+	if code := runCLI([]string{"dr-test", "--output", t.TempDir()}, io.Discard, io.Discard); code != exitCorrupt {
+		t.Errorf("dr-test on an empty vault exit code = %d; want %d", code, exitCorrupt)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// Exit codes used by the CLI; 2 is left to the flag package for usage errors
+const (
+	exitFailure      = 1
+	exitUnauthorized = 3
+	exitRateLimited  = 4
+	exitNotFound     = 5
+	exitCorrupt      = 6
+	exitBackend      = 7
+	exitLocked       = 8
+	exitFrozen       = 9
+)
+
+// exitCode maps an error to the process exit status by its kind
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, ynabvault.ErrUnauthorized):
+		return exitUnauthorized
+	case errors.Is(err, ynabvault.ErrRateLimited):
+		return exitRateLimited
+	case errors.Is(err, ynabvault.ErrNotFound):
+		return exitNotFound
+	case errors.Is(err, ynabvault.ErrCorrupt):
+		return exitCorrupt
+	case errors.Is(err, ynabvault.ErrBackend):
+		return exitBackend
+	case errors.Is(err, ynabvault.ErrLocked):
+		return exitLocked
+	case errors.Is(err, ynabvault.ErrFrozen):
+		return exitFrozen
+	}
+	return exitFailure
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// TestExitCode checks the error-kind to exit-status mapping
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{errors.New("boom"), exitFailure},
+		{fmt.Errorf("fetch budgets: %w", &ynabvault.StatusError{StatusCode: http.StatusUnauthorized}), exitUnauthorized},
+		{fmt.Errorf("fetch budgets: %w", &ynabvault.StatusError{StatusCode: http.StatusTooManyRequests}), exitRateLimited},
+		{fmt.Errorf("fetch budgets: %w", &ynabvault.StatusError{StatusCode: http.StatusInternalServerError}), exitFailure},
+		{fmt.Errorf("x: %w", ynabvault.ErrNotFound), exitNotFound},
+		{fmt.Errorf("x: %w", ynabvault.ErrCorrupt), exitCorrupt},
+		{fmt.Errorf("x: %w", ynabvault.ErrBackend), exitBackend},
+		{fmt.Errorf("x: %w", ynabvault.ErrLocked), exitLocked},
+		{fmt.Errorf("x: %w", ynabvault.ErrFrozen), exitFrozen},
+	}
+	for _, tc := range tests {
+		if got := exitCode(tc.err); got != tc.want {
+			t.Errorf("exitCode(%v) = %d; want %d", tc.err, got, tc.want)
+		}
+	}
+}
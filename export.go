@@ -0,0 +1,304 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// exportSnapshot is a snapshot loaded for export
+type exportSnapshot struct {
+	Info   snapshotInfo
+	Budget map[string]interface{}
+}
+
+// exportTable describes how one budget entity list is flattened into rows
+type exportTable struct {
+	name    string
+	source  string   // key of the list in the budget
+	columns []string // "field TYPE", read from the entity's field of that name
+	key     string   // primary key columns after snapshot_id
+}
+
+// exportTables are the normalized tables the sqlite and pyproject formats
+// write; amounts are integer milliunits as in the API
+var exportTables = []exportTable{
+	{"accounts", "accounts", []string{"id TEXT", "name TEXT", "type TEXT", "on_budget INTEGER", "closed INTEGER", "note TEXT",
+		"balance INTEGER", "cleared_balance INTEGER", "uncleared_balance INTEGER", "transfer_payee_id TEXT"}, "id"},
+	{"category_groups", "category_groups", []string{"id TEXT", "name TEXT", "hidden INTEGER"}, "id"},
+	{"categories", "categories", []string{"id TEXT", "category_group_id TEXT", "name TEXT", "hidden INTEGER", "note TEXT",
+		"budgeted INTEGER", "activity INTEGER", "balance INTEGER", "goal_type TEXT", "goal_target INTEGER"}, "id"},
+	{"payees", "payees", []string{"id TEXT", "name TEXT", "transfer_account_id TEXT"}, "id"},
+	{"transactions", "transactions", []string{"id TEXT", "date TEXT", "amount INTEGER", "memo TEXT", "cleared TEXT",
+		"approved INTEGER", "flag_color TEXT", "account_id TEXT", "payee_id TEXT", "category_id TEXT",
+		"transfer_account_id TEXT", "transfer_transaction_id TEXT", "import_id TEXT"}, "id"},
+	{"subtransactions", "subtransactions", []string{"id TEXT", "transaction_id TEXT", "amount INTEGER", "memo TEXT",
+		"payee_id TEXT", "category_id TEXT", "transfer_account_id TEXT"}, "id"},
+	{"months", "months", []string{"month TEXT", "note TEXT", "income INTEGER", "budgeted INTEGER", "activity INTEGER",
+		"to_be_budgeted INTEGER", "age_of_money INTEGER"}, "month"},
+}
+
+// selectExportSnapshots picks what export writes: every snapshot when all is
+// set, otherwise the newest of each budget; a non-empty budget (name or ID)
+// narrows the choice to that budget
+func selectExportSnapshots(snaps []snapshotInfo, budget string, all bool) []snapshotInfo {
+	var out []snapshotInfo
+	for i, s := range snaps {
+		if budget != "" && s.ID != budget && s.Name != ynabvault.SanitizeFileName(budget) {
+			continue
+		}
+		// snaps is sorted by budget, then time, so the newest comes last
+		newest := i == len(snaps)-1 || snaps[i+1].ID != s.ID || snaps[i+1].Name != s.Name
+		if all || newest {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// loadExportSnapshots reads the named snapshots, in store or as local paths
+func loadExportSnapshots(ctx context.Context, store ynabvault.Store, names []string, ids []age.Identity) ([]exportSnapshot, error) {
+	var out []exportSnapshot
+	var listed map[string]snapshotInfo // the vault's snapshots, for template names
+	for _, name := range names {
+		info, ok := parseSnapshotName(name)
+		if !ok || !info.Nested {
+			info, ok = parseSnapshotName(path.Base(name))
+		}
+		if !ok {
+			if listed == nil {
+				snaps, err := listSnapshots(ctx, store)
+				if err != nil {
+					return nil, err
+				}
+				listed = map[string]snapshotInfo{}
+				for _, s := range snaps {
+					listed[s.File] = s
+				}
+			}
+			info, ok = listed[name]
+		}
+		if !ok {
+			return nil, fmt.Errorf("%s is not a snapshot file name", name)
+		}
+		info.File = name
+		budget, err := loadSnapshotBudget(ctx, store, name, ids)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, exportSnapshot{Info: info, Budget: budget})
+	}
+	return out, nil
+}
+
+// exportValue converts a decoded JSON field to a flat value: integers stay
+// exact, booleans become 0 or 1 and nested values are kept as JSON text
+func exportValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case bool:
+		if v {
+			return int64(1)
+		}
+		return int64(0)
+	case map[string]interface{}, []interface{}:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+	return v
+}
+
+// exportFiles writes what render makes of each snapshot into dir, named
+// after the snapshot file with ext, and returns the file names written
+func exportFiles(dir, ext string, snaps []exportSnapshot, render func(exportSnapshot) ([]byte, error)) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	var written []string
+	for _, s := range snaps {
+		name := exportBaseName(s) + ext
+		data, err := render(s)
+		if err != nil {
+			return written, fmt.Errorf("export %s: %w", s.Info.File, err)
+		}
+		if err := ynabvault.WriteFile(filepath.Join(dir, name), data); err != nil {
+			return written, fmt.Errorf("export %s: %w", s.Info.File, err)
+		}
+		written = append(written, name)
+	}
+	return written, nil
+}
+
+// exportAccountFiles writes what render makes of each account of each
+// snapshot into a directory per snapshot under dir, named after the
+// snapshot file, and returns the file names written
+func exportAccountFiles(dir, ext string, snaps []exportSnapshot, render func(s exportSnapshot, account map[string]interface{}) ([]byte, error)) ([]string, error) {
+	var written []string
+	for _, s := range snaps {
+		base := exportBaseName(s)
+		if err := os.MkdirAll(filepath.Join(dir, base), 0755); err != nil {
+			return written, err
+		}
+		accounts := entitiesByID(s.Budget["accounts"])
+		ids := sortedKeys(accounts)
+		slices.SortStableFunc(ids, func(a, b string) int {
+			return cmp.Compare(stringField(accounts[a], "name"), stringField(accounts[b], "name"))
+		})
+		taken := map[string]bool{}
+		for _, id := range ids {
+			file := cmp.Or(ynabvault.SanitizeFileName(stringField(accounts[id], "name")), "account")
+			name := file
+			for i := 2; taken[strings.ToLower(name)]; i++ {
+				name = fmt.Sprintf("%s_%d", file, i)
+			}
+			taken[strings.ToLower(name)] = true
+			name = path.Join(base, name+ext)
+			data, err := render(s, accounts[id])
+			if err != nil {
+				return written, fmt.Errorf("export %s: %w", s.Info.File, err)
+			}
+			if err := ynabvault.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), data); err != nil {
+				return written, fmt.Errorf("export %s: %w", s.Info.File, err)
+			}
+			written = append(written, name)
+		}
+	}
+	return written, nil
+}
+
+// exportBaseName is the snapshot's file name without its extensions, which
+// export names its files after
+func exportBaseName(s exportSnapshot) string {
+	return strings.TrimSuffix(strings.TrimSuffix(path.Base(s.Info.File), ".age"), ".json")
+}
+
+// registerEntry is a transaction of an account with its split lines, or
+// itself as the only line when it is not split
+type registerEntry struct {
+	Transaction map[string]interface{}
+	Lines       []map[string]interface{}
+}
+
+// split reports whether the transaction is split into lines of its own
+func (e registerEntry) split() bool {
+	return len(e.Lines) != 1 || stringField(e.Lines[0], "id") != stringField(e.Transaction, "id")
+}
+
+// accountRegister lists an account's transactions by date
+func accountRegister(budget map[string]interface{}, accountID string) []registerEntry {
+	subs := map[string][]map[string]interface{}{}
+	splits := entitiesByID(budget["subtransactions"])
+	for _, id := range sortedKeys(splits) {
+		parent := stringField(splits[id], "transaction_id")
+		subs[parent] = append(subs[parent], splits[id])
+	}
+	txns := entitiesByID(budget["transactions"])
+	ids := sortedKeys(txns)
+	slices.SortStableFunc(ids, func(a, b string) int {
+		return cmp.Compare(stringField(txns[a], "date"), stringField(txns[b], "date"))
+	})
+	var out []registerEntry
+	for _, id := range ids {
+		if stringField(txns[id], "account_id") != accountID {
+			continue
+		}
+		lines := subs[id]
+		if len(lines) == 0 {
+			lines = []map[string]interface{}{txns[id]}
+		}
+		out = append(out, registerEntry{txns[id], lines})
+	}
+	return out
+}
+
+// monthlyActivity adds up a budget's on-budget transactions per month:
+// income by payee ID for lines into the inflow category, and spending by
+// category ID for the rest, "" for uncategorized lines. Transfers between
+// budget accounts are neither.
+func monthlyActivity(budget map[string]interface{}) (income, spending map[string]map[string]int64) {
+	accounts := entitiesByID(budget["accounts"])
+	categories := entitiesByID(budget["categories"])
+	groups := entitiesByID(budget["category_groups"])
+	income, spending = map[string]map[string]int64{}, map[string]map[string]int64{}
+	for _, id := range sortedKeys(accounts) {
+		if accounts[id]["on_budget"] == false {
+			continue
+		}
+		for _, e := range accountRegister(budget, id) {
+			t := e.Transaction
+			month := stringField(t, "date")
+			if len(month) < len("2006-01") {
+				continue
+			}
+			month = month[:len("2006-01")]
+			if income[month] == nil {
+				income[month], spending[month] = map[string]int64{}, map[string]int64{}
+			}
+			for _, line := range e.Lines {
+				category := stringField(line, "category_id")
+				if stringField(line, "transfer_account_id") != "" && category == "" {
+					continue
+				}
+				if categoryGroup(categories, groups, category) == internalCategoryGroup {
+					income[month][cmp.Or(stringField(line, "payee_id"), stringField(t, "payee_id"))] += milliunits(line["amount"])
+					continue
+				}
+				spending[month][category] -= milliunits(line["amount"])
+			}
+		}
+	}
+	return income, spending
+}
+
+// fixedAmount renders milliunits exactly, with the given decimal digits or
+// all three when that would drop a non-zero digit. Every amount written for
+// people or other tools goes through it, so they all agree.
+func fixedAmount(n int64, digits int) string {
+	digits = min(max(digits, 0), 3)
+	sign := ""
+	if n < 0 {
+		sign, n = "-", -n
+	}
+	frac := fmt.Sprintf("%03d", n%1000)
+	if strings.TrimRight(frac[digits:], "0") != "" {
+		digits = 3
+	}
+	if digits == 0 {
+		return fmt.Sprintf("%s%d", sign, n/1000)
+	}
+	return fmt.Sprintf("%s%d.%s", sign, n/1000, frac[:digits])
+}
+
+// oneLine puts s on one line with single spaces, for formats that end a
+// field at a line break, or like Ledger at two spaces
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// monthsByKey indexes the budget's months, which have no id field
+func monthsByKey(list interface{}) map[string]map[string]interface{} {
+	out := map[string]map[string]interface{}{}
+	items, _ := list.([]interface{})
+	for _, item := range items {
+		if obj, ok := item.(map[string]interface{}); ok && obj["deleted"] != true {
+			if month, ok := obj["month"].(string); ok {
+				out[month] = obj
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// beancountNameRun matches what may not appear in a Beancount account
+	// name component
+	beancountNameRun = regexp.MustCompile(`[^A-Za-z0-9]+`)
+	// beancountCurrency matches a Beancount commodity such as EUR
+	beancountCurrency = regexp.MustCompile(`^[A-Z][A-Z0-9'._-]{0,22}[A-Z0-9]$`)
+	// beancountString escapes text inside a Beancount string
+	beancountString = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\r\n", " ", "\n", " ")
+)
+
+// exportBeancount writes one Beancount ledger per snapshot into dir, named
+// after the snapshot file, and returns the file names written
+func exportBeancount(dir string, snaps []exportSnapshot, r rollups) ([]string, error) {
+	return exportFiles(dir, ".beancount", snaps, func(s exportSnapshot) ([]byte, error) {
+		return beancountLedger(s, r), nil
+	})
+}
+
+// beancountLedger renders a snapshot's accounts and transactions as a
+// Beancount ledger: an open directive per account, a transaction per YNAB
+// transaction with one posting per split line, and a balance assertion per
+// account from the balance YNAB reports
+func beancountLedger(s exportSnapshot, r rollups) []byte {
+	j := buildJournal(s, r, &journalNames{component: beancountComponent})
+	currency := j.Currency.ISOCode
+	if !beancountCurrency.MatchString(currency) {
+		currency = "USD"
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "; Exported by ynabvault from %s\n", s.Info.File)
+	fmt.Fprintf(&out, "option \"title\" %s\n", beancountQuote(j.Title))
+	fmt.Fprintf(&out, "option \"operating_currency\" %s\n\n", beancountQuote(currency))
+	for _, name := range j.Accounts {
+		fmt.Fprintf(&out, "%s open %s %s\n", j.Open, name, currency)
+	}
+	out.WriteString("\n")
+	for _, t := range j.Transactions {
+		flag := "*"
+		if t.Uncleared {
+			flag = "!"
+		}
+		fmt.Fprintf(&out, "%s %s", t.Date, flag)
+		if t.Payee != "" {
+			fmt.Fprintf(&out, " %s", beancountQuote(t.Payee))
+		}
+		fmt.Fprintf(&out, " %s\n", beancountQuote(t.Memo))
+		fmt.Fprintf(&out, "  ynab_id: %s\n", beancountQuote(t.ID))
+		for _, p := range t.Postings {
+			fmt.Fprintf(&out, "  %s  %s %s\n", p.Account, fixedAmount(p.Amount, 2), currency)
+		}
+		out.WriteString("\n")
+	}
+	for _, b := range j.Balances {
+		fmt.Fprintf(&out, "%s balance %s  %s %s\n", j.Close, b.Account, fixedAmount(b.Amount, 2), currency)
+	}
+	return out.Bytes()
+}
+
+// beancountComponent turns a YNAB name into a Beancount account name
+// component: ASCII letters and digits joined by dashes, starting with a
+// capital
+func beancountComponent(s string) string {
+	s = strings.Trim(beancountNameRun.ReplaceAllString(s, "-"), "-")
+	if s == "" {
+		return "Unnamed"
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// beancountQuote quotes s as a Beancount string
+func beancountQuote(s string) string {
+	return `"` + beancountString.Replace(s) + `"`
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// TestBeancountLedger maps accounts and categories to Beancount accounts,
+// expands splits, writes each transfer once and asserts the balances
+func TestBeancountLedger(t *testing.T) {
+	env, err := ynabvault.DecodeEnvelope([]byte(`{"data":{"budget":{"name":"Home \"Budget\"",
+		"currency_format":{"iso_code":"EUR"},
+		"accounts":[
+			{"id":"a1","name":"Checking","type":"checking","balance":870000},
+			{"id":"a2","name":"Visa Card","type":"creditCard","balance":-30000},
+			{"id":"a3","name":"checking","type":"savings","balance":100000}],
+		"payees":[{"id":"p1","name":"Grocer"},{"id":"p2","name":"Employer"},{"id":"p3","name":"Transfer : Savings"}],
+		"category_groups":[{"id":"g1","name":"Everyday"},{"id":"g2","name":"Internal Master Category"}],
+		"categories":[
+			{"id":"c1","category_group_id":"g1","name":"Food & Drink"},
+			{"id":"c2","category_group_id":"g1","name":"Health"},
+			{"id":"c3","category_group_id":"g2","name":"Inflow: Ready to Assign"}],
+		"transactions":[
+			{"id":"t1","date":"2025-01-01","account_id":"a1","payee_id":"p2","category_id":"c3","amount":1000000,"cleared":"reconciled"},
+			{"id":"t2","date":"2025-01-05","account_id":"a2","payee_id":"p1","amount":-30000,"memo":"Weekly \"shop\"","cleared":"uncleared"},
+			{"id":"t4","date":"2025-01-06","account_id":"a3","payee_id":"p3","transfer_account_id":"a1","transfer_transaction_id":"t3","amount":100000,"cleared":"cleared"},
+			{"id":"t3","date":"2025-01-06","account_id":"a1","payee_id":"p3","transfer_account_id":"a3","transfer_transaction_id":"t4","amount":-100000,"cleared":"cleared"},
+			{"id":"t5","date":"2025-01-07","account_id":"a1","amount":-30000,"cleared":"cleared"},
+			{"id":"t6","deleted":true}],
+		"subtransactions":[
+			{"id":"s1","transaction_id":"t2","category_id":"c1","amount":-20000},
+			{"id":"s2","transaction_id":"t2","category_id":"c2","amount":-10000}]}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap := exportSnapshot{
+		Info:   snapshotInfo{Name: "Home", File: "Home_b1_20250103T000000Z.json", Time: time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC)},
+		Budget: env.Data.Budget,
+	}
+	want := `; Exported by ynabvault from Home_b1_20250103T000000Z.json
+option "title" "Home \"Budget\""
+option "operating_currency" "EUR"
+
+2025-01-01 open Assets:Checking EUR
+2025-01-01 open Assets:Checking-2 EUR
+2025-01-01 open Expenses:Everyday:Food-Drink EUR
+2025-01-01 open Expenses:Everyday:Health EUR
+2025-01-01 open Expenses:Uncategorized EUR
+2025-01-01 open Income:Inflow-Ready-to-Assign EUR
+2025-01-01 open Liabilities:Visa-Card EUR
+
+2025-01-01 * "Employer" ""
+  ynab_id: "t1"
+  Assets:Checking  1000.00 EUR
+  Income:Inflow-Ready-to-Assign  -1000.00 EUR
+
+2025-01-05 ! "Grocer" "Weekly \"shop\""
+  ynab_id: "t2"
+  Liabilities:Visa-Card  -30.00 EUR
+  Expenses:Everyday:Food-Drink  20.00 EUR
+  Expenses:Everyday:Health  10.00 EUR
+
+2025-01-06 * "Transfer : Savings" ""
+  ynab_id: "t3"
+  Assets:Checking  -100.00 EUR
+  Assets:Checking-2  100.00 EUR
+
+2025-01-07 * ""
+  ynab_id: "t5"
+  Assets:Checking  -30.00 EUR
+  Expenses:Uncategorized  30.00 EUR
+
+2025-01-08 balance Assets:Checking  870.00 EUR
+2025-01-08 balance Liabilities:Visa-Card  -30.00 EUR
+2025-01-08 balance Assets:Checking-2  100.00 EUR
+`
+	if got := string(beancountLedger(snap, nil)); got != want {
+		t.Errorf("ledger =\n%s\nwant\n%s", got, want)
+	}
+}
+
+// TestExportBeancountCommand writes one ledger per budget's newest snapshot
+func TestExportBeancountCommand(t *testing.T) {
+	dir := t.TempDir()
+	content := `{"data":{"budget":{"id":"b1","accounts":[{"id":"a1","name":"Cash","type":"cash","balance":1000}],
+		"transactions":[{"id":"t1","date":"2025-01-02","account_id":"a1","amount":1000}]}}}`
+	if err := os.WriteFile(filepath.Join(dir, "Home_b1_20250101T000000Z.json"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "ledgers")
+	var stdout, stderr strings.Builder
+	if code := runCLI([]string{"export", "--output", dir, "--format", "beancount", "--out", out}, &stdout, &stderr); code != 0 {
+		t.Fatalf("export exit code = %d; stderr: %s", code, stderr.String())
+	}
+	file := filepath.Join(out, "Home_b1_20250101T000000Z.beancount")
+	if strings.TrimSpace(stdout.String()) != file {
+		t.Errorf("stdout = %q; want %q", stdout.String(), file)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`option "operating_currency" "USD"`, "2025-01-01 open Assets:Cash USD", "2025-01-03 balance Assets:Cash  1.00 USD"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("ledger lacks %q:\n%s", want, data)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"slices"
+)
+
+// csvHeader names the columns of a transactions CSV
+var csvHeader = []string{"Date", "Account", "Payee", "Category", "Memo", "Amount", "Cleared"}
+
+// exportCSV writes one transactions CSV per snapshot into dir, named after
+// the snapshot file, and returns the file names written. With rollups, a
+// Rollup column follows the category.
+func exportCSV(dir string, snaps []exportSnapshot, r rollups) ([]string, error) {
+	header := csvHeader
+	if len(r) > 0 {
+		header = slices.Insert(slices.Clone(csvHeader), 4, "Rollup")
+	}
+	return exportFiles(dir, ".csv", snaps, func(s exportSnapshot) ([]byte, error) {
+		var buf bytes.Buffer
+		err := csv.NewWriter(&buf).WriteAll(append([][]string{header}, csvRows(s.Budget, r)...))
+		return buf.Bytes(), err
+	})
+}
+
+// csvRows lists a budget's transactions by date, one row per split line for
+// split transactions; split lines without their own payee use the parent's.
+// With rollups, each row has the bucket of its category group after the
+// category.
+func csvRows(budget map[string]interface{}, r rollups) [][]string {
+	accounts := entitiesByID(budget["accounts"])
+	payees := entitiesByID(budget["payees"])
+	categories := entitiesByID(budget["categories"])
+	groups := entitiesByID(budget["category_groups"])
+	subs := map[string][]map[string]interface{}{}
+	splits := entitiesByID(budget["subtransactions"])
+	for _, id := range sortedKeys(splits) {
+		st := splits[id]
+		parent := stringField(st, "transaction_id")
+		subs[parent] = append(subs[parent], st)
+	}
+
+	txns := entitiesByID(budget["transactions"])
+	ids := sortedKeys(txns)
+	slices.SortStableFunc(ids, func(a, b string) int {
+		return cmp.Compare(stringField(txns[a], "date"), stringField(txns[b], "date"))
+	})
+	var rows [][]string
+	for _, id := range ids {
+		t := txns[id]
+		lines := subs[id]
+		if len(lines) == 0 {
+			lines = []map[string]interface{}{t}
+		}
+		for _, line := range lines {
+			payee := cmp.Or(stringField(line, "payee_id"), stringField(t, "payee_id"))
+			row := []string{
+				stringField(t, "date"),
+				stringField(accounts[stringField(t, "account_id")], "name"),
+				stringField(payees[payee], "name"),
+				stringField(categories[stringField(line, "category_id")], "name"),
+				cmp.Or(stringField(line, "memo"), stringField(t, "memo")),
+				csvAmount(line["amount"]),
+				stringField(t, "cleared"),
+			}
+			if len(r) > 0 {
+				row = slices.Insert(row, 4, r.of(categoryGroup(categories, groups, stringField(line, "category_id"))))
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// csvAmount converts milliunits to a decimal amount, keeping a third
+// decimal only for currencies that use it
+func csvAmount(v interface{}) string {
+	num, _ := v.(json.Number)
+	n, err := num.Int64()
+	if err != nil {
+		return ""
+	}
+	return fixedAmount(n, 2)
+}
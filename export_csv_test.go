@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// TestCSVRows lists transactions by date and expands splits
+func TestCSVRows(t *testing.T) {
+	env, err := ynabvault.DecodeEnvelope([]byte(`{"data":{"budget":{
+		"accounts":[{"id":"a1","name":"Checking"}],
+		"payees":[{"id":"p1","name":"Grocer"},{"id":"p2","name":"Pharmacy"}],
+		"categories":[{"id":"c1","name":"Food"},{"id":"c2","name":"Health"}],
+		"transactions":[
+			{"id":"t2","date":"2025-01-05","account_id":"a1","payee_id":"p1","amount":-30000,"memo":"Shop","cleared":"uncleared"},
+			{"id":"t1","date":"2025-01-02","account_id":"a1","payee_id":"p1","category_id":"c1","amount":-12500,"memo":"Groceries","cleared":"cleared"},
+			{"id":"t3","deleted":true}],
+		"subtransactions":[
+			{"id":"s1","transaction_id":"t2","category_id":"c1","amount":-20000},
+			{"id":"s2","transaction_id":"t2","payee_id":"p2","category_id":"c2","amount":-10000,"memo":"Vitamins"}]}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"2025-01-02", "Checking", "Grocer", "Food", "Groceries", "-12.50", "cleared"},
+		{"2025-01-05", "Checking", "Grocer", "Food", "Shop", "-20.00", "uncleared"},
+		{"2025-01-05", "Checking", "Pharmacy", "Health", "Vitamins", "-10.00", "uncleared"},
+	}
+	if got := csvRows(env.Data.Budget, nil); !reflect.DeepEqual(got, want) {
+		t.Errorf("csvRows =\n%v\nwant\n%v", got, want)
+	}
+	for n, want := range map[string]string{"-12500": "-12.50", "5": "0.005", "1234567": "1234.567", "0": "0.00"} {
+		if got := csvAmount(json.Number(n)); got != want {
+			t.Errorf("csvAmount(%s) = %q; want %q", n, got, want)
+		}
+	}
+}
+
+// TestExportCSVCommand writes one CSV per budget's newest snapshot
+func TestExportCSVCommand(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"Home_b1_20250101T000000Z.json": `{"data":{"budget":{"id":"b1","transactions":[]}}}`,
+		"Home_b1_20250102T000000Z.json": `{"data":{"budget":{"id":"b1","transactions":[{"id":"t1","date":"2025-01-02","amount":1000,"memo":"a, \"quoted\" memo"}]}}}`,
+		"Work_b2_20250101T000000Z.json": `{"data":{"budget":{"id":"b2"}}}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := filepath.Join(t.TempDir(), "csv")
+	var stdout, stderr strings.Builder
+	if code := runCLI([]string{"export", "--output", dir, "--format", "csv", "--out", out}, &stdout, &stderr); code != 0 {
+		t.Fatalf("export exit code = %d; stderr: %s", code, stderr.String())
+	}
+	entries, err := os.ReadDir(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if want := []string{"Home_b1_20250102T000000Z.csv", "Work_b2_20250101T000000Z.csv"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("exported files = %v; want %v", names, want)
+	}
+	data, err := os.ReadFile(filepath.Join(out, "Home_b1_20250102T000000Z.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Date,Account,Payee,Category,Memo,Amount,Cleared\n2025-01-02,,,,\"a, \"\"quoted\"\" memo\",1.00,\n"
+	if string(data) != want {
+		t.Errorf("CSV =\n%s\nwant\n%s", data, want)
+	}
+
+	if code := runCLI([]string{"export", "--output", dir, "--format", "xml", "--out", out}, &stdout, &stderr); code != 2 {
+		t.Errorf("unknown format exit code = %d; want 2", code)
+	}
+}
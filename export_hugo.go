@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+	"gopkg.in/yaml.v3"
+)
+
+// dataAmount is milliunits written as a number in currency units, in JSON
+// and YAML alike
+type dataAmount int64
+
+func (a dataAmount) MarshalJSON() ([]byte, error) {
+	return []byte(fixedAmount(int64(a), 2)), nil
+}
+
+func (a dataAmount) MarshalYAML() (interface{}, error) {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!float", Value: fixedAmount(int64(a), 2)}, nil
+}
+
+// dataBudget is the budget data file: the snapshot, the currency and the
+// totals of the accounts
+type dataBudget struct {
+	Name        string       `json:"name" yaml:"name"`
+	ID          string       `json:"id" yaml:"id"`
+	Snapshot    string       `json:"snapshot" yaml:"snapshot"`
+	Currency    dataCurrency `json:"currency" yaml:"currency"`
+	NetWorth    dataAmount   `json:"net_worth" yaml:"net_worth"`
+	Assets      dataAmount   `json:"assets" yaml:"assets"`
+	Liabilities dataAmount   `json:"liabilities" yaml:"liabilities"`
+}
+
+// dataCurrency is how the budget writes amounts
+type dataCurrency struct {
+	ISOCode       string `json:"iso_code" yaml:"iso_code"`
+	Symbol        string `json:"symbol" yaml:"symbol"`
+	SymbolFirst   bool   `json:"symbol_first" yaml:"symbol_first"`
+	DecimalDigits int    `json:"decimal_digits" yaml:"decimal_digits"`
+}
+
+// dataAccount is an entry of the accounts data file
+type dataAccount struct {
+	Name           string     `json:"name" yaml:"name"`
+	Type           string     `json:"type" yaml:"type"`
+	OnBudget       bool       `json:"on_budget" yaml:"on_budget"`
+	Closed         bool       `json:"closed" yaml:"closed"`
+	Balance        dataAmount `json:"balance" yaml:"balance"`
+	ClearedBalance dataAmount `json:"cleared_balance" yaml:"cleared_balance"`
+}
+
+// dataGroup is an entry of the categories data file
+type dataGroup struct {
+	Name       string         `json:"name" yaml:"name"`
+	Rollup     string         `json:"rollup,omitempty" yaml:"rollup,omitempty"`
+	Budgeted   dataAmount     `json:"budgeted" yaml:"budgeted"`
+	Activity   dataAmount     `json:"activity" yaml:"activity"`
+	Balance    dataAmount     `json:"balance" yaml:"balance"`
+	Categories []dataCategory `json:"categories" yaml:"categories"`
+}
+
+// dataCategory is a category of the current month
+type dataCategory struct {
+	Name     string     `json:"name" yaml:"name"`
+	Budgeted dataAmount `json:"budgeted" yaml:"budgeted"`
+	Activity dataAmount `json:"activity" yaml:"activity"`
+	Balance  dataAmount `json:"balance" yaml:"balance"`
+}
+
+// dataMonth is an entry of the months data file
+type dataMonth struct {
+	Month        string     `json:"month" yaml:"month"`
+	Income       dataAmount `json:"income" yaml:"income"`
+	Budgeted     dataAmount `json:"budgeted" yaml:"budgeted"`
+	Activity     dataAmount `json:"activity" yaml:"activity"`
+	ToBeBudgeted dataAmount `json:"to_be_budgeted" yaml:"to_be_budgeted"`
+	AgeOfMoney   *int64     `json:"age_of_money" yaml:"age_of_money"`
+}
+
+// dataKeyRun matches what may not appear in a data key
+var dataKeyRun = regexp.MustCompile(`[^a-z0-9]+`)
+
+// exportHugoData writes the data files of each snapshot's budget into its
+// own directory under dir, named by a key templates can use, such as
+// .Site.Data.ynab.home in Hugo, and returns the file names written. ext is
+// json or yaml.
+func exportHugoData(dir string, snaps []exportSnapshot, r rollups, ext string) ([]string, error) {
+	marshal := func(v interface{}) ([]byte, error) {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		err := enc.Encode(v)
+		return buf.Bytes(), err
+	}
+	if ext == "yaml" {
+		marshal = yaml.Marshal
+	}
+	var written []string
+	keys, budgets := map[string]bool{}, map[string]bool{}
+	for _, s := range snaps {
+		if budgets[s.Info.ID] {
+			return written, fmt.Errorf("export %s: hugo-data takes one snapshot per budget", s.Info.File)
+		}
+		budgets[s.Info.ID] = true
+		name := cmp.Or(stringField(s.Budget, "name"), s.Info.Name)
+		base := cmp.Or(strings.Trim(dataKeyRun.ReplaceAllString(strings.ToLower(name), "_"), "_"), "budget")
+		key := base
+		for i := 2; keys[key]; i++ {
+			key = fmt.Sprintf("%s_%d", base, i)
+		}
+		keys[key] = true
+		if err := os.MkdirAll(filepath.Join(dir, key), 0755); err != nil {
+			return written, err
+		}
+		files := map[string]interface{}{
+			"budget":     hugoBudget(s, name),
+			"accounts":   hugoAccounts(s.Budget),
+			"categories": hugoCategories(s.Budget, r),
+			"months":     hugoMonths(s.Budget),
+		}
+		for _, file := range sortedKeys(files) {
+			data, err := marshal(files[file])
+			if err != nil {
+				return written, fmt.Errorf("export %s: %w", s.Info.File, err)
+			}
+			rel := path.Join(key, file+"."+ext)
+			if err := ynabvault.WriteFile(filepath.Join(dir, filepath.FromSlash(rel)), data); err != nil {
+				return written, fmt.Errorf("export %s: %w", s.Info.File, err)
+			}
+			written = append(written, rel)
+		}
+	}
+	return written, nil
+}
+
+// hugoBudget sums up the snapshot: net worth is the balance of every open
+// account, on budget or tracking
+func hugoBudget(s exportSnapshot, name string) dataBudget {
+	f := budgetCurrency(s.Budget)
+	b := dataBudget{
+		Name:     name,
+		ID:       cmp.Or(stringField(s.Budget, "id"), s.Info.ID),
+		Snapshot: s.Info.Time.UTC().Format("2006-01-02T15:04:05Z"),
+		Currency: dataCurrency{f.ISOCode, f.Symbol, f.SymbolFirst, f.DecimalDigits},
+	}
+	assets, liabilities := netWorth(s.Budget)
+	b.Assets, b.Liabilities, b.NetWorth = dataAmount(assets), dataAmount(liabilities), dataAmount(assets-liabilities)
+	return b
+}
+
+// netWorth sums the positive and the negative balances of the open
+// accounts, both as positive milliunits
+func netWorth(budget map[string]interface{}) (assets, liabilities int64) {
+	for _, a := range entitiesByID(budget["accounts"]) {
+		if a["closed"] == true {
+			continue
+		}
+		if balance := milliunits(a["balance"]); balance < 0 {
+			liabilities -= balance
+		} else {
+			assets += balance
+		}
+	}
+	return assets, liabilities
+}
+
+// hugoAccounts lists the accounts by name
+func hugoAccounts(budget map[string]interface{}) []dataAccount {
+	out := []dataAccount{}
+	for _, a := range entitiesByID(budget["accounts"]) {
+		out = append(out, dataAccount{
+			Name:           stringField(a, "name"),
+			Type:           stringField(a, "type"),
+			OnBudget:       a["on_budget"] == true,
+			Closed:         a["closed"] == true,
+			Balance:        dataAmount(milliunits(a["balance"])),
+			ClearedBalance: dataAmount(milliunits(a["cleared_balance"])),
+		})
+	}
+	slices.SortFunc(out, func(a, b dataAccount) int { return cmp.Compare(a.Name, b.Name) })
+	return out
+}
+
+// hugoCategories lists the visible category groups by name, with the
+// current month of each visible category and the group's totals
+func hugoCategories(budget map[string]interface{}, r rollups) []dataGroup {
+	groups := entitiesByID(budget["category_groups"])
+	byGroup := map[string][]dataCategory{}
+	for _, c := range entitiesByID(budget["categories"]) {
+		if c["hidden"] == true {
+			continue
+		}
+		id := stringField(c, "category_group_id")
+		byGroup[id] = append(byGroup[id], dataCategory{
+			Name:     stringField(c, "name"),
+			Budgeted: dataAmount(milliunits(c["budgeted"])),
+			Activity: dataAmount(milliunits(c["activity"])),
+			Balance:  dataAmount(milliunits(c["balance"])),
+		})
+	}
+	out := []dataGroup{}
+	for id, g := range groups {
+		name := stringField(g, "name")
+		if g["hidden"] == true || name == internalCategoryGroup || len(byGroup[id]) == 0 {
+			continue
+		}
+		d := dataGroup{Name: name, Rollup: r.of(name), Categories: byGroup[id]}
+		slices.SortFunc(d.Categories, func(a, b dataCategory) int { return cmp.Compare(a.Name, b.Name) })
+		for _, c := range d.Categories {
+			d.Budgeted += c.Budgeted
+			d.Activity += c.Activity
+			d.Balance += c.Balance
+		}
+		out = append(out, d)
+	}
+	slices.SortFunc(out, func(a, b dataGroup) int { return cmp.Compare(a.Name, b.Name) })
+	return out
+}
+
+// hugoMonths lists the budget's months, oldest first
+func hugoMonths(budget map[string]interface{}) []dataMonth {
+	months := monthsByKey(budget["months"])
+	out := []dataMonth{}
+	for _, key := range sortedKeys(months) {
+		m := months[key]
+		d := dataMonth{
+			Month:        key,
+			Income:       dataAmount(milliunits(m["income"])),
+			Budgeted:     dataAmount(milliunits(m["budgeted"])),
+			Activity:     dataAmount(milliunits(m["activity"])),
+			ToBeBudgeted: dataAmount(milliunits(m["to_be_budgeted"])),
+		}
+		if age, ok := m["age_of_money"].(json.Number); ok {
+			if n, err := age.Int64(); err == nil {
+				d.AgeOfMoney = &n
+			}
+		}
+		out = append(out, d)
+	}
+	return out
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// hugoBudgetJSON is a budget with open, closed and tracking accounts,
+// hidden categories and months
+const hugoBudgetJSON = `{"data":{"budget":{"id":"b1","name":"Home & Family","currency_format":{"iso_code":"EUR","currency_symbol":"€","decimal_digits":2},
+	"accounts":[
+		{"id":"a1","name":"Checking","type":"checking","on_budget":true,"balance":1250500,"cleared_balance":1200000},
+		{"id":"a2","name":"Visa","type":"creditCard","on_budget":true,"balance":-250000},
+		{"id":"a3","name":"House","type":"otherAsset","on_budget":false,"balance":300000000},
+		{"id":"a4","name":"Old","type":"savings","closed":true,"balance":0}],
+	"category_groups":[{"id":"g1","name":"Bills"},{"id":"g2","name":"Internal Master Category"},{"id":"g3","name":"Hidden","hidden":true}],
+	"categories":[
+		{"id":"c1","category_group_id":"g1","name":"Rent","budgeted":900000,"activity":-900000,"balance":0},
+		{"id":"c2","category_group_id":"g1","name":"Power","budgeted":80000,"activity":-65000,"balance":15000},
+		{"id":"c3","category_group_id":"g1","name":"Retired","hidden":true},
+		{"id":"c4","category_group_id":"g2","name":"Inflow: Ready to Assign"},
+		{"id":"c5","category_group_id":"g3","name":"Secret"}],
+	"months":[
+		{"month":"2025-02-01","income":2000000,"budgeted":980000,"activity":-965000,"to_be_budgeted":0,"age_of_money":null},
+		{"month":"2025-01-01","income":1500000,"budgeted":900000,"activity":-700000,"to_be_budgeted":5000,"age_of_money":21}]}}}`
+
+// TestExportHugoData writes budget, account, category and month data files
+// per budget as JSON or YAML
+func TestExportHugoData(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Home_b1_20250215T080000Z.json"), []byte(hugoBudgetJSON), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(config, []byte("rollups:\n  Needs: [Bills]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := t.TempDir()
+	var stdout, stderr strings.Builder
+	args := []string{"export", "--output", dir, "--config", config, "--format", "hugo-data", "--out", out}
+	if code := runCLI(args, &stdout, &stderr); code != 0 {
+		t.Fatalf("export exit code = %d; stderr: %s", code, stderr.String())
+	}
+	var want []string
+	for _, name := range []string{"accounts", "budget", "categories", "months"} {
+		want = append(want, filepath.Join(out, "home_family", name+".json"))
+	}
+	if got := strings.Fields(stdout.String()); !reflect.DeepEqual(got, want) {
+		t.Errorf("written = %v; want %v", got, want)
+	}
+	data, err := os.ReadFile(filepath.Join(out, "home_family", "budget.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantBudget := `{
+  "name": "Home & Family",
+  "id": "b1",
+  "snapshot": "2025-02-15T08:00:00Z",
+  "currency": {
+    "iso_code": "EUR",
+    "symbol": "€",
+    "symbol_first": false,
+    "decimal_digits": 2
+  },
+  "net_worth": 301000.50,
+  "assets": 301250.50,
+  "liabilities": 250.00
+}
+`
+	if string(data) != wantBudget {
+		t.Errorf("budget.json =\n%s\nwant\n%s", data, wantBudget)
+	}
+	data, err = os.ReadFile(filepath.Join(out, "home_family", "categories.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var groups []map[string]interface{}
+	if err := json.Unmarshal(data, &groups); err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 || groups[0]["name"] != "Bills" || groups[0]["rollup"] != "Needs" || groups[0]["activity"] != -965.0 || len(groups[0]["categories"].([]interface{})) != 2 {
+		t.Errorf("categories = %v", groups)
+	}
+
+	yamlOut := t.TempDir()
+	args = []string{"export", "--output", dir, "--format", "hugo-data", "--data-format", "yaml", "--out", yamlOut}
+	if code := runCLI(args, &strings.Builder{}, &stderr); code != 0 {
+		t.Fatalf("yaml export exit code = %d; stderr: %s", code, stderr.String())
+	}
+	data, err = os.ReadFile(filepath.Join(yamlOut, "home_family", "months.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var months []map[string]interface{}
+	if err := yaml.Unmarshal(data, &months); err != nil {
+		t.Fatal(err)
+	}
+	if len(months) != 2 || months[0]["month"] != "2025-01-01" || months[0]["income"] != 1500.0 || months[0]["age_of_money"] != 21 || months[1]["age_of_money"] != nil {
+		t.Errorf("months = %v", months)
+	}
+
+	for _, args := range [][]string{
+		{"export", "--output", dir, "--format", "hugo-data", "--all", "--out", out},
+		{"export", "--output", dir, "--format", "csv", "--data-format", "yaml", "--out", out},
+		{"export", "--output", dir, "--format", "hugo-data", "--data-format", "toml", "--out", out},
+	} {
+		if code := runCLI(args, &strings.Builder{}, &strings.Builder{}); code != 2 {
+			t.Errorf("%v exit code = %d; want 2", args, code)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// liabilityTypes are the YNAB account types that become Liabilities
+// accounts in a plain-text ledger; every other type is an asset
+var liabilityTypes = map[string]bool{
+	"creditCard":     true,
+	"lineOfCredit":   true,
+	"otherLiability": true,
+	"mortgage":       true,
+	"autoLoan":       true,
+	"studentLoan":    true,
+	"personalLoan":   true,
+	"medicalDebt":    true,
+	"otherDebt":      true,
+}
+
+// internalCategoryGroup holds YNAB's inflow category, which becomes an
+// Income account
+const internalCategoryGroup = "Internal Master Category"
+
+// journal is a snapshot as double-entry bookkeeping, ready to be written in
+// a plain-text accounting format
+type journal struct {
+	Title    string
+	Currency currencyFormat
+	// Open is the day every account opens, the first transaction's or the
+	// snapshot's; Close is the day after the last, when balances are asserted
+	Open, Close  string
+	Accounts     []string // every account used, sorted
+	Transactions []journalTransaction
+	// Balances are what YNAB reports for its accounts, summed where several
+	// share a name
+	Balances []journalPosting
+}
+
+// journalTransaction is a YNAB transaction with one posting for its account
+// and one per split line
+type journalTransaction struct {
+	ID, Date, Payee, Memo string
+	Uncleared             bool
+	Postings              []journalPosting
+}
+
+// journalPosting is an amount in milliunits booked to an account
+type journalPosting struct {
+	Account string
+	Amount  int64
+}
+
+// currencyFormat is the part of a budget's currency_format that says how
+// to write its amounts
+type currencyFormat struct {
+	ISOCode       string
+	Symbol        string
+	SymbolFirst   bool
+	DecimalDigits int
+}
+
+// budgetCurrency reads a budget's currency_format, defaulting to US dollars
+func budgetCurrency(budget map[string]interface{}) currencyFormat {
+	f := currencyFormat{ISOCode: "USD", Symbol: "$", SymbolFirst: true, DecimalDigits: 2}
+	cf, ok := budget["currency_format"].(map[string]interface{})
+	if !ok {
+		return f
+	}
+	f.ISOCode = cmp.Or(stringField(cf, "iso_code"), f.ISOCode)
+	f.Symbol = stringField(cf, "currency_symbol")
+	f.SymbolFirst = cf["symbol_first"] == true
+	if n, err := milliunitsDigits(cf["decimal_digits"]); err == nil {
+		f.DecimalDigits = n
+	}
+	return f
+}
+
+// journalNames hands out account names, keeping them unique across the
+// YNAB accounts and categories they stand for
+type journalNames struct {
+	// component turns a YNAB name into a part of an account name
+	component func(string) string
+	// mapped is the account name configured for a YNAB account or
+	// category, if any
+	mapped func(names ...string) string
+	byKey  map[string]string
+	taken  map[string]bool
+}
+
+// name returns the account for key, built from root and the YNAB names in
+// parts; a name already taken by another key gets a number
+func (n *journalNames) name(key, root string, parts ...string) string {
+	if name, ok := n.byKey[key]; ok {
+		return name
+	}
+	comps := []string{root}
+	for _, p := range parts {
+		comps = append(comps, n.component(p))
+	}
+	base := strings.Join(comps, ":")
+	name := base
+	for i := 2; n.taken[name]; i++ {
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+	return n.claim(key, name)
+}
+
+// claim gives key the account name, which other keys may share
+func (n *journalNames) claim(key, name string) string {
+	if n.byKey == nil {
+		n.byKey, n.taken = map[string]string{}, map[string]bool{}
+	}
+	n.byKey[key], n.taken[name] = name, true
+	return name
+}
+
+// buildJournal books a snapshot's transactions: each against its account
+// and, per split line, the category or the other account of a transfer.
+// Expense accounts of a category group with a rollup sit under the
+// rollup's bucket.
+func buildJournal(s exportSnapshot, r rollups, names *journalNames) journal {
+	budget := s.Budget
+	accounts := entitiesByID(budget["accounts"])
+	payees := entitiesByID(budget["payees"])
+	categories := entitiesByID(budget["categories"])
+	groups := entitiesByID(budget["category_groups"])
+	subs := map[string][]map[string]interface{}{}
+	splits := entitiesByID(budget["subtransactions"])
+	for _, id := range sortedKeys(splits) {
+		st := splits[id]
+		parent := stringField(st, "transaction_id")
+		subs[parent] = append(subs[parent], st)
+	}
+	txns := entitiesByID(budget["transactions"])
+	ids := sortedKeys(txns)
+	slices.SortStableFunc(ids, func(a, b string) int {
+		return cmp.Compare(stringField(txns[a], "date"), stringField(txns[b], "date"))
+	})
+
+	mapped := func(key string, ynab ...string) (string, bool) {
+		if names.mapped == nil {
+			return "", false
+		}
+		if name := names.mapped(ynab...); name != "" {
+			return names.claim(key, name), true
+		}
+		return "", false
+	}
+	accountName := func(id string) string {
+		a := accounts[id]
+		if name, ok := mapped("account:"+id, stringField(a, "name")); ok {
+			return name
+		}
+		root := "Assets"
+		if liabilityTypes[stringField(a, "type")] {
+			root = "Liabilities"
+		}
+		return names.name("account:"+id, root, stringField(a, "name"))
+	}
+	categoryName := func(id string) string {
+		c, ok := categories[id]
+		if !ok {
+			return names.name("category:", "Expenses", "Uncategorized")
+		}
+		group := categoryGroup(categories, groups, id)
+		if name, ok := mapped("category:"+id, group+":"+stringField(c, "name"), stringField(c, "name")); ok {
+			return name
+		}
+		if group == internalCategoryGroup {
+			return names.name("category:"+id, "Income", stringField(c, "name"))
+		}
+		if bucket := r.of(group); bucket != "" {
+			return names.name("category:"+id, "Expenses", bucket, group, stringField(c, "name"))
+		}
+		return names.name("category:"+id, "Expenses", group, stringField(c, "name"))
+	}
+
+	j := journal{Title: cmp.Or(stringField(budget, "name"), s.Info.Name), Currency: budgetCurrency(budget)}
+	// Accounts are named first, so a category never takes an account's name
+	used := map[string]bool{}
+	for _, id := range sortedKeys(accounts) {
+		used[accountName(id)] = true
+	}
+	for _, id := range ids {
+		t := txns[id]
+		if journalSkipTransfer(t, txns, splits) {
+			continue
+		}
+		jt := journalTransaction{
+			ID:        id,
+			Date:      stringField(t, "date"),
+			Payee:     stringField(payees[stringField(t, "payee_id")], "name"),
+			Memo:      stringField(t, "memo"),
+			Uncleared: stringField(t, "cleared") == "uncleared",
+			Postings:  []journalPosting{{accountName(stringField(t, "account_id")), milliunits(t["amount"])}},
+		}
+		lines := subs[id]
+		if len(lines) == 0 {
+			lines = []map[string]interface{}{t}
+		}
+		for _, line := range lines {
+			var other string
+			if to := stringField(line, "transfer_account_id"); to != "" {
+				other = accountName(to)
+			} else {
+				other = categoryName(stringField(line, "category_id"))
+			}
+			jt.Postings = append(jt.Postings, journalPosting{other, -milliunits(line["amount"])})
+		}
+		for _, p := range jt.Postings {
+			used[p.Account] = true
+		}
+		j.Transactions = append(j.Transactions, jt)
+	}
+	j.Accounts = sortedKeys(used)
+	balance := map[string]int{}
+	for _, id := range sortedKeys(accounts) {
+		if _, ok := accounts[id]["balance"]; !ok {
+			continue
+		}
+		name := accountName(id)
+		if i, ok := balance[name]; ok {
+			j.Balances[i].Amount += milliunits(accounts[id]["balance"])
+			continue
+		}
+		balance[name] = len(j.Balances)
+		j.Balances = append(j.Balances, journalPosting{name, milliunits(accounts[id]["balance"])})
+	}
+
+	// Ledgers check a balance at the start of its day, so balances are
+	// asserted the day after the last transaction
+	j.Open, j.Close = s.Info.Time.UTC().Format(time.DateOnly), s.Info.Time.UTC().Format(time.DateOnly)
+	if len(ids) > 0 {
+		j.Open = min(j.Open, stringField(txns[ids[0]], "date"))
+		j.Close = max(j.Close, stringField(txns[ids[len(ids)-1]], "date"))
+	}
+	if day, err := time.Parse(time.DateOnly, j.Close); err == nil {
+		j.Close = day.AddDate(0, 0, 1).Format(time.DateOnly)
+	}
+	return j
+}
+
+// journalSkipTransfer reports whether t is the side of a transfer that the
+// other side already records: a transfer to a split line is recorded by the
+// split, and one between two transactions by the one with the smaller ID
+func journalSkipTransfer(t map[string]interface{}, txns, splits map[string]map[string]interface{}) bool {
+	other := stringField(t, "transfer_transaction_id")
+	if other == "" {
+		return false
+	}
+	if _, ok := splits[other]; ok {
+		return true
+	}
+	_, ok := txns[other]
+	return ok && other < stringField(t, "id")
+}
+
+// milliunitsDigits reads a currency's decimal digits, which milliunits
+// allow up to three of
+func milliunitsDigits(v interface{}) (int, error) {
+	num, _ := v.(json.Number)
+	n, err := num.Int64()
+	if err == nil && (n < 0 || n > 3) {
+		err = fmt.Errorf("%d decimal digits", n)
+	}
+	return int(n), err
+}
+
+// milliunits reads a JSON amount, zero if it is missing
+func milliunits(v interface{}) int64 {
+	num, _ := v.(json.Number)
+	n, _ := num.Int64()
+	return n
+}
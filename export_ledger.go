@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// ledgerAccounts maps YNAB account and category names, lower-cased, to the
+// Ledger account the config's ledger_accounts key names for them
+type ledgerAccounts map[string]string
+
+// newLedgerAccounts checks the config's ledger_accounts and keys them for
+// lookup
+func newLedgerAccounts(config map[string]string) (ledgerAccounts, error) {
+	m := ledgerAccounts{}
+	for _, key := range sortedKeys(config) {
+		name := strings.TrimSpace(config[key])
+		if name == "" || strings.Contains(name, "  ") || strings.ContainsAny(name, "\t\n;") ||
+			strings.HasPrefix(name, ":") || strings.HasSuffix(name, ":") || strings.Contains(name, "::") {
+			return nil, fmt.Errorf("ledger_accounts: %q is not a Ledger account name for %s", config[key], key)
+		}
+		m[strings.ToLower(strings.TrimSpace(key))] = name
+	}
+	return m, nil
+}
+
+// of returns the Ledger account configured for the first of names that has
+// one, or ""
+func (m ledgerAccounts) of(names ...string) string {
+	for _, n := range names {
+		if name, ok := m[strings.ToLower(strings.TrimSpace(n))]; ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// ledgerName escapes what Ledger reads as structure in account names
+var ledgerName = strings.NewReplacer(":", " ", ";", " ")
+
+// exportLedger writes one Ledger journal per snapshot into dir, named after
+// the snapshot file, and returns the file names written; hledger reads them
+// too
+func exportLedger(dir string, snaps []exportSnapshot, r rollups, accounts ledgerAccounts) ([]string, error) {
+	return exportFiles(dir, ".ledger", snaps, func(s exportSnapshot) ([]byte, error) {
+		return ledgerJournal(s, r, accounts), nil
+	})
+}
+
+// ledgerJournal renders a snapshot's accounts and transactions as a Ledger
+// journal: an account directive per account, a transaction per YNAB
+// transaction with one posting per split line, and a last transaction
+// asserting the balance YNAB reports for each account. Amounts are in the
+// budget's currency symbol and decimal digits.
+func ledgerJournal(s exportSnapshot, r rollups, accounts ledgerAccounts) []byte {
+	j := buildJournal(s, r, &journalNames{component: ledgerComponent, mapped: accounts.of})
+	commodity := ledgerCommodity(j.Currency)
+	amount := func(n int64) string {
+		num := fixedAmount(n, j.Currency.DecimalDigits)
+		switch {
+		case !j.Currency.SymbolFirst:
+			return num + " " + commodity
+		case utf8.RuneCountInString(commodity) == 1:
+			return commodity + num
+		}
+		return commodity + " " + num
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "; Exported by ynabvault from %s\n", s.Info.File)
+	fmt.Fprintf(&out, "; Budget: %s\n\n", oneLine(j.Title))
+	fmt.Fprintf(&out, "commodity %s\n\n", commodity)
+	for _, name := range j.Accounts {
+		fmt.Fprintf(&out, "account %s\n", name)
+	}
+	out.WriteString("\n")
+	for _, t := range j.Transactions {
+		flag := "*"
+		if t.Uncleared {
+			flag = "!"
+		}
+		payee, memo := oneLine(t.Payee), oneLine(t.Memo)
+		if payee == "" {
+			payee, memo = memo, ""
+		}
+		out.WriteString(strings.TrimSpace(t.Date + " " + flag + " " + payee))
+		if memo != "" {
+			fmt.Fprintf(&out, "  ; %s", memo)
+		}
+		fmt.Fprintf(&out, "\n    ; ynab_id: %s\n", t.ID)
+		for _, p := range t.Postings {
+			fmt.Fprintf(&out, "    %s  %s\n", p.Account, amount(p.Amount))
+		}
+		out.WriteString("\n")
+	}
+	if len(j.Balances) > 0 {
+		fmt.Fprintf(&out, "%s * Balances reported by YNAB\n", j.Close)
+		for _, b := range j.Balances {
+			fmt.Fprintf(&out, "    %s  %s = %s\n", b.Account, amount(0), amount(b.Amount))
+		}
+	}
+	return out.Bytes()
+}
+
+// ledgerComponent turns a YNAB name into a Ledger account name component:
+// single spaces, and no colons or semicolons
+func ledgerComponent(s string) string {
+	s = strings.Trim(oneLine(ledgerName.Replace(s)), "()[] ")
+	if s == "" {
+		return "Unnamed"
+	}
+	return s
+}
+
+// ledgerCommodity is the budget's currency symbol, or its ISO code when it
+// has none, quoted when Ledger would not read it bare
+func ledgerCommodity(f currencyFormat) string {
+	c := oneLine(cmp.Or(f.Symbol, f.ISOCode))
+	if strings.ContainsAny(c, "0123456789 .,;:?!-+*/^&|=<>{}[]()@\"") {
+		return `"` + strings.ReplaceAll(c, `"`, "") + `"`
+	}
+	return c
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// TestLedgerJournal writes amounts in the budget's currency, applies the
+// configured account names and asserts the balances
+func TestLedgerJournal(t *testing.T) {
+	env, err := ynabvault.DecodeEnvelope([]byte(`{"data":{"budget":{"name":"Home",
+		"currency_format":{"iso_code":"EUR","currency_symbol":"€","symbol_first":false,"decimal_digits":2},
+		"accounts":[
+			{"id":"a1","name":"Giro  Konto","type":"checking","balance":-12345},
+			{"id":"a2","name":"Visa: Gold","type":"creditCard","balance":-20000},
+			{"id":"a3","name":"Cash","type":"cash","balance":5000}],
+		"payees":[{"id":"p1","name":"Bäcker"}],
+		"category_groups":[{"id":"g1","name":"Everyday"},{"id":"g2","name":"Fun"}],
+		"categories":[
+			{"id":"c1","category_group_id":"g1","name":"Food"},
+			{"id":"c2","category_group_id":"g2","name":"Food"}],
+		"transactions":[
+			{"id":"t1","date":"2025-01-02","account_id":"a1","payee_id":"p1","category_id":"c1","amount":-12345,"memo":"Brot\nund Kuchen","cleared":"cleared"},
+			{"id":"t2","date":"2025-01-03","account_id":"a2","category_id":"c2","amount":-20000,"memo":"Kino","cleared":"uncleared"}]}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap := exportSnapshot{
+		Info:   snapshotInfo{Name: "Home", File: "Home_b1_20250101T000000Z.json", Time: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		Budget: env.Data.Budget,
+	}
+	accounts, err := newLedgerAccounts(map[string]string{"fun:food": "Expenses:Leisure:Snacks", "Cash": "Assets:Wallet"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `; Exported by ynabvault from Home_b1_20250101T000000Z.json
+; Budget: Home
+
+commodity €
+
+account Assets:Giro Konto
+account Assets:Wallet
+account Expenses:Everyday:Food
+account Expenses:Leisure:Snacks
+account Liabilities:Visa Gold
+
+2025-01-02 * Bäcker  ; Brot und Kuchen
+    ; ynab_id: t1
+    Assets:Giro Konto  -12.345 €
+    Expenses:Everyday:Food  12.345 €
+
+2025-01-03 ! Kino
+    ; ynab_id: t2
+    Liabilities:Visa Gold  -20.00 €
+    Expenses:Leisure:Snacks  20.00 €
+
+2025-01-04 * Balances reported by YNAB
+    Assets:Giro Konto  0.00 € = -12.345 €
+    Liabilities:Visa Gold  0.00 € = -20.00 €
+    Assets:Wallet  0.00 € = 5.00 €
+`
+	if got := string(ledgerJournal(snap, nil, accounts)); got != want {
+		t.Errorf("journal =\n%s\nwant\n%s", got, want)
+	}
+}
+
+// TestLedgerAmounts writes commodities the way Ledger reads them
+func TestLedgerAmounts(t *testing.T) {
+	for _, tc := range []struct {
+		f    currencyFormat
+		want string
+	}{
+		{currencyFormat{ISOCode: "USD", Symbol: "$"}, "$"},
+		{currencyFormat{ISOCode: "CHF"}, "CHF"},
+		{currencyFormat{ISOCode: "DKK", Symbol: "kr."}, `"kr."`},
+	} {
+		if got := ledgerCommodity(tc.f); got != tc.want {
+			t.Errorf("ledgerCommodity(%+v) = %q; want %q", tc.f, got, tc.want)
+		}
+	}
+}
+
+// TestExportLedgerCommand reads account names from the config and rejects
+// ones Ledger cannot parse
+func TestExportLedgerCommand(t *testing.T) {
+	dir := t.TempDir()
+	content := `{"data":{"budget":{"id":"b1","accounts":[{"id":"a1","name":"Checking","type":"checking","balance":1000}],
+		"transactions":[{"id":"t1","date":"2025-01-02","account_id":"a1","amount":1000}]}}}`
+	if err := os.WriteFile(filepath.Join(dir, "Home_b1_20250101T000000Z.json"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	yaml := "ledger_accounts:\n  checking: Assets:Bank:Checking\nprofiles:\n  bad:\n    ledger_accounts:\n      Checking: \"Assets:Bank;Checking\"\n"
+	if err := os.WriteFile(config, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "ledgers")
+	var stdout, stderr strings.Builder
+	args := []string{"export", "--output", dir, "--config", config, "--format", "ledger", "--out", out}
+	if code := runCLI(args, &stdout, &stderr); code != 0 {
+		t.Fatalf("export exit code = %d; stderr: %s", code, stderr.String())
+	}
+	data, err := os.ReadFile(filepath.Join(out, "Home_b1_20250101T000000Z.ledger"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"account Assets:Bank:Checking\n", "    Assets:Bank:Checking  $1.00\n", "    Assets:Bank:Checking  $0.00 = $1.00\n"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("journal lacks %q:\n%s", want, data)
+		}
+	}
+
+	if code := runCLI(append(args, "--profile", "bad"), &stdout, &stderr); code != 2 {
+		t.Errorf("bad ledger_accounts exit code = %d; want 2", code)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ofxHeader opens an OFX 2.1.1 document
+const ofxHeader = `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<?OFX OFXHEADER="200" VERSION="211" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+`
+
+// ofxBankTypes maps YNAB account types to OFX bank account types; credit
+// cards get a credit card statement, and any other type is a checking
+// account
+var ofxBankTypes = map[string]string{
+	"savings":        "SAVINGS",
+	"lineOfCredit":   "CREDITLINE",
+	"otherLiability": "CREDITLINE",
+	"mortgage":       "CREDITLINE",
+	"autoLoan":       "CREDITLINE",
+	"studentLoan":    "CREDITLINE",
+	"personalLoan":   "CREDITLINE",
+	"medicalDebt":    "CREDITLINE",
+	"otherDebt":      "CREDITLINE",
+}
+
+// exportOFX writes one OFX statement per account of each snapshot, in a
+// directory named after the snapshot, and returns the file names written
+func exportOFX(dir string, snaps []exportSnapshot) ([]string, error) {
+	return exportAccountFiles(dir, ".ofx", snaps, func(s exportSnapshot, account map[string]interface{}) ([]byte, error) {
+		return ofxStatement(s, account), nil
+	})
+}
+
+// ofxStatement renders an account's transactions as an OFX 2.1.1 bank or
+// credit card statement ending at the snapshot's time, with the balance
+// YNAB reports. OFX has no categories, so split lines are not shown; the
+// transaction's YNAB ID is its FITID, so importing twice adds nothing.
+func ofxStatement(s exportSnapshot, account map[string]interface{}) []byte {
+	payees := entitiesByID(s.Budget["payees"])
+	register := accountRegister(s.Budget, stringField(account, "id"))
+	taken := s.Info.Time.UTC()
+	start, end := taken.Format("20060102"), taken.Format("20060102")
+	if len(register) > 0 {
+		start = min(start, ofxDate(stringField(register[0].Transaction, "date")))
+		end = max(end, ofxDate(stringField(register[len(register)-1].Transaction, "date")))
+	}
+
+	var out bytes.Buffer
+	out.WriteString(ofxHeader)
+	out.WriteString("<OFX>\n")
+	out.WriteString("<SIGNONMSGSRSV1><SONRS>\n")
+	out.WriteString("<STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>\n")
+	fmt.Fprintf(&out, "<DTSERVER>%s</DTSERVER><LANGUAGE>ENG</LANGUAGE>\n", taken.Format("20060102150405"))
+	out.WriteString("</SONRS></SIGNONMSGSRSV1>\n")
+
+	card := stringField(account, "type") == "creditCard"
+	msgs, trnrs, rs := "BANKMSGSRSV1", "STMTTRNRS", "STMTRS"
+	if card {
+		msgs, trnrs, rs = "CREDITCARDMSGSRSV1", "CCSTMTTRNRS", "CCSTMTRS"
+	}
+	fmt.Fprintf(&out, "<%s><%s>\n", msgs, trnrs)
+	out.WriteString("<TRNUID>0</TRNUID><STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>\n")
+	fmt.Fprintf(&out, "<%s>\n<CURDEF>%s</CURDEF>\n", rs, ofxText(budgetCurrency(s.Budget).ISOCode, 3))
+	acctID := ofxText(strings.ReplaceAll(stringField(account, "id"), "-", ""), 22)
+	if card {
+		fmt.Fprintf(&out, "<CCACCTFROM><ACCTID>%s</ACCTID></CCACCTFROM>\n", acctID)
+	} else {
+		kind := ofxBankTypes[stringField(account, "type")]
+		if kind == "" {
+			kind = "CHECKING"
+		}
+		fmt.Fprintf(&out, "<BANKACCTFROM><BANKID>YNAB</BANKID><ACCTID>%s</ACCTID><ACCTTYPE>%s</ACCTTYPE></BANKACCTFROM>\n", acctID, kind)
+	}
+	fmt.Fprintf(&out, "<BANKTRANLIST>\n<DTSTART>%s</DTSTART><DTEND>%s</DTEND>\n", start, end)
+	for _, e := range register {
+		t := e.Transaction
+		amount := milliunits(t["amount"])
+		kind := "CREDIT"
+		if amount < 0 {
+			kind = "DEBIT"
+		}
+		if stringField(t, "transfer_account_id") != "" {
+			kind = "XFER"
+		}
+		fmt.Fprintf(&out, "<STMTTRN><TRNTYPE>%s</TRNTYPE><DTPOSTED>%s</DTPOSTED><TRNAMT>%s</TRNAMT><FITID>%s</FITID>",
+			kind, ofxDate(stringField(t, "date")), fixedAmount(amount, 2), ofxText(stringField(t, "id"), 255))
+		if payee := ofxText(stringField(payees[stringField(t, "payee_id")], "name"), 32); payee != "" {
+			fmt.Fprintf(&out, "<NAME>%s</NAME>", payee)
+		}
+		if memo := ofxText(stringField(t, "memo"), 255); memo != "" {
+			fmt.Fprintf(&out, "<MEMO>%s</MEMO>", memo)
+		}
+		out.WriteString("</STMTTRN>\n")
+	}
+	out.WriteString("</BANKTRANLIST>\n")
+	fmt.Fprintf(&out, "<LEDGERBAL><BALAMT>%s</BALAMT><DTASOF>%s</DTASOF></LEDGERBAL>\n",
+		fixedAmount(milliunits(account["balance"]), 2), taken.Format("20060102150405"))
+	fmt.Fprintf(&out, "</%s>\n</%s></%s>\n</OFX>\n", rs, trnrs, msgs)
+	return out.Bytes()
+}
+
+// ofxDate turns a YNAB date into an OFX one
+func ofxDate(date string) string {
+	if day, err := time.Parse(time.DateOnly, date); err == nil {
+		return day.Format("20060102")
+	}
+	return date
+}
+
+// ofxText puts s on one line, cut to the field's maximum length in
+// characters, and escapes it for XML
+func ofxText(s string, limit int) string {
+	s = oneLine(s)
+	if r := []rune(s); len(r) > limit {
+		s = strings.TrimSpace(string(r[:limit]))
+	}
+	var b bytes.Buffer
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/xml"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// ofxTransaction is a STMTTRN read back from an exported statement
+type ofxTransaction struct {
+	Type   string `xml:"TRNTYPE"`
+	Posted string `xml:"DTPOSTED"`
+	Amount string `xml:"TRNAMT"`
+	FITID  string `xml:"FITID"`
+	Name   string `xml:"NAME"`
+	Memo   string `xml:"MEMO"`
+}
+
+// TestOFXStatement writes well-formed bank and credit card statements with
+// the account's transactions and balance
+func TestOFXStatement(t *testing.T) {
+	env, err := ynabvault.DecodeEnvelope([]byte(qifBudget))
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.Data.Budget["payees"] = []interface{}{map[string]interface{}{"id": "p1", "name": "Grocer & Sons, a very long payee name"}}
+	snap := exportSnapshot{
+		Info:   snapshotInfo{File: "Home_b1_20250110T120000Z.json", Time: time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)},
+		Budget: env.Data.Budget,
+	}
+	accounts := entitiesByID(snap.Budget["accounts"])
+
+	var bank struct {
+		Statement struct {
+			Currency string `xml:"CURDEF"`
+			Account  struct {
+				ID   string `xml:"ACCTID"`
+				Type string `xml:"ACCTTYPE"`
+			} `xml:"BANKACCTFROM"`
+			Start        string           `xml:"BANKTRANLIST>DTSTART"`
+			End          string           `xml:"BANKTRANLIST>DTEND"`
+			Transactions []ofxTransaction `xml:"BANKTRANLIST>STMTTRN"`
+			Balance      string           `xml:"LEDGERBAL>BALAMT"`
+		} `xml:"BANKMSGSRSV1>STMTTRNRS>STMTRS"`
+	}
+	if err := xml.Unmarshal(ofxStatement(snap, accounts["a1"]), &bank); err != nil {
+		t.Fatal(err)
+	}
+	s := bank.Statement
+	if s.Currency != "USD" || s.Account.ID != "a1" || s.Account.Type != "CHECKING" || s.Start != "20250101" || s.End != "20250110" || s.Balance != "870.00" {
+		t.Errorf("statement = %+v", s)
+	}
+	want := []ofxTransaction{
+		{"CREDIT", "20250101", "1000.00", "t1", "", ""},
+		{"DEBIT", "20250105", "-30.00", "t2", "Grocer & Sons, a very long payee", "Weekly shop"},
+		{"XFER", "20250106", "-100.00", "t3", "", ""},
+	}
+	if !reflect.DeepEqual(s.Transactions, want) {
+		t.Errorf("transactions =\n%+v\nwant\n%+v", s.Transactions, want)
+	}
+
+	var card struct {
+		Account      string           `xml:"CREDITCARDMSGSRSV1>CCSTMTTRNRS>CCSTMTRS>CCACCTFROM>ACCTID"`
+		Transactions []ofxTransaction `xml:"CREDITCARDMSGSRSV1>CCSTMTTRNRS>CCSTMTRS>BANKTRANLIST>STMTTRN"`
+	}
+	if err := xml.Unmarshal(ofxStatement(snap, accounts["a2"]), &card); err != nil {
+		t.Fatal(err)
+	}
+	if card.Account != "a2" || len(card.Transactions) != 1 || card.Transactions[0].Amount != "100.00" {
+		t.Errorf("credit card statement = %+v", card)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// pyPackage is the Python package pyproject writes
+const pyPackage = "ynab_vault"
+
+// pyProjectTOML makes the export installable with pip; %s is the version
+const pyProjectTOML = `# Generated by ynabvault export --format pyproject
+[build-system]
+requires = ["setuptools>=61"]
+build-backend = "setuptools.build_meta"
+
+[project]
+name = "ynab-vault"
+version = "%s"
+description = "YNAB budget history exported by ynabvault"
+requires-python = ">=3.8"
+dependencies = ["pandas>=1.5"]
+
+[tool.setuptools]
+packages = ["ynab_vault"]
+
+[tool.setuptools.package-data]
+ynab_vault = ["data/*.csv"]
+`
+
+// pyModuleHead opens the generated module, up to its table of column types
+const pyModuleHead = `"""Budget history exported by ynabvault.
+
+Generated by ` + "`ynabvault export --format pyproject`" + `; export again to
+refresh it rather than editing it. Each function returns a pandas DataFrame
+of one table, with a row per entity per snapshot. snapshot_id joins a row to
+the snapshots table, which names the budget and when it was taken.
+
+    import ynab_vault
+    transactions = ynab_vault.transactions()
+"""
+
+from pathlib import Path
+
+import pandas as pd
+
+DATA = Path(__file__).parent / "data"
+
+# Column types per table: string, Int64, boolean, date, datetime, or amount
+# for milliunits
+TABLES = {
+`
+
+// pyModuleLoad reads a table with its column types
+const pyModuleLoad = `}
+
+
+def load(table: str, units: bool = True) -> pd.DataFrame:
+    """Read a table with typed columns. Amounts are in currency units, or in
+    integer milliunits as YNAB stores them when units is False."""
+    columns = TABLES[table]
+    frame = pd.read_csv(
+        DATA / f"{table}.csv",
+        dtype={name: "Int64" if kind in ("Int64", "amount") else "string" for name, kind in columns.items()},
+        keep_default_na=False,
+        na_values=[""],
+    )
+    for name, kind in columns.items():
+        if kind == "amount" and units:
+            frame[name] = frame[name] / 1000
+        elif kind == "boolean":
+            frame[name] = frame[name].map({"true": True, "false": False}).astype("boolean")
+        elif kind == "date":
+            frame[name] = pd.to_datetime(frame[name], format="%Y-%m-%d")
+        elif kind == "datetime":
+            frame[name] = pd.to_datetime(frame[name], utc=True)
+    return frame
+`
+
+// pyBoolColumns are the columns that hold JSON booleans
+var pyBoolColumns = map[string]bool{"on_budget": true, "closed": true, "hidden": true, "approved": true}
+
+// pyTable is a CSV file of the package and the Python types of its columns
+type pyTable struct {
+	name    string
+	columns [][2]string // name and type
+	rows    [][]string
+}
+
+// exportPyProject writes an installable Python package into dir: a
+// pyproject.toml, the ynab_vault module with a function per table that
+// returns a typed pandas DataFrame, and the tables of every snapshot as CSV
+// in the package's data directory. It returns the file names written.
+func exportPyProject(dir string, snaps []exportSnapshot, r rollups) ([]string, error) {
+	tables := []*pyTable{{name: "snapshots", columns: [][2]string{
+		{"snapshot_id", "Int64"}, {"file", "string"}, {"budget_id", "string"}, {"budget_name", "string"}, {"taken_at", "datetime"},
+	}}}
+	for _, t := range exportTables {
+		p := &pyTable{name: t.name, columns: [][2]string{{"snapshot_id", "Int64"}}}
+		for _, c := range t.columns {
+			name, kind := strings.Fields(c)[0], "string"
+			switch {
+			case pyBoolColumns[name]:
+				kind = "boolean"
+			case name == "date" || name == "month":
+				kind = "date"
+			case name == "age_of_money":
+				kind = "Int64"
+			case strings.HasSuffix(c, " INTEGER"):
+				kind = "amount"
+			}
+			p.columns = append(p.columns, [2]string{name, kind})
+		}
+		tables = append(tables, p)
+	}
+	rollupTable := &pyTable{name: "rollups", columns: [][2]string{{"category_group", "string"}, {"rollup", "string"}}}
+	for _, group := range sortedKeys(r) {
+		rollupTable.rows = append(rollupTable.rows, []string{group, r[group]})
+	}
+
+	var newest time.Time
+	for i, s := range snaps {
+		id := strconv.Itoa(i + 1)
+		if s.Info.Time.After(newest) {
+			newest = s.Info.Time.UTC()
+		}
+		tables[0].rows = append(tables[0].rows, []string{id, s.Info.File, s.Info.ID, s.Info.Name, s.Info.Time.UTC().Format("2006-01-02T15:04:05Z")})
+		for i, t := range exportTables {
+			p := tables[i+1]
+			entities := entitiesByID(s.Budget[t.source])
+			if t.key == "month" {
+				entities = monthsByKey(s.Budget[t.source])
+			}
+			for _, key := range sortedKeys(entities) {
+				row := []string{id}
+				for _, c := range p.columns[1:] {
+					row = append(row, pyValue(entities[key][c[0]]))
+				}
+				p.rows = append(p.rows, row)
+			}
+		}
+	}
+	tables = append(tables, rollupTable)
+
+	files := map[string][]byte{
+		"pyproject.toml":                    fmt.Appendf(nil, pyProjectTOML, fmt.Sprintf("%d.%d.%d", newest.Year(), newest.Month(), newest.Day())),
+		path.Join(pyPackage, "__init__.py"): pyModule(tables),
+	}
+	for _, t := range tables {
+		rows := [][]string{{}}
+		for _, c := range t.columns {
+			rows[0] = append(rows[0], c[0])
+		}
+		var buf bytes.Buffer
+		if err := csv.NewWriter(&buf).WriteAll(append(rows, t.rows...)); err != nil {
+			return nil, err
+		}
+		files[path.Join(pyPackage, "data", t.name+".csv")] = buf.Bytes()
+	}
+	if err := os.MkdirAll(filepath.Join(dir, pyPackage, "data"), 0755); err != nil {
+		return nil, err
+	}
+	var written []string
+	for _, name := range sortedKeys(files) {
+		if err := ynabvault.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), files[name]); err != nil {
+			return written, fmt.Errorf("export %s: %w", name, err)
+		}
+		written = append(written, name)
+	}
+	return written, nil
+}
+
+// pyModule renders the ynab_vault module: the column types of every table,
+// the loader, and a function per table
+func pyModule(tables []*pyTable) []byte {
+	var out bytes.Buffer
+	out.WriteString(pyModuleHead)
+	for _, t := range tables {
+		fmt.Fprintf(&out, "    %q: {\n", t.name)
+		for _, c := range t.columns {
+			fmt.Fprintf(&out, "        %q: %q,\n", c[0], c[1])
+		}
+		out.WriteString("    },\n")
+	}
+	out.WriteString(pyModuleLoad)
+	names := []string{`"load"`, `"TABLES"`}
+	for _, t := range tables {
+		names = append(names, strconv.Quote(t.name))
+		amounts := slices.ContainsFunc(t.columns, func(c [2]string) bool { return c[1] == "amount" })
+		if amounts {
+			fmt.Fprintf(&out, "\n\ndef %s(units: bool = True) -> pd.DataFrame:\n", t.name)
+			fmt.Fprintf(&out, "    \"\"\"The %s table; see load.\"\"\"\n    return load(%q, units)\n", t.name, t.name)
+		} else {
+			fmt.Fprintf(&out, "\n\ndef %s() -> pd.DataFrame:\n", t.name)
+			fmt.Fprintf(&out, "    \"\"\"The %s table.\"\"\"\n    return load(%q)\n", t.name, t.name)
+		}
+	}
+	fmt.Fprintf(&out, "\n\n__all__ = [\n    %s,\n]\n", strings.Join(names, ",\n    "))
+	return out.Bytes()
+}
+
+// pyValue writes a decoded JSON field as a CSV cell: booleans as true or
+// false, missing values empty and nested values as JSON text
+func pyValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
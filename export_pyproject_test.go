@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestExportPyProject writes an installable package whose module describes
+// every table and whose CSVs hold each snapshot's rows
+func TestExportPyProject(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"Home_b1_20250101T000000Z.json": `{"data":{"budget":{"id":"b1","name":"Home","accounts":[{"id":"a1","name":"Checking","on_budget":true,"balance":1000}]}}}`,
+		"Home_b1_20250301T000000Z.json": reportBudget,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(config, []byte("rollups:\n  Needs: [Bills]\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	out := t.TempDir()
+	var stdout, stderr strings.Builder
+	args := []string{"export", "--output", dir, "--config", config, "--format", "pyproject", "--all", "--out", out}
+	if code := runCLI(args, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit code = %d; stderr: %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), filepath.Join(out, "ynab_vault", "data", "transactions.csv")) {
+		t.Errorf("stdout = %s", stdout.String())
+	}
+
+	read := func(name string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(out, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	if toml := read("pyproject.toml"); !strings.Contains(toml, `version = "2025.3.1"`) || !strings.Contains(toml, `dependencies = ["pandas>=1.5"]`) {
+		t.Errorf("pyproject.toml =\n%s", toml)
+	}
+	module := read("ynab_vault/__init__.py")
+	for _, want := range []string{
+		`        "taken_at": "datetime",`,
+		`        "on_budget": "boolean",`,
+		`        "age_of_money": "Int64",`,
+		"def transactions(units: bool = True) -> pd.DataFrame:\n",
+		"def payees() -> pd.DataFrame:\n",
+	} {
+		if !strings.Contains(module, want) {
+			t.Errorf("module lacks %q", want)
+		}
+	}
+	tests := []struct {
+		file string
+		want []string
+	}{
+		{"snapshots.csv", []string{
+			"snapshot_id,file,budget_id,budget_name,taken_at",
+			"1,Home_b1_20250101T000000Z.json,b1,Home,2025-01-01T00:00:00Z",
+			"2,Home_b1_20250301T000000Z.json,b1,Home,2025-03-01T00:00:00Z",
+		}},
+		{"accounts.csv", []string{
+			"snapshot_id,id,name,type,on_budget,closed,note,balance,cleared_balance,uncleared_balance,transfer_payee_id",
+			"1,a1,Checking,,true,,,1000,,,",
+			"2,a1,Checking,checking,true,,,1500000,,,",
+			"2,a2,Visa,creditCard,true,,,-200000,,,",
+			"2,a3,House,otherAsset,false,,,90000000,,,",
+			"2,a4,Old,savings,true,true,,0,,,",
+		}},
+		{"rollups.csv", []string{"category_group,rollup", "bills,Needs"}},
+	}
+	for _, tc := range tests {
+		if got := strings.Split(strings.TrimSpace(read("ynab_vault/data/"+tc.file)), "\n"); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s =\n%s", tc.file, strings.Join(got, "\n"))
+		}
+	}
+
+	if python, err := exec.LookPath("python3"); err == nil {
+		if out, err := exec.CommandContext(t.Context(), python, "-m", "py_compile", filepath.Join(out, "ynab_vault", "__init__.py")).CombinedOutput(); err != nil {
+			t.Errorf("generated module does not compile: %v\n%s", err, out)
+		}
+	}
+}
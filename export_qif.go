@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"strings"
+)
+
+// qifAccountTypes maps YNAB account types to QIF account types; any other
+// type is a bank account
+var qifAccountTypes = map[string]string{
+	"cash":           "Cash",
+	"creditCard":     "CCard",
+	"otherAsset":     "Oth A",
+	"lineOfCredit":   "Oth L",
+	"otherLiability": "Oth L",
+	"mortgage":       "Oth L",
+	"autoLoan":       "Oth L",
+	"studentLoan":    "Oth L",
+	"personalLoan":   "Oth L",
+	"medicalDebt":    "Oth L",
+	"otherDebt":      "Oth L",
+}
+
+// exportQIF writes one QIF file per account of each snapshot, in a
+// directory named after the snapshot, and returns the file names written
+func exportQIF(dir string, snaps []exportSnapshot, r rollups) ([]string, error) {
+	return exportAccountFiles(dir, ".qif", snaps, func(s exportSnapshot, account map[string]interface{}) ([]byte, error) {
+		return qifAccount(s.Budget, account, r), nil
+	})
+}
+
+// qifAccount renders an account's transactions as QIF, with categories as
+// Group:Category, or Bucket:Group:Category for a group with a rollup, and
+// transfers as [Account]
+func qifAccount(budget, account map[string]interface{}, r rollups) []byte {
+	accounts := entitiesByID(budget["accounts"])
+	payees := entitiesByID(budget["payees"])
+	categories := entitiesByID(budget["categories"])
+	groups := entitiesByID(budget["category_groups"])
+	category := func(line map[string]interface{}) string {
+		if to := stringField(line, "transfer_account_id"); to != "" {
+			return "[" + qifText(stringField(accounts[to], "name")) + "]"
+		}
+		id := stringField(line, "category_id")
+		c, ok := categories[id]
+		if !ok {
+			return ""
+		}
+		group := categoryGroup(categories, groups, id)
+		if group == internalCategoryGroup {
+			return qifText(stringField(c, "name"))
+		}
+		parts := []string{group, stringField(c, "name")}
+		if bucket := r.of(group); bucket != "" {
+			parts = append([]string{bucket}, parts...)
+		}
+		for i, p := range parts {
+			parts[i] = qifText(p)
+		}
+		return strings.Join(parts, ":")
+	}
+
+	kind := cmp.Or(qifAccountTypes[stringField(account, "type")], "Bank")
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "!Account\nN%s\nT%s\n^\n!Type:%s\n", qifText(stringField(account, "name")), kind, kind)
+	for _, e := range accountRegister(budget, stringField(account, "id")) {
+		t := e.Transaction
+		date := stringField(t, "date")
+		if len(date) == len("2006-01-02") {
+			date = date[5:7] + "/" + date[8:10] + "/" + date[:4]
+		}
+		fmt.Fprintf(&out, "D%s\nT%s\n", date, fixedAmount(milliunits(t["amount"]), 2))
+		switch stringField(t, "cleared") {
+		case "cleared":
+			out.WriteString("C*\n")
+		case "reconciled":
+			out.WriteString("CX\n")
+		}
+		if payee := qifText(stringField(payees[stringField(t, "payee_id")], "name")); payee != "" {
+			fmt.Fprintf(&out, "P%s\n", payee)
+		}
+		if memo := oneLine(stringField(t, "memo")); memo != "" {
+			fmt.Fprintf(&out, "M%s\n", memo)
+		}
+		if !e.split() {
+			if c := category(t); c != "" {
+				fmt.Fprintf(&out, "L%s\n", c)
+			}
+		} else {
+			for _, line := range e.Lines {
+				fmt.Fprintf(&out, "S%s\n", category(line))
+				if memo := oneLine(stringField(line, "memo")); memo != "" {
+					fmt.Fprintf(&out, "E%s\n", memo)
+				}
+				fmt.Fprintf(&out, "$%s\n", fixedAmount(milliunits(line["amount"]), 2))
+			}
+		}
+		out.WriteString("^\n")
+	}
+	return out.Bytes()
+}
+
+// qifText puts a name on one line without the colons and brackets QIF reads
+// as category structure
+func qifText(s string) string {
+	return oneLine(strings.NewReplacer(":", " ", "[", "(", "]", ")").Replace(s))
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// qifBudget is a budget with a split, a transfer and an inflow
+const qifBudget = `{"data":{"budget":{"id":"b1",
+	"accounts":[
+		{"id":"a1","name":"Checking","type":"checking","balance":870000},
+		{"id":"a2","name":"Visa [Gold]","type":"creditCard","balance":-30000},
+		{"id":"a3","name":"Checking!","type":"savings","balance":0}],
+	"payees":[{"id":"p1","name":"Grocer"},{"id":"p2","name":"Employer"}],
+	"category_groups":[{"id":"g1","name":"Everyday"},{"id":"g2","name":"Internal Master Category"}],
+	"categories":[
+		{"id":"c1","category_group_id":"g1","name":"Food"},
+		{"id":"c2","category_group_id":"g1","name":"Health: Drugs"},
+		{"id":"c3","category_group_id":"g2","name":"Inflow: Ready to Assign"}],
+	"transactions":[
+		{"id":"t1","date":"2025-01-01","account_id":"a1","payee_id":"p2","category_id":"c3","amount":1000000,"cleared":"reconciled"},
+		{"id":"t2","date":"2025-01-05","account_id":"a1","payee_id":"p1","amount":-30000,"memo":"Weekly\nshop","cleared":"uncleared"},
+		{"id":"t3","date":"2025-01-06","account_id":"a1","transfer_account_id":"a2","transfer_transaction_id":"t4","amount":-100000,"cleared":"cleared"},
+		{"id":"t4","date":"2025-01-06","account_id":"a2","transfer_account_id":"a1","transfer_transaction_id":"t3","amount":100000,"cleared":"cleared"}],
+	"subtransactions":[
+		{"id":"s1","transaction_id":"t2","category_id":"c1","amount":-20000},
+		{"id":"s2","transaction_id":"t2","category_id":"c2","amount":-10000,"memo":"Vitamins"}]}}}`
+
+// TestQIFAccount writes an account's transactions with categories, splits
+// and transfers
+func TestQIFAccount(t *testing.T) {
+	env, err := ynabvault.DecodeEnvelope([]byte(qifBudget))
+	if err != nil {
+		t.Fatal(err)
+	}
+	budget := env.Data.Budget
+	want := `!Account
+NChecking
+TBank
+^
+!Type:Bank
+D01/01/2025
+T1000.00
+CX
+PEmployer
+LInflow Ready to Assign
+^
+D01/05/2025
+T-30.00
+PGrocer
+MWeekly shop
+SNeeds:Everyday:Food
+$-20.00
+SNeeds:Everyday:Health Drugs
+EVitamins
+$-10.00
+^
+D01/06/2025
+T-100.00
+C*
+L[Visa (Gold)]
+^
+`
+	r := rollups{"everyday": "Needs"}
+	if got := string(qifAccount(budget, entitiesByID(budget["accounts"])["a1"], r)); got != want {
+		t.Errorf("QIF =\n%s\nwant\n%s", got, want)
+	}
+	if got := string(qifAccount(budget, entitiesByID(budget["accounts"])["a2"], nil)); !strings.HasPrefix(got, "!Account\nNVisa (Gold)\nTCCard\n^\n!Type:CCard\n") {
+		t.Errorf("credit card QIF =\n%s", got)
+	}
+}
+
+// TestExportQIFCommand writes one file per account into a directory per
+// snapshot, keeping file names apart
+func TestExportQIFCommand(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Home_b1_20250101T000000Z.json"), []byte(qifBudget), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := t.TempDir()
+	var stdout, stderr strings.Builder
+	if code := runCLI([]string{"export", "--output", dir, "--format", "qif", "--out", out}, &stdout, &stderr); code != 0 {
+		t.Fatalf("export exit code = %d; stderr: %s", code, stderr.String())
+	}
+	var want []string
+	for _, name := range []string{"Checking.qif", "Checking_2.qif", "Visa_Gold.qif"} {
+		want = append(want, filepath.Join(out, "Home_b1_20250101T000000Z", name))
+	}
+	if got := strings.Fields(stdout.String()); !reflect.DeepEqual(got, want) {
+		t.Errorf("written = %v; want %v", got, want)
+	}
+	for _, name := range want {
+		if _, err := os.Stat(name); err != nil {
+			t.Error(err)
+		}
+	}
+}
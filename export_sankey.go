@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+)
+
+// Nodes of a flow that stand for no YNAB entity
+const (
+	flowIncome   = "income"
+	flowUnspent  = "unspent"
+	flowReserves = "reserves"
+)
+
+// budgetFlows is a budget's money flow per month, shaped for Sankey
+// diagram tools
+type budgetFlows struct {
+	Budget   string      `json:"budget"`
+	Currency string      `json:"currency"`
+	Months   []monthFlow `json:"months"`
+}
+
+// monthFlow is one month's flow from income sources through category
+// groups to categories; amounts are in currency units
+type monthFlow struct {
+	Month  string      `json:"month"`
+	Income json.Number `json:"income"`
+	Spent  json.Number `json:"spent"`
+	Nodes  []flowNode  `json:"nodes"`
+	Links  []flowLink  `json:"links"`
+}
+
+// flowNode is a node of a flow; IDs are unique where names may not be
+type flowNode struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// flowLink is money moving between two nodes in a month
+type flowLink struct {
+	Source string      `json:"source"`
+	Target string      `json:"target"`
+	Value  json.Number `json:"value"`
+}
+
+// exportSankey writes one flow JSON file per snapshot into dir, named after
+// the snapshot file, and returns the file names written
+func exportSankey(dir string, snaps []exportSnapshot, r rollups) ([]string, error) {
+	return exportFiles(dir, ".sankey.json", snaps, func(s exportSnapshot) ([]byte, error) {
+		return json.MarshalIndent(sankeyFlows(s, r), "", "  ")
+	})
+}
+
+// exportSankeyCSV writes one flow CSV per snapshot into dir, with a row per
+// link of each month, and returns the file names written
+func exportSankeyCSV(dir string, snaps []exportSnapshot, r rollups) ([]string, error) {
+	return exportFiles(dir, ".sankey.csv", snaps, func(s exportSnapshot) ([]byte, error) {
+		rows := [][]string{{"Month", "Source", "Target", "Value"}}
+		for _, m := range sankeyFlows(s, r).Months {
+			names := map[string]string{}
+			for _, n := range m.Nodes {
+				names[n.ID] = n.Name
+			}
+			for _, l := range m.Links {
+				rows = append(rows, []string{m.Month, names[l.Source], names[l.Target], string(l.Value)})
+			}
+		}
+		var buf bytes.Buffer
+		err := csv.NewWriter(&buf).WriteAll(rows)
+		return buf.Bytes(), err
+	})
+}
+
+// sankeyFlows adds up a budget's on-budget transactions per month: income
+// from each payee into the inflow category flows into Income, and spending
+// flows from Income to each category group, through its rollup's bucket
+// if it has one, and on to each category. Transfers between budget
+// accounts are neither, and payees and categories that net the other way
+// are left out. Income left over flows to Unspent; spending beyond income
+// flows in from reserves.
+func sankeyFlows(s exportSnapshot, r rollups) budgetFlows {
+	budget := s.Budget
+	payees := entitiesByID(budget["payees"])
+	categories := entitiesByID(budget["categories"])
+	groups := entitiesByID(budget["category_groups"])
+	income, spending := monthlyActivity(budget)
+
+	out := budgetFlows{Budget: cmp.Or(stringField(budget, "name"), s.Info.Name), Currency: budgetCurrency(budget).ISOCode}
+	for _, month := range sortedKeys(income) {
+		f := flowBuilder{names: map[string]string{}, values: map[[2]string]int64{}}
+		var in, spent int64
+		for _, id := range sortedKeys(income[month]) {
+			if amount := income[month][id]; amount > 0 {
+				f.add("payee:"+id, cmp.Or(stringField(payees[id], "name"), "Unknown payee"), flowIncome, "Income", amount)
+				in += amount
+			}
+		}
+		for _, id := range sortedKeys(spending[month]) {
+			amount := spending[month][id]
+			if amount <= 0 {
+				continue
+			}
+			spent += amount
+			c, ok := categories[id]
+			if !ok {
+				f.add(flowIncome, "Income", "category:", "Uncategorized", amount)
+				continue
+			}
+			group := categoryGroup(categories, groups, id)
+			groupID := "group:" + stringField(c, "category_group_id")
+			from, fromName := flowIncome, "Income"
+			if bucket := r.of(group); bucket != "" {
+				f.add(from, fromName, "rollup:"+bucket, bucket, amount)
+				from, fromName = "rollup:"+bucket, bucket
+			}
+			f.add(from, fromName, groupID, group, amount)
+			f.add(groupID, group, "category:"+id, stringField(c, "name"), amount)
+		}
+		switch {
+		case in > spent:
+			f.add(flowIncome, "Income", flowUnspent, "Unspent", in-spent)
+		case spent > in:
+			f.add(flowReserves, "From reserves", flowIncome, "Income", spent-in)
+		}
+		if len(f.links) == 0 {
+			continue
+		}
+		m := monthFlow{Month: month, Income: json.Number(fixedAmount(in, 2)), Spent: json.Number(fixedAmount(spent, 2))}
+		for _, id := range f.nodes {
+			m.Nodes = append(m.Nodes, flowNode{id, f.names[id]})
+		}
+		for _, l := range f.links {
+			m.Links = append(m.Links, flowLink{l[0], l[1], json.Number(fixedAmount(f.values[l], 2))})
+		}
+		out.Months = append(out.Months, m)
+	}
+	return out
+}
+
+// flowBuilder collects a month's nodes and links in the order they are
+// first seen
+type flowBuilder struct {
+	nodes  []string
+	names  map[string]string
+	links  [][2]string
+	values map[[2]string]int64
+}
+
+// add records amount flowing from one node to another, naming both
+func (f *flowBuilder) add(from, fromName, to, toName string, amount int64) {
+	for _, n := range [][2]string{{from, fromName}, {to, toName}} {
+		if _, ok := f.names[n[0]]; !ok {
+			f.names[n[0]] = n[1]
+			f.nodes = append(f.nodes, n[0])
+		}
+	}
+	link := [2]string{from, to}
+	if _, ok := f.values[link]; !ok {
+		f.links = append(f.links, link)
+	}
+	f.values[link] += amount
+}
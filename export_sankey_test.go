@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// sankeyBudget has income, split spending, a refund, a transfer and a
+// tracking account over two months
+const sankeyBudget = `{"data":{"budget":{"id":"b1","name":"Home","currency_format":{"iso_code":"EUR"},
+	"accounts":[
+		{"id":"a1","name":"Checking","on_budget":true},
+		{"id":"a2","name":"Savings","on_budget":true},
+		{"id":"a3","name":"House","on_budget":false}],
+	"payees":[{"id":"p1","name":"Employer"},{"id":"p2","name":"Grocer"}],
+	"category_groups":[{"id":"g1","name":"Bills"},{"id":"g2","name":"Fun"},{"id":"g3","name":"Internal Master Category"}],
+	"categories":[
+		{"id":"c1","category_group_id":"g1","name":"Rent"},
+		{"id":"c2","category_group_id":"g1","name":"Food"},
+		{"id":"c3","category_group_id":"g2","name":"Games"},
+		{"id":"c4","category_group_id":"g3","name":"Inflow: Ready to Assign"}],
+	"transactions":[
+		{"id":"t1","date":"2025-01-01","account_id":"a1","payee_id":"p1","category_id":"c4","amount":2000000},
+		{"id":"t2","date":"2025-01-02","account_id":"a1","category_id":"c1","amount":-900000},
+		{"id":"t3","date":"2025-01-05","account_id":"a1","payee_id":"p2","amount":-150000},
+		{"id":"t4","date":"2025-01-06","account_id":"a1","transfer_account_id":"a2","amount":-500000},
+		{"id":"t5","date":"2025-01-06","account_id":"a2","transfer_account_id":"a1","amount":500000},
+		{"id":"t6","date":"2025-01-07","account_id":"a3","amount":100000000},
+		{"id":"t7","date":"2025-02-03","account_id":"a1","category_id":"c3","amount":-50000},
+		{"id":"t8","date":"2025-02-04","account_id":"a1","category_id":"c2","amount":10000}],
+	"subtransactions":[
+		{"id":"s1","transaction_id":"t3","category_id":"c2","amount":-120000},
+		{"id":"s2","transaction_id":"t3","category_id":"c3","amount":-30000}]}}}`
+
+// TestSankeyFlows follows income through rollups and groups to categories
+// per month and balances each month
+func TestSankeyFlows(t *testing.T) {
+	env, err := ynabvault.DecodeEnvelope([]byte(sankeyBudget))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := sankeyFlows(exportSnapshot{Budget: env.Data.Budget}, rollups{"bills": "Needs"})
+	if got.Budget != "Home" || got.Currency != "EUR" || len(got.Months) != 2 {
+		t.Fatalf("flows = %+v", got)
+	}
+	type link struct{ source, target, value string }
+	links := func(m monthFlow) []link {
+		names := map[string]string{}
+		for _, n := range m.Nodes {
+			names[n.ID] = n.Name
+		}
+		var out []link
+		for _, l := range m.Links {
+			out = append(out, link{names[l.Source], names[l.Target], string(l.Value)})
+		}
+		return out
+	}
+	jan := []link{
+		{"Employer", "Income", "2000.00"},
+		{"Income", "Needs", "1020.00"},
+		{"Needs", "Bills", "1020.00"},
+		{"Bills", "Rent", "900.00"},
+		{"Bills", "Food", "120.00"},
+		{"Income", "Fun", "30.00"},
+		{"Fun", "Games", "30.00"},
+		{"Income", "Unspent", "950.00"},
+	}
+	if m := got.Months[0]; m.Month != "2025-01" || m.Income != "2000.00" || m.Spent != "1050.00" || !reflect.DeepEqual(links(m), jan) {
+		t.Errorf("January = %s %s %s %v", m.Month, m.Income, m.Spent, links(m))
+	}
+	feb := []link{{"Income", "Fun", "50.00"}, {"Fun", "Games", "50.00"}, {"From reserves", "Income", "50.00"}}
+	if m := got.Months[1]; m.Month != "2025-02" || m.Income != "0.00" || !reflect.DeepEqual(links(m), feb) {
+		t.Errorf("February = %s %s %v", m.Month, m.Income, links(m))
+	}
+}
+
+// TestExportSankeyCommand writes flow JSON and CSV per snapshot
+func TestExportSankeyCommand(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Home_b1_20250301T000000Z.json"), []byte(sankeyBudget), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := t.TempDir()
+	for _, format := range []string{"sankey", "sankey-csv"} {
+		var stderr strings.Builder
+		if code := runCLI([]string{"export", "--output", dir, "--format", format, "--out", out}, &strings.Builder{}, &stderr); code != 0 {
+			t.Fatalf("%s export exit code = %d; stderr: %s", format, code, stderr.String())
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(out, "Home_b1_20250301T000000Z.sankey.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var flows budgetFlows
+	if err := json.Unmarshal(data, &flows); err != nil {
+		t.Fatal(err)
+	}
+	if len(flows.Months) != 2 || flows.Months[0].Nodes[0] != (flowNode{"payee:p1", "Employer"}) {
+		t.Errorf("flows = %+v", flows)
+	}
+	data, err = os.ReadFile(filepath.Join(out, "Home_b1_20250301T000000Z.sankey.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "Month,Source,Target,Value\n2025-01,Employer,Income,2000.00\n2025-01,Income,Bills,1020.00\n") {
+		t.Errorf("CSV =\n%s", data)
+	}
+}
@@ -0,0 +1,135 @@
+//go:build cgo
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteSchema creates the snapshot index, one table per entity list and
+// the rollups of category groups
+func sqliteSchema() []string {
+	stmts := []string{`CREATE TABLE IF NOT EXISTS snapshots (
+	id INTEGER PRIMARY KEY,
+	file TEXT NOT NULL UNIQUE,
+	budget_id TEXT NOT NULL,
+	budget_name TEXT NOT NULL,
+	taken_at TEXT NOT NULL
+)`, `CREATE TABLE IF NOT EXISTS rollups (
+	category_group TEXT PRIMARY KEY COLLATE NOCASE,
+	rollup TEXT NOT NULL
+)`}
+	for _, t := range exportTables {
+		stmts = append(stmts, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n\tsnapshot_id INTEGER NOT NULL REFERENCES snapshots(id),\n\t%s,\n\tPRIMARY KEY (snapshot_id, %s)\n)",
+			t.name, strings.Join(t.columns, ",\n\t"), t.key))
+	}
+	return stmts
+}
+
+// exportSQLite adds snaps to the SQLite database at path, creating it when
+// needed, and returns how many were added; snapshots already in the
+// database are skipped, so a vault's history can be exported incrementally.
+// The rollups table is replaced with r, so it applies to every snapshot.
+func exportSQLite(ctx context.Context, path string, snaps []exportSnapshot, r rollups) (n int, err error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if cerr := db.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	for _, stmt := range sqliteSchema() {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return 0, fmt.Errorf("create schema: %w", err)
+		}
+	}
+	if err := writeSQLiteRollups(ctx, db, r); err != nil {
+		return 0, fmt.Errorf("write rollups: %w", err)
+	}
+	for _, s := range snaps {
+		added, err := exportSQLiteSnapshot(ctx, db, s)
+		if err != nil {
+			return n, fmt.Errorf("export %s: %w", s.Info.File, err)
+		}
+		if added {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// exportSQLiteSnapshot writes one snapshot in a transaction and reports
+// whether it was new
+func exportSQLiteSnapshot(ctx context.Context, db *sql.DB, s exportSnapshot) (bool, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	res, err := tx.ExecContext(ctx, "INSERT OR IGNORE INTO snapshots (file, budget_id, budget_name, taken_at) VALUES (?, ?, ?, ?)",
+		s.Info.File, s.Info.ID, s.Info.Name, s.Info.Time.UTC().Format("2006-01-02T15:04:05Z"))
+	if err != nil {
+		return false, err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return false, nil
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return false, err
+	}
+	for _, t := range exportTables {
+		names := make([]string, len(t.columns))
+		for i, c := range t.columns {
+			names[i] = strings.Fields(c)[0]
+		}
+		stmt, err := tx.PrepareContext(ctx, fmt.Sprintf("INSERT INTO %s (snapshot_id, %s) VALUES (?%s)",
+			t.name, strings.Join(names, ", "), strings.Repeat(", ?", len(names))))
+		if err != nil {
+			return false, err
+		}
+		entities := entitiesByID(s.Budget[t.source])
+		if t.key == "month" {
+			entities = monthsByKey(s.Budget[t.source])
+		}
+		for _, key := range sortedKeys(entities) {
+			args := []interface{}{id}
+			for _, name := range names {
+				args = append(args, exportValue(entities[key][name]))
+			}
+			if _, err := stmt.ExecContext(ctx, args...); err != nil {
+				_ = stmt.Close()
+				return false, fmt.Errorf("%s %s: %w", t.name, key, err)
+			}
+		}
+		if err := stmt.Close(); err != nil {
+			return false, err
+		}
+	}
+	return true, tx.Commit()
+}
+
+// writeSQLiteRollups replaces the rollups table with r
+func writeSQLiteRollups(ctx context.Context, db *sql.DB, r rollups) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.ExecContext(ctx, "DELETE FROM rollups"); err != nil {
+		return err
+	}
+	for _, group := range sortedKeys(r) {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO rollups (category_group, rollup) VALUES (?, ?)", group, r[group]); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,13 @@
+//go:build !cgo
+
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// exportSQLite needs the cgo SQLite driver, which this binary was built without
+func exportSQLite(context.Context, string, []exportSnapshot, rollups) (int, error) {
+	return 0, errors.New("SQLite export is not available: ynabvault was built with CGO_ENABLED=0")
+}
@@ -0,0 +1,83 @@
+//go:build cgo
+
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestExportSQLite writes normalized tables and skips snapshots already exported
+func TestExportSQLite(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"Home_b1_20250101T000000Z.json": `{"data":{"budget":{"id":"b1",
+			"accounts":[{"id":"a1","name":"Checking","type":"checking","on_budget":true,"closed":false,"balance":100000}],
+			"payees":[{"id":"p1","name":"Grocer"}],
+			"category_groups":[{"id":"g1","name":"Bills","hidden":false}],
+			"categories":[{"id":"c1","category_group_id":"g1","name":"Food","budgeted":50000}],
+			"transactions":[{"id":"t1","date":"2025-01-02","amount":-12500,"account_id":"a1","payee_id":"p1","category_id":"c1","approved":true},
+				{"id":"t2","deleted":true}],
+			"subtransactions":[],
+			"months":[{"month":"2025-01-01","income":0,"budgeted":50000,"activity":-12500,"to_be_budgeted":0}]}}}`,
+		"Home_b1_20250102T000000Z.json": `{"data":{"budget":{"id":"b1","accounts":[{"id":"a1","name":"Checking","balance":87500}]}}}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db := filepath.Join(t.TempDir(), "vault.db")
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(config, []byte("rollups:\n  Needs: [Bills]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr strings.Builder
+	args := []string{"export", "--output", dir, "--out", db, "--all", "--config", config}
+	if code := runCLI(args, &stdout, &stderr); code != 0 {
+		t.Fatalf("export exit code = %d; stderr: %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "Exported 2 of 2") {
+		t.Errorf("unexpected output: %s", stdout.String())
+	}
+	// Running again adds nothing
+	stdout.Reset()
+	if code := runCLI(args, &stdout, &stderr); code != 0 {
+		t.Fatalf("second export exit code = %d; stderr: %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "Exported 0 of 2") {
+		t.Errorf("unexpected output on re-export: %s", stdout.String())
+	}
+
+	conn, err := sql.Open("sqlite3", db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	queries := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT count(*) FROM snapshots", "2"},
+		{"SELECT group_concat(balance) FROM (SELECT balance FROM accounts ORDER BY snapshot_id)", "100000,87500"},
+		{"SELECT count(*) FROM transactions", "1"},
+		{`SELECT p.name || ' ' || c.name || ' ' || t.amount || ' ' || t.approved FROM transactions t
+			JOIN payees p ON p.snapshot_id = t.snapshot_id AND p.id = t.payee_id
+			JOIN categories c ON c.snapshot_id = t.snapshot_id AND c.id = t.category_id`, "Grocer Food -12500 1"},
+		{"SELECT month || ' ' || activity FROM months", "2025-01-01 -12500"},
+		{"SELECT r.rollup FROM category_groups g JOIN rollups r ON r.category_group = g.name", "Needs"},
+	}
+	for _, q := range queries {
+		var got string
+		if err := conn.QueryRowContext(t.Context(), q.query).Scan(&got); err != nil {
+			t.Fatalf("%s: %v", q.query, err)
+		}
+		if got != q.want {
+			t.Errorf("%s = %q; want %q", q.query, got, q.want)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestSelectExportSnapshots picks the newest snapshot per budget unless all is set
+func TestSelectExportSnapshots(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2025, 1, d, 0, 0, 0, 0, time.UTC) }
+	snaps := []snapshotInfo{
+		{Name: "Home", ID: "b1", Time: day(1), File: "h1"},
+		{Name: "Home", ID: "b1", Time: day(2), File: "h2"},
+		{Name: "Work", ID: "b2", Time: day(1), File: "w1"},
+	}
+	files := func(list []snapshotInfo) []string {
+		var out []string
+		for _, s := range list {
+			out = append(out, s.File)
+		}
+		return out
+	}
+	tests := []struct {
+		budget string
+		all    bool
+		want   []string
+	}{
+		{"", false, []string{"h2", "w1"}},
+		{"", true, []string{"h1", "h2", "w1"}},
+		{"Home", true, []string{"h1", "h2"}},
+		{"b2", false, []string{"w1"}},
+		{"Other", false, nil},
+	}
+	for _, tc := range tests {
+		if got := files(selectExportSnapshots(snaps, tc.budget, tc.all)); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("selectExportSnapshots(%q, %v) = %v; want %v", tc.budget, tc.all, got, tc.want)
+		}
+	}
+}
+
+// TestExportValue flattens decoded JSON into column values
+func TestExportValue(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want interface{}
+	}{
+		{json.Number("-12500"), int64(-12500)},
+		{json.Number("1.5"), 1.5},
+		{true, int64(1)},
+		{false, int64(0)},
+		{"text", "text"},
+		{nil, nil},
+		{map[string]interface{}{"a": "b"}, `{"a":"b"}`},
+	}
+	for _, tc := range tests {
+		if got := exportValue(tc.in); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("exportValue(%#v) = %#v; want %#v", tc.in, got, tc.want)
+		}
+	}
+}
+
+// TestFixedAmount renders milliunits exactly, never dropping a digit
+func TestFixedAmount(t *testing.T) {
+	for _, tc := range []struct {
+		n      int64
+		digits int
+		want   string
+	}{
+		{-12500, 2, "-12.50"}, {1234567, 2, "1234.567"}, {5, 2, "0.005"}, {5000, 0, "5"}, {5500, 0, "5.500"},
+		{1, 3, "0.001"}, {0, 2, "0.00"}, {1230, 4, "1.230"}, {-1000, -1, "-1"},
+	} {
+		if got := fixedAmount(tc.n, tc.digits); got != tc.want {
+			t.Errorf("fixedAmount(%d, %d) = %q; want %q", tc.n, tc.digits, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"time"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// freezeFileName marks a vault as frozen; while it exists nothing that
+// changes the vault's snapshots runs
+const freezeFileName = ".ynabvault-freeze.json"
+
+// freezeInfo is the content of the freeze marker
+type freezeInfo struct {
+	Since  time.Time  `json:"since"`
+	Reason string     `json:"reason,omitempty"`
+	Client clientInfo `json:"client"`
+}
+
+func (f freezeInfo) String() string {
+	return f.describe(Localizer{lang: defaultLang})
+}
+
+// describe is String in l's language
+func (f freezeInfo) describe(l Localizer) string {
+	s := l.T(msgFrozenSince, f.Since.Format(time.RFC3339), f.Client.Host)
+	if f.Reason != "" {
+		s += " (" + f.Reason + ")"
+	}
+	return s
+}
+
+// loadFreeze returns the vault's freeze marker, or nil when it is not frozen
+func loadFreeze(ctx context.Context, store ynabvault.Store) (*freezeInfo, error) {
+	data, err := store.Get(ctx, freezeFileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read freeze marker: %w: %w", ynabvault.ErrBackend, err)
+	}
+	var f freezeInfo
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("decode freeze marker: %w: %w", ynabvault.ErrCorrupt, err)
+	}
+	return &f, nil
+}
+
+// checkNotFrozen fails with ErrFrozen when the vault is frozen
+func checkNotFrozen(ctx context.Context, store ynabvault.Store) error {
+	f, err := loadFreeze(ctx, store)
+	if err != nil || f == nil {
+		return err
+	}
+	return fmt.Errorf("%w %s; run 'ynabvault unfreeze --yes' to lift it", ynabvault.ErrFrozen, f)
+}
+
+// freezeVault writes the freeze marker
+func freezeVault(ctx context.Context, store ynabvault.Store, reason string) error {
+	data, err := json.MarshalIndent(freezeInfo{Since: time.Now().UTC(), Reason: reason, Client: currentClient()}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := store.Put(ctx, freezeFileName, data); err != nil {
+		return fmt.Errorf("write freeze marker: %w: %w", ynabvault.ErrBackend, err)
+	}
+	return nil
+}
+
+// unfreezeVault removes the freeze marker
+func unfreezeVault(ctx context.Context, store ynabvault.Store) error {
+	if err := store.Delete(ctx, freezeFileName); err != nil {
+		return fmt.Errorf("remove freeze marker: %w: %w", ynabvault.ErrBackend, err)
+	}
+	return nil
+}
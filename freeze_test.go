@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestFreeze stops backup, prune and sync --repair until the vault is unfrozen
+func TestFreeze(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"data":{"budgets":[]}}`)
+	}))
+	defer srv.Close()
+	dir, src := t.TempDir(), t.TempDir()
+	backup := []string{"backup", "--token", "tok", "--url", srv.URL, "--output", dir}
+
+	steps := []struct {
+		name     string
+		args     []string
+		wantCode int
+		wantOut  string
+	}{
+		{"freeze", []string{"freeze", "--output", dir, "--reason", "tax audit"}, 0, "Froze"},
+		{"freeze again", []string{"freeze", "--output", dir}, 0, "already frozen"},
+		{"backup", backup, exitFrozen, "tax audit"},
+		{"prune", []string{"prune", "--output", dir, "--keep-daily", "1"}, exitFrozen, "unfreeze --yes"},
+		{"prune dry run", []string{"prune", "--output", dir, "--keep-daily", "1", "--dry-run"}, 0, ""},
+		{"sync repair", []string{"sync", "--output", src, "--to", dir, "--repair"}, exitFrozen, "tax audit"},
+		{"sync report", []string{"sync", "--output", src, "--to", dir}, 0, "0 files missing"},
+		{"unfreeze unconfirmed", []string{"unfreeze", "--output", dir}, 2, "pass --yes"},
+		{"unfreeze unconfirmed in German", []string{"unfreeze", "--output", dir, "--lang", "de"}, 2, "ist eingefroren seit"},
+		{"still frozen", backup, exitFrozen, "vault frozen"},
+		{"unfreeze", []string{"unfreeze", "--output", dir, "--yes"}, 0, "Unfroze"},
+		{"unfreeze again", []string{"unfreeze", "--output", dir, "--yes"}, 0, "not frozen"},
+		{"backup after", backup, 0, ""},
+	}
+	for _, st := range steps {
+		var stdout, stderr bytes.Buffer
+		code := runCLI(st.args, &stdout, &stderr)
+		if code != st.wantCode {
+			t.Fatalf("%s: exit %d; want %d (stderr: %s)", st.name, code, st.wantCode, stderr.String())
+		}
+		if out := stdout.String() + stderr.String(); !strings.Contains(out, st.wantOut) {
+			t.Errorf("%s: output %q does not contain %q", st.name, out, st.wantOut)
+		}
+	}
+}
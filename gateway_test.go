@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestGatewayAuthCheck rejects entries that cannot produce a header
+func TestGatewayAuthCheck(t *testing.T) {
+	tests := []struct {
+		g       gatewayAuth
+		wantErr string
+	}{
+		{gatewayAuth{Type: "header", Header: "X-Gateway", Value: "v"}, ""},
+		{gatewayAuth{Type: "hmac", Header: "X-Signature", ValueEnv: "KEY"}, ""},
+		{gatewayAuth{Type: "oidc", Header: "X-Gateway", Value: "v"}, "header or hmac"},
+		{gatewayAuth{Type: "header", Value: "v"}, "header is required"},
+		{gatewayAuth{Type: "header", Header: "authorization", Value: "v"}, "Authorization"},
+		{gatewayAuth{Type: "hmac", Header: "X-Sig", TimestampHeader: "Authorization", Value: "v"}, "Authorization"},
+		{gatewayAuth{Type: "header", Header: "X-Gateway"}, "exactly one"},
+		{gatewayAuth{Type: "header", Header: "X-Gateway", Value: "v", ValueFile: "f"}, "exactly one"},
+	}
+	for _, tc := range tests {
+		err := checkGatewayAuth([]gatewayAuth{tc.g})
+		if tc.wantErr == "" && err != nil {
+			t.Errorf("checkGatewayAuth(%+v): %v", tc.g, err)
+		}
+		if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+			t.Errorf("checkGatewayAuth(%+v) error = %v; want %q", tc.g, err, tc.wantErr)
+		}
+	}
+}
+
+// TestGatewayTransport adds a header, re-reads a rotated token file and
+// signs requests, leaving the YNAB token alone
+func TestGatewayTransport(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer srv.Close()
+	tokenFile := filepath.Join(t.TempDir(), "oidc.token")
+	if err := os.WriteFile(tokenFile, []byte("first\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tr := newGatewayTransport(nil, []gatewayAuth{
+		{Type: "header", Header: "X-Forward-Auth", Prefix: "Bearer ", ValueFile: tokenFile},
+		{Type: "hmac", Header: "X-Signature", Value: "key"},
+	})
+	tr.now = func() time.Time { return time.Unix(1700000000, 0) }
+	send := func() {
+		t.Helper()
+		req, _ := http.NewRequestWithContext(t.Context(), http.MethodPost, srv.URL+"/v1/budgets?x=1", bytes.NewReader([]byte("body")))
+		req.Header.Set("Authorization", "Bearer ynab")
+		resp, err := tr.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip: %v", err)
+		}
+		resp.Body.Close()
+		if req.Header.Get("X-Signature") != "" {
+			t.Error("RoundTrip modified the caller's request")
+		}
+	}
+
+	send()
+	if v := got.Get("X-Forward-Auth"); v != "Bearer first" {
+		t.Errorf("X-Forward-Auth = %q; want %q", v, "Bearer first")
+	}
+	if v := got.Get("Authorization"); v != "Bearer ynab" {
+		t.Errorf("Authorization = %q; want the YNAB token untouched", v)
+	}
+	if v := got.Get(defaultTimestampHeader); v != "1700000000" {
+		t.Errorf("%s = %q; want 1700000000", defaultTimestampHeader, v)
+	}
+	bodySum := sha256.Sum256([]byte("body"))
+	mac := hmac.New(sha256.New, []byte("key"))
+	io.WriteString(mac, "POST\n"+srv.URL+"/v1/budgets?x=1\n1700000000\n"+hex.EncodeToString(bodySum[:]))
+	if v, want := got.Get("X-Signature"), hex.EncodeToString(mac.Sum(nil)); v != want {
+		t.Errorf("X-Signature = %q; want %q", v, want)
+	}
+
+	if err := os.WriteFile(tokenFile, []byte("second"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	send()
+	if v := got.Get("X-Forward-Auth"); v != "Bearer second" {
+		t.Errorf("X-Forward-Auth after rotation = %q; want %q", v, "Bearer second")
+	}
+}
+
+// TestRunCLIBackupGatewayAuth sends the configured header with every API
+// request and rejects a broken entry before any request
+func TestRunCLIBackupGatewayAuth(t *testing.T) {
+	var seen []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, r.Header.Get("X-Egress-Token"))
+		_, _ = io.WriteString(w, `{"data":{"budgets":[]}}`)
+	}))
+	defer srv.Close()
+	t.Setenv("EGRESS_TOKEN", "secret")
+
+	cfg := writeConfig(t, t.TempDir(), "gateway_auth:\n  - type: header\n    header: X-Egress-Token\n    value_env: EGRESS_TOKEN\n")
+	var stderr bytes.Buffer
+	args := []string{"backup", "--token", "tok", "--config", cfg, "--url", srv.URL, "--output", t.TempDir()}
+	if code := runCLI(args, io.Discard, &stderr); code != 0 {
+		t.Fatalf("backup exit code = %d; stderr: %s", code, stderr.String())
+	}
+	if len(seen) != 1 || seen[0] != "secret" {
+		t.Errorf("gateway header on requests = %q; want [secret]", seen)
+	}
+
+	seen = nil
+	cfg = writeConfig(t, t.TempDir(), "gateway_auth:\n  - type: header\n    header: X-Egress-Token\n")
+	args = []string{"backup", "--token", "tok", "--config", cfg, "--url", srv.URL, "--output", t.TempDir()}
+	if code := runCLI(args, io.Discard, io.Discard); code != 2 || len(seen) != 0 {
+		t.Errorf("backup with a broken entry exit code = %d, requests %d; want 2 and none", code, len(seen))
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// Message IDs for user-facing CLI output; the text lives in locales/<lang>.json
+const (
+	msgErrorPrefix      = "error_prefix"
+	msgTokenRequired    = "token_required"
+	msgProcessedBudgets = "processed_budgets"
+	msgUnknownCommand   = "unknown_command"
+	msgNoSnapshots      = "no_snapshots"
+	msgNoRuns           = "no_runs"
+	msgDeprecatedFlag   = "deprecated_flag"
+	msgMinIntervalSkip  = "min_interval_skip"
+
+	// Refusals of --read-only; the argument is the command as typed
+	msgReadOnly        = "read_only"
+	msgReadOnlyDryRun  = "read_only_dry_run"
+	msgReadOnlyDecrypt = "read_only_decrypt"
+
+	// The refusal of --offline; the argument is the command as typed
+	msgOffline = "offline"
+
+	// Output of freeze and unfreeze
+	msgFrozenSince         = "frozen_since"
+	msgAlreadyFrozen       = "already_frozen"
+	msgFroze               = "froze"
+	msgNotFrozen           = "not_frozen"
+	msgUnfreezeUnconfirmed = "unfreeze_unconfirmed"
+	msgUnfroze             = "unfroze"
+
+	// Output of sync
+	msgSyncNeedsTo = "sync_needs_to"
+	msgSyncMissing = "sync_missing"
+	msgSyncDiffers = "sync_differs"
+	msgSyncSummary = "sync_summary"
+	msgSyncCopied  = "sync_copied"
+	msgSyncPinned  = "sync_pinned"
+
+	// Titles, column headers and row labels of report tables
+	msgReportTitle       = "report_title"
+	msgTrendTitle        = "trend_title"
+	msgReportAssets      = "report_assets"
+	msgReportLiabilities = "report_liabilities"
+	msgReportNetWorth    = "report_net_worth"
+	msgColAccount        = "col_account"
+	msgColType           = "col_type"
+	msgColBalance        = "col_balance"
+	msgColMonth          = "col_month"
+	msgColGroup          = "col_group"
+	msgColRollup         = "col_rollup"
+	msgColSpent          = "col_spent"
+	msgColIncome         = "col_income"
+	msgColNet            = "col_net"
+	msgColTaken          = "col_taken"
+	msgColNetWorth       = "col_net_worth"
+	msgColCategory       = "col_category"
+	msgColFirst          = "col_first"
+	msgColLast           = "col_last"
+	msgColChange         = "col_change"
+	msgColTrend          = "col_trend"
+)
+
+const defaultLang = "en"
+
+//go:embed locales/*.json
+var localeFS embed.FS
+
+// catalogs maps a language code to its message catalog
+var catalogs = mustLoadCatalogs()
+
+// mustLoadCatalogs parses every embedded locale file; a broken catalog is a build bug
+func mustLoadCatalogs() map[string]map[string]string {
+	entries, err := localeFS.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	out := make(map[string]map[string]string, len(entries))
+	for _, e := range entries {
+		data, err := localeFS.ReadFile(path.Join("locales", e.Name()))
+		if err != nil {
+			panic(err)
+		}
+		var msgs map[string]string
+		if err := json.Unmarshal(data, &msgs); err != nil {
+			panic(fmt.Sprintf("locale %s: %v", e.Name(), err))
+		}
+		out[strings.TrimSuffix(e.Name(), ".json")] = msgs
+	}
+	return out
+}
+
+// Localizer renders messages in a single language, falling back to English
+type Localizer struct {
+	lang string
+}
+
+// newLocalizer picks the language from the explicit setting, then the
+// LC_ALL, LC_MESSAGES and LANG environment variables
+func newLocalizer(lang string) Localizer {
+	for _, v := range []string{lang, os.Getenv("LC_ALL"), os.Getenv("LC_MESSAGES"), os.Getenv("LANG")} {
+		if code := langCode(v); code != "" {
+			if _, ok := catalogs[code]; ok {
+				return Localizer{lang: code}
+			}
+		}
+	}
+	return Localizer{lang: defaultLang}
+}
+
+// langCode reduces a locale such as "de_DE.UTF-8" to its language code
+func langCode(locale string) string {
+	code, _, _ := strings.Cut(locale, ".")
+	code, _, _ = strings.Cut(code, "_")
+	code, _, _ = strings.Cut(code, "-")
+	return strings.ToLower(code)
+}
+
+// columns joins the messages with the given IDs into a tab-separated header
+func (l Localizer) columns(ids ...string) string {
+	cols := make([]string, len(ids))
+	for i, id := range ids {
+		cols[i] = l.T(id)
+	}
+	return strings.Join(cols, "\t")
+}
+
+// T formats the message with the given ID in the localizer's language
+func (l Localizer) T(id string, args ...interface{}) string {
+	msg, ok := catalogs[l.lang][id]
+	if !ok {
+		msg, ok = catalogs[defaultLang][id]
+	}
+	if !ok {
+		msg = id
+	}
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
@@ -0,0 +1,55 @@
+package main
+
+import "testing"
+
+// TestCatalogsComplete ensures every locale translates every English message
+func TestCatalogsComplete(t *testing.T) {
+	for _, want := range []string{"en", "de", "nl", "es"} {
+		if _, ok := catalogs[want]; !ok {
+			t.Errorf("missing catalog %q", want)
+		}
+	}
+	for lang, msgs := range catalogs {
+		for id := range catalogs[defaultLang] {
+			if msgs[id] == "" {
+				t.Errorf("catalog %q lacks message %q", lang, id)
+			}
+		}
+	}
+}
+
+// TestNewLocalizer checks language resolution from flag and environment
+func TestNewLocalizer(t *testing.T) {
+	tests := []struct {
+		flag, lcAll, lang string
+		want              string
+	}{
+		{"", "", "", "en"},
+		{"de", "", "", "de"},
+		{"", "", "nl_NL.UTF-8", "nl"},
+		{"", "es_ES.UTF-8", "de_DE.UTF-8", "es"},
+		{"fr", "", "de_DE", "de"},
+		{"", "C", "", "en"},
+	}
+	for _, tc := range tests {
+		t.Setenv("LC_ALL", tc.lcAll)
+		t.Setenv("LC_MESSAGES", "")
+		t.Setenv("LANG", tc.lang)
+		if got := newLocalizer(tc.flag).lang; got != tc.want {
+			t.Errorf("newLocalizer(%q) with LC_ALL=%q LANG=%q = %q; want %q", tc.flag, tc.lcAll, tc.lang, got, tc.want)
+		}
+	}
+}
+
+// TestLocalizerT checks formatting and fallbacks
+func TestLocalizerT(t *testing.T) {
+	if got := (Localizer{lang: "nl"}).T(msgProcessedBudgets, 3, 2, 1); got != "3 budgetten verwerkt: 2 gedownload, 1 ongewijzigd" {
+		t.Errorf("nl processed = %q", got)
+	}
+	if got := (Localizer{lang: "xx"}).T(msgErrorPrefix); got != "Error:" {
+		t.Errorf("fallback = %q; want English", got)
+	}
+	if got := (Localizer{lang: "en"}).T("no_such_message"); got != "no_such_message" {
+		t.Errorf("unknown id = %q; want the id itself", got)
+	}
+}
@@ -0,0 +1,111 @@
+// Package s3test fakes an S3 endpoint for tests
+package s3test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Server is an in-memory S3 endpoint supporting the calls the S3 store makes
+type Server struct {
+	mu      sync.Mutex
+	Objects map[string][]byte // "bucket/key" -> body
+	BadETag bool              // report a wrong ETag for uploads
+}
+
+func (f *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	switch {
+	case r.Method == http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+			body = decodeAWSChunked(body)
+		}
+		f.Objects[bucket+"/"+key] = body
+		sum := md5.Sum(body)
+		if f.BadETag {
+			sum[0]++
+		}
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	case r.Method == http.MethodGet && key == "" && r.URL.Query().Get("list-type") == "2":
+		type content struct {
+			Key  string
+			Size int
+		}
+		var result struct {
+			XMLName  xml.Name  `xml:"ListBucketResult"`
+			Name     string    `xml:"Name"`
+			Contents []content `xml:"Contents"`
+		}
+		result.Name = bucket
+		prefix := bucket + "/" + r.URL.Query().Get("prefix")
+		for k := range f.Objects {
+			if strings.HasPrefix(k, prefix) {
+				result.Contents = append(result.Contents, content{Key: strings.TrimPrefix(k, bucket+"/"), Size: len(f.Objects[k])})
+			}
+		}
+		sort.Slice(result.Contents, func(a, b int) bool { return result.Contents[a].Key < result.Contents[b].Key })
+		_ = xml.NewEncoder(w).Encode(result)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		body, ok := f.Objects[bucket+"/"+key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			if r.Method == http.MethodGet {
+				_, _ = io.WriteString(w, `<Error><Code>NoSuchKey</Code><Message>missing</Message></Error>`)
+			}
+			return
+		}
+		w.Header().Set("Last-Modified", "Wed, 01 Jan 2025 00:00:00 GMT")
+		_, _ = w.Write(body)
+	case r.Method == http.MethodDelete:
+		delete(f.Objects, bucket+"/"+key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+// decodeAWSChunked strips the framing of a signed streaming upload:
+// "<hex size>;chunk-signature=...\r\n<data>\r\n" repeated until size 0
+func decodeAWSChunked(body []byte) []byte {
+	var out []byte
+	for {
+		header, rest, ok := bytes.Cut(body, []byte("\r\n"))
+		if !ok {
+			return out
+		}
+		hexSize, _, _ := bytes.Cut(header, []byte(";"))
+		n, err := strconv.ParseInt(string(hexSize), 16, 64)
+		if err != nil || n == 0 || int64(len(rest)) < n {
+			return out
+		}
+		out = append(out, rest[:n]...)
+		body = bytes.TrimPrefix(rest[n:], []byte("\r\n"))
+	}
+}
+
+// New starts a fake endpoint and points the AWS environment at it
+func New(t *testing.T) *Server {
+	t.Helper()
+	f := &Server{Objects: map[string][]byte{}}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	t.Setenv("AWS_ENDPOINT_URL", srv.URL)
+	t.Setenv("AWS_ENDPOINT_URL_S3", "")
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_REGION", "us-east-1")
+	return f
+}
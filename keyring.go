@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/zalando/go-keyring"
+	"golang.org/x/term"
+)
+
+// keyringService names ynabvault's entries in the OS keyring
+const keyringService = "ynabvault"
+
+// defaultKeyringAccount is the keyring entry used without --keyring-account
+const defaultKeyringAccount = "default"
+
+// tokenSources are the values --token-source accepts
+var tokenSources = []string{"env", "keyring", "oauth"}
+
+// stdin is where auth set reads a token from; tests replace it
+var stdin io.Reader = os.Stdin
+
+// tokenFlags choose where a command finds the token when --token is not given
+type tokenFlags struct {
+	source  string
+	account string
+}
+
+func (t *tokenFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&t.source, "token-source", "env", "Where to find the token without --token: env (YNAB_BEARER_TOKEN), keyring or oauth (see auth login)")
+	fs.StringVar(&t.account, "keyring-account", defaultKeyringAccount, "OS keyring entry holding the token, see 'ynabvault auth set'")
+}
+
+// resolve returns tok when set, otherwise the token from the chosen source
+func (t tokenFlags) resolve(ctx context.Context, tok string) (string, error) {
+	if tok != "" {
+		return tok, nil
+	}
+	switch t.source {
+	case "env", "":
+		return os.Getenv("YNAB_BEARER_TOKEN"), nil
+	case "keyring":
+		return keyringToken(t.account)
+	case "oauth":
+		return oauthToken(ctx, t.account)
+	}
+	return "", fmt.Errorf("unknown --token-source %q, want %s", t.source, strings.Join(tokenSources, ", "))
+}
+
+// keyringToken reads the token stored under account in the OS keyring
+func keyringToken(account string) (string, error) {
+	tok, err := keyring.Get(keyringService, account)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return "", fmt.Errorf("no token for %q in the OS keyring; store one with 'ynabvault auth set --keyring-account %s'", account, account)
+	}
+	if err != nil {
+		return "", fmt.Errorf("read OS keyring: %w", err)
+	}
+	return tok, nil
+}
+
+// readToken reads a token from r, prompting without echo on a terminal
+func readToken(r io.Reader, prompt io.Writer) (string, error) {
+	if f, ok := r.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		fmt.Fprint(prompt, "YNAB personal access token: ")
+		line, err := term.ReadPassword(int(f.Fd()))
+		fmt.Fprintln(prompt)
+		return strings.TrimSpace(string(line)), err
+	}
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// setKeyringToken stores tok under account in the OS keyring
+func setKeyringToken(account, tok string) error {
+	if err := keyring.Set(keyringService, account, tok); err != nil {
+		return fmt.Errorf("write OS keyring: %w", err)
+	}
+	return nil
+}
+
+// deleteKeyringToken removes the token stored under account
+func deleteKeyringToken(account string) error {
+	err := keyring.Delete(keyringService, account)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return fmt.Errorf("no token for %q in the OS keyring", account)
+	}
+	if err != nil {
+		return fmt.Errorf("write OS keyring: %w", err)
+	}
+	return nil
+}
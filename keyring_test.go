@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+// TestTokenFlagsResolve prefers --token, then the chosen source
+func TestTokenFlagsResolve(t *testing.T) {
+	keyring.MockInit()
+	t.Setenv("YNAB_BEARER_TOKEN", "from-env")
+	if err := setKeyringToken("work", "from-keyring"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		flags   tokenFlags
+		tok     string
+		want    string
+		wantErr string
+	}{
+		{"flag wins", tokenFlags{source: "keyring", account: "work"}, "from-flag", "from-flag", ""},
+		{"env", tokenFlags{source: "env"}, "", "from-env", ""},
+		{"keyring", tokenFlags{source: "keyring", account: "work"}, "", "from-keyring", ""},
+		{"missing entry", tokenFlags{source: "keyring", account: "home"}, "", "", "auth set --keyring-account home"},
+		{"unknown source", tokenFlags{source: "vault"}, "", "", "unknown --token-source"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.flags.resolve(t.Context(), tc.tok)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("resolve() error = %v; want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tc.want {
+				t.Errorf("resolve() = %q, %v; want %q", got, err, tc.want)
+			}
+		})
+	}
+}
+
+// TestAuthSetAndBackup stores a token from stdin and backs up with it
+func TestAuthSetAndBackup(t *testing.T) {
+	keyring.MockInit()
+	t.Setenv("YNAB_BEARER_TOKEN", "")
+	defer func(r io.Reader) { stdin = r }(stdin)
+	stdin = strings.NewReader("secret\n")
+
+	var stdout, stderr bytes.Buffer
+	if code := runCLI([]string{"auth", "set", "--keyring-account", "family"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("auth set exit %d: %s", code, stderr.String())
+	}
+	if strings.Contains(stdout.String()+stderr.String(), "secret") {
+		t.Errorf("auth set echoed the token: %s%s", stdout.String(), stderr.String())
+	}
+
+	var auth []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = append(auth, r.Header.Get("Authorization"))
+		_, _ = io.WriteString(w, `{"data":{"budgets":[]}}`)
+	}))
+	defer srv.Close()
+	args := []string{"backup", "--url", srv.URL, "--output", t.TempDir(), "--token-source", "keyring", "--keyring-account", "family"}
+	if code := runCLI(args, io.Discard, &stderr); code != 0 {
+		t.Fatalf("backup exit %d: %s", code, stderr.String())
+	}
+	if len(auth) == 0 || auth[0] != "Bearer secret" {
+		t.Errorf("Authorization = %v; want the keyring token", auth)
+	}
+
+	// A config profile can name the keyring entry too
+	cfg := filepath.Join(t.TempDir(), "ynabvault.yaml")
+	if err := os.WriteFile(cfg, []byte("token_keyring: family\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := loadConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok, err := file.profileConfig.token(); err != nil || tok != "secret" {
+		t.Errorf("token_keyring token() = %q, %v; want secret", tok, err)
+	}
+
+	if code := runCLI([]string{"auth", "delete", "--keyring-account", "family"}, io.Discard, &stderr); code != 0 {
+		t.Fatalf("auth delete exit %d: %s", code, stderr.String())
+	}
+	if _, err := keyringToken("family"); err == nil {
+		t.Error("token still in the keyring after auth delete")
+	}
+	if code := runCLI([]string{"auth", "set"}, io.Discard, &stderr); code != 1 {
+		t.Errorf("auth set without a token exit %d; want 1", code)
+	}
+}
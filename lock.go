@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// lockFileName is the lease a process holds while it updates the vault
+const lockFileName = ".ynabvault-lock.json"
+
+// lockSettle is how long acquire waits before reading its lease back, so a
+// racing writer's Put lands first and one of the two backs off
+var lockSettle = 500 * time.Millisecond
+
+// lockFlags are the locking options of commands that write the vault
+type lockFlags struct {
+	ttl   time.Duration
+	force bool // --break-lock
+}
+
+func (f *lockFlags) register(fs *flag.FlagSet) {
+	fs.DurationVar(&f.ttl, "lock-ttl", 15*time.Minute, "Treat another machine's vault lock as stale once it has not been renewed for this long")
+	fs.BoolVar(&f.force, "break-lock", false, "Take the vault lock even when another process holds it")
+}
+
+// lockInfo is the content of the lock file
+type lockInfo struct {
+	ID       string    `json:"id"`
+	Host     string    `json:"host"`
+	PID      int       `json:"pid"`
+	Command  string    `json:"command"`
+	Acquired time.Time `json:"acquired"`
+	Expires  time.Time `json:"expires"`
+}
+
+func (i lockInfo) String() string {
+	return fmt.Sprintf("%s on %s (pid %d) since %s", i.Command, i.Host, i.PID, i.Acquired.Format(time.RFC3339))
+}
+
+// vaultLock is a held lease on a vault. It is renewed in the background
+// until released.
+type vaultLock struct {
+	store ynabvault.Store
+	info  lockInfo
+	ttl   time.Duration
+	log   *slog.Logger
+
+	mu   sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+// readLock returns the lock file's content; ok is false when there is none
+func readLock(ctx context.Context, store ynabvault.Store) (info lockInfo, ok bool, err error) {
+	data, err := store.Get(ctx, lockFileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return info, false, nil
+	}
+	if err != nil {
+		return info, false, fmt.Errorf("read lock: %w: %w", ynabvault.ErrBackend, err)
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return info, true, fmt.Errorf("decode lock: %w: %w", ynabvault.ErrCorrupt, err)
+	}
+	return info, true, nil
+}
+
+// acquireLock takes the vault lock for command. A lock held by someone else
+// fails with ErrLocked unless it has expired or force is set, in which case
+// it is broken with a warning. Stores offer no compare-and-swap, so the
+// lease is read back after a short pause to catch a concurrent taker.
+func acquireLock(ctx context.Context, store ynabvault.Store, command string, flags lockFlags, logger *slog.Logger) (*vaultLock, error) {
+	held, ok, err := readLock(ctx, store)
+	switch {
+	case errors.Is(err, ynabvault.ErrCorrupt):
+		logger.Warn("breaking unreadable vault lock", "file", store.Location(lockFileName), "error", err)
+	case err != nil:
+		return nil, err
+	case ok && time.Now().Before(held.Expires) && !flags.force:
+		return nil, fmt.Errorf("%w: held by %s until %s; wait for it to finish or pass --break-lock if it is gone",
+			ynabvault.ErrLocked, held, held.Expires.Format(time.RFC3339))
+	case ok:
+		logger.Warn("breaking vault lock", "holder", held.String(), "expired", held.Expires.Format(time.RFC3339), "forced", flags.force)
+	}
+
+	host, _ := os.Hostname()
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	now := time.Now()
+	l := &vaultLock{
+		store: store,
+		ttl:   flags.ttl,
+		log:   logger,
+		info: lockInfo{ID: hex.EncodeToString(id), Host: host, PID: os.Getpid(), Command: command,
+			Acquired: now, Expires: now.Add(flags.ttl)},
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	if dir, ok := store.(ynabvault.DirStore); ok {
+		if err := os.MkdirAll(string(dir), 0755); err != nil {
+			return nil, fmt.Errorf("create output dir: %w: %w", ynabvault.ErrBackend, err)
+		}
+	}
+	if err := l.write(ctx); err != nil {
+		return nil, err
+	}
+	if err := ynabvault.SleepContext(ctx, lockSettle); err != nil {
+		return nil, err
+	}
+	if got, _, err := readLock(ctx, store); err != nil || got.ID != l.info.ID {
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: taken at the same time by %s", ynabvault.ErrLocked, got)
+	}
+	logger.Debug("vault locked", "file", store.Location(lockFileName), "expires", l.info.Expires)
+	go l.renew()
+	return l, nil
+}
+
+// write stores the lease with a fresh expiry
+func (l *vaultLock) write(ctx context.Context) error {
+	l.mu.Lock()
+	l.info.Expires = time.Now().Add(l.ttl)
+	data, err := json.MarshalIndent(l.info, "", "  ")
+	l.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := l.store.Put(ctx, lockFileName, data); err != nil {
+		return fmt.Errorf("write lock: %w: %w", ynabvault.ErrBackend, err)
+	}
+	return nil
+}
+
+// renew extends the lease every third of its TTL until released or taken
+// over by someone who broke it
+func (l *vaultLock) renew() {
+	defer close(l.done)
+	tick := time.NewTicker(l.ttl / 3)
+	defer tick.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-tick.C:
+			ctx := context.Background()
+			if held, _, err := readLock(ctx, l.store); err == nil && held.ID != l.info.ID {
+				l.log.Warn("vault lock was taken over; no longer renewing it", "holder", held.String())
+				return
+			}
+			if err := l.write(ctx); err != nil {
+				l.log.Warn("vault lock not renewed", "error", err)
+			}
+		}
+	}
+}
+
+// release stops renewing and removes the lock file if it is still ours
+func (l *vaultLock) release(ctx context.Context) {
+	close(l.stop)
+	<-l.done
+	held, ok, err := readLock(ctx, l.store)
+	switch {
+	case err != nil:
+		l.log.Warn("vault lock not removed", "file", l.store.Location(lockFileName), "error", err)
+		return
+	case !ok:
+		l.log.Warn("vault lock was removed while held", "file", l.store.Location(lockFileName))
+		return
+	case held.ID != l.info.ID:
+		l.log.Warn("vault lock was taken over; leaving it", "holder", held.String())
+		return
+	}
+	if err := l.store.Delete(ctx, lockFileName); err != nil {
+		l.log.Warn("vault lock not removed", "file", l.store.Location(lockFileName), "error", err)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// TestMain skips the lock's settle pause, which only matters across machines
+func TestMain(m *testing.M) {
+	lockSettle = 0
+	os.Exit(m.Run())
+}
+
+// writeLock stores a lock file held by another process
+func writeLock(t *testing.T, dir string, info lockInfo) {
+	t.Helper()
+	data, err := json.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, lockFileName), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestAcquireLock covers free, held, stale and forced locks
+func TestAcquireLock(t *testing.T) {
+	other := lockInfo{ID: "other", Host: "nas", PID: 42, Command: "backup", Acquired: time.Now().Add(-time.Hour)}
+	tests := []struct {
+		name      string
+		held      *lockInfo
+		force     bool
+		wantErr   error
+		wantBreak bool
+	}{
+		{"free", nil, false, nil, false},
+		{"held", &lockInfo{ID: other.ID, Host: other.Host, PID: other.PID, Command: other.Command, Acquired: other.Acquired, Expires: time.Now().Add(time.Hour)}, false, ynabvault.ErrLocked, false},
+		{"stale", &lockInfo{ID: other.ID, Host: other.Host, PID: other.PID, Command: other.Command, Acquired: other.Acquired, Expires: time.Now().Add(-time.Minute)}, false, nil, true},
+		{"forced", &lockInfo{ID: other.ID, Host: other.Host, PID: other.PID, Command: other.Command, Acquired: other.Acquired, Expires: time.Now().Add(time.Hour)}, true, nil, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tc.held != nil {
+				writeLock(t, dir, *tc.held)
+			}
+			var logs bytes.Buffer
+			logger := slog.New(slog.NewTextHandler(&logs, nil))
+			lock, err := acquireLock(t.Context(), ynabvault.DirStore(dir), "backup", lockFlags{ttl: time.Minute, force: tc.force}, logger)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("acquireLock() error = %v; want %v", err, tc.wantErr)
+			}
+			if err != nil {
+				if !strings.Contains(err.Error(), "nas (pid 42)") || !strings.Contains(err.Error(), "--break-lock") {
+					t.Errorf("error %q does not name the holder and the way out", err)
+				}
+				if got, _, _ := readLock(t.Context(), ynabvault.DirStore(dir)); got.ID != "other" {
+					t.Errorf("held lock replaced by %+v", got)
+				}
+				return
+			}
+			if broke := strings.Contains(logs.String(), "breaking vault lock"); broke != tc.wantBreak {
+				t.Errorf("logged breaking = %v; want %v\n%s", broke, tc.wantBreak, logs.String())
+			}
+			got, ok, err := readLock(t.Context(), ynabvault.DirStore(dir))
+			if err != nil || !ok || got.ID != lock.info.ID || got.PID != os.Getpid() {
+				t.Fatalf("lock file = %+v, %v, %v; want ours", got, ok, err)
+			}
+			lock.release(t.Context())
+			if _, err := os.Stat(filepath.Join(dir, lockFileName)); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("lock file not removed on release: %v", err)
+			}
+		})
+	}
+}
+
+// TestLockRenewAndTakeover extends a held lease and leaves a lock that was
+// broken by someone else in place
+func TestLockRenewAndTakeover(t *testing.T) {
+	dir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	lock, err := acquireLock(t.Context(), ynabvault.DirStore(dir), "backup", lockFlags{ttl: 30 * time.Millisecond}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _, _ := readLock(t.Context(), ynabvault.DirStore(dir))
+	time.Sleep(50 * time.Millisecond)
+	renewed, _, _ := readLock(t.Context(), ynabvault.DirStore(dir))
+	if !renewed.Expires.After(first.Expires) {
+		t.Errorf("lease not renewed: expires %v, then %v", first.Expires, renewed.Expires)
+	}
+
+	lock.release(t.Context())
+
+	// A lock broken while held is left to its new owner
+	if lock, err = acquireLock(t.Context(), ynabvault.DirStore(dir), "backup", lockFlags{ttl: time.Hour}, logger); err != nil {
+		t.Fatal(err)
+	}
+	writeLock(t, dir, lockInfo{ID: "other", Expires: time.Now().Add(time.Hour)})
+	lock.release(t.Context())
+	if got, _, _ := readLock(t.Context(), ynabvault.DirStore(dir)); got.ID != "other" {
+		t.Errorf("release removed or replaced a lock taken over by someone else: %+v", got)
+	}
+}
+
+// TestRunCLIBackupLocked refuses to back up into a vault another machine holds
+func TestRunCLIBackupLocked(t *testing.T) {
+	dir := t.TempDir()
+	writeLock(t, dir, lockInfo{ID: "other", Host: "nas", PID: 42, Command: "backup", Expires: time.Now().Add(time.Hour)})
+	var stderr bytes.Buffer
+	args := []string{"backup", "--token", "tok", "--url", "http://127.0.0.1:0", "--output", dir}
+	if code := runCLI(args, io.Discard, &stderr); code != exitLocked {
+		t.Errorf("exit code = %d; want %d (stderr: %s)", code, exitLocked, stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "vault locked") {
+		t.Errorf("stderr %q does not explain the lock", stderr.String())
+	}
+}
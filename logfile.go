@@ -0,0 +1,124 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// logFile is an io.Writer appending log records to a file. Once the file
+// would grow past maxSize it is renamed with the time as a suffix, e.g.
+// ynabvault.log.20250514T153045Z, and a new one is started. Only the keep
+// newest rotated files are kept, and none older than maxAge when it is set.
+//
+// The file is opened for every record, so several processes can share it
+// and deleting it by hand is safe.
+type logFile struct {
+	path    string
+	maxSize int64
+	maxAge  time.Duration
+	keep    int
+	now     func() time.Time
+
+	mu sync.Mutex
+}
+
+// newLogFile returns a writer for path, creating its directory
+func newLogFile(path string, maxSize int64, maxAge time.Duration, keep int) (*logFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("log file: %w", err)
+	}
+	return &logFile{path: path, maxSize: maxSize, maxAge: maxAge, keep: keep, now: time.Now}, nil
+}
+
+func (l *logFile) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if fi, err := os.Stat(l.path); err == nil && l.maxSize > 0 && fi.Size() > 0 && fi.Size()+int64(len(p)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, err
+	}
+	n, err := f.Write(p)
+	return n, errors.Join(err, f.Close())
+}
+
+// rotate moves the current file aside and removes rotated files beyond
+// the retention
+func (l *logFile) rotate() error {
+	stamp := l.path + "." + l.now().UTC().Format(ynabvault.TimeFormat)
+	name := stamp
+	// Files rotated in the same second get a counter past the highest one
+	// left, never a gap prune made, so a higher counter is always newer
+	if matches, _ := filepath.Glob(stamp + "*"); len(matches) > 0 {
+		next := 1
+		for _, m := range matches {
+			if n, err := strconv.Atoi(strings.TrimPrefix(m, stamp+"-")); err == nil && n >= next {
+				next = n + 1
+			}
+		}
+		name = fmt.Sprintf("%s-%d", stamp, next)
+	}
+	if err := os.Rename(l.path, name); err != nil {
+		return err
+	}
+	return l.prune()
+}
+
+// rotatedLog is a file moved aside by rotate
+type rotatedLog struct {
+	path string
+	time time.Time
+	seq  int // the counter after the time, 0 for the first file that second
+}
+
+// prune deletes rotated files past keep or older than maxAge
+func (l *logFile) prune() error {
+	matches, err := filepath.Glob(l.path + ".*")
+	if err != nil {
+		return err
+	}
+	var logs []rotatedLog
+	for _, m := range matches {
+		stamp, counter, hasCounter := strings.Cut(strings.TrimPrefix(m, l.path+"."), "-")
+		ts, err := time.Parse(ynabvault.TimeFormat, stamp)
+		if err != nil {
+			continue
+		}
+		seq := 0
+		if hasCounter {
+			if seq, err = strconv.Atoi(counter); err != nil {
+				continue
+			}
+		}
+		logs = append(logs, rotatedLog{m, ts, seq})
+	}
+	// Newest first; names from the same second sort by their counter as a
+	// number, so -10 is newer than -2
+	slices.SortFunc(logs, func(a, b rotatedLog) int {
+		if c := b.time.Compare(a.time); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.seq, a.seq)
+	})
+	var errs []error
+	for i, r := range logs {
+		if i >= l.keep || (l.maxAge > 0 && l.now().Sub(r.time) > l.maxAge) {
+			errs = append(errs, os.Remove(r.path))
+		}
+	}
+	return errors.Join(errs...)
+}
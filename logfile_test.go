@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLogFileRotation moves the file aside once it would grow past its
+// limit and keeps only the newest rotated files
+func TestLogFileRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "logs", "ynabvault.log")
+	lf, err := newLogFile(path, 10, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2025, 5, 14, 15, 30, 0, 0, time.UTC)
+	lf.now = func() time.Time { return now }
+	for _, line := range []string{"line 1\n", "line 2\n", "line 3\n", "line 4\n"} {
+		now = now.Add(time.Second)
+		if _, err := lf.Write([]byte(line)); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	// line 1, rotated first, was dropped by keep
+	want := []string{"ynabvault.log", "ynabvault.log.20250514T153003Z", "ynabvault.log.20250514T153004Z"}
+	if !slices.Equal(names, want) {
+		t.Errorf("files = %v; want %v", names, want)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "line 4\n" {
+		t.Errorf("current log = %q; want line 4", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(filepath.Dir(path), want[2])); string(data) != "line 3\n" {
+		t.Errorf("newest rotated log = %q; want line 3", data)
+	}
+}
+
+// TestLogFileRotationCounter keeps the newest files rotated within one
+// second by their counter as a number, past -9
+func TestLogFileRotationCounter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "y.log")
+	lf, err := newLogFile(path, 1, 0, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lf.now = func() time.Time { return time.Date(2025, 5, 14, 12, 0, 0, 0, time.UTC) }
+	for i := range 13 {
+		if _, err := lf.Write(fmt.Appendf(nil, "line %d\n", i)); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	matches, _ := filepath.Glob(path + ".*")
+	for i := range matches {
+		matches[i] = strings.TrimPrefix(matches[i], path)
+	}
+	slices.Sort(matches)
+	if want := []string{".20250514T120000Z-10", ".20250514T120000Z-11", ".20250514T120000Z-9"}; !slices.Equal(matches, want) {
+		t.Errorf("rotated = %v; want %v", matches, want)
+	}
+	if data, _ := os.ReadFile(path + ".20250514T120000Z-11"); string(data) != "line 11\n" {
+		t.Errorf("newest rotated log = %q; want line 11", data)
+	}
+}
+
+// TestLogFileMaxAge deletes rotated files older than the limit, including
+// those rotated within the same second
+func TestLogFileMaxAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "y.log")
+	lf, err := newLogFile(path, 1, time.Hour, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2025, 5, 14, 12, 0, 0, 0, time.UTC)
+	lf.now = func() time.Time { return now }
+	for _, step := range []time.Duration{0, 0, 0, 2 * time.Hour} {
+		now = now.Add(step)
+		if _, err := lf.Write([]byte("x\n")); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	matches, _ := filepath.Glob(path + ".*")
+	for i := range matches {
+		matches[i] = strings.TrimPrefix(matches[i], path)
+	}
+	if want := []string{".20250514T140000Z"}; !slices.Equal(matches, want) {
+		t.Errorf("rotated = %v; want %v", matches, want)
+	}
+}
+
+// TestRunCLILogFile sends the log to --log-file instead of stderr
+func TestRunCLILogFile(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			_, _ = io.WriteString(w, `{"data":{"budgets":[{"id":"b1","name":"Budget"}]}}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"data":{"budget":{"id":"b1"}}}`)
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "ynabvault.log")
+	var stderr bytes.Buffer
+	args := []string{"backup", "--token", "tok", "--url", srv.URL, "--output", t.TempDir(), "--verbose", "--log-file", path}
+	if code := runCLI(args, io.Discard, &stderr); code != 0 {
+		t.Fatalf("backup exit code = %d; stderr: %s", code, stderr.String())
+	}
+	if strings.Contains(stderr.String(), "saved budget") {
+		t.Errorf("log written to stderr: %s", stderr.String())
+	}
+	if data, err := os.ReadFile(path); err != nil || !strings.Contains(string(data), "saved budget") {
+		t.Errorf("log file = %q, %v; want the backup's log", data, err)
+	}
+	if code := runCLI([]string{"list", "--log-max-size", "0"}, io.Discard, io.Discard); code != 2 {
+		t.Errorf("--log-max-size 0 exit code = %d; want 2", code)
+	}
+}
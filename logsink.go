@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Log outputs for --log-output
+const (
+	logOutputStderr   = "stderr"
+	logOutputSyslog   = "syslog"
+	logOutputJournald = "journald"
+)
+
+// logIdentifier tags every record sent to syslog or journald
+const logIdentifier = "ynabvault"
+
+// syslogWriter is the part of *syslog.Writer the syslog handler uses, one
+// method per priority
+type syslogWriter interface {
+	Debug(m string) error
+	Info(m string) error
+	Warning(m string) error
+	Err(m string) error
+	Close() error
+}
+
+// syslogHandler sends each record to syslog at the priority of its level.
+// The message is the record in --log-format without time and level, which
+// syslog adds itself, so fields stay parseable as key=value pairs or JSON.
+type syslogHandler struct {
+	slog.Handler // formats into line.buf
+	line         *syslogLine
+}
+
+// syslogLine is the buffer shared by a syslogHandler and those derived from
+// it with WithAttrs and WithGroup
+type syslogLine struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+	w   syslogWriter
+}
+
+// newSyslogHandler returns a handler writing to w
+func newSyslogHandler(w syslogWriter, json bool, opts *slog.HandlerOptions) *syslogHandler {
+	line := &syslogLine{w: w}
+	o := *opts
+	o.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+		if len(groups) == 0 && (a.Key == slog.TimeKey || a.Key == slog.LevelKey) {
+			return slog.Attr{}
+		}
+		return a
+	}
+	if json {
+		return &syslogHandler{slog.NewJSONHandler(&line.buf, &o), line}
+	}
+	return &syslogHandler{slog.NewTextHandler(&line.buf, &o), line}
+}
+
+func (h *syslogHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.line.mu.Lock()
+	defer h.line.mu.Unlock()
+	h.line.buf.Reset()
+	if err := h.Handler.Handle(ctx, r); err != nil {
+		return err
+	}
+	msg := strings.TrimSuffix(h.line.buf.String(), "\n")
+	switch {
+	case r.Level >= slog.LevelError:
+		return h.line.w.Err(msg)
+	case r.Level >= slog.LevelWarn:
+		return h.line.w.Warning(msg)
+	case r.Level >= slog.LevelInfo:
+		return h.line.w.Info(msg)
+	}
+	return h.line.w.Debug(msg)
+}
+
+func (h *syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &syslogHandler{h.Handler.WithAttrs(attrs), h.line}
+}
+
+func (h *syslogHandler) WithGroup(name string) slog.Handler {
+	return &syslogHandler{h.Handler.WithGroup(name), h.line}
+}
+
+// journalSocket is where journald takes records in its native protocol
+var journalSocket = "/run/systemd/journal/socket"
+
+// journalHandler sends each record to journald as one datagram of fields:
+// MESSAGE, PRIORITY and SYSLOG_IDENTIFIER, plus every attribute under its
+// key in upper case, with groups joined by "_", e.g. BUDGET or ERROR.
+type journalHandler struct {
+	conn   net.Conn
+	level  slog.Leveler
+	prefix string // of the open groups, such as "REQUEST_"
+	fields []byte // from WithAttrs, already encoded
+}
+
+// newJournalHandler connects to the journal socket
+func newJournalHandler(opts *slog.HandlerOptions) (*journalHandler, error) {
+	conn, err := net.Dial("unixgram", journalSocket)
+	if err != nil {
+		return nil, fmt.Errorf("journald: %w", err)
+	}
+	return &journalHandler{conn: conn, level: opts.Level}, nil
+}
+
+func (h *journalHandler) Enabled(_ context.Context, level slog.Level) bool {
+	want := slog.LevelInfo
+	if h.level != nil {
+		want = h.level.Level()
+	}
+	return level >= want
+}
+
+func (h *journalHandler) Handle(_ context.Context, r slog.Record) error {
+	var b []byte
+	b = appendJournalField(b, "MESSAGE", r.Message)
+	b = appendJournalField(b, "PRIORITY", journalPriority(r.Level))
+	b = appendJournalField(b, "SYSLOG_IDENTIFIER", logIdentifier)
+	b = append(b, h.fields...)
+	r.Attrs(func(a slog.Attr) bool {
+		b = appendJournalAttr(b, h.prefix, a)
+		return true
+	})
+	// One Write sends one datagram, so records from concurrent workers
+	// never interleave
+	_, err := h.conn.Write(b)
+	return err
+}
+
+func (h *journalHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.fields = append([]byte(nil), h.fields...)
+	for _, a := range attrs {
+		c.fields = appendJournalAttr(c.fields, h.prefix, a)
+	}
+	return &c
+}
+
+func (h *journalHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	c := *h
+	c.prefix += journalFieldName(name) + "_"
+	return &c
+}
+
+// journalPriority maps a level to its syslog priority number
+func journalPriority(l slog.Level) string {
+	switch {
+	case l >= slog.LevelError:
+		return "3"
+	case l >= slog.LevelWarn:
+		return "4"
+	case l >= slog.LevelInfo:
+		return "6"
+	}
+	return "7"
+}
+
+// appendJournalAttr encodes a, flattening groups into the field name
+func appendJournalAttr(b []byte, prefix string, a slog.Attr) []byte {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += journalFieldName(a.Key) + "_"
+		}
+		for _, g := range v.Group() {
+			b = appendJournalAttr(b, prefix, g)
+		}
+		return b
+	}
+	if a.Key == "" {
+		return b
+	}
+	s := v.String()
+	if v.Kind() == slog.KindTime {
+		s = v.Time().Format(time.RFC3339Nano)
+	}
+	return appendJournalField(b, prefix+journalFieldName(a.Key), s)
+}
+
+// journalFieldName turns a key into a valid journal field name: upper case
+// letters, digits and underscores, not starting with an underscore or digit,
+// which journald reserves or rejects
+func journalFieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, key)
+	name = strings.TrimLeft(name, "_")
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		name = "F_" + name
+	}
+	return name
+}
+
+// appendJournalField encodes one field as NAME=value, or for a value with
+// a newline as the name, a newline, the value's length as a little-endian
+// uint64 and the value
+func appendJournalField(b []byte, name, value string) []byte {
+	b = append(b, name...)
+	if !strings.Contains(value, "\n") {
+		b = append(b, '=')
+		b = append(b, value...)
+		return append(b, '\n')
+	}
+	b = append(b, '\n')
+	b = binary.LittleEndian.AppendUint64(b, uint64(len(value)))
+	b = append(b, value...)
+	return append(b, '\n')
+}
@@ -0,0 +1,10 @@
+//go:build windows || plan9
+
+package main
+
+import "errors"
+
+// openSyslog fails: log/syslog has no Windows or Plan 9 implementation
+func openSyslog() (syslogWriter, error) {
+	return nil, errors.New("syslog is not available on this platform")
+}
@@ -0,0 +1,10 @@
+//go:build !windows && !plan9
+
+package main
+
+import "log/syslog"
+
+// openSyslog connects to the local syslog daemon
+func openSyslog() (syslogWriter, error) {
+	return syslog.New(syslog.LOG_DAEMON|syslog.LOG_INFO, logIdentifier)
+}
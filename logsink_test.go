@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// fakeSyslog records messages with their priority
+type fakeSyslog struct {
+	lines []string
+}
+
+func (f *fakeSyslog) Debug(m string) error   { return f.add("debug", m) }
+func (f *fakeSyslog) Info(m string) error    { return f.add("info", m) }
+func (f *fakeSyslog) Warning(m string) error { return f.add("warning", m) }
+func (f *fakeSyslog) Err(m string) error     { return f.add("err", m) }
+func (f *fakeSyslog) Close() error           { return nil }
+
+func (f *fakeSyslog) add(priority, m string) error {
+	f.lines = append(f.lines, priority+" "+m)
+	return nil
+}
+
+// TestSyslogHandler sends each record at its level's priority, formatted
+// without the time and level syslog adds
+func TestSyslogHandler(t *testing.T) {
+	tests := []struct {
+		json bool
+		want []string
+	}{
+		{false, []string{
+			`warning msg="budget skipped" run=r1 budget=Home`,
+			`err msg="backup failed" run=r1 error=boom`,
+		}},
+		{true, []string{
+			`warning {"msg":"budget skipped","run":"r1","budget":"Home"}`,
+			`err {"msg":"backup failed","run":"r1","error":"boom"}`,
+		}},
+	}
+	for _, tc := range tests {
+		w := &fakeSyslog{}
+		log := slog.New(newSyslogHandler(w, tc.json, &slog.HandlerOptions{Level: slog.LevelWarn})).With("run", "r1")
+		log.Info("not logged")
+		log.Warn("budget skipped", "budget", "Home")
+		log.Error("backup failed", "error", errors.New("boom"))
+		if !slices.Equal(w.lines, tc.want) {
+			t.Errorf("json %v: lines = %q; want %q", tc.json, w.lines, tc.want)
+		}
+	}
+}
+
+// TestJournalHandler sends one datagram per record with upper-case fields,
+// groups flattened and multi-line values length-prefixed
+func TestJournalHandler(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: sock, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("unix datagram sockets unavailable: %v", err)
+	}
+	defer conn.Close()
+	old := journalSocket
+	journalSocket = sock
+	defer func() { journalSocket = old }()
+
+	h, err := newJournalHandler(&slog.HandlerOptions{Level: slog.LevelInfo})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := slog.New(h).With("run-id", "r1").WithGroup("budget")
+	log.Debug("not logged")
+	log.Warn("budget skipped", "name", "Home", slog.Group("http", "status", 429), "error", "line 1\nline 2")
+
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := parseJournal(t, buf[:n])
+	want := []string{
+		"MESSAGE=budget skipped",
+		"PRIORITY=4",
+		"SYSLOG_IDENTIFIER=ynabvault",
+		"RUN_ID=r1",
+		"BUDGET_NAME=Home",
+		"BUDGET_HTTP_STATUS=429",
+		"BUDGET_ERROR=line 1\nline 2",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("fields = %q; want %q", got, want)
+	}
+
+	// The command's logger holds one connection, closed when it is done
+	common := commonFlags{logOutput: logOutputJournald}
+	logger, closeLog := common.logger(io.Discard)
+	closeLog()
+	logger.Warn("after close")
+	_ = conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if n, err := conn.Read(buf); err == nil {
+		t.Errorf("logged after close: %q", buf[:n])
+	}
+}
+
+// parseJournal decodes a datagram of the journal's native protocol into
+// NAME=value strings
+func parseJournal(t *testing.T, b []byte) []string {
+	t.Helper()
+	var fields []string
+	for len(b) > 0 {
+		nl := bytes.IndexByte(b, '\n')
+		if nl < 0 {
+			t.Fatalf("unterminated field %q", b)
+		}
+		line := b[:nl]
+		b = b[nl+1:]
+		if bytes.IndexByte(line, '=') >= 0 {
+			fields = append(fields, string(line))
+			continue
+		}
+		size := binary.LittleEndian.Uint64(b)
+		fields = append(fields, fmt.Sprintf("%s=%s", line, b[8:8+size]))
+		b = b[8+size+1:]
+	}
+	return fields
+}
+
+// TestJournalFieldName keeps only characters journald allows
+func TestJournalFieldName(t *testing.T) {
+	tests := map[string]string{
+		"budget":    "BUDGET",
+		"budget_id": "BUDGET_ID",
+		"run-id":    "RUN_ID",
+		"_cursor":   "CURSOR",
+		"2fa":       "F_2FA",
+		"":          "F_",
+	}
+	for key, want := range tests {
+		if got := journalFieldName(key); got != want {
+			t.Errorf("journalFieldName(%q) = %q; want %q", key, got, want)
+		}
+	}
+}
+
+// TestLogOutputFlag rejects unknown outputs and a service combined with
+// --log-file in either order
+func TestLogOutputFlag(t *testing.T) {
+	tests := []struct {
+		args    []string
+		wantErr bool
+	}{
+		{[]string{"--log-output", "journald"}, false},
+		{[]string{"--log-output", "syslog"}, false},
+		{[]string{"--log-output", "stderr", "--log-file", "x.log"}, false},
+		{[]string{"--log-output", "eventlog"}, true},
+		{[]string{"--log-output", "syslog", "--log-file", "x.log"}, true},
+		{[]string{"--log-file", "x.log", "--log-output", "journald"}, true},
+	}
+	for _, tc := range tests {
+		var common commonFlags
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		common.register(fs)
+		if err := fs.Parse(tc.args); (err != nil) != tc.wantErr {
+			t.Errorf("Parse(%q) = %v; want error %v", tc.args, err, tc.wantErr)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// notifyFormats are the --notify-format values; auto picks slack or discord
+// from the webhook's host and generic otherwise
+var notifyFormats = []string{"auto", "generic", "slack", "discord"}
+
+// notifyTimeout bounds sending a notification, which happens even after the
+// run was cancelled
+const notifyTimeout = 30 * time.Second
+
+// notification is the generic webhook payload summarizing a backup run
+type notification struct {
+	Status     string    `json:"status"` // success or failure
+	Host       string    `json:"host"`
+	Started    time.Time `json:"started"`
+	Duration   float64   `json:"duration_seconds"`
+	Budgets    int       `json:"budgets"`
+	Downloaded int       `json:"downloaded"`
+	Skipped    int       `json:"skipped"`
+	Failed     int       `json:"failed"`
+	Error      string    `json:"error,omitempty"`
+	Message    string    `json:"message,omitempty"`
+	Text       string    `json:"text"`
+}
+
+// newNotification summarizes rec; a run fails when it returned an error or
+// any budget was not saved
+func newNotification(rec runRecord) notification {
+	host, _ := os.Hostname()
+	n := notification{
+		Status:     "success",
+		Host:       host,
+		Started:    rec.Started,
+		Duration:   rec.Finished.Sub(rec.Started).Round(time.Millisecond).Seconds(),
+		Budgets:    rec.Budgets,
+		Downloaded: rec.Downloaded,
+		Skipped:    rec.Skipped,
+		Failed:     rec.Failed,
+		Error:      rec.Error,
+		Message:    rec.Message,
+	}
+	if rec.Error != "" || rec.Failed > 0 {
+		n.Status = "failure"
+	}
+	n.Text = fmt.Sprintf("ynabvault backup on %s: %s. %d budgets, %d downloaded, %d unchanged, %d failed in %s",
+		cmp.Or(host, "unknown host"), n.Status, n.Budgets, n.Downloaded, n.Skipped, n.Failed, rec.Finished.Sub(rec.Started).Round(time.Second))
+	if rec.Error != "" {
+		n.Text += ". Error: " + rec.Error
+	}
+	return n
+}
+
+// notifyPayload renders n in format for endpoint
+func notifyPayload(endpoint, format string, n notification) ([]byte, error) {
+	if format == "auto" {
+		format = "generic"
+		if u, err := url.Parse(endpoint); err == nil {
+			switch host := strings.ToLower(u.Hostname()); {
+			case host == "hooks.slack.com":
+				format = "slack"
+			case (host == "discord.com" || host == "discordapp.com") && strings.HasPrefix(u.Path, "/api/webhooks/"):
+				format = "discord"
+			}
+		}
+	}
+	switch format {
+	case "slack":
+		return json.Marshal(map[string]string{"text": n.Text})
+	case "discord":
+		return json.Marshal(map[string]string{"content": n.Text})
+	case "generic":
+		return json.Marshal(n)
+	}
+	return nil, fmt.Errorf("unknown notify format %q (supported: %s)", format, strings.Join(notifyFormats, ", "))
+}
+
+// sendNotification posts the summary of rec to the webhook at endpoint
+func sendNotification(ctx context.Context, client *http.Client, endpoint, format string, rec runRecord) error {
+	body, err := notifyPayload(endpoint, format, newNotification(rec))
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), notifyTimeout)
+	defer cancel()
+	if _, err := ynabvault.HTTPSend(ctx, client, http.MethodPost, endpoint, "", body); err != nil {
+		// The webhook URL is a secret, so it is kept out of the error
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			err = ue.Err
+		}
+		return fmt.Errorf("notify: %w", err)
+	}
+	return nil
+}
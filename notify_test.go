@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestNotifyPayload renders the summary per format, picking one by host
+func TestNotifyPayload(t *testing.T) {
+	start := time.Date(2025, 1, 1, 3, 0, 0, 0, time.UTC)
+	n := newNotification(runRecord{Started: start, Finished: start.Add(90 * time.Second), Budgets: 3, Downloaded: 1, Skipped: 1, Failed: 1})
+	if n.Status != "failure" || n.Duration != 90 || !strings.Contains(n.Text, "3 budgets, 1 downloaded, 1 unchanged, 1 failed in 1m30s") {
+		t.Errorf("notification = %+v", n)
+	}
+	tests := []struct {
+		url, format string
+		wantKey     string
+	}{
+		{"https://hooks.slack.com/services/T/B/x", "auto", "text"},
+		{"https://discord.com/api/webhooks/1/x", "auto", "content"},
+		{"https://example.com/hook", "auto", "status"},
+		{"https://example.com/hook", "slack", "text"},
+		{"https://example.com/hook", "discord", "content"},
+	}
+	for _, tc := range tests {
+		data, err := notifyPayload(tc.url, tc.format, n)
+		if err != nil {
+			t.Fatalf("notifyPayload(%s, %s): %v", tc.url, tc.format, err)
+		}
+		var got map[string]interface{}
+		if err := json.Unmarshal(data, &got); err != nil || got[tc.wantKey] == nil {
+			t.Errorf("notifyPayload(%s, %s) = %s; want a %q field", tc.url, tc.format, data, tc.wantKey)
+		}
+	}
+	if _, err := notifyPayload("https://example.com", "teams", n); err == nil {
+		t.Error("notifyPayload accepted an unknown format")
+	}
+}
+
+// TestBackupNotifies posts the run summary, including failed budgets
+func TestBackupNotifies(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			_, _ = io.WriteString(w, `{"data":{"budgets":[{"id":"b1","name":"A"},{"id":"b2","name":"B"}]}}`)
+		case "/b1":
+			_, _ = io.WriteString(w, `{"data":{"budget":{"id":"b1"}}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	got := make(chan notification, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n notification
+		if r.Header.Get("Authorization") != "" {
+			t.Error("webhook received the API token")
+		}
+		_ = json.NewDecoder(r.Body).Decode(&n)
+		got <- n
+	}))
+	defer hook.Close()
+
+	t.Setenv("YNAB_BEARER_TOKEN", "tok")
+	var stderr bytes.Buffer
+	args := []string{"backup", "--url", srv.URL, "--output", t.TempDir(), "--notify-url", hook.URL, "--retries", "0"}
+	if code := runCLI(args, io.Discard, &stderr); code != 0 {
+		t.Fatalf("backup exit code = %d; stderr: %s", code, stderr.String())
+	}
+	select {
+	case n := <-got:
+		if n.Status != "failure" || n.Budgets != 2 || n.Downloaded != 1 || n.Failed != 1 {
+			t.Errorf("notification = %+v; want a failure with 1 of 2 budgets downloaded", n)
+		}
+	default:
+		t.Fatal("no notification sent")
+	}
+
+	if code := runCLI([]string{"backup", "--notify-format", "teams"}, io.Discard, &stderr); code != 2 {
+		t.Errorf("unknown --notify-format exit code = %d; want 2", code)
+	}
+}
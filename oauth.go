@@ -0,0 +1,187 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+	"golang.org/x/oauth2"
+)
+
+// ynabOAuth is YNAB's OAuth endpoint; tests point it at a fake server
+var ynabOAuth = oauth2.Endpoint{
+	AuthURL:   "https://app.ynab.com/oauth/authorize",
+	TokenURL:  "https://app.ynab.com/oauth/token",
+	AuthStyle: oauth2.AuthStyleInParams,
+}
+
+// oauthLeeway refreshes access tokens this long before they expire, so one
+// does not run out halfway through a backup
+const oauthLeeway = 10 * time.Minute
+
+// oauthCredentials is what auth login keeps in the OS keyring: the OAuth
+// application and the tokens it was granted
+type oauthCredentials struct {
+	ClientID     string        `json:"client_id"`
+	ClientSecret string        `json:"client_secret"`
+	RedirectURI  string        `json:"redirect_uri"`
+	Token        *oauth2.Token `json:"token"`
+}
+
+func (c oauthCredentials) config() *oauth2.Config {
+	return &oauth2.Config{ClientID: c.ClientID, ClientSecret: c.ClientSecret, Endpoint: ynabOAuth, RedirectURL: c.RedirectURI}
+}
+
+// loadOAuth reads the credentials stored under account
+func loadOAuth(account string) (oauthCredentials, error) {
+	var creds oauthCredentials
+	data, err := keyringToken(account)
+	if err != nil {
+		return creds, err
+	}
+	if err := json.Unmarshal([]byte(data), &creds); err != nil || creds.Token == nil {
+		return creds, fmt.Errorf("keyring entry %q holds no OAuth login; run 'ynabvault auth login --keyring-account %s'", account, account)
+	}
+	return creds, nil
+}
+
+// saveOAuth stores creds under account
+func saveOAuth(account string, creds oauthCredentials) error {
+	data, err := json.Marshal(creds)
+	if err != nil {
+		return err
+	}
+	return setKeyringToken(account, string(data))
+}
+
+// oauthToken returns a current access token for the login stored under
+// account. A token close to expiry is refreshed and the new one saved.
+func oauthToken(ctx context.Context, account string) (string, error) {
+	creds, err := loadOAuth(account)
+	if err != nil {
+		return "", err
+	}
+	if creds.Token.Expiry.IsZero() || time.Until(creds.Token.Expiry) > oauthLeeway {
+		return creds.Token.AccessToken, nil
+	}
+	if creds.Token.RefreshToken == "" {
+		return "", fmt.Errorf("OAuth token expired and cannot be refreshed; run 'ynabvault auth login' again")
+	}
+	// A token without an access token is never reused, so this refreshes
+	tok, err := creds.config().TokenSource(ctx, &oauth2.Token{RefreshToken: creds.Token.RefreshToken}).Token()
+	if err != nil {
+		return "", fmt.Errorf("refresh OAuth token: %w", oauthError(err))
+	}
+	creds.Token = tok
+	if err := saveOAuth(account, creds); err != nil {
+		return "", err
+	}
+	return tok.AccessToken, nil
+}
+
+// oauthError wraps a failed token request in a StatusError, so a rejected
+// grant maps to ErrUnauthorized
+func oauthError(err error) error {
+	var re *oauth2.RetrieveError
+	if errors.As(err, &re) && re.Response != nil {
+		return fmt.Errorf("%w: %w", &ynabvault.StatusError{StatusCode: re.Response.StatusCode}, err)
+	}
+	return err
+}
+
+// openBrowser shows url in the user's browser; tests replace it
+var openBrowser = func(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	return cmd.Start()
+}
+
+// oauthLogin runs the authorization-code flow: it listens on the redirect
+// URI's address, sends the user to YNAB to approve access and exchanges the
+// code it is called back with for tokens
+func oauthLogin(ctx context.Context, creds oauthCredentials, prompt io.Writer) (*oauth2.Token, error) {
+	redirect, err := url.Parse(creds.RedirectURI)
+	if err != nil || redirect.Scheme != "http" || redirect.Host == "" {
+		return nil, fmt.Errorf("--redirect-uri must be an http:// URL on this machine, got %q", creds.RedirectURI)
+	}
+	ln, err := net.Listen("tcp", redirect.Host)
+	if err != nil {
+		return nil, fmt.Errorf("listen for the OAuth callback: %w", err)
+	}
+	state := make([]byte, 16)
+	_, _ = rand.Read(state)
+	wantState := hex.EncodeToString(state)
+
+	type callback struct {
+		code string
+		err  error
+	}
+	done := make(chan callback, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc(cmp.Or(redirect.Path, "/"), func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		var cb callback
+		switch {
+		case q.Get("state") != wantState:
+			cb.err = errors.New("OAuth callback with the wrong state")
+		case q.Get("error") != "":
+			cb.err = fmt.Errorf("authorization denied: %s %s", q.Get("error"), q.Get("error_description"))
+		default:
+			cb.code = q.Get("code")
+		}
+		if cb.err != nil {
+			http.Error(w, cb.err.Error(), http.StatusBadRequest)
+		} else {
+			_, _ = io.WriteString(w, "ynabvault is authorized. You can close this window.\n")
+		}
+		select {
+		case done <- cb:
+		default:
+		}
+	})
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() { _ = srv.Serve(ln) }()
+	defer srv.Close()
+
+	conf := creds.config()
+	authURL := conf.AuthCodeURL(wantState)
+	fmt.Fprintln(prompt, "Opening your browser to authorize ynabvault. If it does not open, visit:")
+	fmt.Fprintln(prompt, authURL)
+	if err := openBrowser(authURL); err != nil {
+		fmt.Fprintln(prompt, "Could not open a browser:", err)
+	}
+
+	var cb callback
+	select {
+	case cb = <-done:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("waiting for the OAuth callback: %w", ctx.Err())
+	}
+	if cb.err != nil {
+		return nil, cb.err
+	}
+	tok, err := conf.Exchange(ctx, cb.code)
+	if err != nil {
+		return nil, fmt.Errorf("exchange OAuth code: %w", oauthError(err))
+	}
+	return tok, nil
+}
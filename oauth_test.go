@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zalando/go-keyring"
+	"golang.org/x/oauth2"
+)
+
+// fakeOAuth serves YNAB's token endpoint, granting access-N tokens
+func fakeOAuth(t *testing.T) *atomic.Int32 {
+	t.Helper()
+	var grants atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.Form.Get("client_secret") != "shh" {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		switch r.Form.Get("grant_type") {
+		case "authorization_code":
+			if r.Form.Get("code") != "the-code" {
+				http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+				return
+			}
+		case "refresh_token":
+			if r.Form.Get("refresh_token") != "refresh" {
+				http.Error(w, `{"error":"invalid_grant"}`, http.StatusUnauthorized)
+				return
+			}
+		}
+		n := grants.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"access-%d","token_type":"bearer","expires_in":7200,"refresh_token":"refresh"}`, n)
+	}))
+	t.Cleanup(srv.Close)
+	old := ynabOAuth
+	ynabOAuth = oauth2.Endpoint{AuthURL: srv.URL + "/oauth/authorize", TokenURL: srv.URL + "/oauth/token", AuthStyle: oauth2.AuthStyleInParams}
+	t.Cleanup(func() { ynabOAuth = old })
+	return &grants
+}
+
+// freeRedirect returns a redirect URI on a port nothing listens on
+func freeRedirect(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return "http://" + ln.Addr().String() + "/callback"
+}
+
+// TestAuthLogin approves in a stand-in browser and stores the granted tokens
+func TestAuthLogin(t *testing.T) {
+	keyring.MockInit()
+	fakeOAuth(t)
+	tests := []struct {
+		name     string
+		state    func(string) string
+		wantCode int
+	}{
+		{"approved", func(s string) string { return s }, 0},
+		{"forged state", func(string) string { return "forged" }, 1},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			defer func(f func(string) error) { openBrowser = f }(openBrowser)
+			openBrowser = func(auth string) error {
+				u, err := url.Parse(auth)
+				if err != nil {
+					return err
+				}
+				q := u.Query()
+				cb := q.Get("redirect_uri") + "?code=the-code&state=" + tc.state(q.Get("state"))
+				go func() {
+					if resp, err := http.Get(cb); err == nil {
+						resp.Body.Close()
+					}
+				}()
+				return nil
+			}
+			var stdout, stderr bytes.Buffer
+			args := []string{"auth", "login", "--client-id", "app", "--client-secret", "shh", "--redirect-uri", freeRedirect(t),
+				"--keyring-account", tc.name, "--timeout", "10s"}
+			if code := runCLI(args, &stdout, &stderr); code != tc.wantCode {
+				t.Fatalf("auth login exit %d; want %d (stderr: %s)", code, tc.wantCode, stderr.String())
+			}
+			if tc.wantCode != 0 {
+				return
+			}
+			creds, err := loadOAuth(tc.name)
+			if err != nil || creds.Token.AccessToken != "access-1" || creds.Token.RefreshToken != "refresh" || creds.ClientID != "app" {
+				t.Errorf("stored login = %+v, %v", creds, err)
+			}
+		})
+	}
+}
+
+// TestOAuthToken refreshes a token close to expiry and saves the new one
+func TestOAuthToken(t *testing.T) {
+	keyring.MockInit()
+	grants := fakeOAuth(t)
+	creds := oauthCredentials{ClientID: "app", ClientSecret: "shh", RedirectURI: "http://localhost/callback",
+		Token: &oauth2.Token{AccessToken: "fresh", RefreshToken: "refresh", Expiry: time.Now().Add(time.Hour)}}
+	if err := saveOAuth("home", creds); err != nil {
+		t.Fatal(err)
+	}
+	if tok, err := oauthToken(t.Context(), "home"); err != nil || tok != "fresh" || grants.Load() != 0 {
+		t.Fatalf("oauthToken() = %q, %v after %d grants; want the stored token", tok, err, grants.Load())
+	}
+
+	creds.Token.Expiry = time.Now().Add(time.Minute)
+	if err := saveOAuth("home", creds); err != nil {
+		t.Fatal(err)
+	}
+	tok, err := oauthToken(t.Context(), "home")
+	if err != nil || tok != "access-1" {
+		t.Fatalf("oauthToken() = %q, %v; want a refreshed token", tok, err)
+	}
+	if saved, _ := loadOAuth("home"); saved.Token.AccessToken != "access-1" || time.Until(saved.Token.Expiry) < time.Hour {
+		t.Errorf("refreshed token not saved: %+v", saved.Token)
+	}
+
+	// A revoked refresh token asks for a new login
+	creds.Token = &oauth2.Token{AccessToken: "old", RefreshToken: "revoked", Expiry: time.Now().Add(-time.Hour)}
+	if err := saveOAuth("home", creds); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := oauthToken(t.Context(), "home"); exitCode(err) != exitUnauthorized {
+		t.Errorf("oauthToken() with a revoked grant = %v; want an unauthorized error", err)
+	}
+}
+
+// TestBackupTokenSourceOAuth backs up with the stored OAuth login
+func TestBackupTokenSourceOAuth(t *testing.T) {
+	keyring.MockInit()
+	fakeOAuth(t)
+	creds := oauthCredentials{ClientID: "app", ClientSecret: "shh", Token: &oauth2.Token{AccessToken: "fresh", Expiry: time.Now().Add(time.Hour)}}
+	if err := saveOAuth(defaultKeyringAccount, creds); err != nil {
+		t.Fatal(err)
+	}
+	var auth atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth.Store(r.Header.Get("Authorization"))
+		_, _ = io.WriteString(w, `{"data":{"budgets":[]}}`)
+	}))
+	defer srv.Close()
+	var stderr bytes.Buffer
+	args := []string{"backup", "--url", srv.URL, "--output", t.TempDir(), "--token-source", "oauth"}
+	if code := runCLI(args, io.Discard, &stderr); code != 0 {
+		t.Fatalf("backup exit %d: %s", code, stderr.String())
+	}
+	if got, _ := auth.Load().(string); !strings.HasSuffix(got, " fresh") {
+		t.Errorf("Authorization = %q; want the OAuth access token", got)
+	}
+}
@@ -0,0 +1,141 @@
+package ynabvault
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"filippo.io/age"
+)
+
+// Option sets one setting of a Client or Runner
+type Option func(*Config)
+
+// WithBaseURL sends the API requests to the budgets endpoint at url instead
+// of DefaultBaseURL; see BudgetsURL
+func WithBaseURL(url string) Option { return func(c *Config) { c.BaseURL = url } }
+
+// WithEndpoints overrides the URLs of single endpoints; see CheckEndpoints
+func WithEndpoints(endpoints map[string]string) Option {
+	return func(c *Config) { c.Endpoints = endpoints }
+}
+
+// WithHTTPClient sends the API requests through client
+func WithHTTPClient(client *http.Client) Option { return func(c *Config) { c.Client = client } }
+
+// WithLogger logs through logger, with the token and other sensitive values
+// redacted
+func WithLogger(logger *slog.Logger) Option { return func(c *Config) { c.Logger = logger } }
+
+// WithResources also saves these budget sub-resources, such as "accounts"
+func WithResources(resources ...string) Option {
+	return func(c *Config) { c.Resources = resources }
+}
+
+// WithConcurrency downloads up to n budgets in parallel
+func WithConcurrency(n int) Option { return func(c *Config) { c.Concurrency = n } }
+
+// WithRecipients encrypts every budget file to these age recipients
+func WithRecipients(recipients ...age.Recipient) Option {
+	return func(c *Config) { c.Recipients = recipients }
+}
+
+// WithBudgets limits the backup to budgets matching one of these name globs
+// or IDs
+func WithBudgets(patterns ...string) Option { return func(c *Config) { c.Budgets = patterns } }
+
+// WithExcludeBudgets skips the budgets matching one of these name globs or IDs
+func WithExcludeBudgets(patterns ...string) Option {
+	return func(c *Config) { c.ExcludeBudgets = patterns }
+}
+
+// WithTransactionsSince limits the transactions sub-resource to transactions
+// on or after date, a YYYY-MM-DD date
+func WithTransactionsSince(date string) Option {
+	return func(c *Config) { c.TransactionsSince = date }
+}
+
+// WithMaxBudgetSize refuses to save budget exports larger than n bytes
+func WithMaxBudgetSize(n int64) Option { return func(c *Config) { c.MaxBudgetSize = n } }
+
+// WithFull downloads every budget in full rather than only its changes
+func WithFull() Option { return func(c *Config) { c.Full = true } }
+
+// WithForce downloads budgets even when unchanged since the last run
+func WithForce() Option { return func(c *Config) { c.Force = true } }
+
+// WithResume skips the budgets an interrupted or failed run already saved
+func WithResume() Option { return func(c *Config) { c.Resume = true } }
+
+// WithStrict fails the run when any budget could not be saved
+func WithStrict() Option { return func(c *Config) { c.Strict = true } }
+
+// WithFailFast fails the run at the first budget that could not be saved
+func WithFailFast() Option { return func(c *Config) { c.Strict, c.FailFast = true, true } }
+
+// WithJSONStyle reformats budget files before they are saved
+func WithJSONStyle(style JSONStyle) Option { return func(c *Config) { c.JSONStyle = style } }
+
+// WithFilenameTemplate names budget files from a template; see
+// CheckFilenameTemplate
+func WithFilenameTemplate(template string) Option {
+	return func(c *Config) { c.FilenameTemplate = template }
+}
+
+// WithLayout arranges the files in the store as LayoutFlat or LayoutNested
+func WithLayout(layout string) Option { return func(c *Config) { c.Layout = layout } }
+
+// API is the part of the YNAB API a Client reads. Code that takes an API
+// rather than a *Client can be tested with ynabvaulttest.API.
+type API interface {
+	// Budgets lists the budgets the token can read
+	Budgets(ctx context.Context) ([]Budget, error)
+	// Budget downloads the full export of the budget with this ID
+	Budget(ctx context.Context, id string) ([]byte, error)
+}
+
+// Client talks to the YNAB API with a personal access token
+type Client struct {
+	cfg Config
+}
+
+// NewClient returns a client that authenticates with token
+func NewClient(token string, opts ...Option) *Client {
+	c := &Client{cfg: Config{Token: token}}
+	for _, opt := range opts {
+		opt(&c.cfg)
+	}
+	return c
+}
+
+// Budgets lists the budgets the token can read
+func (c *Client) Budgets(ctx context.Context) ([]Budget, error) {
+	return FetchBudgets(ctx, c.cfg)
+}
+
+// Budget downloads the full export of the budget with this ID, as the API
+// serves it
+func (c *Client) Budget(ctx context.Context, id string) ([]byte, error) {
+	return httpGet(withEndpoint(ctx, EndpointBudget), c.cfg.Client, c.cfg.endpoint(EndpointBudget, id), c.cfg.Token)
+}
+
+// Runner backs up the budgets of a Client into a Store
+type Runner struct {
+	cfg Config
+}
+
+// NewRunner returns a runner that saves the budgets client reads into store,
+// with the settings of client and then opts
+func NewRunner(client *Client, store Store, opts ...Option) *Runner {
+	r := &Runner{cfg: client.cfg}
+	r.cfg.Store = store
+	for _, opt := range opts {
+		opt(&r.cfg)
+	}
+	return r
+}
+
+// Run makes one backup, as Run does with the runner's settings
+func (r *Runner) Run(ctx context.Context) (Report, error) {
+	return Run(ctx, r.cfg)
+}
@@ -0,0 +1,65 @@
+package ynabvault
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestClientRunner lists and downloads budgets through a Client and backs
+// them up with a Runner whose options add to the client's
+func TestClientRunner(t *testing.T) {
+	const budgetJSON = `{"data":{"budget":{"id":"b1","name":"Home"}}}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/":
+			_, _ = io.WriteString(w, `{"data":{"budgets":[{"id":"b1","name":"Home","last_modified_on":"2025-05-14T10:00:00Z"}]}}`)
+		case "/b1":
+			_, _ = io.WriteString(w, budgetJSON)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	client := NewClient("tok", WithBaseURL(srv.URL), WithHTTPClient(srv.Client()))
+	budgets, err := client.Budgets(t.Context())
+	if err != nil || len(budgets) != 1 || budgets[0].ID != "b1" {
+		t.Fatalf("Budgets = %+v, %v", budgets, err)
+	}
+	data, err := client.Budget(t.Context(), "b1")
+	if err != nil || string(data) != budgetJSON {
+		t.Fatalf("Budget = %s, %v", data, err)
+	}
+
+	dir := t.TempDir()
+	runner := NewRunner(client, DirStore(dir), WithLayout(LayoutNested), WithStrict())
+	report, err := runner.Run(t.Context())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if report.Downloaded != 1 || len(report.Results) != 1 {
+		t.Fatalf("report = %+v", report)
+	}
+	path := report.Results[0].Path
+	if filepath.Dir(path) == dir {
+		t.Errorf("path %s is not nested", path)
+	}
+	if got, err := os.ReadFile(path); err != nil || string(got) != budgetJSON {
+		t.Errorf("saved %s = %s, %v", path, got, err)
+	}
+	if client.cfg.Layout != "" || client.cfg.Store != nil {
+		t.Errorf("runner options changed the client: %+v", client.cfg)
+	}
+
+	if _, err := NewClient("wrong", WithBaseURL(srv.URL)).Budgets(t.Context()); err == nil {
+		t.Error("Budgets with a wrong token succeeded")
+	}
+}
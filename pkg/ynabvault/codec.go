@@ -0,0 +1,89 @@
+package ynabvault
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Stored files may carry compression and encryption layers, named by
+// suffixes such as .json.gz.age. Readers detect each layer by its magic
+// bytes, so vaults written with different settings over time read alike.
+const (
+	gzipSuffix = ".gz"
+	zstdSuffix = ".zst"
+)
+
+// storedSuffixes are the layer suffixes a stored JSON file may end in
+var storedSuffixes = []string{AgeSuffix, gzipSuffix, zstdSuffix}
+
+// maxStoredLayers bounds how many layers OpenStored peels off
+const maxStoredLayers = 4
+
+var (
+	ageMagic      = []byte("age-encryption.org/")
+	ageArmorMagic = []byte(armor.Header)
+	gzipMagic     = []byte{0x1f, 0x8b}
+	zstdMagic     = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// TrimStoredSuffixes strips the layer suffixes from name and reports
+// whether one of them was encryption
+func TrimStoredSuffixes(name string) (string, bool) {
+	encrypted := false
+	for trimmed := true; trimmed; {
+		trimmed = false
+		for _, suffix := range storedSuffixes {
+			if base, ok := strings.CutSuffix(name, suffix); ok {
+				name, trimmed = base, true
+				encrypted = encrypted || suffix == AgeSuffix
+			}
+		}
+	}
+	return name, encrypted
+}
+
+// OpenStored peels encryption and compression layers off stored data until
+// plain content remains
+func OpenStored(data []byte, ids []age.Identity) ([]byte, error) {
+	for range maxStoredLayers {
+		var err error
+		switch {
+		case bytes.HasPrefix(data, ageMagic):
+			if len(ids) == 0 {
+				return nil, errors.New("snapshot is encrypted; pass --identity")
+			}
+			data, err = Decrypt(data, ids)
+		case bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), ageArmorMagic):
+			// Armor is a layer of its own around the binary age file
+			data, err = io.ReadAll(armor.NewReader(bytes.NewReader(data)))
+		case bytes.HasPrefix(data, gzipMagic):
+			var zr *gzip.Reader
+			if zr, err = gzip.NewReader(bytes.NewReader(data)); err == nil {
+				data, err = io.ReadAll(zr)
+			}
+		case bytes.HasPrefix(data, zstdMagic):
+			var zr *zstd.Decoder
+			if zr, err = zstd.NewReader(nil, zstd.WithDecoderConcurrency(1)); err == nil {
+				data, err = zr.DecodeAll(data, nil)
+				zr.Close()
+			}
+		default:
+			return data, nil
+		}
+		if err != nil {
+			if errors.Is(err, ErrCorrupt) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%w: %w", ErrCorrupt, err)
+		}
+	}
+	return nil, fmt.Errorf("%w: more than %d compression or encryption layers", ErrCorrupt, maxStoredLayers)
+}
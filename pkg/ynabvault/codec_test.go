@@ -0,0 +1,99 @@
+package ynabvault
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/klauspost/compress/zstd"
+)
+
+// TestOpenStored detects every layer by its magic bytes, whatever the name
+func TestOpenStored(t *testing.T) {
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := []byte(`{"data":{"budget":{"id":"b1"}}}`)
+	gz := func(data []byte) []byte {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, _ = zw.Write(data)
+		_ = zw.Close()
+		return buf.Bytes()
+	}
+	zst := func(data []byte) []byte {
+		zw, _ := zstd.NewWriter(nil)
+		defer zw.Close()
+		return zw.EncodeAll(data, nil)
+	}
+	seal := func(data []byte) []byte {
+		enc, err := Encrypt(data, []age.Recipient{id.Recipient()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return enc
+	}
+	armored := func(data []byte) []byte {
+		var buf bytes.Buffer
+		aw := armor.NewWriter(&buf)
+		_, _ = aw.Write(data)
+		_ = aw.Close()
+		return buf.Bytes()
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"plain", plain},
+		{"gzip", gz(plain)},
+		{"zstd", zst(plain)},
+		{"age", seal(plain)},
+		{"armored age", armored(seal(plain))},
+		{"gzip in age", seal(gz(plain))},
+		{"zstd in gzip", gz(zst(plain))},
+	}
+	for _, tc := range tests {
+		got, err := OpenStored(tc.data, []age.Identity{id})
+		if err != nil || !bytes.Equal(got, plain) {
+			t.Errorf("%s: OpenStored = %q, %v; want %q", tc.name, got, err, plain)
+		}
+	}
+
+	if _, err := OpenStored(seal(plain), nil); err == nil || !strings.Contains(err.Error(), "--identity") {
+		t.Errorf("encrypted without identity: err = %v", err)
+	}
+	if _, err := OpenStored(gz(plain)[:12], nil); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("truncated gzip: err = %v; want ErrCorrupt", err)
+	}
+	nested := plain
+	for range maxStoredLayers + 1 {
+		nested = gz(nested)
+	}
+	if _, err := OpenStored(nested, nil); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("too many layers: err = %v; want ErrCorrupt", err)
+	}
+}
+
+// TestTrimStoredSuffixes strips layer suffixes in any order
+func TestTrimStoredSuffixes(t *testing.T) {
+	tests := []struct {
+		in, want  string
+		encrypted bool
+	}{
+		{"a.json", "a.json", false},
+		{"a.json.gz", "a.json", false},
+		{"a.json.zst.age", "a.json", true},
+		{"a.json.age.gz", "a.json", true},
+		{"notes.txt", "notes.txt", false},
+	}
+	for _, tc := range tests {
+		if got, enc := TrimStoredSuffixes(tc.in); got != tc.want || enc != tc.encrypted {
+			t.Errorf("TrimStoredSuffixes(%q) = %q, %v; want %q, %v", tc.in, got, enc, tc.want, tc.encrypted)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package ynabvault
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// BudgetEnvelope mirrors the budget detail response: {"data":{"budget":{...},"server_knowledge":N}}
+type BudgetEnvelope struct {
+	Data struct {
+		Budget          map[string]interface{} `json:"budget"`
+		ServerKnowledge int64                  `json:"server_knowledge"`
+	} `json:"data"`
+}
+
+// DecodeEnvelope parses a budget detail response, keeping numbers exact
+func DecodeEnvelope(data []byte) (BudgetEnvelope, error) {
+	var env BudgetEnvelope
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&env); err != nil {
+		return env, fmt.Errorf("%w: %w", ErrCorrupt, err)
+	}
+	return env, nil
+}
+
+// serverKnowledge extracts data.server_knowledge, or 0 when the payload lacks it
+func serverKnowledge(data []byte) int64 {
+	env, err := DecodeEnvelope(data)
+	if err != nil {
+		return 0
+	}
+	return env.Data.ServerKnowledge
+}
+
+// mergeDelta applies a delta budget response onto a previous full snapshot and
+// returns the merged snapshot carrying the delta's server_knowledge
+func mergeDelta(snapshot, delta []byte) ([]byte, error) {
+	base, err := DecodeEnvelope(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("previous snapshot: %w", err)
+	}
+	changes, err := DecodeEnvelope(delta)
+	if err != nil {
+		return nil, fmt.Errorf("delta: %w", err)
+	}
+	if base.Data.Budget == nil {
+		return nil, fmt.Errorf("previous snapshot: %w: no budget", ErrCorrupt)
+	}
+	base.Data.Budget = mergeObject(base.Data.Budget, changes.Data.Budget)
+	base.Data.ServerKnowledge = changes.Data.ServerKnowledge
+	return json.Marshal(base)
+}
+
+// mergeObject overlays delta fields onto old, merging entity arrays by key
+func mergeObject(old, delta map[string]interface{}) map[string]interface{} {
+	for k, v := range delta {
+		oldList, okOld := old[k].([]interface{})
+		newList, okNew := v.([]interface{})
+		if okOld && okNew {
+			old[k] = mergeEntities(oldList, newList)
+			continue
+		}
+		old[k] = v
+	}
+	return old
+}
+
+// mergeEntities merges changed entities into old by their key, dropping
+// entities the delta marks as deleted; lists without keys are replaced
+func mergeEntities(old, delta []interface{}) []interface{} {
+	index := make(map[string]int, len(old))
+	for i, e := range old {
+		key := entityKey(e)
+		if key == "" {
+			return delta
+		}
+		index[key] = i
+	}
+	merged := old
+	removed := map[int]bool{}
+	for _, e := range delta {
+		key := entityKey(e)
+		if key == "" {
+			return delta
+		}
+		obj := e.(map[string]interface{})
+		i, exists := index[key]
+		switch {
+		case obj["deleted"] == true:
+			if exists {
+				removed[i] = true
+			}
+		case exists:
+			merged[i] = mergeObject(merged[i].(map[string]interface{}), obj)
+		default:
+			index[key] = len(merged)
+			merged = append(merged, obj)
+		}
+	}
+	if len(removed) == 0 {
+		return merged
+	}
+	out := make([]interface{}, 0, len(merged)-len(removed))
+	for i, e := range merged {
+		if !removed[i] {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// entityKey identifies an entity by its "id", or "month" for month entries
+func entityKey(e interface{}) string {
+	obj, ok := e.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	if id, ok := obj["id"].(string); ok {
+		return "id:" + id
+	}
+	if month, ok := obj["month"].(string); ok {
+		return "month:" + month
+	}
+	return ""
+}
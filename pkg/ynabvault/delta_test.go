@@ -0,0 +1,131 @@
+package ynabvault
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestMergeDelta applies changed, added and deleted entities onto a snapshot
+func TestMergeDelta(t *testing.T) {
+	snapshot := []byte(`{"data":{"server_knowledge":10,"budget":{"id":"b","name":"Old",
+		"accounts":[{"id":"a1","name":"Checking","balance":1000},{"id":"a2","name":"Savings","balance":5}],
+		"months":[{"month":"2025-01-01","categories":[{"id":"c1","budgeted":1},{"id":"c2","budgeted":2}]}]}}}`)
+	delta := []byte(`{"data":{"server_knowledge":12,"budget":{"id":"b","name":"New",
+		"accounts":[{"id":"a1","name":"Checking","balance":900},{"id":"a2","deleted":true},{"id":"a3","name":"Cash","balance":7}],
+		"months":[{"month":"2025-01-01","categories":[{"id":"c2","budgeted":20}]}]}}}`)
+
+	merged, err := mergeDelta(snapshot, delta)
+	if err != nil {
+		t.Fatalf("mergeDelta: %v", err)
+	}
+	var got struct {
+		Data struct {
+			ServerKnowledge int64 `json:"server_knowledge"`
+			Budget          struct {
+				Name     string `json:"name"`
+				Accounts []struct {
+					ID      string `json:"id"`
+					Balance int64  `json:"balance"`
+				} `json:"accounts"`
+				Months []struct {
+					Categories []struct {
+						ID       string `json:"id"`
+						Budgeted int64  `json:"budgeted"`
+					} `json:"categories"`
+				} `json:"months"`
+			} `json:"budget"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(merged, &got); err != nil {
+		t.Fatalf("decode merged: %v", err)
+	}
+	b := got.Data.Budget
+	if got.Data.ServerKnowledge != 12 || b.Name != "New" {
+		t.Errorf("scalars not updated: knowledge=%d name=%q", got.Data.ServerKnowledge, b.Name)
+	}
+	if len(b.Accounts) != 2 || b.Accounts[0].Balance != 900 || b.Accounts[1].ID != "a3" {
+		t.Errorf("accounts merged incorrectly: %+v", b.Accounts)
+	}
+	cats := b.Months[0].Categories
+	if len(cats) != 2 || cats[0].Budgeted != 1 || cats[1].Budgeted != 20 {
+		t.Errorf("month categories merged incorrectly: %+v", cats)
+	}
+}
+
+// TestMergeDeltaCorrupt rejects an unreadable previous snapshot
+func TestMergeDeltaCorrupt(t *testing.T) {
+	if _, err := mergeDelta([]byte(`{"data":{}}`), []byte(`{"data":{"budget":{}}}`)); err == nil {
+		t.Error("expected error for snapshot without budget")
+	}
+	if _, err := mergeDelta([]byte(`nope`), []byte(`{}`)); err == nil {
+		t.Error("expected error for invalid snapshot JSON")
+	}
+}
+
+// TestRunUsesServerKnowledge verifies a second run requests and merges a delta
+func TestRunUsesServerKnowledge(t *testing.T) {
+	var knowledgeParams []string
+	listed := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			// The budget changes between runs so none of them is skipped
+			listed++
+			fmt.Fprintf(w, `{"data":{"budgets":[{"id":"b1","name":"Budget","last_modified_on":"2025-01-%02dT00:00:00Z"}]}}`, listed)
+			return
+		}
+		k := r.URL.Query().Get("last_knowledge_of_server")
+		knowledgeParams = append(knowledgeParams, k)
+		if k == "" {
+			_, _ = io.WriteString(w, `{"data":{"server_knowledge":5,"budget":{"id":"b1","payees":[{"id":"p1","name":"Shop"}]}}}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"data":{"server_knowledge":6,"budget":{"id":"b1","payees":[{"id":"p2","name":"Cafe"}]}}}`)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	cfg := Config{Token: "tok", BaseURL: srv.URL, OutputDir: dir, Client: srv.Client()}
+	for i := 0; i < 2; i++ {
+		if _, err := Run(t.Context(), cfg); err != nil {
+			t.Fatalf("run %d: %v", i, err)
+		}
+	}
+	if len(knowledgeParams) != 2 || knowledgeParams[0] != "" || knowledgeParams[1] != "5" {
+		t.Fatalf("unexpected last_knowledge_of_server params: %q", knowledgeParams)
+	}
+
+	st, err := LoadState(t.Context(), DirStore(dir))
+	if err != nil {
+		t.Fatalf("LoadState: %v", err)
+	}
+	saved := st.Budgets["b1"]
+	if saved.ServerKnowledge != 6 {
+		t.Errorf("expected knowledge 6 after delta, got %d", saved.ServerKnowledge)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, saved.Snapshot))
+	if err != nil {
+		t.Fatalf("read snapshot: %v", err)
+	}
+	env, err := DecodeEnvelope(data)
+	if err != nil {
+		t.Fatalf("decode snapshot: %v", err)
+	}
+	if payees := env.Data.Budget["payees"].([]interface{}); len(payees) != 2 {
+		t.Errorf("expected merged snapshot with 2 payees, got %v", payees)
+	}
+
+	// --full ignores stored knowledge
+	cfg.Full = true
+	if _, err := Run(t.Context(), cfg); err != nil {
+		t.Fatalf("full run: %v", err)
+	}
+	if last := knowledgeParams[len(knowledgeParams)-1]; last != "" {
+		t.Errorf("full run sent last_knowledge_of_server=%q", last)
+	}
+}
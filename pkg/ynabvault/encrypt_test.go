@@ -0,0 +1,43 @@
+package ynabvault
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"filippo.io/age"
+)
+
+// TestEncryptRoundTrip decrypts what encrypt produced and rejects other keys
+func TestEncryptRoundTrip(t *testing.T) {
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipients, err := ParseRecipients([]string{id.Recipient().String()})
+	if err != nil {
+		t.Fatalf("ParseRecipients: %v", err)
+	}
+	plain := []byte(`{"data":{"budget":{"id":"b1"}}}`)
+	enc, err := Encrypt(plain, recipients)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if bytes.Contains(enc, []byte("budget")) {
+		t.Error("ciphertext contains plaintext")
+	}
+	got, err := Decrypt(enc, []age.Identity{id})
+	if err != nil || !bytes.Equal(got, plain) {
+		t.Errorf("decrypt = %q, %v; want %q", got, err, plain)
+	}
+	if _, err := Decrypt(enc, []age.Identity{other}); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("decrypt with wrong identity = %v; want ErrCorrupt", err)
+	}
+	if _, err := ParseRecipients([]string{"not-a-key"}); err == nil {
+		t.Error("expected an error for an invalid recipient")
+	}
+}
@@ -0,0 +1,76 @@
+package ynabvault
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Endpoint names, as Config.Endpoints keys them and --api-usage reports them
+const (
+	EndpointBudgets = "/budgets"
+	EndpointBudget  = "/budgets/{id}"
+)
+
+// EndpointNames lists every endpoint a backup may request: the budgets list,
+// each budget and each of its sub-resources
+func EndpointNames() []string {
+	names := []string{EndpointBudgets, EndpointBudget}
+	for _, res := range BudgetResources {
+		names = append(names, EndpointBudget+"/"+res)
+	}
+	return names
+}
+
+// CheckEndpoints rejects overrides of unknown endpoints and malformed URLs.
+// A per-budget endpoint's URL must contain {id}, which is replaced by the
+// budget ID, or every budget would be fetched from the same place.
+func CheckEndpoints(overrides map[string]string) error {
+	known := EndpointNames()
+	for _, name := range slices.Sorted(maps.Keys(overrides)) {
+		if !slices.Contains(known, name) {
+			return fmt.Errorf("unknown endpoint %q (known: %s)", name, strings.Join(known, ", "))
+		}
+		raw := overrides[name]
+		u, err := url.Parse(strings.ReplaceAll(raw, "{id}", "id"))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" {
+			return fmt.Errorf("endpoint %s: %q must be an http:// or https:// URL without a query", name, raw)
+		}
+		if name != EndpointBudgets && !strings.Contains(raw, "{id}") {
+			return fmt.Errorf("endpoint %s: %q must contain {id} for the budget ID", name, raw)
+		}
+	}
+	return nil
+}
+
+// endpoint returns the URL of the named endpoint for budget id: the
+// override from Endpoints when there is one, otherwise a path below BaseURL
+func (c Config) endpoint(name, id string) string {
+	if u, ok := c.Endpoints[name]; ok {
+		return strings.ReplaceAll(u, "{id}", url.PathEscape(id))
+	}
+	base := cmp.Or(c.BaseURL, DefaultBaseURL)
+	if name == EndpointBudgets {
+		return base
+	}
+	return base + "/" + url.PathEscape(id) + strings.TrimPrefix(name, EndpointBudget)
+}
+
+// endpointKey is the context key carrying the endpoint a request is for
+type endpointKey struct{}
+
+// withEndpoint marks requests made with ctx as being for the named endpoint
+func withEndpoint(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, endpointKey{}, name)
+}
+
+// RequestEndpoint returns the name of the endpoint a backup request made with
+// ctx is for, so transports can label requests whose URL was overridden
+func RequestEndpoint(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(endpointKey{}).(string)
+	return name, ok
+}
@@ -0,0 +1,102 @@
+package ynabvault
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestCheckEndpoints accepts overrides of known endpoints with usable URLs
+func TestCheckEndpoints(t *testing.T) {
+	tests := []struct {
+		overrides map[string]string
+		wantErr   string
+	}{
+		{nil, ""},
+		{map[string]string{"/budgets": "https://cache.example/budgets"}, ""},
+		{map[string]string{"/budgets/{id}/transactions": "http://cache:8080/ynab/{id}/tx"}, ""},
+		{map[string]string{"/budgets/{id}/transfers": "https://cache.example/{id}"}, "unknown endpoint"},
+		{map[string]string{"/budgets/{id}": "cache.example/{id}"}, "http:// or https://"},
+		{map[string]string{"/budgets/{id}": "https://cache.example/{id}?x=1"}, "without a query"},
+		{map[string]string{"/budgets/{id}/accounts": "https://cache.example/accounts"}, "must contain {id}"},
+	}
+	for _, tc := range tests {
+		err := CheckEndpoints(tc.overrides)
+		if tc.wantErr == "" && err != nil {
+			t.Errorf("CheckEndpoints(%v): %v", tc.overrides, err)
+		}
+		if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+			t.Errorf("CheckEndpoints(%v) error = %v; want %q", tc.overrides, err, tc.wantErr)
+		}
+	}
+}
+
+// TestConfigEndpoint prefers an override and falls back to BaseURL
+func TestConfigEndpoint(t *testing.T) {
+	cfg := Config{BaseURL: "https://api.example/v1/budgets", Endpoints: map[string]string{
+		"/budgets/{id}/transactions": "https://cache.example/tx/{id}",
+	}}
+	tests := []struct{ name, id, want string }{
+		{EndpointBudgets, "", "https://api.example/v1/budgets"},
+		{EndpointBudget, "a b", "https://api.example/v1/budgets/a%20b"},
+		{"/budgets/{id}/accounts", "b1", "https://api.example/v1/budgets/b1/accounts"},
+		{"/budgets/{id}/transactions", "b1", "https://cache.example/tx/b1"},
+	}
+	for _, tc := range tests {
+		if got := cfg.endpoint(tc.name, tc.id); got != tc.want {
+			t.Errorf("endpoint(%s, %s) = %s; want %s", tc.name, tc.id, got, tc.want)
+		}
+	}
+}
+
+// labelRoundTripper records the endpoint name of each request it sends
+type labelRoundTripper struct{ labels *[]string }
+
+func (l labelRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	label, _ := RequestEndpoint(req.Context())
+	*l.labels = append(*l.labels, label)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// TestRunEndpointOverride fetches an overridden endpoint from its own URL and
+// labels the request with the endpoint's name
+func TestRunEndpointOverride(t *testing.T) {
+	var labels []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/budgets":
+			_, _ = w.Write([]byte(`{"data":{"budgets":[{"id":"b1","name":"Home"}]}}`))
+		case "/v1/budgets/b1":
+			_, _ = w.Write([]byte(`{"data":{"budget":{"id":"b1"},"server_knowledge":1}}`))
+		case "/cache/b1/accounts":
+			_, _ = w.Write([]byte(`{"data":{"accounts":[]}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	client := &http.Client{Transport: labelRoundTripper{&labels}}
+
+	cfg := Config{
+		Token:     "tok",
+		BaseURL:   srv.URL + "/v1/budgets",
+		Endpoints: map[string]string{"/budgets/{id}/accounts": srv.URL + "/cache/{id}/accounts"},
+		OutputDir: t.TempDir(),
+		Resources: []string{"accounts"},
+		Client:    client,
+		Strict:    true,
+	}
+	if _, err := Run(t.Context(), cfg); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	want := []string{"/budgets", "/budgets/{id}", "/budgets/{id}/accounts"}
+	if strings.Join(labels, " ") != strings.Join(want, " ") {
+		t.Errorf("request labels = %v; want %v", labels, want)
+	}
+
+	cfg.Endpoints = map[string]string{"/nope": srv.URL}
+	if _, err := Run(t.Context(), cfg); err == nil || !strings.Contains(err.Error(), "unknown endpoint") {
+		t.Errorf("Run with a bad override error = %v; want unknown endpoint", err)
+	}
+}
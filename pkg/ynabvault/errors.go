@@ -0,0 +1,40 @@
+package ynabvault
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Error kinds returned (wrapped) throughout the tool; branch on them with errors.Is
+var (
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrRateLimited  = errors.New("rate limited")
+	ErrNotFound     = errors.New("not found")
+	ErrBackend      = errors.New("storage backend failure")
+	ErrCorrupt      = errors.New("corrupt data")
+	ErrLocked       = errors.New("vault locked")
+	ErrFrozen       = errors.New("vault frozen")
+)
+
+// StatusError reports an unexpected HTTP status from the YNAB API
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("bad status: %d", e.StatusCode)
+}
+
+// Unwrap maps the status code onto one of the error kinds, if any applies
+func (e *StatusError) Unwrap() error {
+	switch e.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrUnauthorized
+	case http.StatusTooManyRequests:
+		return ErrRateLimited
+	case http.StatusNotFound:
+		return ErrNotFound
+	}
+	return nil
+}
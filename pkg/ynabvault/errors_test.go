@@ -0,0 +1,56 @@
+package ynabvault
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestHttpGetErrorKinds checks that API statuses map onto the error kinds
+func TestHttpGetErrorKinds(t *testing.T) {
+	tests := []struct {
+		status int
+		want   error
+	}{
+		{http.StatusUnauthorized, ErrUnauthorized},
+		{http.StatusForbidden, ErrUnauthorized},
+		{http.StatusTooManyRequests, ErrRateLimited},
+		{http.StatusNotFound, ErrNotFound},
+	}
+	for _, tc := range tests {
+		t.Run(http.StatusText(tc.status), func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+			}))
+			defer srv.Close()
+
+			_, err := httpGet(t.Context(), srv.Client(), srv.URL, "tok")
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("httpGet error = %v; want %v", err, tc.want)
+			}
+			var se *StatusError
+			if !errors.As(err, &se) || se.StatusCode != tc.status {
+				t.Errorf("expected *StatusError with code %d, got %v", tc.status, err)
+			}
+		})
+	}
+}
+
+// TestErrorKindsWrapped verifies decode and write failures carry their kind
+func TestErrorKindsWrapped(t *testing.T) {
+	if _, err := decodeBudgets([]byte(`{`)); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("decodeBudgets error = %v; want ErrCorrupt", err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+	cfg := Config{Token: "tok", BaseURL: srv.URL, OutputDir: "/nonexistent/dir", Client: srv.Client()}
+	_, _, _, err := downloadAndSave(t.Context(), cfg, Budget{ID: "x", Name: "X", LastModifiedOn: time.Now()}, budgetState{})
+	if !errors.Is(err, ErrBackend) {
+		t.Errorf("downloadAndSave error = %v; want ErrBackend", err)
+	}
+}
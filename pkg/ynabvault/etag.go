@@ -0,0 +1,70 @@
+package ynabvault
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// cachedResponse is what a run remembers of a response to request the same
+// URL conditionally next time, with If-None-Match and If-Modified-Since
+type cachedResponse struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	File         string `json:"file"` // where the body was saved
+}
+
+// usable reports whether c has a validator and a saved body that can be
+// read back in place of a fresh one; encrypted files cannot be
+func (c cachedResponse) usable() bool {
+	return c.File != "" && (c.ETag != "" || c.LastModified != "") && !strings.HasSuffix(c.File, AgeSuffix)
+}
+
+// remember records the validators of the response from url, saved as file,
+// for the next run
+func (s *budgetState) remember(url string, c cachedResponse, file string) {
+	if c.ETag == "" && c.LastModified == "" {
+		return
+	}
+	if s.Responses == nil {
+		s.Responses = map[string]cachedResponse{}
+	}
+	c.File = file
+	s.Responses[url] = c
+}
+
+// cachedGet fetches url, sending the validators of prev unless cfg.Force
+// is set. On 304 Not Modified the body is read back from the file prev
+// saved, which costs no download. It returns the body and the validators
+// to remember.
+func cachedGet(ctx context.Context, cfg Config, url string, prev cachedResponse) ([]byte, cachedResponse, error) {
+	req, err := newRequest(ctx, http.MethodGet, url, cfg.Token, nil)
+	if err != nil {
+		return nil, cachedResponse{}, err
+	}
+	conditional := !cfg.Force && prev.usable()
+	if conditional {
+		if prev.ETag != "" {
+			req.Header.Set("If-None-Match", prev.ETag)
+		}
+		if prev.LastModified != "" {
+			req.Header.Set("If-Modified-Since", prev.LastModified)
+		}
+	}
+	data, header, err := doRequest(cfg.Client, req)
+	var status *StatusError
+	if conditional && errors.As(err, &status) && status.StatusCode == http.StatusNotModified {
+		data, err := cfg.store().Get(ctx, prev.File)
+		if err != nil {
+			cfg.log().Warn("previous file unavailable, downloading in full", "file", prev.File, "error", err)
+			return cachedGet(ctx, cfg, url, cachedResponse{})
+		}
+		cfg.log().Debug("not modified, reusing previous file", "url", url, "file", prev.File)
+		return data, prev, nil
+	}
+	if err != nil {
+		return nil, cachedResponse{}, err
+	}
+	return data, cachedResponse{ETag: header.Get("ETag"), LastModified: header.Get("Last-Modified")}, nil
+}
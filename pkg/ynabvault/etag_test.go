@@ -0,0 +1,92 @@
+package ynabvault
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// TestRunETag sends the validators of the last download and copies the
+// previous file on 304, for the budget and its sub-resources alike
+func TestRunETag(t *testing.T) {
+	var mu sync.Mutex
+	var conditional, sent int
+	modified := "2025-01-01T00:00:00Z"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			fmt.Fprintf(w, `{"data":{"budgets":[{"id":"b1","name":"A","last_modified_on":%q}]}}`, modified)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		etag := `"v1` + r.URL.Path + `"`
+		if r.Header.Get("If-None-Match") != "" {
+			conditional++
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		sent++
+		w.Header().Set("ETag", etag)
+		if r.URL.Path == "/b1/accounts" {
+			fmt.Fprint(w, `{"data":{"accounts":[]}}`)
+			return
+		}
+		fmt.Fprint(w, `{"data":{"budget":{"id":"b1"}}}`)
+	}))
+	defer srv.Close()
+
+	store := DirStore(t.TempDir())
+	cfg := Config{Token: "tok", BaseURL: srv.URL, Store: store, Resources: []string{"accounts"}, Client: srv.Client()}
+	run := func() {
+		t.Helper()
+		if _, err := Run(t.Context(), cfg); err != nil {
+			t.Fatalf("run: %v", err)
+		}
+	}
+	run()
+	if conditional != 0 || sent != 2 {
+		t.Fatalf("first run: %d conditional, %d sent; want 0 and 2", conditional, sent)
+	}
+
+	// A newer last_modified_on gets past the unchanged check, the server
+	// still answers 304 and the files are copied under the new time
+	modified, conditional, sent = "2025-02-01T00:00:00Z", 0, 0
+	run()
+	if conditional != 2 || sent != 0 {
+		t.Errorf("second run: %d conditional, %d sent; want 2 and 0", conditional, sent)
+	}
+	for _, name := range []string{"A_b1_20250201T000000Z.json", "A_b1/accounts_20250201T000000Z.json"} {
+		if _, err := store.Get(t.Context(), name); err != nil {
+			t.Errorf("%s not saved: %v", name, err)
+		}
+	}
+	st, err := LoadState(t.Context(), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := st.Budgets["b1"].Responses[srv.URL+"/b1/accounts"]; c.ETag != `"v1/b1/accounts"` || c.File != "A_b1/accounts_20250201T000000Z.json" {
+		t.Errorf("remembered %+v for accounts", c)
+	}
+
+	// A previous file gone missing is downloaded again in full
+	if err := store.Delete(t.Context(), "A_b1/accounts_20250201T000000Z.json"); err != nil {
+		t.Fatal(err)
+	}
+	modified, conditional, sent = "2025-03-01T00:00:00Z", 0, 0
+	run()
+	if conditional != 2 || sent != 1 {
+		t.Errorf("run with a missing file: %d conditional, %d sent; want 2 and 1", conditional, sent)
+	}
+
+	// Force skips the validators
+	cfg.Force = true
+	conditional, sent = 0, 0
+	run()
+	if conditional != 0 || sent != 2 {
+		t.Errorf("forced run: %d conditional, %d sent; want 0 and 2", conditional, sent)
+	}
+}
@@ -0,0 +1,162 @@
+package ynabvault
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// FilenameLatest is the FilenameTemplate that overwrites one file per budget,
+// {name}_{id}.json, and points a latest symlink in the output directory at
+// the most recently modified budget
+const FilenameLatest = "latest"
+
+// LatestLink is the symlink FilenameLatest maintains
+const LatestLink = "latest"
+
+// Layouts of the output directory
+const (
+	// LayoutFlat keeps budget files at the top, sub-resources in one
+	// directory per budget
+	LayoutFlat = "flat"
+	// LayoutNested keeps each snapshot in <name>_<id>/<timestamp>/, the
+	// budget as NestedBudgetFile next to its sub-resources
+	LayoutNested = "nested"
+)
+
+// NestedBudgetFile is the budget file of a snapshot in LayoutNested
+const NestedBudgetFile = "budget.json"
+
+// CheckLayout rejects unknown layouts and a nested layout combined with a
+// filename template, which only names flat files
+func CheckLayout(layout, tmpl string) error {
+	switch layout {
+	case "", LayoutFlat:
+		return nil
+	case LayoutNested:
+		if tmpl != "" {
+			return fmt.Errorf("filename template %q needs the %s layout", tmpl, LayoutFlat)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown layout %q, want %s or %s", layout, LayoutFlat, LayoutNested)
+}
+
+// filenameVar matches a template variable such as {name}
+var filenameVar = regexp.MustCompile(`\{[^{}]*\}`)
+
+// CheckFilenameTemplate rejects templates with unknown variables, without
+// {id}, which keeps two budgets from sharing a file, or naming a directory.
+// The empty template means BuildFilename.
+func CheckFilenameTemplate(tmpl string) error {
+	if tmpl == "" || tmpl == FilenameLatest {
+		return nil
+	}
+	for _, v := range filenameVar.FindAllString(tmpl, -1) {
+		switch v {
+		case "{name}", "{id}", "{date}", "{ts}":
+		default:
+			return fmt.Errorf("filename template %q: unknown variable %s (known: {name}, {id}, {date}, {ts})", tmpl, v)
+		}
+	}
+	if !strings.Contains(tmpl, "{id}") {
+		return fmt.Errorf("filename template %q must contain {id}", tmpl)
+	}
+	if strings.ContainsAny(tmpl, `/\`) || strings.HasPrefix(tmpl, ".") {
+		return fmt.Errorf("filename template %q must name a visible file in the output directory", tmpl)
+	}
+	return nil
+}
+
+// budgetFilename names a budget file by cfg.Layout and cfg.FilenameTemplate
+func (c Config) budgetFilename(b Budget) string {
+	if c.Layout == LayoutNested {
+		return c.snapshotDir(b) + NestedBudgetFile
+	}
+	switch c.FilenameTemplate {
+	case "":
+		return BuildFilename(b)
+	case FilenameLatest:
+		return budgetDirName(b) + ".json"
+	}
+	name := strings.NewReplacer(
+		"{name}", SanitizeFileName(b.Name),
+		"{id}", SanitizeFileName(b.ID),
+		"{date}", b.LastModifiedOn.UTC().Format("2006-01-02"),
+		"{ts}", b.LastModifiedOn.UTC().Format(TimeFormat),
+	).Replace(c.FilenameTemplate)
+	if !strings.HasSuffix(name, ".json") {
+		name += ".json"
+	}
+	return name
+}
+
+// snapshotDir is the directory of a snapshot in LayoutNested, with a
+// trailing slash
+func (c Config) snapshotDir(b Budget) string {
+	return budgetDirName(b) + "/" + b.LastModifiedOn.UTC().Format(TimeFormat) + "/"
+}
+
+// resourceName names a sub-resource file in the budget's directory. It
+// carries the same time as the budget file, so a template without {ts} or
+// {date} overwrites its resources too.
+func (c Config) resourceName(b Budget, resource string) string {
+	dir := budgetDirName(b) + "/"
+	switch {
+	case c.Layout == LayoutNested:
+		return c.snapshotDir(b) + resource + ".json"
+	case c.FilenameTemplate == "" || strings.Contains(c.FilenameTemplate, "{ts}"):
+		return dir + buildResourceFilename(b, resource)
+	case strings.Contains(c.FilenameTemplate, "{date}"):
+		return dir + resource + "_" + b.LastModifiedOn.UTC().Format("2006-01-02") + ".json"
+	}
+	return dir + resource + ".json"
+}
+
+// linkLatest points dir/LatestLink at target, a file in dir, replacing any
+// previous link in one rename
+func linkLatest(dir, target string) error {
+	link := filepath.Join(dir, LatestLink)
+	if fi, err := os.Lstat(link); err == nil && fi.Mode()&os.ModeSymlink == 0 {
+		return fmt.Errorf("%s exists and is not a symlink", link)
+	}
+	tmp := filepath.Join(dir, "."+LatestLink+tempSuffix)
+	if err := os.Remove(tmp); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// updateLatest points the latest symlink at the saved file of the most
+// recently modified budget. Only a local output directory can hold a
+// symlink; a failure is logged, the backup itself succeeded.
+func updateLatest(cfg Config, budgets []Budget, state *VaultState) {
+	dir, ok := cfg.store().(DirStore)
+	if !ok {
+		cfg.log().Debug("latest symlink skipped, output is not a local directory")
+		return
+	}
+	var newest Budget
+	target := ""
+	for _, b := range budgets {
+		if s, ok := state.Budgets[b.ID]; ok && s.Snapshot != "" && (target == "" || b.LastModifiedOn.After(newest.LastModifiedOn)) {
+			newest, target = b, s.Snapshot
+		}
+	}
+	if target == "" {
+		return
+	}
+	if err := linkLatest(string(dir), target); err != nil {
+		cfg.log().Warn("latest symlink not updated", "error", err)
+	}
+}
@@ -0,0 +1,158 @@
+package ynabvault
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestCheckFilenameTemplate accepts known variables and rejects templates
+// that could collide or leave the output directory
+func TestCheckFilenameTemplate(t *testing.T) {
+	tests := []struct {
+		tmpl    string
+		wantErr bool
+	}{
+		{"", false},
+		{"latest", false},
+		{"{name}_{id}_{date}", false},
+		{"{id}-{ts}.json", false},
+		{"{name}_{date}", true},
+		{"{id}_{when}", true},
+		{"backups/{id}", true},
+		{".{id}", true},
+	}
+	for _, tc := range tests {
+		if err := CheckFilenameTemplate(tc.tmpl); (err != nil) != tc.wantErr {
+			t.Errorf("CheckFilenameTemplate(%q) = %v; want error %v", tc.tmpl, err, tc.wantErr)
+		}
+	}
+}
+
+// TestBudgetFilename expands template variables, places files by layout and
+// names resources to match
+func TestBudgetFilename(t *testing.T) {
+	b := Budget{ID: "b1", Name: "My Budget", LastModifiedOn: time.Date(2025, 5, 14, 15, 30, 45, 0, time.UTC)}
+	tests := []struct {
+		tmpl         string
+		layout       string
+		want         string
+		wantResource string
+	}{
+		{"", "", "My_Budget_b1_20250514T153045Z.json", "My_Budget_b1/accounts_20250514T153045Z.json"},
+		{"latest", "", "My_Budget_b1.json", "My_Budget_b1/accounts.json"},
+		{"{name}_{id}_{date}", "flat", "My_Budget_b1_2025-05-14.json", "My_Budget_b1/accounts_2025-05-14.json"},
+		{"{id}-{ts}.json", "", "b1-20250514T153045Z.json", "My_Budget_b1/accounts_20250514T153045Z.json"},
+		{"", "nested", "My_Budget_b1/20250514T153045Z/budget.json", "My_Budget_b1/20250514T153045Z/accounts.json"},
+	}
+	for _, tc := range tests {
+		cfg := Config{FilenameTemplate: tc.tmpl, Layout: tc.layout}
+		if got := cfg.budgetFilename(b); got != tc.want {
+			t.Errorf("budgetFilename with %q = %q; want %q", tc.tmpl, got, tc.want)
+		}
+		if got := cfg.resourceName(b, "accounts"); got != tc.wantResource {
+			t.Errorf("resourceName with %q = %q; want %q", tc.tmpl, got, tc.wantResource)
+		}
+	}
+}
+
+// TestRunLatest overwrites one file per budget and links latest to the most
+// recently modified budget
+func TestRunLatest(t *testing.T) {
+	modified := "2025-01-01T00:00:00Z"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `{"data":{"budgets":[{"id":"b1","name":"A","last_modified_on":%q},{"id":"b2","name":"B","last_modified_on":"2024-06-01T00:00:00Z"}]}}`, modified)
+		default:
+			fmt.Fprintf(w, `{"data":{"budget":{"modified":%q}}}`, modified)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	cfg := Config{Token: "tok", BaseURL: srv.URL, OutputDir: dir, FilenameTemplate: FilenameLatest, Client: srv.Client()}
+	for _, m := range []string{"2025-01-01T00:00:00Z", "2025-02-01T00:00:00Z"} {
+		modified = m
+		if _, err := Run(t.Context(), cfg); err != nil {
+			t.Fatalf("run: %v", err)
+		}
+	}
+	if files, want := snapshotFiles(t, dir), []string{"A_b1.json", "B_b2.json", LatestLink}; !slices.Equal(files, want) {
+		t.Errorf("files = %v; want %v", files, want)
+	}
+	target, err := os.Readlink(filepath.Join(dir, LatestLink))
+	if err != nil || target != "A_b1.json" {
+		t.Fatalf("latest -> %q (%v); want A_b1.json", target, err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, LatestLink))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"data":{"budget":{"modified":"2025-02-01T00:00:00Z"}}}`; string(data) != want {
+		t.Errorf("latest content = %s; want %s", data, want)
+	}
+}
+
+// TestLinkLatestKeepsFile refuses to replace a regular file named latest
+func TestLinkLatestKeepsFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, LatestLink), []byte("mine"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := linkLatest(dir, "A_b1.json"); err == nil {
+		t.Error("linkLatest replaced a regular file")
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, LatestLink)); string(data) != "mine" {
+		t.Errorf("latest = %q; want it untouched", data)
+	}
+}
+
+// TestCheckLayout accepts the known layouts and no template with nested
+func TestCheckLayout(t *testing.T) {
+	tests := []struct {
+		layout, tmpl string
+		wantErr      bool
+	}{
+		{"", "", false},
+		{"flat", "latest", false},
+		{"nested", "", false},
+		{"nested", "latest", true},
+		{"deep", "", true},
+	}
+	for _, tc := range tests {
+		if err := CheckLayout(tc.layout, tc.tmpl); (err != nil) != tc.wantErr {
+			t.Errorf("CheckLayout(%q, %q) = %v; want error %v", tc.layout, tc.tmpl, err, tc.wantErr)
+		}
+	}
+}
+
+// TestRunNested saves each snapshot with its resources in its own directory
+func TestRunNested(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `{"data":{"budgets":[{"id":"b1","name":"A","last_modified_on":"2025-01-01T00:00:00Z"}]}}`)
+		case "/b1/accounts":
+			fmt.Fprint(w, `{"data":{"accounts":[]}}`)
+		default:
+			fmt.Fprint(w, `{"data":{"budget":{"id":"b1"}}}`)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	cfg := Config{Token: "tok", BaseURL: srv.URL, OutputDir: dir, Layout: LayoutNested, Resources: []string{"accounts"}, Client: srv.Client()}
+	if _, err := Run(t.Context(), cfg); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	got, err := DirStore(dir).List(t.Context(), "A_b1/")
+	if want := []string{"A_b1/20250101T000000Z/accounts.json", "A_b1/20250101T000000Z/budget.json"}; err != nil || !slices.Equal(got, want) {
+		t.Errorf("files = %v, %v; want %v", got, err, want)
+	}
+}
@@ -0,0 +1,57 @@
+package ynabvault
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// JSONStyle is how budget files are serialized before they are saved
+type JSONStyle string
+
+const (
+	// JSONAsFetched keeps the bytes the API sent
+	JSONAsFetched JSONStyle = ""
+	// JSONPretty sorts object keys and indents by two spaces, so snapshots
+	// diff line by line in git and in the diff command
+	JSONPretty JSONStyle = "pretty"
+	// JSONCanonical sorts object keys and drops all insignificant
+	// whitespace, so equal budgets are byte-for-byte equal
+	JSONCanonical JSONStyle = "canonical"
+)
+
+// Check rejects unknown styles
+func (s JSONStyle) Check() error {
+	switch s {
+	case JSONAsFetched, JSONPretty, JSONCanonical:
+		return nil
+	}
+	return fmt.Errorf("unknown JSON style %q, want %s or %s", s, JSONPretty, JSONCanonical)
+}
+
+// FormatJSON re-serializes data in style with sorted keys. Numbers keep
+// their exact digits; HTML characters are not escaped.
+func FormatJSON(data []byte, style JSONStyle) ([]byte, error) {
+	if err := style.Check(); err != nil || style == JSONAsFetched {
+		return data, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("reformat JSON: %w: %w", ErrCorrupt, err)
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if style == JSONPretty {
+		enc.SetIndent("", "  ")
+	}
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	if style == JSONCanonical {
+		return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+	}
+	return buf.Bytes(), nil
+}
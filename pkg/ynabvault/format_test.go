@@ -0,0 +1,31 @@
+package ynabvault
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestFormatJSON sorts keys, keeps numbers exact and lays out by style
+func TestFormatJSON(t *testing.T) {
+	in := []byte(`{"data":{"z":1.10,"a":[12345678901234567890,"<&>"]},"b":null}`)
+	tests := []struct {
+		style JSONStyle
+		want  string
+	}{
+		{JSONAsFetched, string(in)},
+		{JSONCanonical, `{"b":null,"data":{"a":[12345678901234567890,"<&>"],"z":1.10}}`},
+		{JSONPretty, "{\n  \"b\": null,\n  \"data\": {\n    \"a\": [\n      12345678901234567890,\n      \"<&>\"\n    ],\n    \"z\": 1.10\n  }\n}\n"},
+	}
+	for _, tc := range tests {
+		got, err := FormatJSON(in, tc.style)
+		if err != nil || string(got) != tc.want {
+			t.Errorf("FormatJSON(%q) = %q, %v; want %q", tc.style, got, err, tc.want)
+		}
+	}
+	if _, err := FormatJSON([]byte(`{"a":`), JSONPretty); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("FormatJSON of truncated JSON error = %v; want ErrCorrupt", err)
+	}
+	if _, err := FormatJSON(in, "yaml"); err == nil {
+		t.Error("FormatJSON accepted an unknown style")
+	}
+}
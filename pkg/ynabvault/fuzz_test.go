@@ -0,0 +1,79 @@
+package ynabvault
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// FuzzSanitizeFileName checks that sanitized names are safe path elements
+func FuzzSanitizeFileName(f *testing.F) {
+	for _, seed := range []string{"My Budget/Name", "..", "../../etc/passwd", "Café", "été", "..hidden", "a\\b"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, name string) {
+		got := SanitizeFileName(name)
+		if strings.ContainsAny(got, `/\`) {
+			t.Fatalf("SanitizeFileName(%q) = %q contains a path separator", name, got)
+		}
+		if strings.HasPrefix(got, ".") {
+			t.Fatalf("SanitizeFileName(%q) = %q starts with a dot", name, got)
+		}
+		if !utf8.ValidString(got) {
+			t.Fatalf("SanitizeFileName(%q) = %q is not valid UTF-8", name, got)
+		}
+		if !norm.NFC.IsNormalString(got) {
+			t.Fatalf("SanitizeFileName(%q) = %q is not NFC-normalized", name, got)
+		}
+		if again := SanitizeFileName(got); again != got {
+			t.Fatalf("SanitizeFileName is not idempotent: %q -> %q -> %q", name, got, again)
+		}
+	})
+}
+
+// FuzzBuildFilename ensures budget names and IDs cannot escape the output directory
+func FuzzBuildFilename(f *testing.F) {
+	f.Add("My Budget", "abc123")
+	f.Add("..", "../../x")
+	f.Add("", "")
+	f.Fuzz(func(t *testing.T, name, id string) {
+		b := Budget{ID: id, Name: name, LastModifiedOn: time.Date(2025, time.May, 14, 0, 0, 0, 0, time.UTC)}
+		fname := BuildFilename(b)
+		if filepath.Base(fname) != fname {
+			t.Fatalf("BuildFilename(%q, %q) = %q is not a single path element", name, id, fname)
+		}
+		if dir := "out"; filepath.Dir(filepath.Join(dir, fname)) != dir {
+			t.Fatalf("BuildFilename(%q, %q) = %q escapes the output dir", name, id, fname)
+		}
+	})
+}
+
+// FuzzDecodeBudgets feeds arbitrary payloads to the budgets list decoder
+func FuzzDecodeBudgets(f *testing.F) {
+	f.Add([]byte(`{"data":{"budgets":[{"id":"1","name":"A","last_modified_on":"2025-05-14T10:00:00Z"}]}}`))
+	f.Add([]byte(`{"data":{"budgets":[{"id":1e999}]}}`))
+	f.Add([]byte(`{"data":null}`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		budgets, err := decodeBudgets(data)
+		if err != nil {
+			return
+		}
+		// Anything that decoded must survive a round trip unchanged
+		out, err := json.Marshal(budgets)
+		if err != nil {
+			t.Fatalf("re-encoding decoded budgets: %v", err)
+		}
+		var again []Budget
+		if err := json.Unmarshal(out, &again); err != nil {
+			t.Fatalf("decoding re-encoded budgets: %v", err)
+		}
+		if len(again) != len(budgets) {
+			t.Fatalf("round trip changed budget count: %d != %d", len(again), len(budgets))
+		}
+	})
+}
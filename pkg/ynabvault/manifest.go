@@ -0,0 +1,149 @@
+package ynabvault
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// manifestFileName is the vault manifest kept next to the state file
+const manifestFileName = ".ynabvault-manifest.json"
+
+// ErrNotPinned is returned by Manifest.Check for files saved without a hash
+var ErrNotPinned = errors.New("no pinned hash")
+
+// fileDigest pins a stored file to the content it was made from, before
+// encryption, so a round trip through the whole pipeline can be checked
+type fileDigest struct {
+	SHA256 string `json:"sha256"`
+	Size   int    `json:"size"`
+	// BudgetID and ServerTime, the budget's last_modified_on, say which
+	// server state the file holds
+	BudgetID   string    `json:"budget_id,omitempty"`
+	ServerTime time.Time `json:"server_time,omitzero"`
+}
+
+// newDigest hashes plain content
+func newDigest(plain []byte) fileDigest {
+	sum := sha256.Sum256(plain)
+	return fileDigest{SHA256: hex.EncodeToString(sum[:]), Size: len(plain)}
+}
+
+// Manifest maps stored file names to their pinned digests; it is safe for
+// concurrent use by the backup workers
+type Manifest struct {
+	mu    sync.Mutex
+	Files map[string]fileDigest `json:"files"`
+}
+
+// LoadManifest reads the manifest from store; a missing file yields an empty one
+func LoadManifest(ctx context.Context, store Store) (*Manifest, error) {
+	m := &Manifest{Files: map[string]fileDigest{}}
+	data, err := store.Get(ctx, manifestFileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read manifest: %w: %w", ErrBackend, err)
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("decode manifest: %w: %w", ErrCorrupt, err)
+	}
+	if m.Files == nil {
+		m.Files = map[string]fileDigest{}
+	}
+	return m, nil
+}
+
+// record pins name to the plain content it was saved from for budget b
+func (m *Manifest) record(name string, plain []byte, b Budget) {
+	d := newDigest(plain)
+	d.BudgetID, d.ServerTime = b.ID, b.LastModifiedOn
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Files[name] = d
+}
+
+// Remove drops the pins of deleted files
+func (m *Manifest) Remove(names ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, name := range names {
+		delete(m.Files, name)
+	}
+}
+
+// Merge copies the pins other holds for names into m, leaving the pins m
+// already has, and returns how many it added
+func (m *Manifest) Merge(other *Manifest, names []string) int {
+	other.mu.Lock()
+	defer other.mu.Unlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	added := 0
+	for _, name := range names {
+		d, ok := other.Files[name]
+		if _, have := m.Files[name]; ok && !have {
+			m.Files[name] = d
+			added++
+		}
+	}
+	return added
+}
+
+// size returns the plain size pinned for name
+func (m *Manifest) size(name string) (int, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.Files[name]
+	return d.Size, ok
+}
+
+// Check compares plain, read back and decrypted, with the pin for name
+func (m *Manifest) Check(name string, plain []byte) error {
+	m.mu.Lock()
+	want, ok := m.Files[name]
+	m.mu.Unlock()
+	if !ok {
+		return ErrNotPinned
+	}
+	if got := newDigest(plain); got.SHA256 != want.SHA256 || got.Size != want.Size {
+		return fmt.Errorf("%w: content hash %s (%d bytes), pinned %s (%d bytes)", ErrCorrupt, got.SHA256, got.Size, want.SHA256, want.Size)
+	}
+	return nil
+}
+
+// Missing returns the pinned files not among names, sorted
+func (m *Manifest) Missing(names []string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []string
+	for _, name := range slices.Sorted(maps.Keys(m.Files)) {
+		if !slices.Contains(names, name) {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// Save writes the manifest into store
+func (m *Manifest) Save(ctx context.Context, store Store) error {
+	m.mu.Lock()
+	data, err := json.MarshalIndent(m, "", "  ")
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := store.Put(ctx, manifestFileName, data); err != nil {
+		return fmt.Errorf("write manifest: %w: %w", ErrBackend, err)
+	}
+	return nil
+}
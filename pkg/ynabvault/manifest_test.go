@@ -0,0 +1,58 @@
+package ynabvault
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestManifest pins, checks, removes and round-trips digests
+func TestManifest(t *testing.T) {
+	ctx := t.Context()
+	store := DirStore(t.TempDir())
+	m, err := LoadManifest(ctx, store)
+	if err != nil || len(m.Files) != 0 {
+		t.Fatalf("LoadManifest on an empty vault = %v, %v", m, err)
+	}
+	modified := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	m.record("a.json.age", []byte("plain"), Budget{ID: "b1", LastModifiedOn: modified})
+	m.record("b.json", []byte("other"), Budget{ID: "b2"})
+	if err := m.Check("a.json.age", []byte("plain")); err != nil {
+		t.Errorf("check of pinned content = %v", err)
+	}
+	if err := m.Check("a.json.age", []byte("plain!")); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("check of altered content = %v; want ErrCorrupt", err)
+	}
+	if err := m.Check("c.json", nil); !errors.Is(err, ErrNotPinned) {
+		t.Errorf("check of unpinned file = %v; want ErrNotPinned", err)
+	}
+	if got := m.Missing([]string{"a.json.age", "c.json"}); !slices.Equal(got, []string{"b.json"}) {
+		t.Errorf("missing = %v; want [b.json]", got)
+	}
+	mirror := &Manifest{Files: map[string]fileDigest{"b.json": {SHA256: "kept"}}}
+	if n := mirror.Merge(m, []string{"a.json.age", "b.json", "c.json"}); n != 1 || mirror.Files["b.json"].SHA256 != "kept" || mirror.Check("a.json.age", []byte("plain")) != nil {
+		t.Errorf("merge added %d pins: %v; want a.json.age only", n, mirror.Files)
+	}
+	m.Remove("b.json")
+	if err := m.Save(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadManifest(ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Files) != 1 || loaded.Check("a.json.age", []byte("plain")) != nil {
+		t.Errorf("reloaded manifest = %v", loaded.Files)
+	}
+	if d := loaded.Files["a.json.age"]; d.BudgetID != "b1" || !d.ServerTime.Equal(modified) {
+		t.Errorf("reloaded digest = %+v; want budget b1 at %v", d, modified)
+	}
+
+	if err := store.Put(ctx, manifestFileName, []byte("{")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadManifest(ctx, store); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("LoadManifest of a corrupt file = %v; want ErrCorrupt", err)
+	}
+}
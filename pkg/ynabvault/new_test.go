@@ -1,4 +1,4 @@
-package main
+package ynabvault
 
 import (
 	"errors"
@@ -23,7 +23,7 @@ func (staticRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 
 func TestHttpGetCloseError(t *testing.T) {
 	client := &http.Client{Transport: staticRoundTripper{}}
-	_, err := httpGet(client, "http://example", "tok")
+	_, err := httpGet(t.Context(), client, "http://example", "tok")
 	if err == nil || !strings.Contains(err.Error(), "close error") {
 		t.Fatalf("expected close error, got %v", err)
 	}
@@ -0,0 +1,97 @@
+package ynabvault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// preflightBudget counts a budget's accounts, categories and payees through
+// the lightweight endpoints and estimates the export's size from the previous
+// snapshot, before the budget is downloaded in full. It logs what it found
+// and fails when the estimate exceeds cfg.MaxBudgetSize. The counts are
+// advisory, so an endpoint that fails only costs its count.
+func preflightBudget(ctx context.Context, cfg Config, b Budget, prev budgetState) error {
+	attrs := []any{"budget", b.Name, "id", b.ID}
+	for _, res := range []string{"accounts", "categories", "payees"} {
+		name := EndpointBudget + "/" + res
+		n, err := countEntities(withEndpoint(ctx, name), cfg, cfg.endpoint(name, b.ID))
+		if err != nil {
+			cfg.log().Warn("preflight count failed", "budget", b.Name, "id", b.ID, "resource", res, "error", err)
+			continue
+		}
+		attrs = append(attrs, res, n)
+	}
+	var estimate int64
+	if cfg.manifest != nil && prev.Snapshot != "" {
+		if size, ok := cfg.manifest.size(prev.Snapshot); ok {
+			estimate = int64(size)
+			attrs = append(attrs, "estimated_size", formatBytes(estimate))
+		}
+	}
+	cfg.log().Info("preflight", attrs...)
+	return checkBudgetSize(estimate, cfg.MaxBudgetSize)
+}
+
+// countEntities returns the number of live entities in a list endpoint's
+// response; categories are counted inside their groups
+func countEntities(ctx context.Context, cfg Config, endpoint string) (int, error) {
+	data, err := httpGet(ctx, cfg.Client, endpoint, cfg.Token)
+	if err != nil {
+		return 0, err
+	}
+	type entity struct {
+		Deleted    bool     `json:"deleted"`
+		Categories []entity `json:"categories"`
+	}
+	var wrapper struct {
+		Data struct {
+			Accounts []entity `json:"accounts"`
+			Groups   []entity `json:"category_groups"`
+			Payees   []entity `json:"payees"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &wrapper); err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrCorrupt, err)
+	}
+	n := 0
+	count := func(list []entity) {
+		for _, e := range list {
+			if !e.Deleted {
+				n++
+			}
+		}
+	}
+	count(wrapper.Data.Accounts)
+	count(wrapper.Data.Payees)
+	for _, g := range wrapper.Data.Groups {
+		if !g.Deleted {
+			count(g.Categories)
+		}
+	}
+	return n, nil
+}
+
+// checkBudgetSize fails when size exceeds a positive limit, with guidance on
+// how to back the budget up anyway
+func checkBudgetSize(size, limit int64) error {
+	if limit <= 0 || size <= limit {
+		return nil
+	}
+	return fmt.Errorf("budget export of %s exceeds --max-budget-size %s; raise the limit, or save selected --resources with --transactions-since instead",
+		formatBytes(size), formatBytes(limit))
+}
+
+// formatBytes renders n with a binary unit, e.g. 1.5 MiB
+func formatBytes(n int64) string {
+	const unit = 1 << 10
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
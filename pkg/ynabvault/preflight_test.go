@@ -0,0 +1,85 @@
+package ynabvault
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestCheckBudgetSize formats sizes and only fails above a set limit
+func TestCheckBudgetSize(t *testing.T) {
+	for n, want := range map[int64]string{0: "0 B", 1023: "1023 B", 1536: "1.5 KiB", 50 << 20: "50.0 MiB", 3 << 30: "3.0 GiB"} {
+		if got := formatBytes(n); got != want {
+			t.Errorf("formatBytes(%d) = %q; want %q", n, got, want)
+		}
+	}
+	if err := checkBudgetSize(100, 0); err != nil {
+		t.Errorf("no limit: %v", err)
+	}
+	if err := checkBudgetSize(100, 100); err != nil {
+		t.Errorf("at limit: %v", err)
+	}
+	if err := checkBudgetSize(2048, 1024); err == nil || !strings.Contains(err.Error(), "2.0 KiB exceeds --max-budget-size 1.0 KiB") {
+		t.Errorf("over limit error = %v", err)
+	}
+}
+
+// TestRunMaxBudgetSize refuses oversized exports after downloading them and,
+// once a snapshot's size is known, before downloading in full
+func TestRunMaxBudgetSize(t *testing.T) {
+	var mu sync.Mutex
+	var hits []string
+	body := `{"data":{"server_knowledge":1,"budget":{"id":"b1","memo":"` + strings.Repeat("x", 200) + `"}}}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits = append(hits, r.URL.Path)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/":
+			_, _ = io.WriteString(w, `{"data":{"budgets":[{"id":"b1","name":"B"}]}}`)
+		case "/b1/accounts":
+			_, _ = io.WriteString(w, `{"data":{"accounts":[{"id":"a1"},{"id":"a2","deleted":true}]}}`)
+		case "/b1/categories":
+			_, _ = io.WriteString(w, `{"data":{"category_groups":[{"categories":[{"id":"c1"},{"id":"c2"}]}]}}`)
+		case "/b1/payees":
+			_, _ = io.WriteString(w, `{"data":{"payees":[]}}`)
+		default:
+			_, _ = io.WriteString(w, body)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	cfg := Config{Token: "tok", BaseURL: srv.URL, OutputDir: dir, Client: srv.Client(), MaxBudgetSize: 100}
+	stats, err := Run(t.Context(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Downloaded != 0 {
+		t.Errorf("oversized budget saved: %+v", stats)
+	}
+
+	// Without a limit the budget is saved and its size pinned
+	cfg.MaxBudgetSize, cfg.Full = 0, true
+	if _, err := Run(t.Context(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "B_b1_*.json"))
+	if len(files) != 1 {
+		t.Fatalf("snapshots = %v; want one", files)
+	}
+
+	// The pinned size now stops the full download before it starts
+	hits = nil
+	cfg.MaxBudgetSize = 100
+	if stats, err = Run(t.Context(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	if want := "/ /b1/accounts /b1/categories /b1/payees"; stats.Downloaded != 0 || strings.Join(hits, " ") != want {
+		t.Errorf("requests %v, stats %+v; want %s and nothing downloaded", hits, stats, want)
+	}
+}
@@ -0,0 +1,111 @@
+package ynabvault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// ProgressFileName records the budgets a run has finished so far. It is
+// removed once a run saves every budget, so one left behind marks a run
+// that was interrupted or had failures.
+const ProgressFileName = ".ynabvault-progress.json"
+
+// runProgress is the content of ProgressFileName, safe for concurrent use
+type runProgress struct {
+	mu      sync.Mutex
+	Started time.Time              `json:"started"`
+	Budgets map[string]budgetState `json:"budgets"`
+	// Partial holds budgets whose file is saved but not yet every resource
+	Partial map[string]partialBudget `json:"partial,omitempty"`
+}
+
+// partialBudget is a budget saved with only some of its resources
+type partialBudget struct {
+	State     budgetState `json:"state"`
+	Resources []string    `json:"resources,omitempty"` // saved so far
+}
+
+// loadProgress reads the progress of an earlier run from store; without
+// one it returns nil
+func loadProgress(ctx context.Context, store Store) (*runProgress, error) {
+	data, err := store.Get(ctx, ProgressFileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read progress: %w: %w", ErrBackend, err)
+	}
+	p := &runProgress{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("decode progress: %w: %w", ErrCorrupt, err)
+	}
+	if p.Budgets == nil {
+		p.Budgets = map[string]budgetState{}
+	}
+	return p, nil
+}
+
+// done returns what the earlier run saved for budget id
+func (p *runProgress) done(id string) (budgetState, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s, ok := p.Budgets[id]
+	return s, ok
+}
+
+// partial returns what the earlier run saved of budget id before it stopped
+func (p *runProgress) partial(id string) (partialBudget, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pb, ok := p.Partial[id]
+	return pb, ok
+}
+
+// record notes that budget id was saved with all its resources and writes
+// the progress to store
+func (p *runProgress) record(ctx context.Context, store Store, id string, s budgetState) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Budgets[id] = s
+	delete(p.Partial, id)
+	return p.save(ctx, store)
+}
+
+// recordPartial notes that budget id was saved with some of its resources
+// and writes the progress to store
+func (p *runProgress) recordPartial(ctx context.Context, store Store, id string, pb partialBudget) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.Partial == nil {
+		p.Partial = map[string]partialBudget{}
+	}
+	p.Partial[id] = pb
+	return p.save(ctx, store)
+}
+
+// save writes the progress to store; the caller holds p.mu
+func (p *runProgress) save(ctx context.Context, store Store) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := store.Put(ctx, ProgressFileName, data); err != nil {
+		return fmt.Errorf("write progress: %w: %w", ErrBackend, err)
+	}
+	return nil
+}
+
+// finishProgress removes the progress file after a run that saved every
+// budget and resource, including one left by an earlier run, which would
+// otherwise make a later resumed run skip budgets changed since
+func finishProgress(ctx context.Context, store Store) error {
+	if err := store.Delete(ctx, ProgressFileName); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("remove progress: %w: %w", ErrBackend, err)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package ynabvault
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// TestRunResume fetches only the budgets a failed run did not save, and
+// forgets the progress once every budget is saved
+func TestRunResume(t *testing.T) {
+	var mu sync.Mutex
+	var fetched []string
+	failing := "b2"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			_, _ = io.WriteString(w, `{"data":{"budgets":[{"id":"b1","name":"A"},{"id":"b2","name":"B"},{"id":"b3","name":"C"}]}}`)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		fetched = append(fetched, r.URL.Path)
+		if r.URL.Path == "/"+failing {
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, `{"data":{"budget":{"id":%q}}}`, r.URL.Path[1:])
+	}))
+	defer srv.Close()
+
+	store := DirStore(t.TempDir())
+	cfg := Config{Token: "tok", BaseURL: srv.URL, Store: store, Client: srv.Client()}
+	if _, err := Run(t.Context(), cfg); err != nil {
+		t.Fatalf("first run: %v", err)
+	}
+	p, err := loadProgress(t.Context(), store)
+	if err != nil || p == nil || len(p.Budgets) != 2 {
+		t.Fatalf("progress after a failed budget = %+v, %v; want b1 and b3", p, err)
+	}
+
+	fetched, failing = nil, ""
+	cfg.Resume = true
+	report, err := Run(t.Context(), cfg)
+	if err != nil {
+		t.Fatalf("resumed run: %v", err)
+	}
+	if want := []string{"/b2"}; !slices.Equal(fetched, want) {
+		t.Errorf("resumed run fetched %v; want %v", fetched, want)
+	}
+	if report.Skipped != 2 || report.Downloaded != 1 || report.Results[0].Status != "resumed" {
+		t.Errorf("report = %+v", report)
+	}
+	if _, err := store.Get(t.Context(), ProgressFileName); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("progress after a complete run: %v; want it removed", err)
+	}
+	st, _ := LoadState(t.Context(), store)
+	if len(st.Budgets) != 3 {
+		t.Errorf("state has %d budgets; want 3", len(st.Budgets))
+	}
+
+	// Nothing to resume: every budget is fetched again
+	fetched = nil
+	if _, err := Run(t.Context(), cfg); err != nil || len(fetched) != 3 {
+		t.Errorf("run without progress fetched %v, %v; want all 3", fetched, err)
+	}
+}
+
+// TestRunResumeResources fetches only the resources an interrupted run did
+// not save, keeping the budget file it did
+func TestRunResumeResources(t *testing.T) {
+	var mu sync.Mutex
+	var fetched []string
+	failing := "/b1/categories"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			_, _ = io.WriteString(w, `{"data":{"budgets":[{"id":"b1","name":"A","last_modified_on":"2025-01-01T00:00:00Z"}]}}`)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		fetched = append(fetched, r.URL.Path)
+		if r.URL.Path == failing {
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		}
+		_, _ = io.WriteString(w, `{"data":{}}`)
+	}))
+	defer srv.Close()
+
+	store := DirStore(t.TempDir())
+	cfg := Config{Token: "tok", BaseURL: srv.URL, Store: store, Resources: []string{"accounts", "categories", "payees"}, Client: srv.Client()}
+	if _, err := Run(t.Context(), cfg); err != nil {
+		t.Fatalf("first run: %v", err)
+	}
+	p, err := loadProgress(t.Context(), store)
+	if err != nil || p == nil {
+		t.Fatalf("progress after a failed resource = %+v, %v", p, err)
+	}
+	if pb := p.Partial["b1"]; pb.State.Snapshot == "" || !slices.Equal(pb.Resources, []string{"accounts", "payees"}) {
+		t.Errorf("partial = %+v; want the budget with accounts and payees", pb)
+	}
+
+	fetched, failing = nil, ""
+	cfg.Resume = true
+	if _, err := Run(t.Context(), cfg); err != nil {
+		t.Fatalf("resumed run: %v", err)
+	}
+	if want := []string{"/b1/categories"}; !slices.Equal(fetched, want) {
+		t.Errorf("resumed run fetched %v; want %v", fetched, want)
+	}
+	if _, err := store.Get(t.Context(), ProgressFileName); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("progress after a complete run: %v; want it removed", err)
+	}
+}
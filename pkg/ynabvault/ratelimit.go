@@ -0,0 +1,123 @@
+package ynabvault
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimitWindow is YNAB's rolling rate-limit window
+const rateLimitWindow = time.Hour
+
+// RateLimitTransport reads YNAB's X-Rate-Limit header ("used/limit") and
+// holds back requests once the quota is spent, so large backups wait for
+// capacity instead of running into 429 responses
+type RateLimitTransport struct {
+	base http.RoundTripper
+	log  *slog.Logger
+	now  func() time.Time
+	wait func(ctx context.Context, d time.Duration) error
+
+	mu    sync.Mutex
+	used  int
+	limit int
+	sent  []time.Time // our own requests still inside the window
+}
+
+// NewRateLimitTransport wraps base (http.DefaultTransport when nil)
+func NewRateLimitTransport(base http.RoundTripper, logger *slog.Logger) *RateLimitTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if logger == nil {
+		logger = discardLogger
+	}
+	return &RateLimitTransport{base: base, log: logger, now: time.Now, wait: SleepContext}
+}
+
+func (t *RateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.reserve(req.Context()); err != nil {
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if used, limit, ok := parseRateLimit(resp.Header.Get("X-Rate-Limit")); ok {
+		t.mu.Lock()
+		t.used, t.limit = used, limit
+		t.mu.Unlock()
+	}
+	return resp, nil
+}
+
+// reserve blocks until the quota allows one more request and counts it
+func (t *RateLimitTransport) reserve(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for t.limit > 0 && t.used >= t.limit {
+		now := t.now()
+		t.expire(now)
+		// Without our own requests to age out, the quota was spent elsewhere
+		// and the whole window has to pass
+		d := rateLimitWindow
+		if len(t.sent) > 0 {
+			d = t.sent[0].Add(rateLimitWindow).Sub(now)
+		}
+		t.log.Info("rate limit reached, waiting", "used", t.used, "limit", t.limit, "wait", d.Round(time.Second))
+		t.mu.Unlock()
+		err := t.wait(ctx, d)
+		t.mu.Lock()
+		if err != nil {
+			return err
+		}
+		if len(t.sent) > 0 {
+			t.sent = t.sent[1:]
+			t.used--
+		} else {
+			t.used = 0
+		}
+	}
+	t.sent = append(t.sent, t.now())
+	t.used++
+	return nil
+}
+
+// expire drops recorded requests that have left the window
+func (t *RateLimitTransport) expire(now time.Time) {
+	i := 0
+	for i < len(t.sent) && now.Sub(t.sent[i]) >= rateLimitWindow {
+		i++
+	}
+	t.sent = t.sent[i:]
+}
+
+// parseRateLimit parses an X-Rate-Limit value such as "36/200"
+func parseRateLimit(v string) (used, limit int, ok bool) {
+	a, b, found := strings.Cut(strings.TrimSpace(v), "/")
+	if !found {
+		return 0, 0, false
+	}
+	used, err1 := strconv.Atoi(a)
+	limit, err2 := strconv.Atoi(b)
+	if err1 != nil || err2 != nil || limit <= 0 {
+		return 0, 0, false
+	}
+	return used, limit, true
+}
+
+// SleepContext sleeps for d or until ctx is done
+func SleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,100 @@
+package ynabvault
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// headerRoundTripper answers every request with the given X-Rate-Limit value
+type headerRoundTripper struct{ header string }
+
+func (h headerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("{}"))}
+	if h.header != "" {
+		resp.Header.Set("X-Rate-Limit", h.header)
+	}
+	return resp, nil
+}
+
+// TestParseRateLimit covers valid and malformed header values
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		in          string
+		used, limit int
+		ok          bool
+	}{
+		{"36/200", 36, 200, true},
+		{" 200/200 ", 200, 200, true},
+		{"", 0, 0, false},
+		{"36", 0, 0, false},
+		{"a/200", 0, 0, false},
+		{"1/0", 0, 0, false},
+	}
+	for _, tc := range tests {
+		used, limit, ok := parseRateLimit(tc.in)
+		if used != tc.used || limit != tc.limit || ok != tc.ok {
+			t.Errorf("parseRateLimit(%q) = %d, %d, %v; want %d, %d, %v", tc.in, used, limit, ok, tc.used, tc.limit, tc.ok)
+		}
+	}
+}
+
+// TestRateLimitTransportWaits verifies requests pause once the quota is used up
+func TestRateLimitTransportWaits(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	var waits []time.Duration
+	rt := NewRateLimitTransport(headerRoundTripper{header: "2/2"}, nil)
+	rt.now = func() time.Time { return now }
+	rt.wait = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		now = now.Add(d)
+		return nil
+	}
+
+	client := &http.Client{Transport: rt}
+	// First request: no quota known yet, so no wait
+	if _, err := httpGet(t.Context(), client, "http://ynab.test/budgets", "tok"); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(10 * time.Minute)
+	// Header reported 2/2: the next request waits for our first one to age out
+	if _, err := httpGet(t.Context(), client, "http://ynab.test/budgets", "tok"); err != nil {
+		t.Fatal(err)
+	}
+	if len(waits) != 1 || waits[0] != 50*time.Minute {
+		t.Fatalf("waits = %v; want [50m]", waits)
+	}
+}
+
+// TestRateLimitTransportExhaustedElsewhere waits a full window when the quota
+// was used up by requests this process never made
+func TestRateLimitTransportExhaustedElsewhere(t *testing.T) {
+	rt := NewRateLimitTransport(headerRoundTripper{}, nil)
+	rt.used, rt.limit = 200, 200
+	var waited time.Duration
+	rt.wait = func(ctx context.Context, d time.Duration) error {
+		waited = d
+		return nil
+	}
+	if err := rt.reserve(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if waited != rateLimitWindow {
+		t.Errorf("waited %v; want %v", waited, rateLimitWindow)
+	}
+}
+
+// TestRateLimitTransportCancel stops waiting when the request is cancelled
+func TestRateLimitTransportCancel(t *testing.T) {
+	rt := NewRateLimitTransport(headerRoundTripper{}, nil)
+	rt.used, rt.limit = 5, 5
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := rt.reserve(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("reserve error = %v; want context.Canceled", err)
+	}
+}
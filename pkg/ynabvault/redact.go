@@ -0,0 +1,159 @@
+package ynabvault
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Redacted replaces sensitive values in log records
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are attribute keys, and JSON fields, whose values are
+// never logged: credentials, and transaction details that reveal spending
+var sensitiveKeys = map[string]bool{
+	"token":         true,
+	"access_token":  true,
+	"refresh_token": true,
+	"authorization": true,
+	"password":      true,
+	"secret":        true,
+	"client_secret": true,
+	"api_key":       true,
+	"cookie":        true,
+	"set-cookie":    true,
+	"payee":         true,
+	"payee_name":    true,
+	"memo":          true,
+}
+
+// sensitiveKey reports whether values under key must be redacted; keys
+// ending in _token, _secret or _password count too
+func sensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	return sensitiveKeys[key] || strings.HasSuffix(key, "_token") || strings.HasSuffix(key, "_secret") || strings.HasSuffix(key, "_password")
+}
+
+var (
+	// bearerPattern matches the credential of an Authorization header
+	bearerPattern = regexp.MustCompile(`(?i)\b(bearer\s+)[^\s"',;]+`)
+	// queryPattern matches credentials passed in a URL query
+	queryPattern = regexp.MustCompile(`(?i)\b((?:access_token|refresh_token|token|api_key)=)[^&\s"']+`)
+	// jsonFieldPattern matches sensitive string fields in JSON text, such as
+	// a response body quoted in an error
+	jsonFieldPattern = regexp.MustCompile(`"(token|access_token|refresh_token|password|client_secret|payee_name|memo)"(\s*:\s*)"(?:[^"\\]|\\.)*"`)
+)
+
+// redactHandler is a slog.Handler that scrubs credentials and payee and
+// memo contents from every record before passing it on
+type redactHandler struct {
+	next    slog.Handler
+	secrets []string
+}
+
+// NewRedactHandler returns a handler passing records to next with
+// sensitive values replaced by Redacted, at every level. Values under
+// sensitive keys such as token, authorization, payee_name or memo are
+// dropped; bearer credentials, tokens in URLs, sensitive JSON fields and
+// the given secrets, such as the API token, are cut out of messages, strings
+// and errors. Wrapping a handler it returned adds to its secrets.
+func NewRedactHandler(next slog.Handler, secrets ...string) slog.Handler {
+	var keep []string
+	for _, s := range secrets {
+		if s != "" {
+			keep = append(keep, s)
+		}
+	}
+	if r, ok := next.(*redactHandler); ok {
+		if len(keep) == 0 {
+			return r
+		}
+		return &redactHandler{r.next, append(slices.Clip(r.secrets), keep...)}
+	}
+	return &redactHandler{next, keep}
+}
+
+func (h *redactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *redactHandler) Handle(ctx context.Context, r slog.Record) error {
+	out := slog.NewRecord(r.Time, r.Level, h.scrub(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(h.attr(a))
+		return true
+	})
+	return h.next.Handle(ctx, out)
+}
+
+func (h *redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clean := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		clean[i] = h.attr(a)
+	}
+	return &redactHandler{h.next.WithAttrs(clean), h.secrets}
+}
+
+func (h *redactHandler) WithGroup(name string) slog.Handler {
+	return &redactHandler{h.next.WithGroup(name), h.secrets}
+}
+
+// attr returns a with its value redacted
+func (h *redactHandler) attr(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+	if sensitiveKey(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, h.scrub(v.String()))
+	case slog.KindGroup:
+		group := v.Group()
+		clean := make([]slog.Attr, len(group))
+		for i, g := range group {
+			clean[i] = h.attr(g)
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(clean...)}
+	case slog.KindAny:
+		switch x := v.Any().(type) {
+		case error:
+			return slog.String(a.Key, h.scrub(x.Error()))
+		case http.Header:
+			clean := make(http.Header, len(x))
+			for k, vs := range x {
+				for _, s := range vs {
+					if sensitiveKey(k) {
+						s = Redacted
+					}
+					clean.Add(k, h.scrub(s))
+				}
+			}
+			return slog.Any(a.Key, clean)
+		case []string:
+			clean := make([]string, len(x))
+			for i, s := range x {
+				clean[i] = h.scrub(s)
+			}
+			return slog.Any(a.Key, clean)
+		case []byte:
+			return slog.String(a.Key, h.scrub(string(x)))
+		case fmt.Stringer:
+			return slog.String(a.Key, h.scrub(x.String()))
+		}
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
+
+// scrub cuts credentials and sensitive JSON fields out of s
+func (h *redactHandler) scrub(s string) string {
+	for _, secret := range h.secrets {
+		s = strings.ReplaceAll(s, secret, Redacted)
+	}
+	s = bearerPattern.ReplaceAllString(s, "${1}"+Redacted)
+	s = queryPattern.ReplaceAllString(s, "${1}"+Redacted)
+	return jsonFieldPattern.ReplaceAllString(s, `"$1"$2"`+Redacted+`"`)
+}
@@ -0,0 +1,93 @@
+package ynabvault
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestRedactHandler keeps credentials and payee and memo contents out of
+// every record, whatever shape they are logged in
+func TestRedactHandler(t *testing.T) {
+	const secret = "tok-4f9a2c"
+	tests := []struct {
+		name string
+		log  func(*slog.Logger)
+	}{
+		{"message", func(l *slog.Logger) { l.Info("using token " + secret) }},
+		{"token key", func(l *slog.Logger) { l.Info("auth", "token", "anything") }},
+		{"key suffix", func(l *slog.Logger) { l.Info("auth", "refresh_token", secret) }},
+		{"bearer", func(l *slog.Logger) { l.Debug("request", "header", "Authorization: Bearer "+secret) }},
+		{"header", func(l *slog.Logger) {
+			l.Debug("request", "headers", http.Header{"Authorization": {"Bearer " + secret}, "Accept": {"application/json"}})
+		}},
+		{"query", func(l *slog.Logger) { l.Warn("redirect", "url", "https://example.com/cb?access_token="+secret+"&x=1") }},
+		{"error", func(l *slog.Logger) {
+			l.Error("failed", "error", fmt.Errorf("login: %w", errors.New("bad token "+secret)))
+		}},
+		{"payee", func(l *slog.Logger) { l.Info("transaction", "payee_name", "Dr. Smith Clinic", "memo", "therapy") }},
+		{"json body", func(l *slog.Logger) {
+			l.Warn("bad response", "body", `{"payee_name":"Dr. Smith Clinic","memo":"therapy \"weekly\"","amount":-5000}`)
+		}},
+		{"group", func(l *slog.Logger) { l.Info("request", slog.Group("auth", "token", secret, "memo", "therapy")) }},
+		{"with attrs", func(l *slog.Logger) { l.With("memo", "therapy").WithGroup("req").Info("saved", "note", secret) }},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, json := range []bool{false, true} {
+				var buf bytes.Buffer
+				opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+				var h slog.Handler = slog.NewTextHandler(&buf, opts)
+				if json {
+					h = slog.NewJSONHandler(&buf, opts)
+				}
+				tc.log(slog.New(NewRedactHandler(h, secret)))
+				out := buf.String()
+				for _, leak := range []string{secret, "anything", "Dr. Smith", "therapy"} {
+					if strings.Contains(out, leak) {
+						t.Errorf("json %v: %q leaked in %s", json, leak, out)
+					}
+				}
+				if !strings.Contains(out, Redacted) {
+					t.Errorf("json %v: no %s in %s", json, Redacted, out)
+				}
+			}
+		})
+	}
+}
+
+// TestRedactHandlerKeepsOthers leaves harmless values alone
+func TestRedactHandlerKeepsOthers(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewRedactHandler(slog.NewTextHandler(&buf, nil), "tok"))
+	l.Info("saved budget", "budget", "Home", "bytes", 42, "server_knowledge", 7)
+	if want := `msg="saved budget" budget=Home bytes=42 server_knowledge=7`; !strings.Contains(buf.String(), want) {
+		t.Errorf("log = %s; want %s", buf.String(), want)
+	}
+}
+
+// TestRunRedactsToken keeps the configured token out of a run's log, even
+// where an error repeats it
+func TestRunRedactsToken(t *testing.T) {
+	const token = "tok-4f9a2c"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data":{"budgets":[{"id":"b1","name":"A"}]}}`)
+	}))
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	cfg := Config{Token: token, BaseURL: srv.URL, OutputDir: t.TempDir(), Client: srv.Client(),
+		Logger: slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))}
+	if _, err := Run(t.Context(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	cfg.log().Warn("retrying", "error", errors.New("token "+token+" rejected"))
+	if strings.Contains(buf.String(), token) {
+		t.Errorf("token leaked in %s", buf.String())
+	}
+}
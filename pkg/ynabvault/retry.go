@@ -0,0 +1,104 @@
+package ynabvault
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxRetryDelay caps a single backoff sleep
+const maxRetryDelay = 5 * time.Minute
+
+// RetryTransport retries requests that fail with a network error, 429 or a
+// 5xx status, sleeping with jittered exponential backoff between attempts
+type RetryTransport struct {
+	base    http.RoundTripper
+	retries int
+	backoff time.Duration
+	log     *slog.Logger
+	wait    func(ctx context.Context, d time.Duration) error
+	jitter  func(d time.Duration) time.Duration
+}
+
+// NewRetryTransport wraps base (http.DefaultTransport when nil)
+func NewRetryTransport(base http.RoundTripper, retries int, backoff time.Duration, logger *slog.Logger) *RetryTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if logger == nil {
+		logger = discardLogger
+	}
+	return &RetryTransport{
+		base:    base,
+		retries: retries,
+		backoff: backoff,
+		log:     logger,
+		wait:    SleepContext,
+		jitter:  func(d time.Duration) time.Duration { return rand.N(d + 1) },
+	}
+}
+
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	for attempt := 0; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if attempt >= t.retries || ctx.Err() != nil || !retryable(resp, err) {
+			return resp, err
+		}
+		// A consumed body can only be sent again if it can be recreated
+		if req.Body != nil && req.GetBody == nil {
+			return resp, err
+		}
+
+		d := t.delay(attempt, resp)
+		if err != nil {
+			t.log.Warn("request failed, retrying", "url", req.URL.Redacted(), "error", err, "wait", d.Round(time.Millisecond))
+		} else {
+			t.log.Warn("request failed, retrying", "url", req.URL.Redacted(), "status", resp.StatusCode, "wait", d.Round(time.Millisecond))
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+		if werr := t.wait(ctx, d); werr != nil {
+			return nil, werr
+		}
+		if req.GetBody != nil {
+			body, berr := req.GetBody()
+			if berr != nil {
+				return nil, berr
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+	}
+}
+
+// delay picks the sleep before the next attempt: the server's Retry-After
+// when given, otherwise backoff*2^attempt with the upper half jittered
+func (t *RetryTransport) delay(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs >= 0 {
+			return min(time.Duration(secs)*time.Second, maxRetryDelay)
+		}
+	}
+	d := t.backoff
+	for i := 0; i < attempt && d < maxRetryDelay; i++ {
+		d *= 2
+	}
+	if d < 0 || d > maxRetryDelay {
+		d = maxRetryDelay
+	}
+	return d/2 + t.jitter(d/2)
+}
+
+// retryable reports whether a response or transport error is worth retrying
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
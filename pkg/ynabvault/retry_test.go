@@ -0,0 +1,107 @@
+package ynabvault
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestRetryTransport retries transient statuses and gives up on others
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name      string
+		statuses  []int
+		retries   int
+		wantCalls int32
+		wantErr   bool
+	}{
+		{"recovers from 503", []int{503, 503, 200}, 3, 3, false},
+		{"recovers from 429", []int{429, 200}, 3, 2, false},
+		{"gives up after retries", []int{500, 500, 500}, 2, 3, true},
+		{"no retry on 404", []int{404, 200}, 3, 1, true},
+		{"disabled", []int{503, 200}, 0, 1, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := calls.Add(1)
+				w.WriteHeader(tc.statuses[min(int(n), len(tc.statuses))-1])
+				_, _ = io.WriteString(w, "body")
+			}))
+			defer srv.Close()
+
+			rt := NewRetryTransport(srv.Client().Transport, tc.retries, time.Millisecond, nil)
+			rt.wait = func(context.Context, time.Duration) error { return nil }
+			data, err := httpGet(t.Context(), &http.Client{Transport: rt}, srv.URL, "tok")
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("httpGet error = %v; wantErr %v", err, tc.wantErr)
+			}
+			if !tc.wantErr && string(data) != "body" {
+				t.Errorf("body = %q", data)
+			}
+			if got := calls.Load(); got != tc.wantCalls {
+				t.Errorf("server calls = %d; want %d", got, tc.wantCalls)
+			}
+		})
+	}
+}
+
+// TestRetryDelay checks exponential growth, jitter bounds and Retry-After
+func TestRetryDelay(t *testing.T) {
+	rt := NewRetryTransport(nil, 5, time.Second, nil)
+	rt.jitter = func(d time.Duration) time.Duration { return d } // upper bound
+	for attempt, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		if got := rt.delay(attempt, nil); got != want {
+			t.Errorf("delay(%d) = %v; want %v", attempt, got, want)
+		}
+	}
+	rt.jitter = func(time.Duration) time.Duration { return 0 } // lower bound
+	if got := rt.delay(2, nil); got != 2*time.Second {
+		t.Errorf("delay(2) lower bound = %v; want 2s", got)
+	}
+	if got := rt.delay(40, nil); got != maxRetryDelay/2 {
+		t.Errorf("delay(40) = %v; want capped %v", got, maxRetryDelay/2)
+	}
+	if got := NewRetryTransport(nil, 1, 0, nil).delay(3, nil); got != 0 {
+		t.Errorf("zero backoff delay = %v; want 0", got)
+	}
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"7"}}}
+	if got := rt.delay(0, resp); got != 7*time.Second {
+		t.Errorf("Retry-After delay = %v; want 7s", got)
+	}
+}
+
+// failingRoundTripper fails every request with a network error
+type failingRoundTripper struct{ calls *atomic.Int32 }
+
+func (f failingRoundTripper) RoundTrip(*http.Request) (*http.Response, error) {
+	f.calls.Add(1)
+	return nil, errors.New("connection reset")
+}
+
+// TestRetryTransportNetworkError retries network errors and honours cancellation
+func TestRetryTransportNetworkError(t *testing.T) {
+	var calls atomic.Int32
+	rt := NewRetryTransport(failingRoundTripper{&calls}, 2, time.Millisecond, nil)
+	rt.wait = func(context.Context, time.Duration) error { return nil }
+	if _, err := httpGet(t.Context(), &http.Client{Transport: rt}, "http://ynab.test", "tok"); err == nil || !strings.Contains(err.Error(), "connection reset") {
+		t.Fatalf("expected connection error, got %v", err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("calls = %d; want 3", calls.Load())
+	}
+
+	calls.Store(0)
+	rt.wait = func(context.Context, time.Duration) error { return context.Canceled }
+	_, err := httpGet(t.Context(), &http.Client{Transport: rt}, "http://ynab.test", "tok")
+	if !errors.Is(err, context.Canceled) || calls.Load() != 1 {
+		t.Errorf("cancelled wait: err = %v, calls = %d", err, calls.Load())
+	}
+}
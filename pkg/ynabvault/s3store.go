@@ -0,0 +1,185 @@
+package ynabvault
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// s3Scheme prefixes --output values that name an S3 bucket
+const s3Scheme = "s3://"
+
+// s3Store keeps files in an S3-compatible bucket (AWS S3, MinIO, B2) under a
+// key prefix
+type s3Store struct {
+	client *minio.Client
+	bucket string
+	prefix string // empty or ending in "/"
+}
+
+// newS3Store connects to the bucket named by an s3://bucket/prefix URL.
+// Credentials come from the standard AWS chain: AWS_ACCESS_KEY_ID and
+// friends, the shared credentials file, then the instance role. The endpoint
+// defaults to AWS and can be pointed at MinIO or B2 with AWS_ENDPOINT_URL.
+// A proxy in opts replaces the one from the environment.
+func newS3Store(output string, opts StoreOptions) (*s3Store, error) {
+	u, err := url.Parse(output)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3 output %q: want s3://bucket/prefix", output)
+	}
+	endpoint, secure := "s3.amazonaws.com", true
+	if e := firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"); e != "" {
+		eu, err := url.Parse(e)
+		if err != nil || eu.Host == "" {
+			return nil, fmt.Errorf("invalid AWS_ENDPOINT_URL %q", e)
+		}
+		endpoint, secure = eu.Host, eu.Scheme != "http"
+	}
+	var transport http.RoundTripper
+	if opts.Proxy != nil || opts.Network != "" {
+		t, err := minio.DefaultTransport(secure)
+		if err != nil {
+			return nil, fmt.Errorf("create S3 transport: %w", err)
+		}
+		if opts.Proxy != nil {
+			t.Proxy = http.ProxyURL(opts.Proxy)
+		}
+		if network := opts.Network; network != "" {
+			d := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+			t.DialContext = func(ctx context.Context, _, addr string) (net.Conn, error) {
+				return d.DialContext(ctx, network, addr)
+			}
+		}
+		transport = t
+	}
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds: credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.FileAWSCredentials{},
+			&credentials.IAM{},
+		}),
+		Secure:    secure,
+		Region:    firstEnv("AWS_REGION", "AWS_DEFAULT_REGION"),
+		Transport: transport,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create S3 client: %w", err)
+	}
+	prefix := strings.Trim(u.Path, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &s3Store{client: client, bucket: u.Host, prefix: prefix}, nil
+}
+
+// Put uploads data and checks it arrived intact using the checksum the
+// backend reports, so no re-download is needed
+func (s *s3Store) Put(ctx context.Context, name string, data []byte) error {
+	info, err := s.client.PutObject(ctx, s.bucket, s.prefix+name, bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{ContentType: "application/octet-stream"})
+	if err != nil {
+		return err
+	}
+	return checkUpload(info, data)
+}
+
+// checkUpload compares the backend's hash of an upload with data: the
+// SHA-256 checksum when the backend returns one, otherwise the ETag, which
+// is the MD5 of single-part uploads. Multipart and encrypted-at-rest ETags
+// are not plain MD5s and are not checked.
+func checkUpload(info minio.UploadInfo, data []byte) error {
+	if info.ChecksumSHA256 != "" {
+		sum := sha256.Sum256(data)
+		if want := base64.StdEncoding.EncodeToString(sum[:]); info.ChecksumSHA256 != want {
+			return fmt.Errorf("upload of %s: %w: SHA-256 %s, want %s", info.Key, ErrCorrupt, info.ChecksumSHA256, want)
+		}
+		return nil
+	}
+	etag := strings.Trim(info.ETag, `"`)
+	if len(etag) != 2*md5.Size || strings.Contains(etag, "-") {
+		return nil
+	}
+	sum := md5.Sum(data)
+	if want := hex.EncodeToString(sum[:]); !strings.EqualFold(etag, want) {
+		return fmt.Errorf("upload of %s: %w: ETag %s, want %s", info.Key, ErrCorrupt, etag, want)
+	}
+	return nil
+}
+
+func (s *s3Store) Get(ctx context.Context, name string) ([]byte, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, s.prefix+name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s.notExist(err)
+	}
+	defer obj.Close()
+	data, err := io.ReadAll(obj)
+	if err != nil {
+		return nil, s.notExist(err)
+	}
+	return data, nil
+}
+
+// notExist wraps fs.ErrNotExist into missing-key errors so callers can treat
+// both stores alike
+func (s *s3Store) notExist(err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return fmt.Errorf("%w: %w", fs.ErrNotExist, err)
+	}
+	return err
+}
+
+func (s *s3Store) List(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: s.prefix + prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		names = append(names, strings.TrimPrefix(obj.Key, s.prefix))
+	}
+	return names, nil
+}
+
+// Sizes lists the objects under prefix with their sizes
+func (s *s3Store) Sizes(ctx context.Context, prefix string) (map[string]int64, error) {
+	sizes := map[string]int64{}
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: s.prefix + prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		sizes[strings.TrimPrefix(obj.Key, s.prefix)] = obj.Size
+	}
+	return sizes, nil
+}
+
+func (s *s3Store) Delete(ctx context.Context, name string) error {
+	return s.client.RemoveObject(ctx, s.bucket, s.prefix+name, minio.RemoveObjectOptions{})
+}
+
+func (s *s3Store) Location(name string) string {
+	return s3Scheme + s.bucket + "/" + s.prefix + name
+}
+
+// firstEnv returns the first non-empty environment variable among names
+func firstEnv(names ...string) string {
+	for _, n := range names {
+		if v := os.Getenv(n); v != "" {
+			return v
+		}
+	}
+	return ""
+}
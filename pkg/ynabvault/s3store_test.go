@@ -0,0 +1,89 @@
+package ynabvault
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bad33ndj3/ynabvault/internal/s3test"
+	"github.com/minio/minio-go/v7"
+)
+
+// TestS3Store exercises Put/Get/List/Delete against the fake endpoint
+func TestS3Store(t *testing.T) {
+	fake := s3test.New(t)
+	store, err := OpenStore("s3://vault/backups/")
+	if err != nil {
+		t.Fatalf("OpenStore: %v", err)
+	}
+	ctx := t.Context()
+	for _, name := range []string{"A_1_20250101T000000Z.json", "A_1/accounts_20250101T000000Z.json"} {
+		if err := store.Put(ctx, name, []byte(name)); err != nil {
+			t.Fatalf("Put(%s): %v", name, err)
+		}
+	}
+	if _, ok := fake.Objects["vault/backups/A_1/accounts_20250101T000000Z.json"]; !ok {
+		t.Errorf("object not stored under the prefix: %v", fake.Objects)
+	}
+	if got, err := store.Get(ctx, "A_1_20250101T000000Z.json"); err != nil || string(got) != "A_1_20250101T000000Z.json" {
+		t.Errorf("Get = %q, %v", got, err)
+	}
+	if _, err := store.Get(ctx, "missing.json"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Get(missing) = %v; want fs.ErrNotExist", err)
+	}
+	names, err := store.List(ctx, "")
+	if want := []string{"A_1/accounts_20250101T000000Z.json", "A_1_20250101T000000Z.json"}; err != nil || !reflect.DeepEqual(names, want) {
+		t.Errorf("List = %v, %v; want %v", names, err, want)
+	}
+	if sizes, err := store.(*s3Store).Sizes(ctx, "A_1/"); err != nil || len(sizes) != 1 || sizes["A_1/accounts_20250101T000000Z.json"] != 34 {
+		t.Errorf("Sizes = %v, %v", sizes, err)
+	}
+	if err := store.Delete(ctx, "A_1_20250101T000000Z.json"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if names, _ := store.List(ctx, ""); len(names) != 1 {
+		t.Errorf("List after Delete = %v", names)
+	}
+	if got := store.Location("x.json"); got != "s3://vault/backups/x.json" {
+		t.Errorf("Location = %q", got)
+	}
+
+	fake.BadETag = true
+	if err := store.Put(ctx, "x.json", []byte("x")); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Put with a mismatching ETag = %v; want ErrCorrupt", err)
+	}
+
+	if _, err := OpenStore("s3://"); err == nil {
+		t.Error("expected an error for an S3 URL without a bucket")
+	}
+}
+
+// TestCheckUpload prefers SHA-256 and skips ETags that are not MD5s
+func TestCheckUpload(t *testing.T) {
+	data := []byte("budget")
+	md5sum := md5.Sum(data)
+	shasum := sha256.Sum256(data)
+	tests := []struct {
+		name    string
+		info    minio.UploadInfo
+		wantErr bool
+	}{
+		{"etag match", minio.UploadInfo{ETag: `"` + hex.EncodeToString(md5sum[:]) + `"`}, false},
+		{"etag mismatch", minio.UploadInfo{ETag: strings.Repeat("0", 32)}, true},
+		{"multipart etag", minio.UploadInfo{ETag: strings.Repeat("0", 30) + "-2"}, false},
+		{"no etag", minio.UploadInfo{}, false},
+		{"sha256 match", minio.UploadInfo{ETag: strings.Repeat("0", 32), ChecksumSHA256: base64.StdEncoding.EncodeToString(shasum[:])}, false},
+		{"sha256 mismatch", minio.UploadInfo{ChecksumSHA256: "AAAA"}, true},
+	}
+	for _, tc := range tests {
+		if err := checkUpload(tc.info, data); (err != nil) != tc.wantErr {
+			t.Errorf("%s: checkUpload = %v; want error %v", tc.name, err, tc.wantErr)
+		}
+	}
+}
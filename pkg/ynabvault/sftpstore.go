@@ -0,0 +1,382 @@
+package ynabvault
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/net/proxy"
+)
+
+// sftpScheme prefixes --output values that name a directory on an SSH server
+const sftpScheme = "sftp://"
+
+// sftpStore keeps files in a directory on an SSH server, reached through its
+// SFTP subsystem. The connection is opened on first use and redialled when it
+// breaks.
+type sftpStore struct {
+	user string
+	addr string // host:port
+	root string // absolute, or relative to the login directory
+	dial func(ctx context.Context) (*sftpConn, error)
+
+	mu     sync.Mutex
+	client *sftpConn
+}
+
+// posixRename is the OpenSSH extension that replaces an existing file;
+// plain SFTP v3 renames refuse to
+const posixRename = "posix-rename@openssh.com"
+
+// sftpConn is an SFTP session and what closes the connection under it
+type sftpConn struct {
+	*sftp.Client
+	closeConn func() error
+	done      chan struct{} // closed once the session has ended
+}
+
+// newSFTPConn watches c so a broken session is noticed before it is used
+func newSFTPConn(c *sftp.Client, closeConn func() error) *sftpConn {
+	conn := &sftpConn{Client: c, closeConn: closeConn, done: make(chan struct{})}
+	go func() {
+		_ = c.Wait()
+		close(conn.done)
+	}()
+	return conn
+}
+
+// close ends the session and the connection
+func (c *sftpConn) close() error {
+	return errors.Join(c.Client.Close(), c.closeConn())
+}
+
+// broken reports whether the session has ended
+func (c *sftpConn) broken() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// newSFTPStore parses an sftp://user@host:port/path URL. The path is
+// absolute; start it with /~/ to make it relative to the login directory.
+// The port defaults to 22 and the user to $USER. A SOCKS5 proxy in opts
+// carries the SSH connection.
+func newSFTPStore(output string, opts StoreOptions) (*sftpStore, error) {
+	u, err := url.Parse(output)
+	if err != nil || u.Hostname() == "" || u.RawQuery != "" {
+		return nil, fmt.Errorf("invalid SFTP output %q: want sftp://user@host/path", output)
+	}
+	s := &sftpStore{
+		user: cmp.Or(u.User.Username(), os.Getenv("USER")),
+		addr: net.JoinHostPort(u.Hostname(), cmp.Or(u.Port(), "22")),
+		root: path.Clean("/" + u.Path),
+	}
+	if s.user == "" {
+		return nil, fmt.Errorf("invalid SFTP output %q: no user given and $USER is not set", output)
+	}
+	if s.root == "/~" || strings.HasPrefix(s.root, "/~/") {
+		s.root = path.Clean("." + strings.TrimPrefix(s.root, "/~"))
+	}
+	var dialer proxy.ContextDialer = &net.Dialer{}
+	if opts.Proxy != nil {
+		if opts.Proxy.Scheme != "socks5" && opts.Proxy.Scheme != "socks5h" {
+			return nil, fmt.Errorf("SFTP proxy %s: only socks5:// and socks5h:// proxies can carry SSH", opts.Proxy.Redacted())
+		}
+		d, err := proxy.FromURL(opts.Proxy, proxy.Direct)
+		cd, ok := d.(proxy.ContextDialer)
+		if err != nil || !ok {
+			return nil, fmt.Errorf("SFTP proxy %s: %w", opts.Proxy.Redacted(), cmp.Or(err, errors.ErrUnsupported))
+		}
+		dialer = cd
+	}
+	password, _ := u.User.Password()
+	s.dial = func(ctx context.Context) (*sftpConn, error) {
+		return dialSFTP(ctx, dialer, cmp.Or(opts.Network, "tcp"), s.user, s.addr, cmp.Or(password, os.Getenv("YNABVAULT_SFTP_PASSWORD")))
+	}
+	return s, nil
+}
+
+// dialSFTP logs in over SSH and starts the sftp subsystem. The host key must
+// be in known_hosts. Authentication tries the SSH agent, then a private key,
+// then the password when one is given.
+func dialSFTP(ctx context.Context, dialer proxy.ContextDialer, network, user, addr, password string) (*sftpConn, error) {
+	hostKeys, err := knownhosts.New(cmp.Or(os.Getenv("YNABVAULT_SFTP_KNOWN_HOSTS"), homeFile(".ssh", "known_hosts")))
+	if err != nil {
+		return nil, fmt.Errorf("load SSH known hosts: %w", err)
+	}
+	auth, closeAgent, err := sshAuth(password)
+	if err != nil {
+		return nil, err
+	}
+	// The agent is only asked to sign during the login below
+	defer closeAgent()
+	conn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, &ssh.ClientConfig{
+		User:            user,
+		Auth:            auth,
+		HostKeyCallback: hostKeys,
+		Timeout:         30 * time.Second,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("SSH login to %s: %w", addr, err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	client := ssh.NewClient(c, chans, reqs)
+	sc, err := sftp.NewClient(client)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("start SFTP on %s: %w", addr, err)
+	}
+	return newSFTPConn(sc, client.Close), nil
+}
+
+// sshAuth collects the ways to log in: the agent at $SSH_AUTH_SOCK, the key
+// in $YNABVAULT_SFTP_KEY or else the default ~/.ssh keys without a
+// passphrase, and password. The returned func closes the connection to the
+// agent once the login is done.
+func sshAuth(password string) ([]ssh.AuthMethod, func(), error) {
+	var methods []ssh.AuthMethod
+	closeAgent := func() {}
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+			closeAgent = func() { _ = conn.Close() }
+		}
+	}
+	var signers []ssh.Signer
+	if key := os.Getenv("YNABVAULT_SFTP_KEY"); key != "" {
+		data, err := os.ReadFile(key)
+		if err != nil {
+			closeAgent()
+			return nil, nil, fmt.Errorf("read SFTP key: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			closeAgent()
+			return nil, nil, fmt.Errorf("parse SFTP key %s: %w", key, err)
+		}
+		signers = append(signers, signer)
+	} else {
+		for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+			data, err := os.ReadFile(homeFile(".ssh", name))
+			if err != nil {
+				continue
+			}
+			if signer, err := ssh.ParsePrivateKey(data); err == nil {
+				signers = append(signers, signer)
+			}
+		}
+	}
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+	if password != "" {
+		methods = append(methods, ssh.Password(password))
+	}
+	if len(methods) == 0 {
+		return nil, nil, errors.New("no SSH credentials: start ssh-agent, set YNABVAULT_SFTP_KEY or give a password")
+	}
+	return methods, closeAgent, nil
+}
+
+// homeFile joins elem onto the user's home directory
+func homeFile(elem ...string) string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(append([]string{home}, elem...)...)
+}
+
+// conn returns the open client, dialling a new one when there is none or
+// the last one broke
+func (s *sftpStore) conn(ctx context.Context) (*sftpConn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client != nil {
+		if !s.client.broken() {
+			return s.client, nil
+		}
+		_ = s.client.close()
+		s.client = nil
+	}
+	c, err := s.dial(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("connect to %s: %w", s.addr, err)
+	}
+	s.client = c
+	return c, nil
+}
+
+func (s *sftpStore) path(name string) string {
+	return path.Join(s.root, name)
+}
+
+// Put uploads to a hidden temporary file and renames it into place, so an
+// interrupted upload never leaves a truncated snapshot
+func (s *sftpStore) Put(ctx context.Context, name string, data []byte) error {
+	c, err := s.conn(ctx)
+	if err != nil {
+		return err
+	}
+	p := s.path(name)
+	if err := c.MkdirAll(path.Dir(p)); err != nil {
+		return fmt.Errorf("sftp mkdir %s: %w", path.Dir(p), err)
+	}
+	tmp := path.Join(path.Dir(p), fmt.Sprintf(".%s.%d.tmp", path.Base(p), time.Now().UnixNano()))
+	if err := c.writeFile(tmp, data); err != nil {
+		_ = c.Remove(tmp)
+		return fmt.Errorf("sftp write %s: %w", tmp, err)
+	}
+	if err := c.rename(tmp, p); err != nil {
+		_ = c.Remove(tmp)
+		return fmt.Errorf("sftp rename %s: %w", p, err)
+	}
+	return nil
+}
+
+// writeFile creates or truncates name and writes data into it. Some servers
+// refuse files opened for reading and writing at once, so it only writes.
+func (c *sftpConn) writeFile(name string, data []byte) error {
+	f, err := c.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// rename moves from onto to, replacing to. Without the posix-rename
+// extension the target is removed first, which is not atomic.
+func (c *sftpConn) rename(from, to string) error {
+	if _, ok := c.HasExtension(posixRename); ok {
+		return c.PosixRename(from, to)
+	}
+	if err := c.Remove(to); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return c.Rename(from, to)
+}
+
+func (s *sftpStore) Get(ctx context.Context, name string) ([]byte, error) {
+	c, err := s.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	f, err := c.Open(s.path(name))
+	if err != nil {
+		return nil, fmt.Errorf("sftp open %s: %w", s.path(name), err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("sftp read %s: %w", s.path(name), err)
+	}
+	return data, nil
+}
+
+// walk lists every file under dir with its size, keyed by its name below
+// the root; a missing root lists nothing
+func (s *sftpStore) walk(ctx context.Context, c *sftpConn, dir string, sizes map[string]int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	entries, err := c.ReadDirContext(ctx, s.path(dir))
+	if err != nil {
+		if dir == "" && errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("sftp readdir %s: %w", s.path(dir), err)
+	}
+	for _, e := range entries {
+		name := path.Join(dir, e.Name())
+		if e.IsDir() {
+			if err := s.walk(ctx, c, name, sizes); err != nil {
+				return err
+			}
+			continue
+		}
+		sizes[name] = e.Size()
+	}
+	return nil
+}
+
+// Sizes lists the files under prefix with their sizes
+func (s *sftpStore) Sizes(ctx context.Context, prefix string) (map[string]int64, error) {
+	c, err := s.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	all := map[string]int64{}
+	if err := s.walk(ctx, c, "", all); err != nil {
+		return nil, err
+	}
+	sizes := map[string]int64{}
+	for name, size := range all {
+		if strings.HasPrefix(name, prefix) {
+			sizes[name] = size
+		}
+	}
+	return sizes, nil
+}
+
+func (s *sftpStore) List(ctx context.Context, prefix string) ([]string, error) {
+	sizes, err := s.Sizes(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(sizes))
+	for name := range sizes {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+func (s *sftpStore) Delete(ctx context.Context, name string) error {
+	c, err := s.conn(ctx)
+	if err != nil {
+		return err
+	}
+	if err := c.Remove(s.path(name)); err != nil {
+		return fmt.Errorf("sftp remove %s: %w", s.path(name), err)
+	}
+	return nil
+}
+
+func (s *sftpStore) Location(name string) string {
+	p := s.path(name)
+	if !path.IsAbs(p) {
+		p = "/~/" + p
+	}
+	return sftpScheme + s.user + "@" + s.addr + p
+}
@@ -0,0 +1,181 @@
+package ynabvault
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/pkg/sftp"
+)
+
+// TestNewSFTPStore parses the user, address and root from the URL
+func TestNewSFTPStore(t *testing.T) {
+	t.Setenv("USER", "me")
+	tests := []struct {
+		in                   string
+		user, addr, root     string
+		wantErr, wantLocated string
+	}{
+		{in: "sftp://backup@nas/srv/ynab", user: "backup", addr: "nas:22", root: "/srv/ynab", wantLocated: "sftp://backup@nas:22/srv/ynab/x.json"},
+		{in: "sftp://nas:2222/~/ynab/", user: "me", addr: "nas:2222", root: "ynab", wantLocated: "sftp://me@nas:2222/~/ynab/x.json"},
+		{in: "sftp://u:pw@[::1]", user: "u", addr: "[::1]:22", root: "/", wantLocated: "sftp://u@[::1]:22/x.json"},
+		{in: "sftp:///srv", wantErr: "want sftp://user@host/path"},
+		{in: "sftp://nas/srv?x=1", wantErr: "want sftp://user@host/path"},
+	}
+	for _, tc := range tests {
+		s, err := newSFTPStore(tc.in, StoreOptions{})
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("newSFTPStore(%q) error = %v; want %q", tc.in, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("newSFTPStore(%q): %v", tc.in, err)
+			continue
+		}
+		if s.user != tc.user || s.addr != tc.addr || s.root != tc.root {
+			t.Errorf("newSFTPStore(%q) = %s, %s, %s; want %s, %s, %s", tc.in, s.user, s.addr, s.root, tc.user, tc.addr, tc.root)
+		}
+		if got := s.Location("x.json"); got != tc.wantLocated {
+			t.Errorf("Location = %q; want %q", got, tc.wantLocated)
+		}
+	}
+	if _, err := OpenStoreWith("sftp://u@nas/srv", StoreOptions{Proxy: &url.URL{Scheme: "http", Host: "proxy:3128"}}); err == nil {
+		t.Error("OpenStoreWith accepted an HTTP proxy for SFTP")
+	}
+	if _, err := OpenStoreWith("sftp://u@nas/srv", StoreOptions{Proxy: &url.URL{Scheme: "socks5", Host: "127.0.0.1:1080"}}); err != nil {
+		t.Errorf("OpenStoreWith with a SOCKS5 proxy: %v", err)
+	}
+	if s, err := OpenStore("sftp://u@nas/srv"); err != nil {
+		t.Errorf("OpenStore: %v", err)
+	} else if _, ok := s.(*sftpStore); !ok {
+		t.Errorf("OpenStore(sftp://...) = %T; want *sftpStore", s)
+	}
+}
+
+// newSFTPPipe serves root over one end of a pipe, resolving relative paths
+// below it, and returns a session on the other end
+func newSFTPPipe(t *testing.T, root string) *sftpConn {
+	t.Helper()
+	cc, sc := net.Pipe()
+	srv, err := sftp.NewServer(sc, sftp.WithServerWorkingDirectory(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve()
+	c, err := sftp.NewClientPipe(cc, cc)
+	if err != nil {
+		t.Fatalf("NewClientPipe: %v", err)
+	}
+	conn := newSFTPConn(c, sc.Close)
+	t.Cleanup(func() { conn.close() })
+	return conn
+}
+
+// TestSFTPStore stores, lists and deletes files through an SFTP server and
+// redials after the connection breaks
+func TestSFTPStore(t *testing.T) {
+	root := t.TempDir()
+	dials := 0
+	var last *sftpConn
+	s := &sftpStore{user: "u", addr: "nas:22", root: "vault", dial: func(context.Context) (*sftpConn, error) {
+		dials++
+		last = newSFTPPipe(t, root)
+		return last, nil
+	}}
+	ctx := t.Context()
+
+	if names, err := s.List(ctx, ""); err != nil || len(names) != 0 {
+		t.Fatalf("List of a missing root = %v, %v; want nothing", names, err)
+	}
+	for _, name := range []string{"B_1/budget.json", "B_1/accounts.json", "state.json"} {
+		if err := s.Put(ctx, name, []byte(name)); err != nil {
+			t.Fatalf("Put(%s): %v", name, err)
+		}
+	}
+	if err := s.Put(ctx, "state.json", []byte("v2")); err != nil {
+		t.Fatalf("Put over an existing file: %v", err)
+	}
+	if got, err := s.Get(ctx, "state.json"); err != nil || string(got) != "v2" {
+		t.Errorf("Get = %q, %v; want v2", got, err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "vault", "B_1", "budget.json")); err != nil {
+		t.Errorf("file not below the root on the server: %v", err)
+	}
+	names, err := s.List(ctx, "B_1/")
+	if want := []string{"B_1/accounts.json", "B_1/budget.json"}; err != nil || !slices.Equal(names, want) {
+		t.Errorf("List(B_1/) = %v, %v; want %v", names, err, want)
+	}
+	sizes, err := s.Sizes(ctx, "")
+	if err != nil || len(sizes) != 3 || sizes["state.json"] != 2 {
+		t.Errorf("Sizes = %v, %v; want 3 files with state.json of 2 bytes", sizes, err)
+	}
+
+	// The server going away ends the session; the next call redials
+	broken := last
+	broken.closeConn()
+	<-broken.done
+	if err := broken.Remove("vault/state.json"); err == nil {
+		t.Fatal("Remove over a broken connection succeeded")
+	}
+	if err := s.Delete(ctx, "state.json"); err != nil {
+		t.Fatalf("Delete after redial: %v", err)
+	}
+	if dials != 2 {
+		t.Errorf("dialled %d times; want 2", dials)
+	}
+	if _, err := s.Get(ctx, "state.json"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Get of a deleted file error = %v; want fs.ErrNotExist", err)
+	}
+}
+
+// TestSSHAuthClosesAgent hands back a func closing the agent connection,
+// and closes it itself when it fails
+func TestSSHAuthClosesAgent(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "agent.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	defer ln.Close()
+	t.Setenv("SSH_AUTH_SOCK", sock)
+	t.Setenv("HOME", t.TempDir())
+
+	// closed reports whether the next connection to the agent is closed by
+	// the client
+	closed := func() bool {
+		conn, err := ln.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		_, err = conn.Read(make([]byte, 1))
+		return errors.Is(err, io.EOF)
+	}
+
+	methods, closeAgent, err := sshAuth("secret")
+	if err != nil || len(methods) != 2 {
+		t.Fatalf("sshAuth = %d methods, %v", len(methods), err)
+	}
+	closeAgent()
+	if !closed() {
+		t.Error("agent connection left open after closeAgent")
+	}
+
+	t.Setenv("YNABVAULT_SFTP_KEY", filepath.Join(t.TempDir(), "missing"))
+	if _, _, err := sshAuth(""); err == nil {
+		t.Fatal("sshAuth with a missing key succeeded")
+	}
+	if !closed() {
+		t.Error("agent connection left open after a failed sshAuth")
+	}
+}
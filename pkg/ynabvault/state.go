@@ -0,0 +1,73 @@
+package ynabvault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+	"time"
+)
+
+// StateFileName is the per-vault state file kept in the output directory
+const StateFileName = ".ynabvault-state.json"
+
+// budgetState records what the last successful run saved for a budget
+type budgetState struct {
+	ServerKnowledge int64     `json:"server_knowledge"`
+	Snapshot        string    `json:"snapshot"`
+	LastModified    time.Time `json:"last_modified_on,omitzero"`
+	// Resources lists the sub-resources saved with Snapshot
+	Resources []string `json:"resources,omitempty"`
+	// Responses remembers the validators of full downloads by URL
+	Responses map[string]cachedResponse `json:"responses,omitempty"`
+}
+
+// unchanged reports whether b was not modified since the state was saved,
+// which also saved every one of resources; a newly selected resource is
+// only fetched with the budget
+func (s budgetState) unchanged(b Budget, resources []string) bool {
+	for _, res := range resources {
+		if !slices.Contains(s.Resources, res) {
+			return false
+		}
+	}
+	return s.Snapshot != "" && !b.LastModifiedOn.IsZero() && s.LastModified.Equal(b.LastModifiedOn)
+}
+
+// VaultState is persisted between runs, keyed by budget ID
+type VaultState struct {
+	Budgets map[string]budgetState `json:"budgets"`
+}
+
+// LoadState reads the state file from store; a missing file yields empty state
+func LoadState(ctx context.Context, store Store) (*VaultState, error) {
+	st := &VaultState{Budgets: map[string]budgetState{}}
+	data, err := store.Get(ctx, StateFileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return st, fmt.Errorf("read state: %w: %w", ErrBackend, err)
+	}
+	if err := json.Unmarshal(data, st); err != nil {
+		return &VaultState{Budgets: map[string]budgetState{}}, fmt.Errorf("decode state: %w: %w", ErrCorrupt, err)
+	}
+	if st.Budgets == nil {
+		st.Budgets = map[string]budgetState{}
+	}
+	return st, nil
+}
+
+// save writes the state file into store
+func (s *VaultState) save(ctx context.Context, store Store) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := store.Put(ctx, StateFileName, data); err != nil {
+		return fmt.Errorf("write state: %w: %w", ErrBackend, err)
+	}
+	return nil
+}
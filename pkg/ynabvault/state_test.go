@@ -0,0 +1,46 @@
+package ynabvault
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestStateRoundTrip saves and reloads vault state
+func TestStateRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	st, err := LoadState(t.Context(), DirStore(dir))
+	if err != nil {
+		t.Fatalf("LoadState on empty dir: %v", err)
+	}
+	if len(st.Budgets) != 0 {
+		t.Fatalf("expected empty state, got %+v", st)
+	}
+	st.Budgets["b1"] = budgetState{ServerKnowledge: 42, Snapshot: "B_b1_20250101T000000Z.json"}
+	if err := st.save(t.Context(), DirStore(dir)); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	again, err := LoadState(t.Context(), DirStore(dir))
+	if err != nil {
+		t.Fatalf("LoadState: %v", err)
+	}
+	if got := again.Budgets["b1"]; got.ServerKnowledge != 42 || got.Snapshot != "B_b1_20250101T000000Z.json" {
+		t.Errorf("reloaded state mismatch: %+v", got)
+	}
+}
+
+// TestLoadStateCorrupt reports ErrCorrupt but still returns usable state
+func TestLoadStateCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, StateFileName), []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	st, err := LoadState(t.Context(), DirStore(dir))
+	if !errors.Is(err, ErrCorrupt) {
+		t.Errorf("expected ErrCorrupt, got %v", err)
+	}
+	if st == nil || st.Budgets == nil {
+		t.Fatal("expected empty usable state alongside the error")
+	}
+}
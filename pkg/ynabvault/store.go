@@ -0,0 +1,150 @@
+package ynabvault
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Store is where a vault keeps its files: a local directory or a remote
+// bucket. Names are slash-separated and relative to the store's root.
+// ynabvaulttest.Store keeps them in memory.
+type Store interface {
+	Reader
+	Writer
+	// Location describes where name is kept, for messages
+	Location(name string) string
+}
+
+// Reader is the reading half of a Store, for code that only looks at a vault
+type Reader interface {
+	// Get reads name; a missing name yields an error wrapping fs.ErrNotExist
+	Get(ctx context.Context, name string) ([]byte, error)
+	// List returns every name under prefix in lexical order
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// Writer is the writing half of a Store
+type Writer interface {
+	// Put creates or replaces name with data
+	Put(ctx context.Context, name string, data []byte) error
+	// Delete removes name
+	Delete(ctx context.Context, name string) error
+}
+
+// OpenStore returns the store for an --output value: s3://bucket/prefix
+// for S3-compatible storage, sftp://user@host/path for a directory on an SSH
+// server, anything else is a local directory
+func OpenStore(output string) (Store, error) {
+	return OpenStoreWith(output, StoreOptions{})
+}
+
+// StoreOptions tune how a remote store is reached
+type StoreOptions struct {
+	// Proxy routes the store's traffic through an http://, https://,
+	// socks5:// or socks5h:// proxy; SFTP needs SOCKS5. Nil keeps the
+	// default: HTTPS_PROXY and friends for S3, a direct connection for SFTP.
+	Proxy *url.URL
+	// Network is tcp4 or tcp6 to connect over one IP version only; empty
+	// tries both
+	Network string
+}
+
+// OpenStoreWith is OpenStore with options for remote stores
+func OpenStoreWith(output string, opts StoreOptions) (Store, error) {
+	switch {
+	case strings.HasPrefix(output, s3Scheme):
+		return newS3Store(output, opts)
+	case strings.HasPrefix(output, sftpScheme):
+		return newSFTPStore(output, opts)
+	}
+	return DirStore(output), nil
+}
+
+// DirStore keeps files in a local directory
+type DirStore string
+
+func (d DirStore) path(name string) string {
+	return filepath.Join(string(d), filepath.FromSlash(name))
+}
+
+// Put writes atomically, creating subdirectories below the root as needed
+func (d DirStore) Put(_ context.Context, name string, data []byte) error {
+	if dir := path.Dir(name); dir != "." {
+		if err := os.MkdirAll(d.path(dir), 0755); err != nil {
+			return err
+		}
+	}
+	return WriteFile(d.path(name), data)
+}
+
+func (d DirStore) Get(_ context.Context, name string) ([]byte, error) {
+	return os.ReadFile(d.path(name))
+}
+
+// List walks the directory tree; a missing root lists nothing
+func (d DirStore) List(_ context.Context, prefix string) ([]string, error) {
+	var names []string
+	err := filepath.WalkDir(string(d), func(p string, e fs.DirEntry, err error) error {
+		if err != nil {
+			if p == string(d) && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if e.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(string(d), p)
+		if err != nil {
+			return err
+		}
+		if name := filepath.ToSlash(rel); strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	// WalkDir sorts each directory on its own, which puts "a/b" before "a.json"
+	slices.Sort(names)
+	return names, err
+}
+
+// Sizes stats every file under prefix
+func (d DirStore) Sizes(ctx context.Context, prefix string) (map[string]int64, error) {
+	names, err := d.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	sizes := map[string]int64{}
+	for _, name := range names {
+		fi, err := os.Stat(d.path(name))
+		if err != nil {
+			return nil, err
+		}
+		sizes[name] = fi.Size()
+	}
+	return sizes, nil
+}
+
+// Delete removes name and then the directories below the root it leaves empty
+func (d DirStore) Delete(_ context.Context, name string) error {
+	if err := os.Remove(d.path(name)); err != nil {
+		return err
+	}
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if os.Remove(d.path(dir)) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func (d DirStore) Location(name string) string {
+	return d.path(name)
+}
@@ -0,0 +1,59 @@
+package ynabvault
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestDirStore covers nested puts, listing and missing names
+func TestDirStore(t *testing.T) {
+	ctx := t.Context()
+	if names, err := DirStore(filepath.Join(t.TempDir(), "missing")).List(ctx, ""); err != nil || len(names) != 0 {
+		t.Fatalf("List on a missing dir = %v, %v", names, err)
+	}
+
+	store := DirStore(t.TempDir())
+	for _, name := range []string{"b.json", "A_1/accounts.json", ".hidden", "A_1.json"} {
+		if err := store.Put(ctx, name, []byte(name)); err != nil {
+			t.Fatalf("Put(%s): %v", name, err)
+		}
+	}
+	names, err := store.List(ctx, "")
+	// "A_1.json" sorts before "A_1/accounts.json", though the walk visits
+	// the directory first
+	if want := []string{".hidden", "A_1.json", "A_1/accounts.json", "b.json"}; err != nil || !reflect.DeepEqual(names, want) {
+		t.Errorf("List = %v, %v; want %v", names, err, want)
+	}
+	if names, _ := store.List(ctx, "A_1/"); len(names) != 1 {
+		t.Errorf("List(A_1/) = %v", names)
+	}
+	if got, err := store.Get(ctx, "A_1/accounts.json"); err != nil || string(got) != "A_1/accounts.json" {
+		t.Errorf("Get = %q, %v", got, err)
+	}
+	if sizes, err := store.Sizes(ctx, ""); err != nil || sizes["A_1/accounts.json"] != int64(len("A_1/accounts.json")) || len(sizes) != 4 {
+		t.Errorf("Sizes = %v, %v", sizes, err)
+	}
+	if err := store.Delete(ctx, "b.json"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get(ctx, "b.json"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Get after Delete = %v; want fs.ErrNotExist", err)
+	}
+	if got := store.Location("A_1/accounts.json"); got != filepath.Join(string(store), "A_1", "accounts.json") {
+		t.Errorf("Location = %q", got)
+	}
+	// Deleting the last file of a directory removes the directory
+	if err := store.Delete(ctx, "A_1/accounts.json"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(string(store), "A_1")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat(A_1) after its last file was deleted = %v; want fs.ErrNotExist", err)
+	}
+	if _, err := os.Stat(string(store)); err != nil {
+		t.Errorf("root removed: %v", err)
+	}
+}
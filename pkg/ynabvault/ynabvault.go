@@ -0,0 +1,767 @@
+// Package ynabvault backs up YNAB budgets into a Store: a Runner lists the
+// budgets through a Client, downloads those changed since the last run and
+// records what it saved, so other Go programs can embed the backups the CLI
+// makes. Run with a Config does the same without the functional options.
+package ynabvault
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"filippo.io/age"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/text/unicode/norm"
+)
+
+// DefaultAPIHost serves the YNAB API
+const DefaultAPIHost = "https://api.youneedabudget.com"
+
+// DefaultBaseURL is the YNAB budgets endpoint, used when Config.BaseURL is empty
+const DefaultBaseURL = DefaultAPIHost + "/v1/budgets"
+
+// BudgetsURL returns the budgets endpoint of the YNAB API served at host, a
+// URL such as "http://localhost:8080" or "https://proxy.example/ynab". Every
+// other endpoint, per budget and per sub-resource, lies below it.
+func BudgetsURL(host string) (string, error) {
+	u, err := url.Parse(host)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" {
+		return "", fmt.Errorf("API host %q must be an http:// or https:// URL without a query", host)
+	}
+	return strings.TrimSuffix(u.String(), "/") + "/v1/budgets", nil
+}
+
+// Config holds the parameters and dependencies of a run
+type Config struct {
+	Token   string
+	BaseURL string
+	// Endpoints overrides the URLs of single endpoints, keyed by the names
+	// EndpointNames lists; see CheckEndpoints
+	Endpoints map[string]string
+	OutputDir string
+	Verbose   bool
+	Full      bool
+	// Force downloads budgets even when unchanged since the last run
+	Force bool
+	// Resume skips the budgets that an interrupted or failed run already
+	// saved, as recorded in ProgressFileName
+	Resume    bool
+	Resources []string
+	// Concurrency bounds parallel budget downloads; values below 1 mean 1
+	Concurrency int
+	// Recipients, when set, encrypt every budget file with age
+	Recipients []age.Recipient
+	// Budgets, when set, limits the backup to budgets matching one of these
+	// name globs or IDs; ExcludeBudgets then drops matches, see matchBudget
+	Budgets        []string
+	ExcludeBudgets []string
+	// TransactionsSince, a YYYY-MM-DD date, limits the transactions
+	// sub-resource to transactions on or after it
+	TransactionsSince string
+	// MaxBudgetSize, when positive, refuses to save budget exports larger
+	// than this many bytes, checked by a preflight before full downloads
+	MaxBudgetSize int64
+	// Strict fails the run when any budget could not be saved; FailFast
+	// also stops at the first such budget, leaving the rest unattempted
+	Strict   bool
+	FailFast bool
+	// JSONStyle reformats budget files before they are saved
+	JSONStyle JSONStyle
+	// FilenameTemplate names budget files from {name}, {id}, {date} and
+	// {ts}; empty means BuildFilename, FilenameLatest one file per budget
+	FilenameTemplate string
+	// Layout is LayoutFlat (the default when empty) or LayoutNested
+	Layout string
+	// Store receives the backup; nil means the local directory OutputDir
+	Store Store
+	// Client sends the API requests; nil means http.DefaultClient
+	Client *http.Client
+	Logger *slog.Logger
+
+	// manifest, set by Run, pins the hash of every file saved
+	manifest *Manifest
+}
+
+// store returns where the backup is written
+func (c Config) store() Store {
+	if c.Store != nil {
+		return c.Store
+	}
+	return DirStore(c.OutputDir)
+}
+
+// discardLogger drops every record; it stands in for a nil logger
+var discardLogger = slog.New(slog.DiscardHandler)
+
+// log returns the configured logger, redacting the token and other
+// sensitive values, or one that discards everything
+func (c Config) log() *slog.Logger {
+	if c.Logger != nil {
+		return slog.New(NewRedactHandler(c.Logger.Handler(), c.Token))
+	}
+	return discardLogger
+}
+
+// Budget holds basic info from YNAB list endpoint
+type Budget struct {
+	ID             string    `json:"id"`
+	Name           string    `json:"name"`
+	LastModifiedOn time.Time `json:"last_modified_on"`
+}
+
+// TimeFormat is the UTC timestamp layout in snapshot file names
+const TimeFormat = "20060102T150405Z"
+
+// matchBudget reports whether b's ID equals one of patterns or its name
+// matches one as a case-insensitive glob
+func matchBudget(b Budget, patterns []string) bool {
+	for _, p := range patterns {
+		if p == b.ID {
+			return true
+		}
+		if ok, _ := path.Match(strings.ToLower(p), strings.ToLower(b.Name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// filterBudgets keeps the budgets matching include (all when empty) and
+// not matching exclude
+func filterBudgets(budgets []Budget, include, exclude []string) []Budget {
+	var out []Budget
+	for _, b := range budgets {
+		if (len(include) == 0 || matchBudget(b, include)) && !matchBudget(b, exclude) {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// CheckBudgetPatterns rejects malformed --budget and --exclude-budget globs
+func CheckBudgetPatterns(patterns []string) error {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("budget pattern %q: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// BudgetResources lists the per-budget sub-resource endpoints --resources may collect
+var BudgetResources = []string{"accounts", "categories", "payees", "payee_locations", "months", "scheduled_transactions", "transactions"}
+
+// Stats counts what a backup run did with the listed budgets
+type Stats struct {
+	Budgets    int // listed by the API
+	Downloaded int
+	Skipped    int // unchanged since the last run
+	Failed     int // not saved, see the logged warnings
+}
+
+// BudgetReport is the outcome of one budget in a run
+type BudgetReport struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Status   string   `json:"status"` // downloaded, unchanged or failed
+	Path     string   `json:"path,omitempty"`
+	Bytes    int      `json:"bytes,omitempty"` // size of the budget JSON
+	Duration float64  `json:"duration_seconds"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+// Report is what a run did, in total and per budget
+type Report struct {
+	Stats
+	Results []BudgetReport
+}
+
+// Run orchestrates the fetch-and-save workflow and returns what it did
+func Run(ctx context.Context, cfg Config) (Report, error) {
+	var stats Report
+	cfg.BaseURL = cmp.Or(cfg.BaseURL, DefaultBaseURL)
+	if err := CheckEndpoints(cfg.Endpoints); err != nil {
+		return stats, err
+	}
+	if err := cfg.JSONStyle.Check(); err != nil {
+		return stats, err
+	}
+	if err := CheckFilenameTemplate(cfg.FilenameTemplate); err != nil {
+		return stats, err
+	}
+	if err := CheckLayout(cfg.Layout, cfg.FilenameTemplate); err != nil {
+		return stats, err
+	}
+	store := cfg.store()
+	if dir, ok := store.(DirStore); ok {
+		cfg.log().Debug("creating output directory", "dir", string(dir))
+		if err := os.MkdirAll(string(dir), 0755); err != nil {
+			return stats, fmt.Errorf("failed to create output dir: %w: %w", ErrBackend, err)
+		}
+		if n, err := cleanTempFiles(string(dir)); err != nil {
+			cfg.log().Warn("cleaning temp files failed", "error", err)
+		} else if n > 0 {
+			cfg.log().Info("removed temp files left by an interrupted run", "count", n)
+		}
+	}
+
+	cfg.log().Debug("fetching budgets list", "url", cfg.BaseURL)
+	budgets, err := FetchBudgets(ctx, cfg)
+	if err != nil {
+		return stats, fmt.Errorf("fetch budgets: %w", err)
+	}
+	budgets = filterBudgets(budgets, cfg.Budgets, cfg.ExcludeBudgets)
+	if len(budgets) == 0 && len(cfg.Budgets) > 0 {
+		cfg.log().Warn("no budget matches the budget filter", "budgets", cfg.Budgets)
+	}
+
+	state, err := LoadState(ctx, store)
+	if err != nil {
+		cfg.log().Warn("state unreadable, downloading all budgets in full", "error", err)
+	}
+	// A manifest that cannot be read is left alone rather than overwritten
+	if cfg.manifest, err = LoadManifest(ctx, store); err != nil {
+		cfg.log().Warn("manifest unreadable, file hashes will not be pinned", "error", err)
+	}
+
+	progress := &runProgress{Started: time.Now(), Budgets: map[string]budgetState{}}
+	if cfg.Resume {
+		switch prior, err := loadProgress(ctx, store); {
+		case err != nil:
+			cfg.log().Warn("progress unreadable, nothing to resume", "error", err)
+		case prior == nil:
+			cfg.log().Info("no interrupted run to resume")
+		default:
+			cfg.log().Info("resuming run", "started", prior.Started, "budgets_done", len(prior.Budgets))
+			progress = prior
+		}
+	}
+
+	// Budgets are processed by a bounded worker pool; each worker only reads
+	// the shared state, and results are applied in list order afterwards
+	results := make([]budgetResult, len(budgets))
+	work, stop := context.WithCancel(ctx)
+	defer stop()
+	var g errgroup.Group
+	g.SetLimit(max(cfg.Concurrency, 1))
+	for i, b := range budgets {
+		prev := state.Budgets[b.ID]
+		g.Go(func() error {
+			if done, ok := progress.done(b.ID); ok {
+				cfg.log().Info("skipping budget saved by the interrupted run", "budget", b.Name, "id", b.ID, "snapshot", done.Snapshot)
+				results[i] = budgetResult{saved: true, skipped: true, resumed: true, next: done}
+				return nil
+			}
+			results[i] = processBudget(work, cfg, b, prev, progress)
+			if r := results[i]; r.saved && !r.skipped && len(r.warnings) == 0 {
+				if err := progress.record(context.WithoutCancel(ctx), store, b.ID, r.next); err != nil {
+					cfg.log().Warn("progress not recorded", "budget", b.Name, "id", b.ID, "error", err)
+				}
+			}
+			if cfg.FailFast && results[i].failed() && work.Err() == nil {
+				cfg.log().Error("stopping at the first failed budget", "budget", b.Name, "id", b.ID)
+				stop()
+			}
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	stats.Budgets = len(budgets)
+	var failed []string
+	var firstErr error
+	complete := true
+	for i, r := range results {
+		b := budgets[i]
+		if r.saved {
+			state.Budgets[b.ID] = r.next
+		}
+		report := BudgetReport{ID: b.ID, Name: b.Name, Path: r.path, Bytes: r.bytes, Duration: r.duration.Seconds()}
+		switch {
+		case r.resumed:
+			stats.Skipped++
+			report.Status = "resumed"
+		case r.skipped:
+			stats.Skipped++
+			report.Status = "unchanged"
+		case r.saved:
+			stats.Downloaded++
+			report.Status = "downloaded"
+		default:
+			stats.Failed++
+			report.Status = "failed"
+			failed = append(failed, fmt.Sprintf("%s (%s)", b.Name, b.ID))
+			// With --fail-fast the budget that stopped the run comes first
+			if firstErr == nil || errors.Is(firstErr, context.Canceled) {
+				firstErr = cmp.Or(r.warnings...)
+			}
+		}
+		for _, w := range r.warnings {
+			complete = false
+			cfg.log().Warn("budget not fully saved", "budget", b.Name, "id", b.ID, "error", w)
+			report.Errors = append(report.Errors, w.Error())
+		}
+		stats.Results = append(stats.Results, report)
+	}
+	if cfg.FilenameTemplate == FilenameLatest {
+		updateLatest(cfg, budgets, state)
+	}
+	// Saved even after a cancellation so finished budgets are remembered
+	if err := state.save(context.WithoutCancel(ctx), store); err != nil {
+		return stats, err
+	}
+	if cfg.manifest != nil {
+		if err := cfg.manifest.Save(context.WithoutCancel(ctx), store); err != nil {
+			return stats, err
+		}
+	}
+	// Budgets finished before a cancellation are kept; the run still fails
+	if err := ctx.Err(); err != nil {
+		return stats, fmt.Errorf("backup interrupted: %w", err)
+	}
+	if complete {
+		if err := finishProgress(ctx, store); err != nil {
+			cfg.log().Warn("progress not removed", "error", err)
+		}
+	}
+	if len(failed) > 0 && (cfg.Strict || cfg.FailFast) {
+		return stats, fmt.Errorf("%d of %d budgets not saved: %s: %w", len(failed), len(budgets), strings.Join(failed, ", "), firstErr)
+	}
+	return stats, nil
+}
+
+// budgetResult collects the outcome of processing one budget
+type budgetResult struct {
+	saved    bool
+	skipped  bool // unchanged, next is the previous state
+	resumed  bool // saved by the run being resumed, next is what it saved
+	next     budgetState
+	warnings []error
+	path     string // where the budget was saved
+	bytes    int    // size of the budget JSON
+	duration time.Duration
+}
+
+// failed reports whether the budget was not saved; unchanged budgets count
+// as saved
+func (r budgetResult) failed() bool {
+	return !r.saved
+}
+
+// processBudget downloads a budget and its selected sub-resources; failures
+// are collected as warnings so one budget never stops the others. Each file
+// saved is noted in progress, and what progress holds from an interrupted
+// run is not fetched again.
+func processBudget(ctx context.Context, cfg Config, b Budget, prev budgetState, progress *runProgress) (r budgetResult) {
+	start := time.Now()
+	defer func() { r.duration = time.Since(start) }()
+	if err := ctx.Err(); err != nil {
+		r.warnings = append(r.warnings, fmt.Errorf("skipped: %w", err))
+		return r
+	}
+	// Resources missing from an interrupted run are fetched even when the
+	// budget has not changed since
+	pb, resumed := progress.partial(b.ID)
+	if !resumed && !cfg.Force && prev.unchanged(b, cfg.Resources) {
+		cfg.log().Info("skipping unchanged budget", "budget", b.Name, "id", b.ID, "snapshot", prev.Snapshot)
+		r.saved, r.skipped, r.next = true, true, prev
+		return r
+	}
+	if resumed {
+		cfg.log().Info("resuming budget saved by the interrupted run", "budget", b.Name, "id", b.ID, "snapshot", pb.State.Snapshot, "resources_done", len(pb.Resources))
+		r.saved, r.next, r.path = true, pb.State, cfg.store().Location(pb.State.Snapshot)
+	} else {
+		cfg.log().Info("processing budget", "budget", b.Name, "id", b.ID)
+		if cfg.MaxBudgetSize > 0 && fullDownload(cfg, prev) {
+			if err := preflightBudget(ctx, cfg, b, prev); err != nil {
+				r.warnings = append(r.warnings, err)
+				return r
+			}
+		}
+		path, size, next, err := downloadAndSave(ctx, cfg, b, prev)
+		if err != nil {
+			r.warnings = append(r.warnings, err)
+			return r
+		}
+		cfg.log().Info("saved budget", "budget", b.Name, "id", b.ID, "path", path, "bytes", size)
+		r.saved, r.next, r.path, r.bytes = true, next, path, size
+		pb = partialBudget{State: next}
+		if len(cfg.Resources) > 0 {
+			notePartial(ctx, cfg, b, progress, pb)
+		}
+	}
+	for _, res := range cfg.Resources {
+		if slices.Contains(pb.Resources, res) {
+			continue
+		}
+		rpath, err := downloadResource(ctx, cfg, b, res, prev, &r.next)
+		if err != nil {
+			r.warnings = append(r.warnings, err)
+			continue
+		}
+		cfg.log().Debug("saved resource", "budget", b.Name, "id", b.ID, "resource", res, "path", rpath)
+		pb.State, pb.Resources = r.next, append(pb.Resources, res)
+		notePartial(ctx, cfg, b, progress, pb)
+	}
+	r.next.Resources = slices.Sorted(slices.Values(pb.Resources))
+	return r
+}
+
+// notePartial records in progress what is saved of b so far; a failure to
+// record is only logged
+func notePartial(ctx context.Context, cfg Config, b Budget, progress *runProgress, pb partialBudget) {
+	if err := progress.recordPartial(context.WithoutCancel(ctx), cfg.store(), b.ID, pb); err != nil {
+		cfg.log().Warn("progress not recorded", "budget", b.Name, "id", b.ID, "error", err)
+	}
+}
+
+// FetchBudgets calls the YNAB API to list budgets and logs count if verbose
+func FetchBudgets(ctx context.Context, cfg Config) ([]Budget, error) {
+	data, err := httpGet(withEndpoint(ctx, EndpointBudgets), cfg.Client, cfg.endpoint(EndpointBudgets, ""), cfg.Token)
+	if err != nil {
+		return nil, err
+	}
+	budgets, err := decodeBudgets(data)
+	if err != nil {
+		return nil, err
+	}
+	cfg.log().Info("fetched budgets", "count", len(budgets))
+	return budgets, nil
+}
+
+// httpGet performs a GET request with bearer token and returns response body
+func httpGet(ctx context.Context, client *http.Client, url, token string) ([]byte, error) {
+	return HTTPSend(ctx, client, http.MethodGet, url, token, nil)
+}
+
+// HTTPSend performs a request with bearer token and an optional JSON body,
+// and returns the body of a 2xx response
+func HTTPSend(ctx context.Context, client *http.Client, method, url, token string, body []byte) ([]byte, error) {
+	req, err := newRequest(ctx, method, url, token, body)
+	if err != nil {
+		return nil, err
+	}
+	data, _, err := doRequest(client, req)
+	return data, err
+}
+
+// newRequest builds a request with bearer token and an optional JSON body
+func newRequest(ctx context.Context, method, url, token string, body []byte) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		// A bytes.Reader lets the retry transport resend the body
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// doRequest sends req and returns the body and headers of a 2xx response
+func doRequest(client *http.Client, req *http.Request) (data []byte, header http.Header, err error) {
+	resp, err := cmp.Or(client, http.DefaultClient).Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		err = errors.Join(err, resp.Body.Close())
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err = &StatusError{StatusCode: resp.StatusCode}
+		return
+	}
+	data, err = io.ReadAll(resp.Body)
+	return data, resp.Header, err
+}
+
+// decodeBudgets decodes a budgets list JSON
+func decodeBudgets(data []byte) ([]Budget, error) {
+	var wrapper struct {
+		Data struct {
+			Budgets []Budget `json:"budgets"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &wrapper); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCorrupt, err)
+	}
+	return wrapper.Data.Budgets, nil
+}
+
+// downloadAndSave fetches a single budget's JSON, writes to file, and returns
+// the file path and JSON size along with the state to remember for the next run
+func downloadAndSave(ctx context.Context, cfg Config, b Budget, prev budgetState) (string, int, budgetState, error) {
+	data, cached, err := fetchBudget(ctx, cfg, b, prev)
+	if err != nil {
+		return "", 0, prev, fmt.Errorf("download budget: %w", err)
+	}
+	if err := checkBudgetSize(int64(len(data)), cfg.MaxBudgetSize); err != nil {
+		return "", 0, prev, err
+	}
+	name, err := saveData(ctx, cfg, b, cfg.budgetFilename(b), data)
+	if err != nil {
+		return "", 0, prev, err
+	}
+	next := budgetState{ServerKnowledge: serverKnowledge(data), Snapshot: name, LastModified: b.LastModifiedOn}
+	next.remember(cfg.endpoint(EndpointBudget, b.ID), cached, name)
+	return cfg.store().Location(name), len(data), next, nil
+}
+
+// fullDownload reports whether the budget has to be downloaded in full
+// rather than as changes since prev
+func fullDownload(cfg Config, prev budgetState) bool {
+	// Encrypted snapshots cannot be read back without the identity
+	return cfg.Full || prev.ServerKnowledge == 0 || prev.Snapshot == "" || strings.HasSuffix(prev.Snapshot, AgeSuffix)
+}
+
+// fetchBudget downloads a budget's JSON. When the previous run left server
+// knowledge and its snapshot, only changed entities are requested and merged
+// into that snapshot. A full download is conditional on the validators of
+// the previous one, which are returned for the next run.
+func fetchBudget(ctx context.Context, cfg Config, b Budget, prev budgetState) ([]byte, cachedResponse, error) {
+	ctx = withEndpoint(ctx, EndpointBudget)
+	endpoint := cfg.endpoint(EndpointBudget, b.ID)
+	if fullDownload(cfg, prev) {
+		return cachedGet(ctx, cfg, endpoint, prev.Responses[endpoint])
+	}
+	old, err := cfg.store().Get(ctx, prev.Snapshot)
+	if err != nil {
+		cfg.log().Warn("previous snapshot unavailable, downloading in full", "snapshot", prev.Snapshot, "error", err)
+		return cachedGet(ctx, cfg, endpoint, cachedResponse{})
+	}
+	cfg.log().Debug("requesting changes", "budget", b.Name, "id", b.ID, "server_knowledge", prev.ServerKnowledge)
+	delta, err := httpGet(ctx, cfg.Client, endpoint+"?last_knowledge_of_server="+strconv.FormatInt(prev.ServerKnowledge, 10), cfg.Token)
+	if err != nil {
+		return nil, cachedResponse{}, err
+	}
+	data, err := mergeDelta(old, delta)
+	return data, cachedResponse{}, err
+}
+
+// downloadResource fetches a budget sub-resource such as /accounts into the
+// budget's subdirectory and returns where it was saved. The request is
+// conditional on what prev remembers of the URL; next remembers the response.
+func downloadResource(ctx context.Context, cfg Config, b Budget, resource string, prev budgetState, next *budgetState) (string, error) {
+	ctx = withEndpoint(ctx, EndpointBudget+"/"+resource)
+	endpoint := cfg.endpoint(EndpointBudget+"/"+resource, b.ID)
+	if resource == "transactions" && cfg.TransactionsSince != "" {
+		endpoint += "?since_date=" + url.QueryEscape(cfg.TransactionsSince)
+	}
+	data, cached, err := cachedGet(ctx, cfg, endpoint, prev.Responses[endpoint])
+	if err != nil {
+		return "", fmt.Errorf("download %s: %w", endpoint, err)
+	}
+	name, err := saveData(ctx, cfg, b, cfg.resourceName(b, resource), data)
+	if err != nil {
+		return "", err
+	}
+	next.remember(endpoint, cached, name)
+	return cfg.store().Location(name), nil
+}
+
+// saveData stores a budget file in cfg.JSONStyle, encrypting it and adding
+// AgeSuffix to its name when recipients are configured, and returns the name
+// written. The hash of the unencrypted data is pinned in the manifest.
+func saveData(ctx context.Context, cfg Config, b Budget, name string, data []byte) (string, error) {
+	data, err := FormatJSON(data, cfg.JSONStyle)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	plain := data
+	if len(cfg.Recipients) > 0 {
+		enc, err := Encrypt(data, cfg.Recipients)
+		if err != nil {
+			return "", fmt.Errorf("encrypt %s: %w", name, err)
+		}
+		data, name = enc, name+AgeSuffix
+	}
+	if err := cfg.store().Put(ctx, name, data); err != nil {
+		return "", fmt.Errorf("write file: %w: %w", ErrBackend, err)
+	}
+	if cfg.manifest != nil {
+		cfg.manifest.record(name, plain, b)
+	}
+	return name, nil
+}
+
+// ParseResources splits and validates the --resources list
+func ParseResources(s string) ([]string, error) {
+	var out []string
+	for _, res := range strings.Split(s, ",") {
+		res = strings.TrimSpace(res)
+		if res == "" {
+			continue
+		}
+		if !slices.Contains(BudgetResources, res) {
+			return nil, fmt.Errorf("unknown resource %q (supported: %s)", res, strings.Join(BudgetResources, ", "))
+		}
+		out = append(out, res)
+	}
+	return out, nil
+}
+
+// tempSuffix marks in-progress writes; leftovers are removed by cleanTempFiles
+const tempSuffix = ".tmp"
+
+// WriteFile atomically writes data to a file with 0644 permissions: it writes
+// a hidden temp file in the same directory, fsyncs it, renames it into place
+// and fsyncs the directory, so a crash never leaves a truncated file at path
+// nor loses the rename
+func WriteFile(path string, data []byte) (err error) {
+	dir, base := filepath.Split(path)
+	f, err := os.CreateTemp(dir, "."+base+".*"+tempSuffix)
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmp)
+		}
+	}()
+	if _, err = f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Chmod(0644); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return err
+	}
+	return syncDir(cmp.Or(dir, "."))
+}
+
+// syncDir flushes a directory's entries to disk. Windows cannot fsync a
+// directory and makes renames durable on its own.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// cleanTempFiles removes temp files orphaned by an interrupted WriteFile
+// anywhere under dir and returns how many were removed
+func cleanTempFiles(dir string) (int, error) {
+	removed := 0
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.Type().IsRegular() && strings.HasPrefix(name, ".") && strings.HasSuffix(name, tempSuffix) {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// BuildFilename constructs a safe filename for a budget
+func BuildFilename(b Budget) string {
+	safe := SanitizeFileName(b.Name)
+	ts := b.LastModifiedOn.UTC().Format(TimeFormat)
+	return fmt.Sprintf("%s_%s_%s.json", safe, SanitizeFileName(b.ID), ts)
+}
+
+// budgetDirName names the per-budget subdirectory holding sub-resources
+func budgetDirName(b Budget) string {
+	return fmt.Sprintf("%s_%s", SanitizeFileName(b.Name), SanitizeFileName(b.ID))
+}
+
+// buildResourceFilename names a sub-resource file, e.g. accounts_20250514T153045Z.json
+func buildResourceFilename(b Budget, resource string) string {
+	ts := b.LastModifiedOn.UTC().Format(TimeFormat)
+	return fmt.Sprintf("%s_%s.json", resource, ts)
+}
+
+// maxNameBytes bounds a sanitized name, leaving room within the common
+// 255-byte file name limit for the ID, timestamp and suffixes around it
+const maxNameBytes = 120
+
+// windowsReserved are device names Windows refuses as file names, with or
+// without an extension
+var windowsReserved = []string{
+	"CON", "PRN", "AUX", "NUL",
+	"COM1", "COM2", "COM3", "COM4", "COM5", "COM6", "COM7", "COM8", "COM9",
+	"LPT1", "LPT2", "LPT3", "LPT4", "LPT5", "LPT6", "LPT7", "LPT8", "LPT9",
+}
+
+// SanitizeFileName replaces or removes unsupported characters. Input is
+// NFC-normalized first so composed and decomposed names map to the same file,
+// and leading dots are trimmed so a name never yields "..", or a hidden file.
+// Trailing dots, which Windows drops, are trimmed too, and a Windows device
+// name such as "aux" gets an underscore. Names longer than maxNameBytes are
+// cut and end in a hash of the whole name, so two long names that share a
+// beginning still differ.
+func SanitizeFileName(name string) string {
+	clean := strings.NewReplacer(" ", "_", "/", "_").Replace(norm.NFC.String(name))
+	var b strings.Builder
+	for _, r := range clean {
+		switch {
+		case r == '_' || r == '-' || r == '+' || r == '(' || r == ')' || r == '.':
+			b.WriteRune(r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+		}
+	}
+	safe := norm.NFC.String(strings.Trim(b.String(), "."))
+	stem, _, _ := strings.Cut(safe, ".")
+	if slices.Contains(windowsReserved, strings.ToUpper(stem)) {
+		safe = stem + "_" + safe[len(stem):]
+	}
+	if len(safe) > maxNameBytes {
+		sum := sha256.Sum256([]byte(safe))
+		suffix := "-" + hex.EncodeToString(sum[:4])
+		cut := maxNameBytes - len(suffix)
+		for cut > 0 && !utf8.RuneStart(safe[cut]) {
+			cut--
+		}
+		safe = strings.TrimRight(safe[:cut], ".") + suffix
+	}
+	return safe
+}
@@ -0,0 +1,833 @@
+package ynabvault
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestSanitizeFileName ensures name cleaning matches expectations
+func TestSanitizeFileName(t *testing.T) {
+	tests := []struct{ input, want string }{
+		{"My Budget/Name", "My_Budget_Name"},
+		{"Budget:Special*Chars?", "BudgetSpecialChars"},
+		{"  Leading and Trailing  ", "__Leading_and_Trailing__"},
+		{"Complex-Name_123+()", "Complex-Name_123+()"},
+		{"../../etc", "_.._etc"},
+		{"...hidden", "hidden"},
+		{"Cafe\u0301", "Caf\u00e9"},
+		{"Budget...", "Budget"},
+		{"aux", "aux_"},
+		{"Con.backup", "Con_.backup"},
+		{"LPT1", "LPT1_"},
+		{"Console", "Console"},
+		{strings.Repeat("x", 200), strings.Repeat("x", 111) + "-" + shortHash(strings.Repeat("x", 200))},
+		{strings.Repeat("\u00e9", 100), strings.Repeat("\u00e9", 55) + "-" + shortHash(strings.Repeat("\u00e9", 100))},
+	}
+	for _, tc := range tests {
+		got := SanitizeFileName(tc.input)
+		if got != tc.want {
+			t.Errorf("SanitizeFileName(%q) = %q; want %q", tc.input, got, tc.want)
+		}
+	}
+}
+
+// shortHash is the suffix SanitizeFileName gives a name it cuts
+func shortHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:4])
+}
+
+// TestBuildFilename checks timestamp formatting and filename structure
+func TestBuildFilename(t *testing.T) {
+	b := Budget{
+		ID:             "abc123",
+		Name:           "My Budget",
+		LastModifiedOn: time.Date(2025, time.May, 14, 15, 30, 45, 0, time.UTC),
+	}
+	want := "My_Budget_abc123_20250514T153045Z.json"
+	if got := BuildFilename(b); got != want {
+		t.Errorf("BuildFilename() = %q; want %q", got, want)
+	}
+}
+
+// TestFetchBudgets mocks the YNAB list endpoint to verify parsing
+func TestFetchBudgets(t *testing.T) {
+	// Prepare fake server
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer testtoken" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, err := io.WriteString(w, `{"data":{"budgets":[{"id":"1","name":"A","last_modified_on":"2025-05-14T10:00:00Z"},{"id":"2","name":"B","last_modified_on":"2025-05-14T11:00:00Z"}]}}`)
+		if err != nil {
+			t.Fatalf("writing response: %v", err)
+		}
+	}
+	srv := httptest.NewServer(http.HandlerFunc(handler))
+	defer srv.Close()
+
+	cfg := Config{Token: "testtoken", BaseURL: srv.URL, Client: srv.Client()}
+	list, err := FetchBudgets(t.Context(), cfg)
+	if err != nil {
+		t.Fatalf("FetchBudgets error: %v", err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("expected 2 budgets; got %d", len(list))
+	}
+	if list[0].ID != "1" || list[0].Name != "A" {
+		t.Errorf("first budget mismatch: %+v", list[0])
+	}
+}
+
+// TestDownloadAndSave uses a temp dir and fake budget endpoint
+func TestDownloadAndSave(t *testing.T) {
+	// Fake budget JSON
+	budgetJSON := `{"budget":{"id":"x","name":"X"}}`
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/x") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, err := io.WriteString(w, budgetJSON)
+		if err != nil {
+			t.Fatalf("writing response: %v", err)
+		}
+	}
+	srv := httptest.NewServer(http.HandlerFunc(handler))
+	defer srv.Close()
+
+	// Setup config with temp dir
+	tmpDir := t.TempDir()
+	b := Budget{ID: "x", Name: "X", LastModifiedOn: time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)}
+	cfg := Config{Token: "tok", BaseURL: srv.URL, OutputDir: tmpDir, Client: srv.Client()}
+
+	// Run download
+	path, _, _, err := downloadAndSave(t.Context(), cfg, b, budgetState{})
+	if err != nil {
+		t.Fatalf("downloadAndSave error: %v", err)
+	}
+
+	// Verify file exists
+	files, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf("reading dir: %v", err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("expected 1 file; got %d", len(files))
+	}
+	fname := files[0].Name()
+	// Should contain ID and timestamp
+	if !strings.Contains(fname, "x_") || !strings.HasSuffix(fname, ".json") {
+		t.Errorf("unexpected filename: %s", fname)
+	}
+	// Verify returned path matches
+	if got := filepath.Base(path); got != fname {
+		t.Errorf("returned path %q does not match file %q", got, fname)
+	}
+	// Verify content
+	data, err := os.ReadFile(filepath.Join(tmpDir, fname))
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	if string(data) != budgetJSON {
+		t.Errorf("file content mismatch: %s", data)
+	}
+}
+
+// Optionally, add tests for new helpers if desired
+func TestDecodeBudgets(t *testing.T) {
+	jsonData := []byte(`{"data":{"budgets":[{"id":"1","name":"A","last_modified_on":"2025-05-14T10:00:00Z"}]}}`)
+	budgets, err := decodeBudgets(jsonData)
+	if err != nil {
+		t.Fatalf("decodeBudgets error: %v", err)
+	}
+	if len(budgets) != 1 || budgets[0].ID != "1" {
+		t.Errorf("unexpected decodeBudgets result: %+v", budgets)
+	}
+}
+
+// TestHttpGet verifies proper handling of various HTTP scenarios
+func TestHttpGet(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		body       string
+		wantErr    bool
+	}{
+		{"success", http.StatusOK, "test data", false},
+		{"unauthorized", http.StatusUnauthorized, "", true},
+		{"server error", http.StatusInternalServerError, "", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// Verify auth header is set
+				if r.Header.Get("Authorization") != "Bearer testtoken" {
+					t.Errorf("Expected Authorization header with bearer token")
+				}
+				w.WriteHeader(tc.statusCode)
+				_, err := w.Write([]byte(tc.body))
+				if err != nil {
+					t.Fatalf("writing response: %v", err)
+				}
+			}))
+			defer server.Close()
+
+			data, err := httpGet(t.Context(), server.Client(), server.URL, "testtoken")
+
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+			} else {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				if string(data) != tc.body {
+					t.Errorf("Expected body %q, got %q", tc.body, string(data))
+				}
+			}
+		})
+	}
+}
+
+// TestDecodeBudgetsError verifies error handling with malformed JSON
+func TestDecodeBudgetsError(t *testing.T) {
+	invalidJSON := []byte(`{"data":{"budgets":[{"id":1,"name`)
+	_, err := decodeBudgets(invalidJSON)
+	if err == nil {
+		t.Error("Expected error with invalid JSON but got nil")
+	}
+}
+
+// TestWriteFile verifies file writing functionality
+func TestWriteFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	testPath := filepath.Join(tmpDir, "test.json")
+	testData := []byte(`{"test":"data"}`)
+
+	err := WriteFile(testPath, testData)
+	if err != nil {
+		t.Fatalf("WriteFile error: %v", err)
+	}
+
+	// Verify content was written correctly
+	content, err := os.ReadFile(testPath)
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	if string(content) != string(testData) {
+		t.Errorf("Expected file content %q, got %q", testData, content)
+	}
+
+	// A bare file name lands in, and syncs, the working directory
+	t.Chdir(tmpDir)
+	if err := WriteFile("bare.json", testData); err != nil {
+		t.Errorf("WriteFile in the working directory: %v", err)
+	}
+
+	// Test write error with bad path
+	badPath := filepath.Join(os.DevNull, "impossible.txt")
+	err = WriteFile(badPath, testData)
+	if err == nil {
+		t.Error("Expected error writing to invalid path but got nil")
+	}
+}
+
+// TestDownloadAndSaveError checks error handling in downloadAndSave
+func TestDownloadAndSaveError(t *testing.T) {
+	// Server that always returns an error
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	tmpDir := t.TempDir()
+	b := Budget{ID: "x", Name: "X", LastModifiedOn: time.Now()}
+	cfg := Config{Token: "tok", BaseURL: srv.URL, OutputDir: tmpDir, Client: srv.Client()}
+
+	_, _, _, err := downloadAndSave(t.Context(), cfg, b, budgetState{})
+	if err == nil {
+		t.Error("Expected error from downloadAndSave but got nil")
+	}
+}
+
+// TestFetchBudgetsError verifies error handling in FetchBudgets
+func TestFetchBudgetsError(t *testing.T) {
+	// Server that returns invalid JSON
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write([]byte(`{"data":{"budgets":[{"invalid`)) // Malformed JSON
+		if err != nil {
+			t.Fatalf("writing response: %v", err)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := Config{Token: "testtoken", BaseURL: srv.URL, Client: srv.Client()}
+	_, err := FetchBudgets(t.Context(), cfg)
+	if err == nil {
+		t.Error("Expected error with invalid JSON but got nil")
+	}
+}
+
+// TestRun verifies the main orchestration function
+func TestRun(t *testing.T) {
+	// Mock server that returns a list of budgets and then budget details
+	var requestCount int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount++
+		w.Header().Set("Content-Type", "application/json")
+
+		// First request: budgets list
+		if requestCount == 1 {
+			_, err := io.WriteString(w, `{"data":{"budgets":[{"id":"test1","name":"Budget1","last_modified_on":"2025-01-01T00:00:00Z"}]}}`)
+			if err != nil {
+				t.Fatalf("writing response: %v", err)
+			}
+			return
+		}
+
+		// Budget detail requests
+		_, err := io.WriteString(w, `{"budget":{"name":"Budget1","id":"test1"}}`)
+		if err != nil {
+			t.Fatalf("writing response: %v", err)
+		}
+	}))
+	defer srv.Close()
+
+	tmpDir := t.TempDir()
+	cfg := Config{
+		Token:     "testtoken",
+		BaseURL:   srv.URL,
+		OutputDir: tmpDir,
+		Verbose:   true,
+		Client:    srv.Client(),
+	}
+
+	stats, err := Run(t.Context(), cfg)
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+
+	// Verify count is correct
+	if stats.Budgets != 1 {
+		t.Errorf("Expected to process 1 budget, got %d", stats.Budgets)
+	}
+
+	// Verify file was created
+	if files := snapshotFiles(t, tmpDir); len(files) != 1 {
+		t.Errorf("Expected 1 file in output dir, got %d", len(files))
+	}
+}
+
+// TestRunFetchError verifies Run() returns an error when the
+// initial budget list cannot be fetched.
+func TestRunFetchError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	cfg := Config{
+		Token:     "tok",
+		BaseURL:   srv.URL,
+		OutputDir: t.TempDir(),
+		Client:    srv.Client(),
+	}
+
+	_, err := Run(t.Context(), cfg)
+	if err == nil {
+		t.Fatal("expected error from run but got nil")
+	}
+}
+
+// TestRunMinimalConfig backs up with only a token, an endpoint and a store,
+// as a program embedding the package would
+func TestRunMinimalConfig(t *testing.T) {
+	var auth []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = append(auth, r.Header.Get("Authorization"))
+		if r.URL.Path == "/" {
+			_, _ = io.WriteString(w, `{"data":{"budgets":[{"id":"b1","name":"Home","last_modified_on":"2025-01-01T00:00:00Z"}]}}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"data":{"budget":{"id":"b1"},"server_knowledge":1}}`)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	report, err := Run(t.Context(), Config{Token: "tok", BaseURL: srv.URL, Store: DirStore(dir)})
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if report.Downloaded != 1 || len(report.Results) != 1 || report.Results[0].Path == "" {
+		t.Errorf("report = %+v; want one downloaded budget", report)
+	}
+	if files := snapshotFiles(t, dir); len(files) != 1 || files[0] != "Home_b1_20250101T000000Z.json" {
+		t.Errorf("files = %v; want the Home snapshot", files)
+	}
+	for _, a := range auth {
+		if a != "Bearer tok" {
+			t.Errorf("Authorization = %q; want the token", a)
+		}
+	}
+}
+
+// TestParseResources validates the --resources list
+func TestParseResources(t *testing.T) {
+	got, err := ParseResources(" accounts, ,payees")
+	if err != nil || len(got) != 2 || got[0] != "accounts" || got[1] != "payees" {
+		t.Errorf("ParseResources = %v, %v; want [accounts payees]", got, err)
+	}
+	if got, err := ParseResources(""); err != nil || len(got) != 0 {
+		t.Errorf("ParseResources(\"\") = %v, %v; want empty", got, err)
+	}
+	if _, err := ParseResources("transactions,widgets"); err == nil {
+		t.Error("expected error for unknown resource")
+	}
+}
+
+// TestRunResources saves each requested sub-resource into the budget's subdirectory
+func TestRunResources(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			_, _ = io.WriteString(w, `{"data":{"budgets":[{"id":"b1","name":"My Budget","last_modified_on":"2025-01-01T00:00:00Z"}]}}`)
+		case "/b1":
+			_, _ = io.WriteString(w, `{"data":{"budget":{"id":"b1"}}}`)
+		case "/b1/transactions", "/b1/accounts":
+			_, _ = io.WriteString(w, `{"data":{"`+strings.TrimPrefix(r.URL.Path, "/b1/")+`":[]}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	cfg := Config{Token: "tok", BaseURL: srv.URL, OutputDir: dir, Resources: []string{"accounts", "transactions", "payees"}, Client: srv.Client()}
+	if _, err := Run(t.Context(), cfg); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	sub := filepath.Join(dir, "My_Budget_b1")
+	for _, res := range []string{"accounts", "transactions"} {
+		data, err := os.ReadFile(filepath.Join(sub, res+"_20250101T000000Z.json"))
+		if err != nil {
+			t.Fatalf("%s file missing: %v", res, err)
+		}
+		if want := `{"data":{"` + res + `":[]}}`; string(data) != want {
+			t.Errorf("%s content = %s; want %s", res, data, want)
+		}
+	}
+	// payees failed with 404 and must only be a warning
+	if files := snapshotFiles(t, sub); len(files) != 2 {
+		t.Errorf("expected 2 resource files, got %v", files)
+	}
+}
+
+// TestRunTransactionsSince passes since_date to the transactions resource only
+func TestRunTransactionsSince(t *testing.T) {
+	var mu sync.Mutex
+	queries := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		queries[r.URL.Path] = r.URL.RawQuery
+		mu.Unlock()
+		if r.URL.Path == "/" {
+			_, _ = io.WriteString(w, `{"data":{"budgets":[{"id":"b1","name":"B"}]}}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"data":{}}`)
+	}))
+	defer srv.Close()
+
+	cfg := Config{Token: "tok", BaseURL: srv.URL, OutputDir: t.TempDir(), Resources: []string{"accounts", "transactions"},
+		TransactionsSince: "2024-06-01", Client: srv.Client()}
+	if _, err := Run(t.Context(), cfg); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	want := map[string]string{"/": "", "/b1": "", "/b1/accounts": "", "/b1/transactions": "since_date=2024-06-01"}
+	if !reflect.DeepEqual(queries, want) {
+		t.Errorf("queries = %v; want %v", queries, want)
+	}
+}
+
+// TestRunConcurrency checks that --concurrency bounds parallel downloads
+func TestRunConcurrency(t *testing.T) {
+	for _, tc := range []struct{ limit, wantPeak int32 }{{1, 1}, {3, 3}} {
+		var inFlight, peak atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/" {
+				_, _ = io.WriteString(w, `{"data":{"budgets":[`+
+					`{"id":"1","name":"A","last_modified_on":"2025-01-01T00:00:00Z"},`+
+					`{"id":"2","name":"B","last_modified_on":"2025-01-01T00:00:00Z"},`+
+					`{"id":"3","name":"C","last_modified_on":"2025-01-01T00:00:00Z"},`+
+					`{"id":"4","name":"D","last_modified_on":"2025-01-01T00:00:00Z"}]}}`)
+				return
+			}
+			n := inFlight.Add(1)
+			defer inFlight.Add(-1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(50 * time.Millisecond)
+			_, _ = io.WriteString(w, `{}`)
+		}))
+
+		dir := t.TempDir()
+		cfg := Config{Token: "tok", BaseURL: srv.URL, OutputDir: dir, Concurrency: int(tc.limit), Client: srv.Client()}
+		stats, err := Run(t.Context(), cfg)
+		srv.Close()
+		if err != nil {
+			t.Fatalf("run: %v", err)
+		}
+		if stats.Downloaded != 4 || len(snapshotFiles(t, dir)) != 4 {
+			t.Errorf("limit %d: downloaded %d budgets, %d files", tc.limit, stats.Downloaded, len(snapshotFiles(t, dir)))
+		}
+		if got := peak.Load(); got != tc.wantPeak {
+			t.Errorf("limit %d: peak concurrency %d; want %d", tc.limit, got, tc.wantPeak)
+		}
+	}
+}
+
+// TestRunCancelled verifies a cancelled run aborts in-flight downloads,
+// reports the interruption and leaves no partial snapshot behind
+func TestRunCancelled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			_, _ = io.WriteString(w, `{"data":{"budgets":[{"id":"b1","name":"A","last_modified_on":"2025-01-01T00:00:00Z"}]}}`)
+			return
+		}
+		// Stream part of a body, then stall until the client gives up
+		_, _ = io.WriteString(w, `{"data":`)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	ctx, cancel := context.WithTimeout(t.Context(), 200*time.Millisecond)
+	defer cancel()
+	cfg := Config{Token: "tok", BaseURL: srv.URL, OutputDir: dir, Client: srv.Client()}
+	_, err := Run(ctx, cfg)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("run error = %v; want context.DeadlineExceeded", err)
+	}
+	if files := snapshotFiles(t, dir); len(files) != 0 {
+		t.Errorf("expected no snapshot files after cancellation, got %v", files)
+	}
+}
+
+// TestWriteFileAtomic checks that writes replace the target and leave no temp files
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "snap.json")
+	for _, content := range []string{"first", "second"} {
+		if err := WriteFile(path, []byte(content)); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "second" {
+		t.Fatalf("content = %q, %v; want second", data, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0644 {
+		t.Errorf("permissions = %v; want 0644", perm)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected only the target file, found %d entries", len(entries))
+	}
+}
+
+// TestCleanTempFiles removes orphaned temp files but nothing else
+func TestCleanTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "Budget_b1")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	keep := []string{filepath.Join(dir, "A_1_20250101T000000Z.json"), filepath.Join(dir, StateFileName), filepath.Join(sub, "notes.tmp")}
+	orphans := []string{filepath.Join(dir, ".A_1_20250101T000000Z.json.123"+tempSuffix), filepath.Join(sub, ".accounts_x.json.9"+tempSuffix)}
+	for _, p := range append(keep, orphans...) {
+		if err := os.WriteFile(p, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n, err := cleanTempFiles(dir)
+	if err != nil || n != len(orphans) {
+		t.Fatalf("cleanTempFiles = %d, %v; want %d", n, err, len(orphans))
+	}
+	for _, p := range keep {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("%s was removed: %v", p, err)
+		}
+	}
+	for _, p := range orphans {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s still exists", p)
+		}
+	}
+}
+
+// TestRunSkipsUnchanged only downloads budgets whose last_modified_on moved
+// or that lack a selected resource
+func TestRunSkipsUnchanged(t *testing.T) {
+	modified := "2025-01-01T00:00:00Z"
+	var downloads atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			fmt.Fprintf(w, `{"data":{"budgets":[{"id":"b1","name":"A","last_modified_on":%q},{"id":"b2","name":"B"}]}}`, modified)
+			return
+		}
+		downloads.Add(1)
+		_, _ = io.WriteString(w, `{"data":{"budget":{}}}`)
+	}))
+	defer srv.Close()
+
+	cfg := Config{Token: "tok", BaseURL: srv.URL, OutputDir: t.TempDir(), Client: srv.Client()}
+	tests := []struct {
+		name     string
+		change   func()
+		want     Stats
+		wantGets int32
+	}{
+		{"first run", func() {}, Stats{Budgets: 2, Downloaded: 2}, 2},
+		// b2 has no modification time, so it is always downloaded
+		{"unchanged", func() {}, Stats{Budgets: 2, Downloaded: 1, Skipped: 1}, 1},
+		// A resource the last run did not save is fetched with the budget
+		{"new resource", func() { cfg.Resources = []string{"accounts"} }, Stats{Budgets: 2, Downloaded: 2}, 4},
+		{"resource saved", func() {}, Stats{Budgets: 2, Downloaded: 1, Skipped: 1}, 2},
+		{"resource dropped", func() { cfg.Resources = nil }, Stats{Budgets: 2, Downloaded: 1, Skipped: 1}, 1},
+		{"modified", func() { modified = "2025-01-02T00:00:00Z" }, Stats{Budgets: 2, Downloaded: 2}, 2},
+		{"forced", func() { cfg.Force = true }, Stats{Budgets: 2, Downloaded: 2}, 2},
+	}
+	for _, tc := range tests {
+		tc.change()
+		downloads.Store(0)
+		stats, err := Run(t.Context(), cfg)
+		if err != nil {
+			t.Fatalf("%s: run: %v", tc.name, err)
+		}
+		if stats.Stats != tc.want || downloads.Load() != tc.wantGets {
+			t.Errorf("%s: stats %+v with %d downloads; want %+v with %d", tc.name, stats, downloads.Load(), tc.want, tc.wantGets)
+		}
+	}
+}
+
+// TestFilterBudgets matches name globs case-insensitively and IDs exactly
+func TestFilterBudgets(t *testing.T) {
+	budgets := []Budget{{ID: "b1", Name: "Home"}, {ID: "b2", Name: "Shared - Bob"}, {ID: "b3", Name: "Shared - Ann"}}
+	tests := []struct {
+		name             string
+		include, exclude []string
+		want             []string
+	}{
+		{"no filter", nil, nil, []string{"b1", "b2", "b3"}},
+		{"glob", []string{"shared*"}, nil, []string{"b2", "b3"}},
+		{"id and name", []string{"b1", "Shared - Ann"}, nil, []string{"b1", "b3"}},
+		{"exclude", nil, []string{"*bob"}, []string{"b1", "b3"}},
+		{"include and exclude", []string{"Shared*"}, []string{"b3"}, []string{"b2"}},
+		{"no match", []string{"Work"}, nil, nil},
+	}
+	for _, tc := range tests {
+		var got []string
+		for _, b := range filterBudgets(budgets, tc.include, tc.exclude) {
+			got = append(got, b.ID)
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%s: filterBudgets = %v; want %v", tc.name, got, tc.want)
+		}
+	}
+	if err := CheckBudgetPatterns([]string{"Home", "[bad"}); err == nil {
+		t.Error("CheckBudgetPatterns accepted a malformed glob")
+	}
+}
+
+// TestRunBudgetFilter only downloads the selected budgets
+func TestRunBudgetFilter(t *testing.T) {
+	var downloads atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			_, _ = io.WriteString(w, `{"data":{"budgets":[{"id":"b1","name":"Home"},{"id":"b2","name":"Shared"}]}}`)
+			return
+		}
+		downloads.Add(1)
+		_, _ = io.WriteString(w, `{"data":{"budget":{}}}`)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	cfg := Config{Token: "tok", BaseURL: srv.URL, OutputDir: dir, Client: srv.Client(), ExcludeBudgets: []string{"shared"}}
+	stats, err := Run(t.Context(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Stats{Budgets: 1, Downloaded: 1}); stats.Stats != want || downloads.Load() != 1 {
+		t.Errorf("stats %+v with %d downloads; want %+v with 1", stats, downloads.Load(), want)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "Shared_*")); len(matches) > 0 {
+		t.Errorf("excluded budget was saved: %v", matches)
+	}
+}
+
+// TestRunReport records the outcome of each budget
+func TestRunReport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			_, _ = io.WriteString(w, `{"data":{"budgets":[{"id":"b1","name":"Home"},{"id":"b2","name":"Broken"}]}}`)
+		case "/b1":
+			_, _ = io.WriteString(w, `{"data":{"budget":{"id":"b1"}}}`)
+		default:
+			http.Error(w, "boom", http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := Config{Token: "tok", BaseURL: srv.URL, OutputDir: t.TempDir(), Client: srv.Client()}
+	report, err := Run(t.Context(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Results) != 2 {
+		t.Fatalf("got %d results; want 2", len(report.Results))
+	}
+	byID := map[string]BudgetReport{}
+	for _, r := range report.Results {
+		byID[r.ID] = r
+	}
+	if ok := byID["b1"]; ok.Status != "downloaded" || ok.Path == "" || ok.Bytes == 0 || len(ok.Errors) != 0 {
+		t.Errorf("saved budget report = %+v", ok)
+	}
+	if failed := byID["b2"]; failed.Status != "failed" || failed.Path != "" || len(failed.Errors) == 0 {
+		t.Errorf("failed budget report = %+v", failed)
+	}
+	if report.Downloaded != 1 || report.Failed != 1 {
+		t.Errorf("stats = %+v; want 1 downloaded and 1 failed", report.Stats)
+	}
+}
+
+// TestRunStrictAndFailFast turns budget failures into a run error
+func TestRunStrictAndFailFast(t *testing.T) {
+	tests := []struct {
+		name          string
+		strict        bool
+		failFast      bool
+		wantErr       bool
+		wantDownloads []string
+	}{
+		{"lenient", false, false, false, []string{"/b1", "/b2", "/b3"}},
+		{"strict", true, false, true, []string{"/b1", "/b2", "/b3"}},
+		{"fail fast", false, true, true, []string{"/b1", "/b2"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var downloads []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/" {
+					_, _ = io.WriteString(w, `{"data":{"budgets":[{"id":"b1","name":"A"},{"id":"b2","name":"Broken"},{"id":"b3","name":"C"}]}}`)
+					return
+				}
+				mu.Lock()
+				downloads = append(downloads, r.URL.Path)
+				mu.Unlock()
+				if r.URL.Path == "/b2" {
+					http.Error(w, "nope", http.StatusUnauthorized)
+					return
+				}
+				_, _ = io.WriteString(w, `{"data":{"budget":{}}}`)
+			}))
+			defer srv.Close()
+
+			cfg := Config{Token: "tok", BaseURL: srv.URL, OutputDir: t.TempDir(), Client: srv.Client(),
+				Strict: tc.strict, FailFast: tc.failFast}
+			report, err := Run(t.Context(), cfg)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Run() error = %v; want error %v", err, tc.wantErr)
+			}
+			if err != nil {
+				if !strings.Contains(err.Error(), "Broken (b2)") || !errors.Is(err, ErrUnauthorized) {
+					t.Errorf("error %q does not name the failed budget and its cause", err)
+				}
+			}
+			if !slices.Equal(downloads, tc.wantDownloads) {
+				t.Errorf("downloads = %v; want %v", downloads, tc.wantDownloads)
+			}
+			if report.Failed != 1+len(report.Results)-len(tc.wantDownloads) {
+				t.Errorf("failed = %d; want the broken budget and every one not attempted", report.Failed)
+			}
+		})
+	}
+}
+
+// snapshotFiles lists the budget files in dir, skipping hidden bookkeeping files
+func snapshotFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Error reading output dir: %v", err)
+	}
+	var names []string
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), ".") {
+			names = append(names, e.Name())
+		}
+	}
+	return names
+}
+
+// TestBudgetsURL derives the budgets endpoint from an API host
+func TestBudgetsURL(t *testing.T) {
+	tests := []struct {
+		host, want string
+	}{
+		{DefaultAPIHost, DefaultBaseURL},
+		{"http://localhost:8080", "http://localhost:8080/v1/budgets"},
+		{"https://proxy.example/ynab/", "https://proxy.example/ynab/v1/budgets"},
+		{"localhost:8080", ""},
+		{"ftp://example.com", ""},
+		{"https://example.com?x=1", ""},
+	}
+	for _, tc := range tests {
+		got, err := BudgetsURL(tc.host)
+		if tc.want == "" {
+			if err == nil {
+				t.Errorf("BudgetsURL(%q) = %q; want an error", tc.host, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("BudgetsURL(%q) = %q, %v; want %q", tc.host, got, err, tc.want)
+		}
+	}
+}
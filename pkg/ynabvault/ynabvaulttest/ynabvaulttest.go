@@ -0,0 +1,138 @@
+// Package ynabvaulttest provides in-memory fakes of the ynabvault
+// interfaces, so programs built on the package can test their integration
+// without the YNAB API or a disk
+package ynabvaulttest
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// API is an in-memory ynabvault.API serving the budgets added to it. It is
+// safe for concurrent use.
+type API struct {
+	mu      sync.Mutex
+	budgets []ynabvault.Budget
+	exports map[string][]byte
+}
+
+// NewAPI returns an API without budgets
+func NewAPI() *API {
+	return &API{exports: map[string][]byte{}}
+}
+
+// Add serves b with export as its full export, replacing a budget with the
+// same ID
+func (a *API) Add(b ynabvault.Budget, export []byte) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.budgets = slices.DeleteFunc(a.budgets, func(old ynabvault.Budget) bool { return old.ID == b.ID })
+	a.budgets = append(a.budgets, b)
+	a.exports[b.ID] = slices.Clone(export)
+}
+
+// Budgets lists the added budgets in the order they were added
+func (a *API) Budgets(ctx context.Context) ([]ynabvault.Budget, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return slices.Clone(a.budgets), nil
+}
+
+// Budget returns the export added for id; an unknown id yields an error
+// wrapping ynabvault.ErrNotFound, as the API's 404 does
+func (a *API) Budget(ctx context.Context, id string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	export, ok := a.exports[id]
+	if !ok {
+		return nil, fmt.Errorf("budget %s: %w", id, ynabvault.ErrNotFound)
+	}
+	return slices.Clone(export), nil
+}
+
+// Store is an in-memory ynabvault.Store. It is safe for concurrent use, so
+// a Runner with several workers can write to it.
+type Store struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+// NewStore returns an empty store
+func NewStore() *Store {
+	return &Store{files: map[string][]byte{}}
+}
+
+// Put creates or replaces name with a copy of data
+func (s *Store) Put(ctx context.Context, name string, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[name] = slices.Clone(data)
+	return nil
+}
+
+// Get returns a copy of name; a missing name yields an error wrapping
+// fs.ErrNotExist
+func (s *Store) Get(ctx context.Context, name string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.files[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", s.Location(name), fs.ErrNotExist)
+	}
+	return slices.Clone(data), nil
+}
+
+// List returns every name under prefix in lexical order
+func (s *Store) List(ctx context.Context, prefix string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var names []string
+	for _, name := range slices.Sorted(maps.Keys(s.files)) {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// Delete removes name; a missing name yields an error wrapping
+// fs.ErrNotExist, as it does for a DirStore
+func (s *Store) Delete(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.files[name]; !ok {
+		return fmt.Errorf("%s: %w", s.Location(name), fs.ErrNotExist)
+	}
+	delete(s.files, name)
+	return nil
+}
+
+// Location names name as "mem://" and the name, for messages
+func (s *Store) Location(name string) string {
+	return "mem://" + name
+}
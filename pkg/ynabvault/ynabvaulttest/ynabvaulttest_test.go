@@ -0,0 +1,95 @@
+package ynabvaulttest
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// TestAPI serves the added budgets and fails like the API for others
+func TestAPI(t *testing.T) {
+	var api ynabvault.API = NewAPI()
+	fake := api.(*API)
+	home := ynabvault.Budget{ID: "b1", Name: "Home", LastModifiedOn: time.Date(2025, 5, 14, 10, 0, 0, 0, time.UTC)}
+	fake.Add(home, []byte(`{"old":true}`))
+	fake.Add(home, []byte(`{"data":{}}`))
+	fake.Add(ynabvault.Budget{ID: "b2", Name: "Work"}, []byte(`{}`))
+
+	budgets, err := api.Budgets(t.Context())
+	if err != nil || len(budgets) != 2 || budgets[0] != home || budgets[1].ID != "b2" {
+		t.Fatalf("Budgets = %+v, %v", budgets, err)
+	}
+	export, err := api.Budget(t.Context(), "b1")
+	if err != nil || string(export) != `{"data":{}}` {
+		t.Errorf("Budget(b1) = %s, %v", export, err)
+	}
+	export[0] = 'x'
+	if again, _ := api.Budget(t.Context(), "b1"); string(again) != `{"data":{}}` {
+		t.Errorf("changing a returned export changed the fake: %s", again)
+	}
+	if _, err := api.Budget(t.Context(), "nope"); !errors.Is(err, ynabvault.ErrNotFound) {
+		t.Errorf("Budget(nope) = %v; want ErrNotFound", err)
+	}
+}
+
+// TestStore behaves like a DirStore, in memory
+func TestStore(t *testing.T) {
+	ctx := t.Context()
+	var store ynabvault.Store = NewStore()
+	for _, name := range []string{"b.json", "A_1/accounts.json", "A_1.json"} {
+		if err := store.Put(ctx, name, []byte(name)); err != nil {
+			t.Fatalf("Put(%s): %v", name, err)
+		}
+	}
+	if names, err := store.List(ctx, ""); err != nil || !slices.Equal(names, []string{"A_1.json", "A_1/accounts.json", "b.json"}) {
+		t.Errorf("List = %v, %v", names, err)
+	}
+	if names, _ := store.List(ctx, "A_1/"); !slices.Equal(names, []string{"A_1/accounts.json"}) {
+		t.Errorf("List(A_1/) = %v", names)
+	}
+	if got, err := store.Get(ctx, "b.json"); err != nil || string(got) != "b.json" {
+		t.Errorf("Get = %q, %v", got, err)
+	}
+	if err := store.Delete(ctx, "b.json"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get(ctx, "b.json"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Get after Delete = %v; want fs.ErrNotExist", err)
+	}
+	if err := store.Delete(ctx, "b.json"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("second Delete = %v; want fs.ErrNotExist", err)
+	}
+}
+
+// TestStoreRunner backs up into the fake store without touching the disk
+func TestStoreRunner(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			_, _ = io.WriteString(w, `{"data":{"budgets":[{"id":"b1","name":"Home","last_modified_on":"2025-05-14T10:00:00Z"}]}}`)
+		case "/b1":
+			_, _ = io.WriteString(w, `{"data":{"budget":{"id":"b1","name":"Home"},"server_knowledge":1}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	store := NewStore()
+	client := ynabvault.NewClient("tok", ynabvault.WithBaseURL(srv.URL), ynabvault.WithHTTPClient(srv.Client()))
+	report, err := ynabvault.NewRunner(client, store, ynabvault.WithStrict()).Run(t.Context())
+	if err != nil || report.Downloaded != 1 {
+		t.Fatalf("Run = %+v, %v", report, err)
+	}
+	names, _ := store.List(t.Context(), "Home_b1_")
+	if len(names) != 1 {
+		t.Errorf("snapshots in the store = %v; want one", names)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// proxyConfig is the proxy config key: a proxy per kind of traffic, so the
+// YNAB API and the vault can go through different tunnels. An empty target
+// keeps the default, which honours HTTPS_PROXY for HTTP traffic.
+type proxyConfig struct {
+	API     string `yaml:"api"`     // YNAB API requests
+	Storage string `yaml:"storage"` // S3 and SFTP vaults
+	Notify  string `yaml:"notify"`  // --notify-url webhooks
+}
+
+// parseProxy parses a proxy URL; an empty string yields nil
+func parseProxy(target, s string) (*url.URL, error) {
+	if s == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("proxy %s: %q is not a URL such as socks5://127.0.0.1:1080", target, s)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+		return u, nil
+	}
+	return nil, fmt.Errorf("proxy %s: unsupported scheme %q, want http, https, socks5 or socks5h", target, u.Scheme)
+}
+
+// check validates every target
+func (p proxyConfig) check() error {
+	for _, t := range []struct{ name, url string }{{"api", p.API}, {"storage", p.Storage}, {"notify", p.Notify}} {
+		if _, err := parseProxy(t.name, t.url); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// merge overrides the targets other sets
+func (p *proxyConfig) merge(other proxyConfig) {
+	if other.API != "" {
+		p.API = other.API
+	}
+	if other.Storage != "" {
+		p.Storage = other.Storage
+	}
+	if other.Notify != "" {
+		p.Notify = other.Notify
+	}
+}
+
+// proxyTransport returns http.DefaultTransport, or a copy of it sending
+// everything through the proxy at s; s must have passed check
+func proxyTransport(target, s string) http.RoundTripper {
+	u, err := parseProxy(target, s)
+	if err != nil || u == nil {
+		return http.DefaultTransport
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = http.ProxyURL(u)
+	return t
+}
+
+// storeOptions returns the options for opening the vault
+func (p proxyConfig) storeOptions() (ynabvault.StoreOptions, error) {
+	u, err := parseProxy("storage", p.Storage)
+	return ynabvault.StoreOptions{Proxy: u}, err
+}
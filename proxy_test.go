@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestParseProxy accepts HTTP and SOCKS5 proxy URLs
+func TestParseProxy(t *testing.T) {
+	tests := []struct {
+		in      string
+		wantNil bool
+		wantErr string
+	}{
+		{"", true, ""},
+		{"http://proxy.corp:3128", false, ""},
+		{"socks5h://user:pw@127.0.0.1:1080", false, ""},
+		{"ftp://proxy.corp", false, "unsupported scheme"},
+		{"127.0.0.1:1080", false, "not a URL"},
+	}
+	for _, tc := range tests {
+		u, err := parseProxy("api", tc.in)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("parseProxy(%q) error = %v; want %q", tc.in, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil || (u == nil) != tc.wantNil {
+			t.Errorf("parseProxy(%q) = %v, %v", tc.in, u, err)
+		}
+	}
+}
+
+// TestRunCLIBackupProxy sends API requests through the api proxy and
+// rejects a malformed proxy before any request
+func TestRunCLIBackupProxy(t *testing.T) {
+	var hosts []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts = append(hosts, r.URL.Host)
+		_, _ = io.WriteString(w, `{"data":{"budgets":[]}}`)
+	}))
+	defer proxy.Close()
+
+	cfg := writeConfig(t, t.TempDir(), "proxy:\n  api: "+proxy.URL+"\n")
+	var stderr bytes.Buffer
+	args := []string{"backup", "--token", "tok", "--config", cfg, "--api-host", "http://ynab.invalid", "--output", t.TempDir()}
+	if code := runCLI(args, io.Discard, &stderr); code != 0 {
+		t.Fatalf("backup exit code = %d; stderr: %s", code, stderr.String())
+	}
+	if len(hosts) != 1 || hosts[0] != "ynab.invalid" {
+		t.Errorf("proxy saw requests for %v; want [ynab.invalid]", hosts)
+	}
+
+	cfg = writeConfig(t, t.TempDir(), "proxy:\n  storage: ftp://proxy.corp\n")
+	args = []string{"backup", "--token", "tok", "--config", cfg, "--output", t.TempDir()}
+	if code := runCLI(args, io.Discard, io.Discard); code != 2 {
+		t.Errorf("backup with a bad proxy exit code = %d; want 2", code)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// retention is a keep-N-per-period schedule in the style of restic and borg
+type retention struct {
+	Daily   int
+	Weekly  int
+	Monthly int
+}
+
+// register adds the --keep-* flags to fs
+func (r *retention) register(fs *flag.FlagSet) {
+	fs.IntVar(&r.Daily, "keep-daily", 0, "Keep the newest snapshot of each of the last N days per budget")
+	fs.IntVar(&r.Weekly, "keep-weekly", 0, "Keep the newest snapshot of each of the last N weeks per budget")
+	fs.IntVar(&r.Monthly, "keep-monthly", 0, "Keep the newest snapshot of each of the last N months per budget")
+}
+
+// enabled reports whether any period is kept; pruning without a schedule
+// would delete everything
+func (r retention) enabled() bool {
+	return r.Daily > 0 || r.Weekly > 0 || r.Monthly > 0
+}
+
+// keep selects the snapshots the schedule retains. Per budget and period,
+// the newest snapshot of each of the last N days, ISO weeks or months is
+// kept; the newest snapshot of every budget is always kept.
+func (r retention) keep(snaps []snapshotInfo) map[string]bool {
+	byID := map[string][]snapshotInfo{}
+	for _, s := range snaps {
+		byID[s.ID] = append(byID[s.ID], s)
+	}
+	periods := []struct {
+		n      int
+		bucket func(t time.Time) string
+	}{
+		{r.Daily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{r.Weekly, func(t time.Time) string { y, w := t.ISOWeek(); return fmt.Sprintf("%d-W%02d", y, w) }},
+		{r.Monthly, func(t time.Time) string { return t.Format("2006-01") }},
+	}
+	kept := map[string]bool{}
+	for _, list := range byID {
+		sort.Slice(list, func(a, b int) bool { return list[a].Time.After(list[b].Time) })
+		kept[list[0].File] = true
+		for _, p := range periods {
+			seen := map[string]bool{}
+			for _, s := range list {
+				if len(seen) >= p.n {
+					break
+				}
+				if b := p.bucket(s.Time.UTC()); !seen[b] {
+					seen[b] = true
+					kept[s.File] = true
+				}
+			}
+		}
+	}
+	return kept
+}
+
+// pruneSnapshots deletes the snapshots not in keep together with the
+// sub-resource files saved alongside them, and returns what was (or, on a
+// dry run, would be) removed. Pins of deleted files are dropped from the
+// manifest.
+func pruneSnapshots(ctx context.Context, store ynabvault.Store, snaps []snapshotInfo, keep map[string]bool, dryRun bool) ([]string, error) {
+	var removed []string
+	for _, s := range snaps {
+		if keep[s.File] {
+			continue
+		}
+		resources, err := snapshotResources(ctx, store, s)
+		if err != nil {
+			return removed, err
+		}
+		for _, name := range append([]string{s.File}, resources...) {
+			if !dryRun {
+				if err := store.Delete(ctx, name); err != nil {
+					return removed, fmt.Errorf("delete %s: %w: %w", name, ynabvault.ErrBackend, err)
+				}
+			}
+			removed = append(removed, name)
+		}
+	}
+	if dryRun || len(removed) == 0 {
+		return removed, nil
+	}
+	m, err := ynabvault.LoadManifest(ctx, store)
+	if err != nil {
+		return removed, err
+	}
+	m.Remove(removed...)
+	return removed, m.Save(ctx, store)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// snapshotsAt builds one budget's snapshot infos at the given times
+func snapshotsAt(id string, times ...time.Time) []snapshotInfo {
+	var out []snapshotInfo
+	for _, ts := range times {
+		out = append(out, snapshotInfo{Name: "B", ID: id, Time: ts, File: "B_" + id + "_" + ts.Format(ynabvault.TimeFormat) + ".json"})
+	}
+	return out
+}
+
+// keptTimes returns the kept snapshots' dates, oldest first
+func keptTimes(snaps []snapshotInfo, kept map[string]bool) []string {
+	var out []string
+	for _, s := range snaps {
+		if kept[s.File] {
+			out = append(out, s.Time.Format("2006-01-02T15"))
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// TestRetentionKeep applies daily, weekly and monthly schedules
+func TestRetentionKeep(t *testing.T) {
+	day := func(m time.Month, d, h int) time.Time { return time.Date(2025, m, d, h, 0, 0, 0, time.UTC) }
+	snaps := snapshotsAt("b1",
+		day(1, 15, 10), day(2, 10, 10), day(2, 20, 10),
+		day(3, 3, 10), day(3, 4, 10), day(3, 5, 8), day(3, 5, 20),
+	)
+	tests := []struct {
+		name string
+		r    retention
+		want []string
+	}{
+		{"daily", retention{Daily: 2}, []string{"2025-03-04T10", "2025-03-05T20"}},
+		{"weekly", retention{Weekly: 2}, []string{"2025-02-20T10", "2025-03-05T20"}},
+		{"monthly", retention{Monthly: 3}, []string{"2025-01-15T10", "2025-02-20T10", "2025-03-05T20"}},
+		{"combined", retention{Daily: 1, Monthly: 2}, []string{"2025-02-20T10", "2025-03-05T20"}},
+		{"newest always kept", retention{Daily: 0}, []string{"2025-03-05T20"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := keptTimes(snaps, tc.r.keep(snaps))
+			if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("kept %v; want %v", got, tc.want)
+			}
+		})
+	}
+
+	// Budgets are scheduled independently
+	both := append(snapshotsAt("b2", day(1, 1, 0)), snaps...)
+	if kept := (retention{Daily: 1}).keep(both); !kept[both[0].File] {
+		t.Error("the only snapshot of another budget was not kept")
+	}
+}
+
+// TestPruneCommand previews and then deletes snapshots and their sub-resources
+func TestPruneCommand(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{
+		"B_b1_20250101T000000Z.json",
+		"B_b1_20250102T000000Z.json",
+		"B_b1_20250103T000000Z.json",
+		"B_b1/accounts_20250101T000000Z.json",
+		"B_b1/accounts_20250103T000000Z.json",
+		ynabvault.StateFileName,
+		"B_2025-01-01.json", // named by a template the catalog does not know
+	}
+	for _, f := range files {
+		p := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stdout bytes.Buffer
+	if code := runCLI([]string{"prune", "--output", dir, "--keep-daily", "2", "--dry-run"}, &stdout, io.Discard); code != 0 {
+		t.Fatalf("dry run exit code = %d", code)
+	}
+	if !strings.Contains(stdout.String(), "would remove B_b1/accounts_20250101T000000Z.json") {
+		t.Errorf("dry run output:\n%s", stdout.String())
+	}
+	if got := snapshotFiles(t, dir); len(got) != 5 {
+		t.Fatalf("dry run deleted files: %v", got)
+	}
+
+	stdout.Reset()
+	var stderr bytes.Buffer
+	if code := runCLI([]string{"prune", "--output", dir, "--keep-daily", "2"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("prune exit code = %d", code)
+	}
+	if !strings.Contains(stderr.String(), "B_2025-01-01.json") {
+		t.Errorf("prune did not warn about the unrecognized file:\n%s", stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "Kept 2 of 3 snapshots, removed 2 files") {
+		t.Errorf("prune output:\n%s", stdout.String())
+	}
+	for _, gone := range []string{files[0], files[3]} {
+		if _, err := os.Stat(filepath.Join(dir, gone)); !os.IsNotExist(err) {
+			t.Errorf("%s was not removed", gone)
+		}
+	}
+	for _, kept := range []string{files[1], files[2], files[4], files[5], files[6]} {
+		if _, err := os.Stat(filepath.Join(dir, kept)); err != nil {
+			t.Errorf("%s was removed: %v", kept, err)
+		}
+	}
+
+	if code := runCLI([]string{"prune", "--output", dir}, io.Discard, io.Discard); code != 2 {
+		t.Errorf("prune without a schedule exit code = %d; want 2", code)
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"filippo.io/age"
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// budgetReport answers basic questions about a snapshot: what the accounts
+// hold, and where each month's money came from and went
+type budgetReport struct {
+	Budget      string          `json:"budget"`
+	Snapshot    string          `json:"snapshot"`
+	TakenAt     string          `json:"taken_at"`
+	Currency    string          `json:"currency"`
+	Accounts    []reportAccount `json:"accounts"`
+	Assets      dataAmount      `json:"assets"`
+	Liabilities dataAmount      `json:"liabilities"`
+	NetWorth    dataAmount      `json:"net_worth"`
+	Months      []reportMonth   `json:"months"`
+
+	digits  int
+	rollups bool
+}
+
+// reportAccount is an open account's balance
+type reportAccount struct {
+	Name     string     `json:"name"`
+	Type     string     `json:"type"`
+	OnBudget bool       `json:"on_budget"`
+	Balance  dataAmount `json:"balance"`
+}
+
+// reportMonth is a month's income, spending and spending per category group
+type reportMonth struct {
+	Month  string        `json:"month"`
+	Income dataAmount    `json:"income"`
+	Spent  dataAmount    `json:"spent"`
+	Net    dataAmount    `json:"net"`
+	Groups []reportGroup `json:"groups"`
+}
+
+// reportGroup is what a category group spent in a month, net of refunds
+type reportGroup struct {
+	Name   string     `json:"name"`
+	Rollup string     `json:"rollup,omitempty"`
+	Spent  dataAmount `json:"spent"`
+}
+
+// cmdReport implements "ynabvault report"
+func cmdReport(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var common commonFlags
+	common.register(fs)
+	var conf configFlags
+	conf.register(fs)
+	output := fs.String("output", "budgets", "Directory, s3://bucket/prefix or sftp://user@host/path holding budget JSON files")
+	identity := fs.String("identity", "", "age identity file for encrypted snapshots")
+	budget := fs.String("budget", "", "Report on this budget (name or ID): its newest snapshot, or all of them with --trend")
+	format := fs.String("format", "table", "Output format: table, csv or json")
+	months := fs.Int("months", 12, "Show this many of the latest months, or 0 for all")
+	trend := fs.Bool("trend", false, "Follow net worth and category balances across every snapshot of the budget")
+	if ok, code := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	l := newLocalizer(common.lang)
+	if fs.NArg() > 1 || (fs.NArg() == 1 && (*budget != "" || *trend)) || *months < 0 {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), "usage: ynabvault report [--budget NAME] [--trend] [--format table|csv|json] [--months N] [SNAPSHOT.json]")
+		return 2
+	}
+	if !slices.Contains([]string{"table", "csv", "json"}, *format) {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), fmt.Sprintf("unknown report format %q; want table, csv or json", *format))
+		return 2
+	}
+	store, _, err := conf.store(fs, *output, common.network)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 2
+	}
+	settings, err := conf.settings()
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 2
+	}
+	rollup, err := newRollups(settings.Rollups)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 2
+	}
+	var ids []age.Identity
+	if *identity != "" {
+		if ids, err = ynabvault.LoadIdentities(*identity); err != nil {
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+			return 2
+		}
+	}
+
+	ctx, stop := common.context()
+	defer stop()
+	names := fs.Args()
+	if len(names) == 0 {
+		snaps, err := listSnapshots(ctx, store)
+		if err != nil {
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+			return exitCode(err)
+		}
+		selected := selectExportSnapshots(snaps, *budget, *trend)
+		var budgets []string
+		for _, s := range selected {
+			if b := s.Name + " (" + s.ID + ")"; !slices.Contains(budgets, b) {
+				budgets = append(budgets, b)
+			}
+		}
+		switch {
+		case len(selected) == 0 && *budget != "":
+			err := fmt.Errorf("%w: no snapshots of budget %q", ynabvault.ErrNotFound, *budget)
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+			return exitCode(err)
+		case len(selected) == 0:
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), "no snapshots to report on")
+			return 1
+		case len(budgets) > 1:
+			fmt.Fprintln(stderr, l.T(msgErrorPrefix), "the vault holds several budgets; pick one with --budget:", strings.Join(budgets, ", "))
+			return 2
+		}
+		// With --trend, --months keeps the snapshots taken in the latest
+		// months, counted back from the newest
+		since := selected[len(selected)-1].Time.AddDate(0, -*months, 0)
+		for _, s := range selected {
+			if *months == 0 || !s.Time.Before(since) {
+				names = append(names, s.File)
+			}
+		}
+	}
+	snaps, err := loadExportSnapshots(ctx, store, names, ids)
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return exitCode(err)
+	}
+
+	var report interface {
+		print(w io.Writer, l Localizer)
+		rows() [][]string
+	}
+	if *trend {
+		report = buildTrend(snaps, rollup)
+	} else {
+		report = buildReport(snaps[0], rollup, *months)
+	}
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(stdout)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	case "csv":
+		err = csv.NewWriter(stdout).WriteAll(report.rows())
+	default:
+		tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+		report.print(tw, l)
+		err = tw.Flush()
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, l.T(msgErrorPrefix), err)
+		return 1
+	}
+	return 0
+}
+
+// buildReport reports on a snapshot: the balance of each open account, and
+// for the latest months (all of them when months is 0) the income, the
+// spending and the spending per category group, with the same rules as
+// the sankey export
+func buildReport(s exportSnapshot, r rollups, months int) budgetReport {
+	f := budgetCurrency(s.Budget)
+	out := budgetReport{
+		Budget:   cmp.Or(stringField(s.Budget, "name"), s.Info.Name),
+		Snapshot: s.Info.File,
+		TakenAt:  s.Info.Time.UTC().Format("2006-01-02T15:04:05Z"),
+		Currency: f.ISOCode,
+		Accounts: []reportAccount{},
+		Months:   []reportMonth{},
+		digits:   f.DecimalDigits,
+		rollups:  len(r) > 0,
+	}
+	for _, a := range entitiesByID(s.Budget["accounts"]) {
+		if a["closed"] == true {
+			continue
+		}
+		out.Accounts = append(out.Accounts, reportAccount{
+			Name:     stringField(a, "name"),
+			Type:     stringField(a, "type"),
+			OnBudget: a["on_budget"] == true,
+			Balance:  dataAmount(milliunits(a["balance"])),
+		})
+	}
+	slices.SortFunc(out.Accounts, func(a, b reportAccount) int { return cmp.Compare(a.Name, b.Name) })
+	assets, liabilities := netWorth(s.Budget)
+	out.Assets, out.Liabilities, out.NetWorth = dataAmount(assets), dataAmount(liabilities), dataAmount(assets-liabilities)
+
+	categories := entitiesByID(s.Budget["categories"])
+	groups := entitiesByID(s.Budget["category_groups"])
+	income, spending := monthlyActivity(s.Budget)
+	keys := sortedKeys(income)
+	if months > 0 && len(keys) > months {
+		keys = keys[len(keys)-months:]
+	}
+	for _, month := range keys {
+		m := reportMonth{Month: month, Groups: []reportGroup{}}
+		for _, amount := range income[month] {
+			m.Income += dataAmount(amount)
+		}
+		byGroup := map[string]int64{}
+		for id, amount := range spending[month] {
+			group := "Uncategorized"
+			if _, ok := categories[id]; ok {
+				group = categoryGroup(categories, groups, id)
+			}
+			byGroup[group] += amount
+		}
+		for _, group := range sortedKeys(byGroup) {
+			m.Groups = append(m.Groups, reportGroup{Name: group, Rollup: r.of(group), Spent: dataAmount(byGroup[group])})
+			m.Spent += dataAmount(byGroup[group])
+		}
+		m.Net = m.Income - m.Spent
+		out.Months = append(out.Months, m)
+	}
+	return out
+}
+
+// print writes the report as three tables: net worth, spending per group
+// and the monthly summary
+func (b budgetReport) print(w io.Writer, l Localizer) {
+	amount := func(a dataAmount) string { return fixedAmount(int64(a), b.digits) }
+	fmt.Fprintf(w, "%s\n\n", l.T(msgReportTitle, b.Budget, b.TakenAt, b.Snapshot))
+	fmt.Fprintln(w, l.columns(msgColAccount, msgColType, msgColBalance))
+	for _, a := range b.Accounts {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", a.Name, a.Type, amount(a.Balance))
+	}
+	fmt.Fprintf(w, "%s\t\t%s\n", l.T(msgReportAssets), amount(b.Assets))
+	fmt.Fprintf(w, "%s\t\t%s\n", l.T(msgReportLiabilities), amount(-b.Liabilities))
+	fmt.Fprintf(w, "%s\t\t%s\n", l.T(msgReportNetWorth), amount(b.NetWorth))
+	if len(b.Months) == 0 {
+		return
+	}
+	fmt.Fprintln(w)
+	if b.rollups {
+		fmt.Fprintln(w, l.columns(msgColMonth, msgColGroup, msgColRollup, msgColSpent))
+	} else {
+		fmt.Fprintln(w, l.columns(msgColMonth, msgColGroup, msgColSpent))
+	}
+	for _, m := range b.Months {
+		for _, g := range m.Groups {
+			if b.rollups {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", m.Month, g.Name, g.Rollup, amount(g.Spent))
+			} else {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", m.Month, g.Name, amount(g.Spent))
+			}
+		}
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, l.columns(msgColMonth, msgColIncome, msgColSpent, msgColNet))
+	for _, m := range b.Months {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", m.Month, amount(m.Income), amount(m.Spent), amount(m.Net))
+	}
+}
+
+// rows lays the report out as one CSV table: a row per account balance,
+// per month and category group, and per month for income, spent and net.
+// The Rollup column is only there when rollups are configured.
+func (b budgetReport) rows() [][]string {
+	row := func(report, month, name, rollup string, a dataAmount) []string {
+		if b.rollups {
+			return []string{report, month, name, rollup, fixedAmount(int64(a), 2)}
+		}
+		return []string{report, month, name, fixedAmount(int64(a), 2)}
+	}
+	header := []string{"Report", "Month", "Name", "Amount"}
+	if b.rollups {
+		header = []string{"Report", "Month", "Name", "Rollup", "Amount"}
+	}
+	out := [][]string{header}
+	for _, a := range b.Accounts {
+		out = append(out, row("balance", "", a.Name, "", a.Balance))
+	}
+	for _, m := range b.Months {
+		for _, g := range m.Groups {
+			out = append(out, row("spending", m.Month, g.Name, g.Rollup, g.Spent))
+		}
+	}
+	for _, m := range b.Months {
+		out = append(out,
+			row("summary", m.Month, "Income", "", m.Income),
+			row("summary", m.Month, "Spent", "", m.Spent),
+			row("summary", m.Month, "Net", "", m.Net))
+	}
+	return out
+}
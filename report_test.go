@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// reportBudget has open, closed and tracking accounts and three months of
+// income, split spending, a refund and a transfer
+const reportBudget = `{"data":{"budget":{"id":"b1","name":"Home","currency_format":{"iso_code":"EUR","decimal_digits":2},
+	"accounts":[
+		{"id":"a1","name":"Checking","type":"checking","on_budget":true,"balance":1500000},
+		{"id":"a2","name":"Visa","type":"creditCard","on_budget":true,"balance":-200000},
+		{"id":"a3","name":"House","type":"otherAsset","on_budget":false,"balance":90000000},
+		{"id":"a4","name":"Old","type":"savings","on_budget":true,"closed":true,"balance":0}],
+	"payees":[{"id":"p1","name":"Employer"}],
+	"category_groups":[{"id":"g1","name":"Bills"},{"id":"g2","name":"Fun"},{"id":"g3","name":"Internal Master Category"}],
+	"categories":[
+		{"id":"c1","category_group_id":"g1","name":"Rent"},
+		{"id":"c2","category_group_id":"g1","name":"Food"},
+		{"id":"c3","category_group_id":"g2","name":"Games"},
+		{"id":"c4","category_group_id":"g3","name":"Inflow: Ready to Assign"}],
+	"transactions":[
+		{"id":"t0","date":"2024-12-01","account_id":"a1","payee_id":"p1","category_id":"c4","amount":1000000},
+		{"id":"t1","date":"2025-01-01","account_id":"a1","payee_id":"p1","category_id":"c4","amount":2000000},
+		{"id":"t2","date":"2025-01-02","account_id":"a1","category_id":"c1","amount":-900000},
+		{"id":"t3","date":"2025-01-05","account_id":"a2","amount":-150000},
+		{"id":"t4","date":"2025-01-06","account_id":"a1","transfer_account_id":"a2","amount":-100000},
+		{"id":"t5","date":"2025-01-06","account_id":"a2","transfer_account_id":"a1","amount":100000},
+		{"id":"t6","date":"2025-01-07","account_id":"a3","amount":5000000},
+		{"id":"t7","date":"2025-02-03","account_id":"a1","category_id":"c3","amount":-50000},
+		{"id":"t8","date":"2025-02-04","account_id":"a1","category_id":"c2","amount":10000},
+		{"id":"t9","date":"2025-02-05","account_id":"a1","amount":-7500}],
+	"subtransactions":[
+		{"id":"s1","transaction_id":"t3","category_id":"c2","amount":-120000},
+		{"id":"s2","transaction_id":"t3","category_id":"c3","amount":-30000}]}}}`
+
+// TestBuildReport sums open accounts into net worth and on-budget
+// transactions into monthly income and spending per category group
+func TestBuildReport(t *testing.T) {
+	env, err := ynabvault.DecodeEnvelope([]byte(reportBudget))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := buildReport(exportSnapshot{Budget: env.Data.Budget}, rollups{"bills": "Needs"}, 2)
+	accounts := []reportAccount{
+		{"Checking", "checking", true, 1500000},
+		{"House", "otherAsset", false, 90000000},
+		{"Visa", "creditCard", true, -200000},
+	}
+	if !reflect.DeepEqual(got.Accounts, accounts) {
+		t.Errorf("accounts = %+v", got.Accounts)
+	}
+	if got.Assets != 91500000 || got.Liabilities != 200000 || got.NetWorth != 91300000 {
+		t.Errorf("assets %d, liabilities %d, net worth %d", got.Assets, got.Liabilities, got.NetWorth)
+	}
+	months := []reportMonth{
+		{Month: "2025-01", Income: 2000000, Spent: 1050000, Net: 950000, Groups: []reportGroup{
+			{"Bills", "Needs", 1020000}, {"Fun", "", 30000},
+		}},
+		{Month: "2025-02", Income: 0, Spent: 47500, Net: -47500, Groups: []reportGroup{
+			{"Bills", "Needs", -10000}, {"Fun", "", 50000}, {"Uncategorized", "", 7500},
+		}},
+	}
+	if !reflect.DeepEqual(got.Months, months) {
+		t.Errorf("months = %+v", got.Months)
+	}
+	if all := buildReport(exportSnapshot{Budget: env.Data.Budget}, nil, 0); len(all.Months) != 3 || all.Months[0].Month != "2024-12" {
+		t.Errorf("all months = %+v", all.Months)
+	}
+}
+
+// TestReportCommand prints the newest snapshot as a table, CSV or JSON and
+// asks for --budget when the vault holds several budgets
+func TestReportCommand(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"Home_b1_20250101T000000Z.json": `{"data":{"budget":{"id":"b1","name":"Home"}}}`,
+		"Home_b1_20250301T000000Z.json": reportBudget,
+		"Work_b2_20250301T000000Z.json": `{"data":{"budget":{"id":"b2","name":"Work"}}}`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stdout, stderr strings.Builder
+	if code := runCLI([]string{"report", "--output", dir, "--budget", "Home"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit code = %d; stderr: %s", code, stderr.String())
+	}
+	for _, want := range []string{
+		"Home, snapshot 2025-03-01T00:00:00Z (Home_b1_20250301T000000Z.json)",
+		"Net worth                91300.00",
+		"2025-02  Uncategorized  7.50",
+		"2025-01  2000.00  1050.00  950.00",
+	} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("table lacks %q:\n%s", want, stdout.String())
+		}
+	}
+
+	// Tables follow --lang; CSV and JSON keep their English keys
+	stdout.Reset()
+	if code := runCLI([]string{"report", "--lang", "de", "--output", dir, "--budget", "Home"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("--lang de exit code = %d; stderr: %s", code, stderr.String())
+	}
+	for _, want := range []string{"Home, Snapshot 2025-03-01T00:00:00Z", "KONTO", "Nettovermögen", "EINNAHMEN"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("German table lacks %q:\n%s", want, stdout.String())
+		}
+	}
+
+	stdout.Reset()
+	if code := runCLI([]string{"report", "--output", dir, "--format", "csv", "Home_b1_20250301T000000Z.json"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("csv exit code = %d; stderr: %s", code, stderr.String())
+	}
+	for _, want := range []string{"Report,Month,Name,Amount\nbalance,,Checking,1500.00\n", "spending,2025-01,Bills,1020.00\n", "summary,2025-02,Net,-47.50\n"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("CSV lacks %q:\n%s", want, stdout.String())
+		}
+	}
+
+	stdout.Reset()
+	if code := runCLI([]string{"report", "--output", dir, "--budget", "b1", "--format", "json", "--months", "1"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("json exit code = %d; stderr: %s", code, stderr.String())
+	}
+	var report map[string]interface{}
+	if err := json.Unmarshal([]byte(stdout.String()), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report["net_worth"] != 91300.0 || len(report["months"].([]interface{})) != 1 {
+		t.Errorf("JSON = %s", stdout.String())
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+	}{
+		{"several budgets", []string{"report", "--output", dir}, 2},
+		{"unknown budget", []string{"report", "--output", dir, "--budget", "Nope"}, exitNotFound},
+		{"unknown format", []string{"report", "--output", dir, "--budget", "Home", "--format", "xml"}, 2},
+		{"budget and file", []string{"report", "--output", dir, "--budget", "Home", "Home_b1_20250301T000000Z.json"}, 2},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if code := runCLI(tc.args, &strings.Builder{}, &strings.Builder{}); code != tc.wantCode {
+				t.Errorf("exit code = %d; want %d", code, tc.wantCode)
+			}
+		})
+	}
+}
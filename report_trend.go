@@ -0,0 +1,189 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// sparkLevels draws a value from low to high
+var sparkLevels = []rune("▁▂▃▄▅▆▇█")
+
+// Widths of the textual plots
+const (
+	trendBarWidth   = 30
+	trendSparkWidth = 40
+)
+
+// budgetTrend follows a budget's net worth and category balances across its
+// snapshots, oldest first
+type budgetTrend struct {
+	Budget   string       `json:"budget"`
+	Currency string       `json:"currency"`
+	Points   []trendPoint `json:"points"`
+
+	digits  int
+	rollups bool
+}
+
+// trendPoint is what one snapshot says
+type trendPoint struct {
+	TakenAt     string          `json:"taken_at"`
+	Snapshot    string          `json:"snapshot"`
+	Assets      dataAmount      `json:"assets"`
+	Liabilities dataAmount      `json:"liabilities"`
+	NetWorth    dataAmount      `json:"net_worth"`
+	Categories  []trendCategory `json:"categories"`
+}
+
+// trendCategory is a visible category's balance in the snapshot's month
+type trendCategory struct {
+	ID      string     `json:"id"`
+	Group   string     `json:"group"`
+	Rollup  string     `json:"rollup,omitempty"`
+	Name    string     `json:"name"`
+	Balance dataAmount `json:"balance"`
+}
+
+// buildTrend reports on each snapshot in turn: its net worth over the open
+// accounts and the balance of each visible category, as of when it was
+// taken. The budget's name and currency come from the newest snapshot.
+func buildTrend(snaps []exportSnapshot, r rollups) budgetTrend {
+	snaps = slices.Clone(snaps)
+	slices.SortStableFunc(snaps, func(a, b exportSnapshot) int { return a.Info.Time.Compare(b.Info.Time) })
+	out := budgetTrend{Points: []trendPoint{}, rollups: len(r) > 0}
+	for _, s := range snaps {
+		f := budgetCurrency(s.Budget)
+		out.Budget, out.Currency, out.digits = cmp.Or(stringField(s.Budget, "name"), s.Info.Name), f.ISOCode, f.DecimalDigits
+		assets, liabilities := netWorth(s.Budget)
+		p := trendPoint{
+			TakenAt:     s.Info.Time.UTC().Format("2006-01-02T15:04:05Z"),
+			Snapshot:    s.Info.File,
+			Assets:      dataAmount(assets),
+			Liabilities: dataAmount(liabilities),
+			NetWorth:    dataAmount(assets - liabilities),
+			Categories:  []trendCategory{},
+		}
+		categories := entitiesByID(s.Budget["categories"])
+		groups := entitiesByID(s.Budget["category_groups"])
+		for id, c := range categories {
+			group := categoryGroup(categories, groups, id)
+			if c["hidden"] == true || groups[stringField(c, "category_group_id")]["hidden"] == true || group == internalCategoryGroup {
+				continue
+			}
+			p.Categories = append(p.Categories, trendCategory{
+				ID:      id,
+				Group:   group,
+				Rollup:  r.of(group),
+				Name:    stringField(c, "name"),
+				Balance: dataAmount(milliunits(c["balance"])),
+			})
+		}
+		slices.SortFunc(p.Categories, func(a, b trendCategory) int {
+			return cmp.Or(cmp.Compare(a.Group, b.Group), cmp.Compare(a.Name, b.Name), cmp.Compare(a.ID, b.ID))
+		})
+		out.Points = append(out.Points, p)
+	}
+	return out
+}
+
+// print plots net worth as a bar per snapshot, then each category of the
+// newest snapshot with its first and last balance and a sparkline of the
+// balances between
+func (b budgetTrend) print(w io.Writer, l Localizer) {
+	amount := func(a dataAmount) string { return fixedAmount(int64(a), b.digits) }
+	if len(b.Points) == 0 {
+		return
+	}
+	first, last := b.Points[0], b.Points[len(b.Points)-1]
+	fmt.Fprintf(w, "%s\n\n", l.T(msgTrendTitle, b.Budget, len(b.Points), first.TakenAt, last.TakenAt))
+
+	fmt.Fprintln(w, l.columns(msgColTaken, msgColNetWorth))
+	var widest dataAmount
+	for _, p := range b.Points {
+		widest = max(widest, p.NetWorth, -p.NetWorth)
+	}
+	for _, p := range b.Points {
+		bar := ""
+		if widest > 0 {
+			n := int(int64(max(p.NetWorth, -p.NetWorth)) * trendBarWidth / int64(widest))
+			bar = strings.Repeat("#", n)
+			if p.NetWorth < 0 {
+				bar = strings.Repeat("-", n)
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", p.TakenAt, amount(p.NetWorth), bar)
+	}
+
+	if len(last.Categories) == 0 {
+		return
+	}
+	fmt.Fprintln(w)
+	if b.rollups {
+		fmt.Fprintln(w, l.columns(msgColGroup, msgColRollup, msgColCategory, msgColFirst, msgColLast, msgColChange, msgColTrend))
+	} else {
+		fmt.Fprintln(w, l.columns(msgColGroup, msgColCategory, msgColFirst, msgColLast, msgColChange, msgColTrend))
+	}
+	for _, c := range last.Categories {
+		var balances []dataAmount
+		for _, p := range b.Points {
+			if i := slices.IndexFunc(p.Categories, func(pc trendCategory) bool { return pc.ID == c.ID }); i >= 0 {
+				balances = append(balances, p.Categories[i].Balance)
+			}
+		}
+		from := balances[0]
+		cells := []string{c.Group, c.Name, amount(from), amount(c.Balance), amount(c.Balance - from), sparkline(balances, trendSparkWidth)}
+		if b.rollups {
+			cells = slices.Insert(cells, 1, c.Rollup)
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+}
+
+// rows lays the trend out as one CSV table: a net_worth row and a balance
+// row per category for each snapshot. The Rollup column is only there when
+// rollups are configured.
+func (b budgetTrend) rows() [][]string {
+	header := []string{"Report", "Taken", "Group", "Name", "Amount"}
+	if b.rollups {
+		header = slices.Insert(header, 4, "Rollup")
+	}
+	row := func(report, taken, group, name, rollup string, a dataAmount) []string {
+		if b.rollups {
+			return []string{report, taken, group, name, rollup, fixedAmount(int64(a), 2)}
+		}
+		return []string{report, taken, group, name, fixedAmount(int64(a), 2)}
+	}
+	out := [][]string{header}
+	for _, p := range b.Points {
+		out = append(out, row("net_worth", p.TakenAt, "", "Net worth", "", p.NetWorth))
+		for _, c := range p.Categories {
+			out = append(out, row("balance", p.TakenAt, c.Group, c.Name, c.Rollup, c.Balance))
+		}
+	}
+	return out
+}
+
+// sparkline draws values from their lowest to their highest, picking evenly
+// spaced values when there are more than width
+func sparkline(values []dataAmount, width int) string {
+	if len(values) > width {
+		picked := make([]dataAmount, width)
+		for i := range picked {
+			picked[i] = values[i*(len(values)-1)/(width-1)]
+		}
+		values = picked
+	}
+	low, high := slices.Min(values), slices.Max(values)
+	var out strings.Builder
+	for _, v := range values {
+		level := 0
+		if high > low {
+			level = int(int64(v-low) * int64(len(sparkLevels)-1) / int64(high-low))
+		}
+		out.WriteRune(sparkLevels[level])
+	}
+	return out.String()
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// trendBudget is a snapshot of budget b1 with the given balances of the
+// checking account and the Rent category
+func trendBudget(checking, rent int64) string {
+	return fmt.Sprintf(`{"data":{"budget":{"id":"b1","name":"Home","currency_format":{"iso_code":"EUR","decimal_digits":2},
+	"accounts":[{"id":"a1","name":"Checking","balance":%d},{"id":"a2","name":"Visa","balance":-100000}],
+	"category_groups":[{"id":"g1","name":"Bills"},{"id":"g2","name":"Internal Master Category"}],
+	"categories":[
+		{"id":"c1","category_group_id":"g1","name":"Rent","balance":%d},
+		{"id":"c2","category_group_id":"g1","name":"Old","hidden":true,"balance":5000},
+		{"id":"c3","category_group_id":"g2","name":"Inflow: Ready to Assign","balance":1000}]}}}`, checking, rent)
+}
+
+// TestTrendReport follows net worth and category balances across every
+// snapshot of a budget, oldest first
+func TestTrendReport(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"Home_b1_20250301T000000Z.json": trendBudget(1300000, 900000),
+		"Home_b1_20250101T000000Z.json": trendBudget(1100000, 0),
+		"Home_b1_20250201T000000Z.json": trendBudget(1200000, 450000),
+		"Work_b2_20250201T000000Z.json": `{"data":{"budget":{"id":"b2","name":"Work"}}}`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stdout, stderr strings.Builder
+	if code := runCLI([]string{"report", "--trend", "--output", dir, "--budget", "Home", "--format", "json"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit code = %d; stderr: %s", code, stderr.String())
+	}
+	var trend struct {
+		Budget string `json:"budget"`
+		Points []struct {
+			TakenAt    string  `json:"taken_at"`
+			NetWorth   float64 `json:"net_worth"`
+			Categories []struct {
+				Name    string  `json:"name"`
+				Balance float64 `json:"balance"`
+			} `json:"categories"`
+		} `json:"points"`
+	}
+	if err := json.Unmarshal([]byte(stdout.String()), &trend); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, p := range trend.Points {
+		got = append(got, fmt.Sprintf("%s %.2f %v", p.TakenAt, p.NetWorth, p.Categories))
+	}
+	want := []string{
+		"2025-01-01T00:00:00Z 1000.00 [{Rent 0}]",
+		"2025-02-01T00:00:00Z 1100.00 [{Rent 450}]",
+		"2025-03-01T00:00:00Z 1200.00 [{Rent 900}]",
+	}
+	if trend.Budget != "Home" || !reflect.DeepEqual(got, want) {
+		t.Errorf("trend of %s = %q", trend.Budget, got)
+	}
+
+	stdout.Reset()
+	if code := runCLI([]string{"report", "--trend", "--output", dir, "--budget", "b1", "--months", "1"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("table exit code = %d; stderr: %s", code, stderr.String())
+	}
+	for _, want := range []string{
+		"Home, 2 snapshots from 2025-02-01T00:00:00Z to 2025-03-01T00:00:00Z",
+		"2025-03-01T00:00:00Z  1200.00  " + strings.Repeat("#", trendBarWidth),
+		"Bills  Rent      450.00  900.00  450.00  ▁█",
+	} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("table lacks %q:\n%s", want, stdout.String())
+		}
+	}
+
+	stdout.Reset()
+	if code := runCLI([]string{"report", "--trend", "--output", dir, "--budget", "Home", "--format", "csv"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("csv exit code = %d; stderr: %s", code, stderr.String())
+	}
+	if !strings.HasPrefix(stdout.String(), "Report,Taken,Group,Name,Amount\nnet_worth,2025-01-01T00:00:00Z,,Net worth,1000.00\nbalance,2025-01-01T00:00:00Z,Bills,Rent,0.00\n") {
+		t.Errorf("CSV =\n%s", stdout.String())
+	}
+
+	for _, args := range [][]string{
+		{"report", "--trend", "--output", dir},
+		{"report", "--trend", "--output", dir, "Home_b1_20250101T000000Z.json"},
+	} {
+		if code := runCLI(args, &strings.Builder{}, &strings.Builder{}); code != 2 {
+			t.Errorf("%v: exit code = %d; want 2", args, code)
+		}
+	}
+}
+
+// TestSparkline scales values between the lowest and highest level and
+// samples long series
+func TestSparkline(t *testing.T) {
+	tests := []struct {
+		values []dataAmount
+		width  int
+		want   string
+	}{
+		{[]dataAmount{0, 7, 14}, 10, "▁▄█"},
+		{[]dataAmount{5, 5}, 10, "▁▁"},
+		{[]dataAmount{-10, 0, 10, 20, 30}, 3, "▁▄█"},
+	}
+	for _, tc := range tests {
+		if got := sparkline(tc.values, tc.width); got != tc.want {
+			t.Errorf("sparkline(%v, %d) = %q; want %q", tc.values, tc.width, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// restoreBatchSize bounds the transactions sent per bulk-create request
+const restoreBatchSize = 1000
+
+// restoreOptions selects what restoreBudget writes into the target budget
+type restoreOptions struct {
+	// TransactionsOnly maps accounts by name but never creates them;
+	// transactions of unmatched accounts are skipped
+	TransactionsOnly bool
+	DryRun           bool
+}
+
+// restoreResult counts what a restore did or, on a dry run, would do
+type restoreResult struct {
+	AccountsMatched int
+	AccountsCreated int
+	AccountsSkipped int
+	Imported        int
+	Duplicates      int // already imported by an earlier restore
+	Skipped         int // in accounts that were not restored
+}
+
+// restoreCreateAttempts bounds the tries at creating one account
+const restoreCreateAttempts = 3
+
+// ynabWriter calls the YNAB API for one target budget
+type ynabWriter struct {
+	client *http.Client
+	// once sends requests that must not be repeated blindly, such as
+	// creating an account; nil means client
+	once    *http.Client
+	backoff time.Duration // pause before another try at creating an account
+	base    string        // the budgets endpoint
+	token   string
+	budget  string // target budget ID
+}
+
+// newYNABWriter talks to the target budget through rt, retrying failed
+// requests except those that create accounts
+func newYNABWriter(rt http.RoundTripper, logger *slog.Logger, base, token, budget string) ynabWriter {
+	rt = ynabvault.NewRateLimitTransport(rt, logger)
+	return ynabWriter{
+		client:  &http.Client{Transport: ynabvault.NewRetryTransport(rt, 3, time.Second, logger)},
+		once:    &http.Client{Transport: rt},
+		backoff: time.Second,
+		base:    base,
+		token:   token,
+		budget:  budget,
+	}
+}
+
+// call sends in (when non-nil) as JSON to path below the target budget and
+// decodes the response's data object into out
+func (w ynabWriter) call(ctx context.Context, method, path string, in, out interface{}) error {
+	return w.send(ctx, w.client, method, path, in, out)
+}
+
+func (w ynabWriter) send(ctx context.Context, client *http.Client, method, path string, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	endpoint := w.base + "/" + url.PathEscape(w.budget) + path
+	data, err := ynabvault.HTTPSend(ctx, client, method, endpoint, w.token, body)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	wrapper := struct {
+		Data interface{} `json:"data"`
+	}{out}
+	if err := json.Unmarshal(data, &wrapper); err != nil {
+		return fmt.Errorf("%s %s: %w: %w", method, path, ynabvault.ErrCorrupt, err)
+	}
+	return nil
+}
+
+// targetAccount is an account of the budget being restored into
+type targetAccount struct {
+	ID              string `json:"id"`
+	Name            string `json:"name"`
+	TransferPayeeID string `json:"transfer_payee_id"`
+	Deleted         bool   `json:"deleted"`
+}
+
+// accounts returns the target budget's accounts that are not deleted, by name
+func (w ynabWriter) accounts(ctx context.Context) (map[string]targetAccount, error) {
+	var existing struct {
+		Accounts []targetAccount `json:"accounts"`
+	}
+	if err := w.call(ctx, http.MethodGet, "/accounts", nil, &existing); err != nil {
+		return nil, err
+	}
+	byName := map[string]targetAccount{}
+	for _, a := range existing.Accounts {
+		if !a.Deleted {
+			byName[a.Name] = a
+		}
+	}
+	return byName, nil
+}
+
+// createAccount creates an account with a zero balance. Accounts have no
+// import ID, and a request that failed may still have created one, so the
+// request is never repeated as is: before another try the accounts are
+// listed again and one by this name is taken as created.
+func (w ynabWriter) createAccount(ctx context.Context, name string, typ interface{}) (targetAccount, error) {
+	in := map[string]interface{}{"account": map[string]interface{}{"name": name, "type": typ, "balance": 0}}
+	var err error
+	for attempt := range restoreCreateAttempts {
+		if attempt > 0 {
+			if werr := ynabvault.SleepContext(ctx, time.Duration(attempt)*w.backoff); werr != nil {
+				return targetAccount{}, werr
+			}
+			byName, lerr := w.accounts(ctx)
+			if lerr != nil {
+				return targetAccount{}, lerr
+			}
+			if a, ok := byName[name]; ok {
+				return a, nil
+			}
+		}
+		var created struct {
+			Account targetAccount `json:"account"`
+		}
+		if err = w.send(ctx, cmp.Or(w.once, w.client), http.MethodPost, "/accounts", in, &created); err == nil {
+			return created.Account, nil
+		}
+		// The request was refused, so nothing was created
+		var status *ynabvault.StatusError
+		if ctx.Err() != nil || errors.As(err, &status) && status.StatusCode < 500 && status.StatusCode != http.StatusTooManyRequests {
+			return targetAccount{}, err
+		}
+	}
+	return targetAccount{}, err
+}
+
+// restoreBudget replays a snapshot's accounts and transactions into the
+// target budget. Accounts and categories are matched by name; payees are
+// recreated by name. Every transaction carries an import ID derived from its
+// original ID, so running a restore again adds nothing twice. Each transfer
+// is sent once and YNAB creates its other side.
+func restoreBudget(ctx context.Context, w ynabWriter, budget map[string]interface{}, opts restoreOptions) (restoreResult, error) {
+	var res restoreResult
+	byName, err := w.accounts(ctx)
+	if err != nil {
+		return res, err
+	}
+
+	accounts := map[string]targetAccount{} // snapshot account ID -> target
+	snapAccounts := entitiesByID(budget["accounts"])
+	for _, id := range sortedKeys(snapAccounts) {
+		a := snapAccounts[id]
+		name := stringField(a, "name")
+		switch target, ok := byName[name]; {
+		case ok:
+			accounts[id] = target
+			res.AccountsMatched++
+		case opts.TransactionsOnly:
+			res.AccountsSkipped++
+		case opts.DryRun:
+			accounts[id] = targetAccount{Name: name}
+			res.AccountsCreated++
+		default:
+			created, err := w.createAccount(ctx, name, a["type"])
+			if err != nil {
+				return res, fmt.Errorf("create account %q: %w", name, err)
+			}
+			accounts[id] = created
+			res.AccountsCreated++
+		}
+	}
+
+	categories, err := mapCategories(ctx, w, budget)
+	if err != nil {
+		return res, err
+	}
+	payees := entitiesByID(budget["payees"])
+	subs := map[string][]map[string]interface{}{}
+	splits := entitiesByID(budget["subtransactions"])
+	for _, id := range sortedKeys(splits) {
+		st := splits[id]
+		parent := stringField(st, "transaction_id")
+		subs[parent] = append(subs[parent], st)
+	}
+
+	var batch []map[string]interface{}
+	txns := entitiesByID(budget["transactions"])
+	for _, id := range sortedKeys(txns) {
+		t := txns[id]
+		account, ok := accounts[stringField(t, "account_id")]
+		if !ok {
+			res.Skipped++
+			continue
+		}
+		out := map[string]interface{}{
+			"account_id": account.ID,
+			"date":       t["date"],
+			"amount":     t["amount"],
+			"memo":       t["memo"],
+			"cleared":    t["cleared"],
+			"approved":   t["approved"],
+			"flag_color": t["flag_color"],
+			"import_id":  restoreImportID(id),
+		}
+		transfer, isTransfer := accounts[stringField(t, "transfer_account_id")]
+		if isTransfer {
+			// The side with the smaller ID creates both
+			if peer := stringField(t, "transfer_transaction_id"); peer != "" && peer < id {
+				continue
+			}
+			out["payee_id"] = transfer.TransferPayeeID
+		} else {
+			out["payee_name"] = stringField(payees[stringField(t, "payee_id")], "name")
+		}
+		if parts := subs[id]; len(parts) > 0 {
+			var split []map[string]interface{}
+			for _, st := range parts {
+				part := map[string]interface{}{
+					"amount":     st["amount"],
+					"memo":       st["memo"],
+					"payee_name": stringField(payees[stringField(st, "payee_id")], "name"),
+				}
+				if c, ok := categories[stringField(st, "category_id")]; ok {
+					part["category_id"] = c
+				}
+				split = append(split, part)
+			}
+			out["subtransactions"] = split
+		} else if c, ok := categories[stringField(t, "category_id")]; ok {
+			out["category_id"] = c
+		}
+		batch = append(batch, out)
+	}
+
+	if opts.DryRun {
+		res.Imported = len(batch)
+		return res, nil
+	}
+	for start := 0; start < len(batch); start += restoreBatchSize {
+		var saved struct {
+			TransactionIDs     []string `json:"transaction_ids"`
+			DuplicateImportIDs []string `json:"duplicate_import_ids"`
+		}
+		in := map[string]interface{}{"transactions": batch[start:min(start+restoreBatchSize, len(batch))]}
+		if err := w.call(ctx, http.MethodPost, "/transactions", in, &saved); err != nil {
+			return res, fmt.Errorf("import transactions: %w", err)
+		}
+		res.Imported += len(saved.TransactionIDs)
+		res.Duplicates += len(saved.DuplicateImportIDs)
+	}
+	return res, nil
+}
+
+// mapCategories maps the snapshot's category IDs to the target's categories
+// with the same group and name
+func mapCategories(ctx context.Context, w ynabWriter, budget map[string]interface{}) (map[string]string, error) {
+	var existing struct {
+		Groups []struct {
+			Name       string `json:"name"`
+			Categories []struct {
+				ID      string `json:"id"`
+				Name    string `json:"name"`
+				Deleted bool   `json:"deleted"`
+			} `json:"categories"`
+		} `json:"category_groups"`
+	}
+	if err := w.call(ctx, http.MethodGet, "/categories", nil, &existing); err != nil {
+		return nil, err
+	}
+	byName := map[[2]string]string{}
+	for _, g := range existing.Groups {
+		for _, c := range g.Categories {
+			if !c.Deleted {
+				byName[[2]string{g.Name, c.Name}] = c.ID
+			}
+		}
+	}
+	groups := entitiesByID(budget["category_groups"])
+	out := map[string]string{}
+	for id, c := range entitiesByID(budget["categories"]) {
+		group := stringField(groups[stringField(c, "category_group_id")], "name")
+		if target, ok := byName[[2]string{group, stringField(c, "name")}]; ok {
+			out[id] = target
+		}
+	}
+	return out, nil
+}
+
+// restoreImportID derives a stable import ID (at most 36 characters) from a
+// transaction's original ID
+func restoreImportID(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return "YV:" + hex.EncodeToString(sum[:16])
+}
+
+// stringField returns obj[key] when it is a string
+func stringField(obj map[string]interface{}, key string) string {
+	s, _ := obj[key].(string)
+	return s
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// fakeYNABWriter serves a target budget's accounts and categories and
+// records the accounts and transactions posted to it
+type fakeYNABWriter struct {
+	mu           sync.Mutex
+	accounts     []targetAccount
+	transactions []map[string]interface{}
+	imported     map[string]bool
+	creates      int // POST /accounts requests
+	failCreates  int // creations that still answer 500
+}
+
+func (f *fakeYNABWriter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	reply := func(data interface{}) { _ = json.NewEncoder(w).Encode(map[string]interface{}{"data": data}) }
+	switch r.Method + " " + r.URL.Path {
+	case "GET /target/accounts":
+		reply(map[string]interface{}{"accounts": f.accounts})
+	case "GET /target/categories":
+		_, _ = io.WriteString(w, `{"data":{"category_groups":[{"name":"Bills","categories":[{"id":"tc-rent","name":"Rent"}]}]}}`)
+	case "POST /target/accounts":
+		var in struct{ Account targetAccount }
+		_ = json.NewDecoder(r.Body).Decode(&in)
+		a := targetAccount{ID: "t-" + in.Account.Name, Name: in.Account.Name, TransferPayeeID: "tp-" + in.Account.Name}
+		f.accounts = append(f.accounts, a)
+		if f.creates++; f.creates <= f.failCreates {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		reply(map[string]interface{}{"account": a})
+	case "POST /target/transactions":
+		var in struct{ Transactions []map[string]interface{} }
+		_ = json.NewDecoder(r.Body).Decode(&in)
+		var ids, dups []string
+		for _, t := range in.Transactions {
+			id := t["import_id"].(string)
+			if f.imported[id] {
+				dups = append(dups, id)
+				continue
+			}
+			f.imported[id] = true
+			f.transactions = append(f.transactions, t)
+			ids = append(ids, id)
+		}
+		w.WriteHeader(http.StatusCreated)
+		reply(map[string]interface{}{"transaction_ids": ids, "duplicate_import_ids": dups})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+const restoreSnapshot = `{"data":{"budget":{"id":"b1",
+	"accounts":[{"id":"a1","name":"Checking","type":"checking"},{"id":"a2","name":"Savings","type":"savings"},{"id":"a3","name":"Gone","deleted":true}],
+	"payees":[{"id":"p1","name":"Landlord"},{"id":"p2","name":"Transfer : Savings"}],
+	"category_groups":[{"id":"g1","name":"Bills"}],
+	"categories":[{"id":"c1","name":"Rent","category_group_id":"g1"}],
+	"transactions":[
+		{"id":"t1","account_id":"a1","date":"2025-01-01","amount":-1000000,"payee_id":"p1","category_id":"c1","cleared":"cleared","approved":true},
+		{"id":"t2","account_id":"a1","date":"2025-01-02","amount":-50000,"payee_id":"p2","transfer_account_id":"a2","transfer_transaction_id":"t3"},
+		{"id":"t3","account_id":"a2","date":"2025-01-02","amount":50000,"transfer_account_id":"a1","transfer_transaction_id":"t2"},
+		{"id":"t4","account_id":"a1","date":"2025-01-03","amount":-1,"deleted":true}
+	]}}}`
+
+// TestRestoreCommand replays a snapshot, then again without duplicating
+func TestRestoreCommand(t *testing.T) {
+	fake := &fakeYNABWriter{accounts: []targetAccount{{ID: "t-Checking", Name: "Checking", TransferPayeeID: "tp-Checking"}}, imported: map[string]bool{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "B_b1_20250101T000000Z.json"), []byte(restoreSnapshot), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("YNAB_BEARER_TOKEN", "tok")
+	base := []string{"restore", "--output", dir, "--url", srv.URL, "--to", "target"}
+
+	var stdout strings.Builder
+	if code := runCLI(append(base, "--dry-run", "B_b1_20250101T000000Z.json"), &stdout, io.Discard); code != 0 {
+		t.Fatalf("dry run exit code = %d", code)
+	}
+	if out := stdout.String(); !strings.Contains(out, "1 matched, 1 to create") || !strings.Contains(out, "2 to import") || len(fake.accounts) != 1 {
+		t.Errorf("dry run wrote or miscounted:\n%s", out)
+	}
+
+	stdout.Reset()
+	if code := runCLI(append(base, "B_b1_20250101T000000Z.json"), &stdout, io.Discard); code != 0 {
+		t.Fatalf("restore exit code = %d", code)
+	}
+	if out := stdout.String(); !strings.Contains(out, "1 matched, 1 created") || !strings.Contains(out, "2 imported, 0 already present") {
+		t.Errorf("restore output:\n%s", out)
+	}
+	if len(fake.transactions) != 2 {
+		t.Fatalf("posted %d transactions; want 2 (transfers once, no deleted)", len(fake.transactions))
+	}
+	rent, transfer := fake.transactions[0], fake.transactions[1]
+	if rent["account_id"] != "t-Checking" || rent["payee_name"] != "Landlord" || rent["category_id"] != "tc-rent" || rent["import_id"] != restoreImportID("t1") {
+		t.Errorf("rent transaction = %v", rent)
+	}
+	if transfer["payee_id"] != "tp-Savings" || transfer["amount"] != float64(-50000) {
+		t.Errorf("transfer transaction = %v", transfer)
+	}
+
+	stdout.Reset()
+	if code := runCLI(append(base, "B_b1_20250101T000000Z.json"), &stdout, io.Discard); code != 0 || !strings.Contains(stdout.String(), "0 imported, 2 already present") {
+		t.Errorf("second restore exit code = %d:\n%s", code, stdout.String())
+	}
+	if len(restoreImportID("t1")) > 36 {
+		t.Errorf("import ID %q exceeds YNAB's 36 characters", restoreImportID("t1"))
+	}
+}
+
+// TestRestoreTransactionsOnly skips accounts missing from the target
+func TestRestoreTransactionsOnly(t *testing.T) {
+	fake := &fakeYNABWriter{accounts: []targetAccount{{ID: "t-Checking", Name: "Checking"}}, imported: map[string]bool{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	env, err := ynabvault.DecodeEnvelope([]byte(restoreSnapshot))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := ynabWriter{client: srv.Client(), base: srv.URL, token: "tok", budget: "target"}
+	res, err := restoreBudget(t.Context(), w, env.Data.Budget, restoreOptions{TransactionsOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := restoreResult{AccountsMatched: 1, AccountsSkipped: 1, Imported: 2, Skipped: 1}
+	if res != want {
+		t.Errorf("result = %+v; want %+v", res, want)
+	}
+	if len(fake.accounts) != 1 {
+		t.Errorf("accounts were created: %v", fake.accounts)
+	}
+}
+
+// TestRestoreCreateAccountOnce never sends an account creation again after
+// a failure that still created the account
+func TestRestoreCreateAccountOnce(t *testing.T) {
+	fake := &fakeYNABWriter{accounts: []targetAccount{{ID: "t-Checking", Name: "Checking"}}, imported: map[string]bool{}, failCreates: 1}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	env, err := ynabvault.DecodeEnvelope([]byte(restoreSnapshot))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := newYNABWriter(srv.Client().Transport, nil, srv.URL, "tok", "target")
+	w.backoff = 0
+	res, err := restoreBudget(t.Context(), w, env.Data.Budget, restoreOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fake.creates != 1 || len(fake.accounts) != 2 || res.AccountsCreated != 1 {
+		t.Errorf("%d creations left accounts %v, result %+v; want Savings created once", fake.creates, fake.accounts, res)
+	}
+	if transfer := fake.transactions[1]; transfer["payee_id"] != "tp-Savings" {
+		t.Errorf("transfer transaction = %v; want it into the created account", transfer)
+	}
+
+	// Without the account, a failed creation is tried again
+	fake = &fakeYNABWriter{imported: map[string]bool{}}
+	srv2 := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/target/accounts" && fake.creates == 0 {
+			fake.creates++
+			rw.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		fake.ServeHTTP(rw, r)
+	}))
+	defer srv2.Close()
+	w = newYNABWriter(srv2.Client().Transport, nil, srv2.URL, "tok", "target")
+	w.backoff = 0
+	if _, err := w.createAccount(t.Context(), "Savings", "savings"); err != nil || fake.creates != 2 || len(fake.accounts) != 1 {
+		t.Errorf("retried creation = %v after %d requests, accounts %v", err, fake.creates, fake.accounts)
+	}
+}
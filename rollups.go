@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// rollups maps category group names, lower-cased, to the higher-level
+// bucket the config's rollups key puts them in, such as Needs or Wants
+type rollups map[string]string
+
+// newRollups inverts the config's rollups, bucket to category groups, and
+// rejects a group listed in two buckets
+func newRollups(config map[string][]string) (rollups, error) {
+	r := rollups{}
+	for _, bucket := range sortedKeys(config) {
+		if strings.TrimSpace(bucket) == "" {
+			return nil, fmt.Errorf("rollups: bucket name is empty")
+		}
+		for _, group := range config[bucket] {
+			key := strings.ToLower(strings.TrimSpace(group))
+			if prev, ok := r[key]; ok && prev != bucket {
+				return nil, fmt.Errorf("rollups: category group %q is in both %s and %s", group, prev, bucket)
+			}
+			r[key] = bucket
+		}
+	}
+	return r, nil
+}
+
+// of returns the bucket of a category group, or "" when it has none
+func (r rollups) of(group string) string {
+	return r[strings.ToLower(strings.TrimSpace(group))]
+}
+
+// categoryGroup returns the name of the category group a category of the
+// budget belongs to
+func categoryGroup(categories, groups map[string]map[string]interface{}, categoryID string) string {
+	return stringField(groups[stringField(categories[categoryID], "category_group_id")], "name")
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestNewRollups inverts buckets to category groups, ignoring case, and
+// rejects a group in two buckets
+func TestNewRollups(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  map[string][]string
+		want    rollups
+		wantErr bool
+	}{
+		{"none", nil, rollups{}, false},
+		{"buckets", map[string][]string{"Needs": {"Bills", " Groceries"}, "Wants": {"Fun"}},
+			rollups{"bills": "Needs", "groceries": "Needs", "fun": "Wants"}, false},
+		{"listed twice in a bucket", map[string][]string{"Needs": {"Bills", "bills"}}, rollups{"bills": "Needs"}, false},
+		{"two buckets", map[string][]string{"Needs": {"Bills"}, "Wants": {"BILLS"}}, nil, true},
+		{"empty bucket name", map[string][]string{" ": {"Bills"}}, nil, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := newRollups(tc.config)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("newRollups = %v, %v; want error %v", got, err, tc.wantErr)
+			}
+			if !tc.wantErr && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("rollups = %v; want %v", got, tc.want)
+			}
+		})
+	}
+	if got := (rollups{"bills": "Needs"}).of(" Bills"); got != "Needs" {
+		t.Errorf("of(Bills) = %q; want Needs", got)
+	}
+}
+
+// TestExportRollups applies the configured rollups to CSV and Beancount
+// exports, and rejects a conflicting configuration
+func TestExportRollups(t *testing.T) {
+	dir := t.TempDir()
+	content := `{"data":{"budget":{"id":"b1",
+		"accounts":[{"id":"a1","name":"Checking","type":"checking"}],
+		"category_groups":[{"id":"g1","name":"Bills"},{"id":"g2","name":"Fun"}],
+		"categories":[{"id":"c1","category_group_id":"g1","name":"Rent"},{"id":"c2","category_group_id":"g2","name":"Games"}],
+		"transactions":[
+			{"id":"t1","date":"2025-01-02","account_id":"a1","category_id":"c1","amount":-900000},
+			{"id":"t2","date":"2025-01-03","account_id":"a1","category_id":"c2","amount":-20000}]}}}`
+	if err := os.WriteFile(filepath.Join(dir, "Home_b1_20250101T000000Z.json"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(config, []byte("rollups:\n  Needs: [bills]\nprofiles:\n  strict:\n    rollups:\n      Needs: [Bills]\n      Wants: [Bills]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := t.TempDir()
+	for _, format := range []string{"csv", "beancount"} {
+		var stderr strings.Builder
+		if code := runCLI([]string{"export", "--output", dir, "--config", config, "--format", format, "--out", out}, &strings.Builder{}, &stderr); code != 0 {
+			t.Fatalf("%s export exit code = %d; stderr: %s", format, code, stderr.String())
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(out, "Home_b1_20250101T000000Z.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Date,Account,Payee,Category,Rollup,Memo,Amount,Cleared\n2025-01-02,Checking,,Rent,Needs,,-900.00,\n2025-01-03,Checking,,Games,,,-20.00,\n"
+	if string(data) != want {
+		t.Errorf("CSV =\n%s\nwant\n%s", data, want)
+	}
+	data, err = os.ReadFile(filepath.Join(out, "Home_b1_20250101T000000Z.beancount"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"  Expenses:Needs:Bills:Rent  900.00 USD", "  Expenses:Fun:Games  20.00 USD"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("ledger lacks %q:\n%s", want, data)
+		}
+	}
+
+	args := []string{"export", "--output", dir, "--config", config, "--profile", "strict", "--format", "csv", "--out", out}
+	if code := runCLI(args, &strings.Builder{}, &strings.Builder{}); code != 2 {
+		t.Errorf("conflicting rollups exit code = %d; want 2", code)
+	}
+}
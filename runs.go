@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// runsFileName is the append-only run history kept in the output directory
+const runsFileName = ".ynabvault-runs.jsonl"
+
+// runRecord is one line of the run history
+type runRecord struct {
+	// Command is "backup" or "prune"; records from before prune was
+	// recorded have none and are backups
+	Command     string         `json:"command,omitempty"`
+	Client      clientInfo     `json:"client,omitzero"`
+	Started     time.Time      `json:"started"`
+	Finished    time.Time      `json:"finished"`
+	Budgets     int            `json:"budgets"`
+	Downloaded  int            `json:"downloaded"`
+	Skipped     int            `json:"skipped"`
+	Failed      int            `json:"failed,omitempty"`
+	Error       string         `json:"error,omitempty"`
+	Message     string         `json:"message,omitempty"`
+	Snapshots   []string       `json:"snapshots,omitempty"`
+	Pruned      []string       `json:"pruned,omitempty"`
+	APIRequests map[string]int `json:"api_requests"`
+}
+
+// clientInfo identifies the machine and build that made a run
+type clientInfo struct {
+	Host    string `json:"host"`
+	Version string `json:"version"`
+	OS      string `json:"os"`
+}
+
+// currentClient describes this process
+func currentClient() clientInfo {
+	host, _ := os.Hostname()
+	version := "(devel)"
+	if bi, ok := debug.ReadBuildInfo(); ok && bi.Main.Version != "" {
+		version = bi.Main.Version
+	}
+	return clientInfo{Host: host, Version: version, OS: runtime.GOOS + "/" + runtime.GOARCH}
+}
+
+func (c clientInfo) String() string {
+	if c == (clientInfo{}) {
+		return "-"
+	}
+	return fmt.Sprintf("%s (%s, %s)", c.Host, c.Version, c.OS)
+}
+
+// isBackup reports whether the run was a backup rather than a prune
+func (r runRecord) isBackup() bool {
+	return r.Command == "" || r.Command == "backup"
+}
+
+// totalRequests sums the API requests made during the run
+func (r runRecord) totalRequests() int {
+	n := 0
+	for _, c := range r.APIRequests {
+		n += c
+	}
+	return n
+}
+
+// savedSnapshots lists the snapshot files that are new in after compared to before
+func savedSnapshots(before, after *ynabvault.VaultState) []string {
+	var files []string
+	for id, st := range after.Budgets {
+		if st.Snapshot != "" && st.Snapshot != before.Budgets[id].Snapshot {
+			files = append(files, st.Snapshot)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// lastSuccess returns the most recent backup that saved every budget
+func lastSuccess(runs []runRecord) (runRecord, bool) {
+	for i := len(runs) - 1; i >= 0; i-- {
+		if r := runs[i]; r.isBackup() && r.Error == "" && r.Failed == 0 {
+			return r, true
+		}
+	}
+	return runRecord{}, false
+}
+
+// snapshotRuns maps snapshot files to the run that wrote them
+func snapshotRuns(runs []runRecord) map[string]runRecord {
+	writers := map[string]runRecord{}
+	for _, r := range runs {
+		for _, f := range r.Snapshots {
+			writers[f] = r
+		}
+	}
+	return writers
+}
+
+// appendRun adds a record to the run history in store
+func appendRun(ctx context.Context, store ynabvault.Store, rec runRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	// Object stores cannot append, so the history is rewritten as a whole
+	data, err := store.Get(ctx, runsFileName)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("read run history: %w: %w", ynabvault.ErrBackend, err)
+	}
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		data = append(data, '\n')
+	}
+	if err := store.Put(ctx, runsFileName, append(append(data, line...), '\n')); err != nil {
+		return fmt.Errorf("write run history: %w: %w", ynabvault.ErrBackend, err)
+	}
+	return nil
+}
+
+// appendPrune records a prune that started at started and removed files,
+// and marks those files pruned in the catalog
+func appendPrune(ctx context.Context, store ynabvault.Store, started time.Time, removed []string, pruneErr error) error {
+	rec := runRecord{Command: "prune", Client: currentClient(), Started: started, Finished: time.Now(), Pruned: removed}
+	if pruneErr != nil {
+		rec.Error = pruneErr.Error()
+	}
+	return errors.Join(appendRun(ctx, store, rec), catalogPrune(ctx, store, removed, rec.Finished))
+}
+
+// loadRuns reads the run history in store, oldest first
+func loadRuns(ctx context.Context, store ynabvault.Store) ([]runRecord, error) {
+	data, err := store.Get(ctx, runsFileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read run history: %w: %w", ynabvault.ErrBackend, err)
+	}
+
+	var runs []runRecord
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var rec runRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return nil, fmt.Errorf("run history line %d: %w: %w", i+1, ynabvault.ErrCorrupt, err)
+		}
+		runs = append(runs, rec)
+	}
+	return runs, nil
+}
+
+// usageTransport counts outgoing API requests per endpoint
+type usageTransport struct {
+	base     http.RoundTripper
+	basePath string
+
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// newUsageTransport wraps base; baseURL is the budgets endpoint used to label requests
+func newUsageTransport(base http.RoundTripper, baseURL string) *usageTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	var basePath string
+	if u, err := url.Parse(baseURL); err == nil {
+		basePath = strings.TrimSuffix(u.Path, "/")
+	}
+	return &usageTransport{base: base, basePath: basePath, counts: map[string]int{}}
+}
+
+func (t *usageTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	label, ok := ynabvault.RequestEndpoint(req.Context())
+	if !ok {
+		label = endpointLabel(t.basePath, req.URL.Path)
+	}
+	t.mu.Lock()
+	t.counts[label]++
+	t.mu.Unlock()
+	return t.base.RoundTrip(req)
+}
+
+// snapshot returns a copy of the counts so far
+func (t *usageTransport) snapshot() map[string]int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make(map[string]int, len(t.counts))
+	for k, v := range t.counts {
+		out[k] = v
+	}
+	return out
+}
+
+// endpointLabel names a request path relative to the budgets endpoint, with
+// the budget ID replaced so counts group by endpoint, e.g. /budgets/{id}/accounts
+func endpointLabel(basePath, path string) string {
+	rel := strings.Trim(strings.TrimPrefix(path, basePath), "/")
+	if rel == "" {
+		return "/budgets"
+	}
+	segs := strings.Split(rel, "/")
+	segs[0] = "{id}"
+	return "/budgets/" + strings.Join(segs, "/")
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// TestEndpointLabel groups request paths by endpoint
+func TestEndpointLabel(t *testing.T) {
+	tests := []struct{ base, path, want string }{
+		{"/v1/budgets", "/v1/budgets", "/budgets"},
+		{"/v1/budgets", "/v1/budgets/", "/budgets"},
+		{"/v1/budgets", "/v1/budgets/abc-123", "/budgets/{id}"},
+		{"/v1/budgets", "/v1/budgets/abc-123/accounts", "/budgets/{id}/accounts"},
+		{"", "/b1/transactions", "/budgets/{id}/transactions"},
+	}
+	for _, tc := range tests {
+		if got := endpointLabel(tc.base, tc.path); got != tc.want {
+			t.Errorf("endpointLabel(%q, %q) = %q; want %q", tc.base, tc.path, got, tc.want)
+		}
+	}
+}
+
+// TestRunHistoryRoundTrip appends and reloads run records
+func TestRunHistoryRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	if runs, err := loadRuns(t.Context(), ynabvault.DirStore(dir)); err != nil || len(runs) != 0 {
+		t.Fatalf("loadRuns on empty dir = %v, %v", runs, err)
+	}
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		rec := runRecord{Started: start, Finished: start.Add(time.Second), Budgets: i, APIRequests: map[string]int{"/budgets": 1}}
+		if err := appendRun(t.Context(), ynabvault.DirStore(dir), rec); err != nil {
+			t.Fatalf("appendRun: %v", err)
+		}
+	}
+	runs, err := loadRuns(t.Context(), ynabvault.DirStore(dir))
+	if err != nil {
+		t.Fatalf("loadRuns: %v", err)
+	}
+	if len(runs) != 2 || runs[1].Budgets != 1 || runs[1].totalRequests() != 1 {
+		t.Errorf("unexpected runs: %+v", runs)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, runsFileName), []byte("{broken\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadRuns(t.Context(), ynabvault.DirStore(dir)); !errors.Is(err, ynabvault.ErrCorrupt) {
+		t.Errorf("expected ErrCorrupt for broken history, got %v", err)
+	}
+}
+
+// TestBackupRecordsAPIUsage runs a backup and reads its usage back via the runs command
+func TestBackupRecordsAPIUsage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			_, _ = io.WriteString(w, `{"data":{"budgets":[{"id":"b1","name":"A","last_modified_on":"2025-01-01T00:00:00Z"},{"id":"b2","name":"B","last_modified_on":"2025-01-01T00:00:00Z"}]}}`)
+		default:
+			_, _ = io.WriteString(w, `{}`)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	t.Setenv("YNAB_BEARER_TOKEN", "tok")
+	var stderr bytes.Buffer
+	if code := runCLI([]string{"backup", "--url", srv.URL, "--output", dir, "--resources", "accounts"}, io.Discard, &stderr); code != 0 {
+		t.Fatalf("backup exit %d: %s", code, stderr.String())
+	}
+
+	runs, err := loadRuns(t.Context(), ynabvault.DirStore(dir))
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("loadRuns = %v, %v", runs, err)
+	}
+	want := map[string]int{"/budgets": 1, "/budgets/{id}": 2, "/budgets/{id}/accounts": 2}
+	for ep, n := range want {
+		if runs[0].APIRequests[ep] != n {
+			t.Errorf("requests[%s] = %d; want %d (all: %v)", ep, runs[0].APIRequests[ep], n, runs[0].APIRequests)
+		}
+	}
+
+	var stdout bytes.Buffer
+	if code := runCLI([]string{"runs", "--output", dir, "--api-usage"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("runs exit %d: %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "/budgets/{id}/accounts") || !strings.Contains(stdout.String(), "TOTAL") {
+		t.Errorf("unexpected api usage output:\n%s", stdout.String())
+	}
+	stdout.Reset()
+	if code := runCLI([]string{"runs", "--output", dir}, &stdout, &stderr); code != 0 || !strings.Contains(stdout.String(), "ok") {
+		t.Errorf("runs output (exit %d):\n%s", code, stdout.String())
+	}
+}
+
+// TestBackupMessage attaches a -m message to the run and the snapshots it wrote
+func TestBackupMessage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			_, _ = io.WriteString(w, `{"data":{"budgets":[{"id":"b1","name":"Budget","last_modified_on":"2025-01-01T00:00:00Z"}]}}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"data":{"budget":{"id":"b1"},"server_knowledge":1}}`)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	t.Setenv("YNAB_BEARER_TOKEN", "tok")
+	var stderr bytes.Buffer
+	args := []string{"backup", "--url", srv.URL, "--output", dir, "-m", "before moving categories"}
+	if code := runCLI(args, io.Discard, &stderr); code != 0 {
+		t.Fatalf("backup exit code = %d; stderr: %s", code, stderr.String())
+	}
+	runs, err := loadRuns(t.Context(), ynabvault.DirStore(dir))
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("loadRuns = %v, %v", runs, err)
+	}
+	if want := []string{"Budget_b1_20250101T000000Z.json"}; runs[0].Message != "before moving categories" || !slices.Equal(runs[0].Snapshots, want) {
+		t.Errorf("run record = %+v; want message and snapshots %v", runs[0], want)
+	}
+
+	for _, cmd := range []string{"list", "runs"} {
+		var stdout bytes.Buffer
+		if code := runCLI([]string{cmd, "--output", dir}, &stdout, io.Discard); code != 0 {
+			t.Fatalf("%s exit code = %d", cmd, code)
+		}
+		if !strings.Contains(stdout.String(), "before moving categories") {
+			t.Errorf("%s output lacks the message:\n%s", cmd, stdout.String())
+		}
+	}
+}
+
+// TestRunsRecordClient names the machine behind each backup and prune
+func TestRunsRecordClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			_, _ = io.WriteString(w, `{"data":{"budgets":[{"id":"b1","name":"Budget","last_modified_on":"2025-01-01T00:00:00Z"}]}}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"data":{"budget":{}}}`)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	old := "Budget_b1_20200101T000000Z.json"
+	if err := os.WriteFile(filepath.Join(dir, old), []byte(`{}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var stderr bytes.Buffer
+	args := []string{"backup", "--token", "tok", "--url", srv.URL, "--output", dir, "--force", "--keep-daily", "1"}
+	if code := runCLI(args, io.Discard, &stderr); code != 0 {
+		t.Fatalf("backup exit %d: %s", code, stderr.String())
+	}
+
+	runs, err := loadRuns(t.Context(), ynabvault.DirStore(dir))
+	if err != nil || len(runs) != 2 {
+		t.Fatalf("loadRuns = %+v, %v; want a backup and a prune", runs, err)
+	}
+	me := currentClient()
+	if me.Host == "" || me.Version == "" || me.OS == "" {
+		t.Errorf("currentClient() = %+v; want every field", me)
+	}
+	if b := runs[0]; b.Command != "backup" || b.Client != me || len(b.Snapshots) != 1 {
+		t.Errorf("backup record = %+v", b)
+	}
+	if p := runs[1]; p.Command != "prune" || p.isBackup() || p.Client != me || !slices.Equal(p.Pruned, []string{old}) {
+		t.Errorf("prune record = %+v", p)
+	}
+
+	var stdout bytes.Buffer
+	if code := runCLI([]string{"list", "--output", dir}, &stdout, &stderr); code != 0 || !strings.Contains(stdout.String(), me.Host) {
+		t.Errorf("list does not show the host (exit %d):\n%s", code, stdout.String())
+	}
+	stdout.Reset()
+	if code := runCLI([]string{"runs", "--output", dir}, &stdout, &stderr); code != 0 || !strings.Contains(stdout.String(), "removed 1 files") {
+		t.Errorf("runs does not show the prune (exit %d):\n%s", code, stdout.String())
+	}
+}
+
+// TestBackupMinInterval skips a backup soon after a successful one, but not
+// after a failed one
+func TestBackupMinInterval(t *testing.T) {
+	var lists int
+	failing := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			lists++
+			if failing {
+				http.Error(w, "boom", http.StatusInternalServerError)
+				return
+			}
+			_, _ = io.WriteString(w, `{"data":{"budgets":[{"id":"b1","name":"Budget","last_modified_on":"2025-01-01T00:00:00Z"}]}}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"data":{"budget":{"id":"b1"},"server_knowledge":1}}`)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	t.Setenv("YNAB_BEARER_TOKEN", "tok")
+	backup := func(wantCode int, extra ...string) string {
+		t.Helper()
+		var stderr bytes.Buffer
+		args := append([]string{"backup", "--url", srv.URL, "--output", dir, "--retries", "0", "--min-interval", "1h"}, extra...)
+		if code := runCLI(args, io.Discard, &stderr); code != wantCode {
+			t.Fatalf("backup %v exit code = %d; want %d (stderr: %s)", extra, code, wantCode, stderr.String())
+		}
+		return stderr.String()
+	}
+
+	failing = true
+	backup(1)
+	failing = false
+	backup(0)
+	if lists != 2 {
+		t.Fatalf("API called %d times; want a run after the failed one", lists)
+	}
+	if out := backup(0); !strings.Contains(out, "Skipping backup") || lists != 2 {
+		t.Errorf("second run called the API (%d) or said %q; want it skipped", lists, out)
+	}
+	if out := backup(0, "--lang", "nl"); !strings.HasPrefix(out, "Back-up overgeslagen") {
+		t.Errorf("Dutch skip message = %q", out)
+	}
+	backup(3, "--min-interval-exit", "3")
+	backup(0, "--min-interval", "0")
+	if lists != 3 {
+		t.Errorf("API called %d times; want a run with --min-interval 0", lists)
+	}
+}
+
+// TestLastSuccess ignores prunes and runs that failed
+func TestLastSuccess(t *testing.T) {
+	at := func(h int) time.Time { return time.Date(2025, 5, 14, h, 0, 0, 0, time.UTC) }
+	runs := []runRecord{
+		{Command: "backup", Finished: at(1)},
+		{Finished: at(2)},
+		{Command: "backup", Finished: at(3), Failed: 1},
+		{Command: "backup", Finished: at(4), Error: "interrupted"},
+		{Command: "prune", Finished: at(5)},
+	}
+	if r, ok := lastSuccess(runs); !ok || !r.Finished.Equal(at(2)) {
+		t.Errorf("lastSuccess = %v, %v; want the run finished at 02:00", r.Finished, ok)
+	}
+	if _, ok := lastSuccess(runs[2:]); ok {
+		t.Error("lastSuccess found a run among failures and prunes")
+	}
+}
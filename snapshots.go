@@ -0,0 +1,196 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// snapshotInfo describes a budget snapshot file in the output directory
+type snapshotInfo struct {
+	Name string // sanitized budget name
+	ID   string
+	Time time.Time
+	File string
+	// Encrypted is set for age-encrypted snapshots
+	Encrypted bool
+	// Nested is set for snapshots saved in the nested layout
+	Nested bool
+}
+
+// parseSnapshotName splits a ynabvault.BuildFilename result, or the path of
+// a nested snapshot ending in <name>_<id>/<timestamp>/budget.json, back into
+// its parts
+func parseSnapshotName(fname string) (snapshotInfo, bool) {
+	base, encrypted := ynabvault.TrimStoredSuffixes(fname)
+	if dir, ok := strings.CutSuffix(base, "/"+ynabvault.NestedBudgetFile); ok {
+		return parseNestedSnapshot(dir, fname, encrypted)
+	}
+	base, ok := strings.CutSuffix(base, ".json")
+	if !ok {
+		return snapshotInfo{}, false
+	}
+	i := strings.LastIndex(base, "_")
+	if i < 0 {
+		return snapshotInfo{}, false
+	}
+	ts, err := time.Parse(ynabvault.TimeFormat, base[i+1:])
+	if err != nil {
+		return snapshotInfo{}, false
+	}
+	rest := base[:i]
+	j := strings.LastIndex(rest, "_")
+	if j < 0 {
+		return snapshotInfo{}, false
+	}
+	return snapshotInfo{Name: rest[:j], ID: rest[j+1:], Time: ts, File: fname, Encrypted: encrypted}, true
+}
+
+// parseNestedSnapshot parses dir, the <name>_<id>/<timestamp> directory of
+// the nested snapshot fname
+func parseNestedSnapshot(dir, fname string, encrypted bool) (snapshotInfo, bool) {
+	budgetDir, stamp := path.Split(dir)
+	ts, err := time.Parse(ynabvault.TimeFormat, stamp)
+	if err != nil {
+		return snapshotInfo{}, false
+	}
+	budgetDir = path.Base(budgetDir)
+	j := strings.LastIndex(budgetDir, "_")
+	if j < 0 {
+		return snapshotInfo{}, false
+	}
+	return snapshotInfo{Name: budgetDir[:j], ID: budgetDir[j+1:], Time: ts, File: fname, Encrypted: encrypted, Nested: true}, true
+}
+
+// listSnapshots returns the snapshot files at the top of store, and those
+// of the nested layout, sorted by budget, then time
+func listSnapshots(ctx context.Context, store ynabvault.Store) ([]snapshotInfo, error) {
+	snaps, _, err := scanSnapshots(ctx, store)
+	return snaps, err
+}
+
+// scanSnapshots is listSnapshots that also returns the JSON files at the top
+// of store it cannot place: named neither by BuildFilename nor, according
+// to the catalog, by a --filename-template
+func scanSnapshots(ctx context.Context, store ynabvault.Store) ([]snapshotInfo, []string, error) {
+	names, err := store.List(ctx, "")
+	if err != nil {
+		return nil, nil, fmt.Errorf("list snapshots: %w: %w", ynabvault.ErrBackend, err)
+	}
+	var snaps []snapshotInfo
+	var unknown []string
+	for _, name := range names {
+		// Bookkeeping files are hidden
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		// Flat sub-resources live in per-budget directories; a nested
+		// snapshot is exactly two directories down
+		s, ok := parseSnapshotName(name)
+		depth := 0
+		if s.Nested {
+			depth = 2
+		}
+		if ok && strings.Count(name, "/") == depth {
+			snaps = append(snaps, s)
+		} else if base, _ := ynabvault.TrimStoredSuffixes(name); !ok && !strings.Contains(name, "/") && strings.HasSuffix(base, ".json") {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		// A template such as {id}_{date} or latest drops the budget name or
+		// time from the file name; the catalog recorded both at backup time
+		entries, err := loadCatalog(ctx, store)
+		if err != nil {
+			return nil, nil, err
+		}
+		catalogued := map[string]catalogEntry{}
+		for _, e := range entries {
+			if e.Pruned.IsZero() && e.BudgetID != "" {
+				catalogued[e.File] = e
+			}
+		}
+		unknown = slices.DeleteFunc(unknown, func(name string) bool {
+			e, ok := catalogued[name]
+			if ok {
+				_, encrypted := ynabvault.TrimStoredSuffixes(name)
+				snaps = append(snaps, snapshotInfo{
+					Name:      cmp.Or(ynabvault.SanitizeFileName(e.Budget), ynabvault.SanitizeFileName(e.BudgetID)),
+					ID:        e.BudgetID,
+					Time:      e.Time,
+					File:      name,
+					Encrypted: encrypted,
+				})
+			}
+			return ok
+		})
+	}
+	sort.Slice(snaps, func(a, b int) bool {
+		if snaps[a].Name != snaps[b].Name {
+			return snaps[a].Name < snaps[b].Name
+		}
+		if snaps[a].ID != snaps[b].ID {
+			return snaps[a].ID < snaps[b].ID
+		}
+		return snaps[a].Time.Before(snaps[b].Time)
+	})
+	return snaps, unknown, nil
+}
+
+// snapshotResources lists the sub-resource files saved by the same run as
+// snap: in the nested layout, every other file in its directory
+func snapshotResources(ctx context.Context, store ynabvault.Store, snap snapshotInfo) ([]string, error) {
+	prefix := snap.Name + "_" + snap.ID + "/"
+	if snap.Nested {
+		prefix = path.Dir(snap.File) + "/"
+	}
+	names, err := store.List(ctx, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("list sub-resources: %w: %w", ynabvault.ErrBackend, err)
+	}
+	ts := "_" + snap.Time.UTC().Format(ynabvault.TimeFormat) + ".json"
+	var out []string
+	for _, name := range names {
+		if snap.Nested {
+			if name != snap.File {
+				out = append(out, name)
+			}
+		} else if base, _ := ynabvault.TrimStoredSuffixes(name); strings.HasSuffix(base, ts) {
+			out = append(out, name)
+		}
+	}
+	return out, nil
+}
+
+// loadSnapshotBudget reads a snapshot by its name in store, falling back to
+// a local file path, and returns its budget
+func loadSnapshotBudget(ctx context.Context, store ynabvault.Store, name string, ids []age.Identity) (map[string]interface{}, error) {
+	data, err := readPlain(ctx, store, name, ids)
+	if errors.Is(err, fs.ErrNotExist) {
+		if data, err = os.ReadFile(name); err == nil {
+			data, err = ynabvault.OpenStored(data, ids)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", name, err)
+	}
+	env, err := ynabvault.DecodeEnvelope(data)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", name, err)
+	}
+	if env.Data.Budget == nil {
+		return nil, fmt.Errorf("read %s: %w: no budget in snapshot", name, ynabvault.ErrCorrupt)
+	}
+	return env.Data.Budget, nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// TestParseSnapshotName round-trips ynabvault.BuildFilename output
+func TestParseSnapshotName(t *testing.T) {
+	b := ynabvault.Budget{ID: "abc-123", Name: "My Budget_2", LastModifiedOn: time.Date(2025, time.May, 14, 15, 30, 45, 0, time.UTC)}
+	got, ok := parseSnapshotName(ynabvault.BuildFilename(b))
+	if !ok {
+		t.Fatal("parseSnapshotName rejected BuildFilename output")
+	}
+	if got.Name != "My_Budget_2" || got.ID != "abc-123" || !got.Time.Equal(b.LastModifiedOn) {
+		t.Errorf("parsed %+v", got)
+	}
+	nested, ok := parseSnapshotName("My_Budget_2_abc-123/20250514T153045Z/budget.json.age")
+	if !ok || !nested.Nested || !nested.Encrypted || nested.Name != "My_Budget_2" || nested.ID != "abc-123" || !nested.Time.Equal(b.LastModifiedOn) {
+		t.Errorf("parsed nested %+v, %v", nested, ok)
+	}
+	for _, bad := range []string{"notes.txt", "x.json", "a_b_notatime.json", "only_20250101T000000Z.json", "A_1/latest/budget.json", "A/20250101T000000Z/budget.json"} {
+		if _, ok := parseSnapshotName(bad); ok {
+			t.Errorf("parseSnapshotName(%q) accepted a non-snapshot name", bad)
+		}
+	}
+}
+
+// TestListSnapshotsOrder sorts by budget then time and tolerates a missing dir
+func TestListSnapshotsOrder(t *testing.T) {
+	if snaps, err := listSnapshots(t.Context(), ynabvault.DirStore(filepath.Join(t.TempDir(), "missing"))); err != nil || len(snaps) != 0 {
+		t.Fatalf("listSnapshots(t.Context(), DirStore(missing)) = %v, %v", snaps, err)
+	}
+	dir := t.TempDir()
+	store := ynabvault.DirStore(dir)
+	for _, name := range []string{
+		"B_2_20250102T000000Z.json",
+		"A_1_20250103T000000Z.json",
+		"A_1_20250101T000000Z.json",
+		"A_1/20250102T000000Z/budget.json",
+		"A_1/20250102T000000Z/accounts.json",
+		"A_1/accounts_20250101T000000Z.json",
+	} {
+		if err := store.Put(t.Context(), name, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snaps, err := listSnapshots(t.Context(), store)
+	if err != nil {
+		t.Fatalf("listSnapshots: %v", err)
+	}
+	want := []string{"A_1_20250101T000000Z.json", "A_1/20250102T000000Z/budget.json", "A_1_20250103T000000Z.json", "B_2_20250102T000000Z.json"}
+	if len(snaps) != len(want) {
+		t.Fatalf("got %d snapshots; want %d", len(snaps), len(want))
+	}
+	for i, s := range snaps {
+		if s.File != want[i] {
+			t.Errorf("snaps[%d] = %s; want %s", i, s.File, want[i])
+		}
+	}
+}
+
+// TestScanSnapshots places template-named files through the catalog and
+// returns the JSON files nothing places
+func TestScanSnapshots(t *testing.T) {
+	store := ynabvault.DirStore(t.TempDir())
+	for _, name := range []string{
+		"A_1_20250101T000000Z.json",
+		"1_2025-02-01.json.age",
+		"Home_1.json",
+		"1_2025-01-15.json",
+		"notes.json",
+		"README.txt",
+	} {
+		if err := store.Put(t.Context(), name, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	feb := time.Date(2025, time.February, 1, 0, 0, 0, 0, time.UTC)
+	if err := saveCatalog(t.Context(), store, []catalogEntry{
+		{BudgetID: "1", Budget: "A", Time: feb, File: "1_2025-02-01.json.age"},
+		{BudgetID: "1", Budget: "A", Time: feb.AddDate(0, 1, 0), File: "Home_1.json"},
+		{BudgetID: "1", Budget: "A", Time: feb.AddDate(0, 0, -17), File: "1_2025-01-15.json", Pruned: feb},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	snaps, unknown, err := scanSnapshots(t.Context(), store)
+	if err != nil {
+		t.Fatalf("scanSnapshots: %v", err)
+	}
+	var got []string
+	for _, s := range snaps {
+		got = append(got, s.Name+" "+s.ID+" "+s.Time.Format("2006-01-02")+" "+s.File)
+	}
+	want := []string{
+		"A 1 2025-01-01 A_1_20250101T000000Z.json",
+		"A 1 2025-02-01 1_2025-02-01.json.age",
+		"A 1 2025-03-01 Home_1.json",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("snapshots = %q; want %q", got, want)
+	}
+	if !snaps[1].Encrypted {
+		t.Errorf("%s not marked encrypted", snaps[1].File)
+	}
+	if want := []string{"1_2025-01-15.json", "notes.json"}; !slices.Equal(unknown, want) {
+		t.Errorf("unknown = %q; want %q", unknown, want)
+	}
+
+	// Export and report load a template name by what the catalog says
+	if err := store.Put(t.Context(), "Home_1.json", []byte(`{"data":{"budget":{"id":"1"}}}`)); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadExportSnapshots(t.Context(), store, []string{"Home_1.json"}, nil)
+	if err != nil || loaded[0].Info.ID != "1" || !loaded[0].Info.Time.Equal(feb.AddDate(0, 1, 0)) {
+		t.Errorf("loadExportSnapshots = %+v, %v", loaded, err)
+	}
+}
+
+// TestSnapshotResources finds the files saved with a flat or nested snapshot
+func TestSnapshotResources(t *testing.T) {
+	store := ynabvault.DirStore(t.TempDir())
+	for _, name := range []string{
+		"A_1_20250101T000000Z.json",
+		"A_1/accounts_20250101T000000Z.json",
+		"A_1/accounts_20250102T000000Z.json",
+		"A_1/20250102T000000Z/budget.json",
+		"A_1/20250102T000000Z/accounts.json",
+		"A_1/20250102T000000Z/payees.json",
+	} {
+		if err := store.Put(t.Context(), name, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snaps, err := listSnapshots(t.Context(), store)
+	if err != nil || len(snaps) != 2 {
+		t.Fatalf("listSnapshots = %v, %v; want 2 snapshots", snaps, err)
+	}
+	want := map[string][]string{
+		"A_1_20250101T000000Z.json":        {"A_1/accounts_20250101T000000Z.json"},
+		"A_1/20250102T000000Z/budget.json": {"A_1/20250102T000000Z/accounts.json", "A_1/20250102T000000Z/payees.json"},
+	}
+	for _, s := range snaps {
+		got, err := snapshotResources(t.Context(), store, s)
+		if err != nil || !slices.Equal(got, want[s.File]) {
+			t.Errorf("snapshotResources(%s) = %v, %v; want %v", s.File, got, err, want[s.File])
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// compareStores lists the snapshot and sub-resource files in src that dst
+// lacks, and those dst holds with other content: a different size or, for
+// unencrypted files src's manifest pins, a copy that no longer matches the
+// pin. Encrypted copies are compared by size only, as pins are of the plain
+// content. Bookkeeping files are rewritten on every run and are not
+// compared; mergeIndexes carries over the manifest and catalog entries.
+func compareStores(ctx context.Context, src, dst ynabvault.Store) (missing, differ []string, err error) {
+	have, err := storeSizes(ctx, dst)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list destination: %w: %w", ynabvault.ErrBackend, err)
+	}
+	sizes, err := storeSizes(ctx, src)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list source: %w: %w", ynabvault.ErrBackend, err)
+	}
+	pins, err := ynabvault.LoadManifest(ctx, src)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, name := range slices.Sorted(maps.Keys(sizes)) {
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		size, ok := have[name]
+		if !ok {
+			missing = append(missing, name)
+			continue
+		}
+		same := size == sizes[name]
+		if same {
+			if same, err = matchesPin(ctx, dst, pins, name); err != nil {
+				return nil, nil, err
+			}
+		}
+		if !same {
+			differ = append(differ, name)
+		}
+	}
+	return missing, differ, nil
+}
+
+// matchesPin reports whether store's copy of name holds the content pins
+// records for it; files without a pin and encrypted files pass unread
+func matchesPin(ctx context.Context, store ynabvault.Store, pins *ynabvault.Manifest, name string) (bool, error) {
+	if _, ok := pins.Files[name]; !ok {
+		return true, nil
+	}
+	if _, encrypted := ynabvault.TrimStoredSuffixes(name); encrypted {
+		return true, nil
+	}
+	data, err := store.Get(ctx, name)
+	if err != nil {
+		return false, fmt.Errorf("read %s: %w: %w", name, ynabvault.ErrBackend, err)
+	}
+	plain, err := ynabvault.OpenStored(data, nil)
+	if err != nil {
+		return false, nil // a copy that does not decompress is corrupt
+	}
+	return pins.Check(name, plain) == nil, nil
+}
+
+// repairFiles copies names from src to dst one at a time, replacing copies
+// that differ, paced by t, and returns the files and bytes copied. Each
+// file is written whole, so an interrupted repair resumes with what is
+// still missing or different on the next run.
+func repairFiles(ctx context.Context, src, dst ynabvault.Store, names []string, t *throttle) (int, int64, error) {
+	var copied int
+	var total int64
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return copied, total, fmt.Errorf("repair interrupted: %w", err)
+		}
+		data, err := src.Get(ctx, name)
+		if err != nil {
+			return copied, total, fmt.Errorf("read %s: %w: %w", name, ynabvault.ErrBackend, err)
+		}
+		if err := dst.Put(ctx, name, data); err != nil {
+			return copied, total, fmt.Errorf("write %s: %w: %w", name, ynabvault.ErrBackend, err)
+		}
+		copied++
+		total += int64(len(data))
+		if err := t.pace(ctx, len(data)); err != nil {
+			return copied, total, fmt.Errorf("repair interrupted: %w", err)
+		}
+	}
+	return copied, total, nil
+}
+
+// mergeIndexes adds to dst's manifest and catalog what src records of the
+// files dst holds, so verify --deep and list work on the copy. Entries dst
+// already has are kept, and the files are only written when they change.
+// It returns how many pins were added.
+func mergeIndexes(ctx context.Context, src, dst ynabvault.Store) (int, error) {
+	have, err := dst.List(ctx, "")
+	if err != nil {
+		return 0, fmt.Errorf("list destination: %w: %w", ynabvault.ErrBackend, err)
+	}
+	srcPins, err := ynabvault.LoadManifest(ctx, src)
+	if err != nil {
+		return 0, err
+	}
+	dstPins, err := ynabvault.LoadManifest(ctx, dst)
+	if err != nil {
+		return 0, err
+	}
+	pinned := dstPins.Merge(srcPins, have)
+	if pinned > 0 {
+		if err := dstPins.Save(ctx, dst); err != nil {
+			return 0, err
+		}
+	}
+
+	srcCatalog, err := loadCatalog(ctx, src)
+	if err != nil {
+		return pinned, err
+	}
+	dstCatalog, err := loadCatalog(ctx, dst)
+	if err != nil {
+		return pinned, err
+	}
+	present := map[string]bool{}
+	for _, name := range have {
+		present[name] = true
+	}
+	cataloged := map[string]bool{}
+	for _, e := range dstCatalog {
+		cataloged[e.File] = true
+	}
+	n := len(dstCatalog)
+	for _, e := range srcCatalog {
+		if present[e.File] && !cataloged[e.File] {
+			dstCatalog = append(dstCatalog, e)
+		}
+	}
+	if len(dstCatalog) == n {
+		return pinned, nil
+	}
+	return pinned, saveCatalog(ctx, dst, dstCatalog)
+}
+
+// throttle holds an average transfer rate by sleeping once the bytes moved
+// run ahead of the limit; a zero limit never sleeps
+type throttle struct {
+	limit int64 // bytes per second
+	start time.Time
+	sent  int64
+	now   func() time.Time
+	wait  func(ctx context.Context, d time.Duration) error
+}
+
+// newThrottle returns a throttle for limit bytes per second
+func newThrottle(limit int64) *throttle {
+	return &throttle{limit: limit, now: time.Now, wait: ynabvault.SleepContext}
+}
+
+// pace accounts for n more bytes and waits until they fit the rate
+func (t *throttle) pace(ctx context.Context, n int) error {
+	if t.limit <= 0 {
+		return nil
+	}
+	if t.start.IsZero() {
+		t.start = t.now()
+	}
+	t.sent += int64(n)
+	due := t.start.Add(time.Duration(float64(t.sent) / float64(t.limit) * float64(time.Second)))
+	if d := due.Sub(t.now()); d > 0 {
+		return t.wait(ctx, d)
+	}
+	return nil
+}
+
+// parseByteRate parses a --bwlimit value such as "512K", "2M" or "1.5MiB/s";
+// suffixes are binary multiples and "" means unlimited
+func parseByteRate(s string) (int64, error) {
+	n, err := parseByteSize(strings.TrimSuffix(strings.TrimSpace(s), "/s"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate %q: want bytes per second such as 512K or 2M", s)
+	}
+	return n, nil
+}
+
+// parseByteSize parses a size such as "512K", "2M" or "1.5GiB"; suffixes
+// are binary multiples and "" means no limit
+func parseByteSize(s string) (int64, error) {
+	v := strings.TrimSpace(s)
+	if v == "" {
+		return 0, nil
+	}
+	v = strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(v), "B"), "I")
+	mult := int64(1)
+	for suffix, m := range map[string]int64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30} {
+		if num, ok := strings.CutSuffix(v, suffix); ok {
+			v, mult = num, m
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q: want bytes such as 512K or 2M", s)
+	}
+	return int64(n * float64(mult)), nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// TestParseByteRate accepts binary suffixes and rejects nonsense
+func TestParseByteRate(t *testing.T) {
+	for in, want := range map[string]int64{"": 0, "100": 100, "512K": 512 << 10, "2M": 2 << 20, "1.5MiB/s": 3 << 19, "1gb": 1 << 30} {
+		if got, err := parseByteRate(in); err != nil || got != want {
+			t.Errorf("parseByteRate(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"fast", "-1M", "0"} {
+		if _, err := parseByteRate(bad); err == nil {
+			t.Errorf("parseByteRate(%q) succeeded", bad)
+		}
+	}
+	if n, err := parseByteSize("50M"); err != nil || n != 50<<20 {
+		t.Errorf("parseByteSize(50M) = %d, %v", n, err)
+	}
+}
+
+// TestThrottle sleeps only when transfers run ahead of the limit
+func TestThrottle(t *testing.T) {
+	now := time.Unix(0, 0)
+	var waited []time.Duration
+	th := newThrottle(1000)
+	th.now = func() time.Time { return now }
+	th.wait = func(_ context.Context, d time.Duration) error {
+		waited = append(waited, d)
+		now = now.Add(d)
+		return nil
+	}
+	ctx := t.Context()
+	_ = th.pace(ctx, 500) // due at 0.5s, waits until then
+	now = now.Add(time.Second)
+	_ = th.pace(ctx, 1000) // due at 1.5s, already reached
+	_ = th.pace(ctx, 1000) // due at 2.5s
+	if len(waited) != 2 || waited[0] != 500*time.Millisecond || waited[1] != time.Second {
+		t.Errorf("waits = %v; want [500ms 1s]", waited)
+	}
+	if err := newThrottle(0).pace(ctx, 1<<30); err != nil {
+		t.Errorf("unlimited pace = %v", err)
+	}
+}
+
+// TestSyncCommand reports missing and differing files, then repairs them in
+// place
+func TestSyncCommand(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	for _, name := range []string{"B_b1_20250101T000000Z.json", "B_b1_20250102T000000Z.json", "B_b1/accounts_20250102T000000Z.json", ynabvault.StateFileName} {
+		if err := ynabvault.DirStore(src).Put(t.Context(), name, []byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ynabvault.DirStore(dst).Put(t.Context(), "B_b1_20250101T000000Z.json", []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	// The second snapshot's copy has the right size but not the pinned content
+	if err := ynabvault.DirStore(dst).Put(t.Context(), "B_b1_20250102T000000Z.json", []byte("B_b1_20250102T000000Z.jsoX")); err != nil {
+		t.Fatal(err)
+	}
+	pins := fmt.Sprintf(`{"files":{"B_b1_20250101T000000Z.json":{"sha256":"%x","size":26},"B_b1_20250102T000000Z.json":{"sha256":"%x","size":26},"Gone_b2_20250101T000000Z.json":{"sha256":"c","size":1}}}`,
+		sha256.Sum256([]byte("B_b1_20250101T000000Z.json")), sha256.Sum256([]byte("B_b1_20250102T000000Z.json")))
+	if err := ynabvault.DirStore(src).Put(t.Context(), ".ynabvault-manifest.json", []byte(pins)); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveCatalog(t.Context(), ynabvault.DirStore(src), []catalogEntry{{BudgetID: "b1", Budget: "B", File: "B_b1_20250102T000000Z.json"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout strings.Builder
+	if code := runCLI([]string{"sync", "--output", src, "--to", dst}, &stdout, io.Discard); code != 0 {
+		t.Fatalf("exit code = %d", code)
+	}
+	if out := stdout.String(); !strings.Contains(out, "missing B_b1/accounts_20250102T000000Z.json") || !strings.Contains(out, "differs B_b1_20250101T000000Z.json") ||
+		!strings.Contains(out, "differs B_b1_20250102T000000Z.json") || !strings.Contains(out, "1 files missing from "+dst+", 2 differ") {
+		t.Errorf("report:\n%s", out)
+	}
+
+	stdout.Reset()
+	if code := runCLI([]string{"sync", "--output", src, "--to", dst, "--repair", "--bwlimit", "1G"}, &stdout, io.Discard); code != 0 {
+		t.Fatalf("repair exit code = %d", code)
+	}
+	if !strings.Contains(stdout.String(), "Copied 3 of 3 missing or differing files") {
+		t.Errorf("repair output:\n%s", stdout.String())
+	}
+	if got, err := os.ReadFile(filepath.Join(dst, "B_b1", "accounts_20250102T000000Z.json")); err != nil || string(got) != "B_b1/accounts_20250102T000000Z.json" {
+		t.Errorf("repaired file = %q, %v", got, err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, ynabvault.StateFileName)); !os.IsNotExist(err) {
+		t.Errorf("bookkeeping file was copied: %v", err)
+	}
+	// The copy gets the pins and catalog entries of the files it holds
+	if !strings.Contains(stdout.String(), "Pinned 2 files in the manifest") {
+		t.Errorf("repair output lacks the merged pins:\n%s", stdout.String())
+	}
+	m, err := ynabvault.LoadManifest(t.Context(), ynabvault.DirStore(dst))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, gone := m.Files["Gone_b2_20250101T000000Z.json"]; len(m.Files) != 2 || gone {
+		t.Errorf("destination manifest = %v; want the pins of its two snapshots", m.Files)
+	}
+	if entries, err := loadCatalog(t.Context(), ynabvault.DirStore(dst)); err != nil || len(entries) != 1 || entries[0].File != "B_b1_20250102T000000Z.json" {
+		t.Errorf("destination catalog = %v, %v", entries, err)
+	}
+
+	stdout.Reset()
+	if code := runCLI([]string{"sync", "--output", src, "--to", dst}, &stdout, io.Discard); code != 0 || !strings.Contains(stdout.String(), "0 files missing from "+dst+", 0 differ") {
+		t.Errorf("after repair exit code = %d:\n%s", code, stdout.String())
+	}
+	stdout.Reset()
+	if code := runCLI([]string{"sync", "--output", src, "--to", dst, "--lang", "de"}, &stdout, io.Discard); code != 0 || !strings.Contains(stdout.String(), "0 Dateien fehlen in "+dst) {
+		t.Errorf("German report exit code = %d:\n%s", code, stdout.String())
+	}
+	if code := runCLI([]string{"sync", "--output", src}, io.Discard, io.Discard); code != 2 {
+		t.Errorf("missing --to exit code = %d; want 2", code)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+	"gopkg.in/yaml.v3"
+)
+
+// vaultSettingsFile holds vault-wide defaults at the root of the destination
+const vaultSettingsFile = "vault.yaml"
+
+// vaultSettings are defaults shared by every machine operating on a vault;
+// flags and the --config file override them. Secrets such as the token
+// stay out of the vault.
+type vaultSettings struct {
+	Resources         []string `yaml:"resources"`
+	EncryptRecipients []string `yaml:"encrypt_recipients"`
+	MaxBudgetSize     string   `yaml:"max_budget_size"`
+	KeepDaily         int      `yaml:"keep_daily"`
+	KeepWeekly        int      `yaml:"keep_weekly"`
+	KeepMonthly       int      `yaml:"keep_monthly"`
+	// Layout is the layout every backup into the vault must use
+	Layout string `yaml:"layout"`
+}
+
+// loadVaultSettings reads vault.yaml from store; a vault without one has no defaults
+func loadVaultSettings(ctx context.Context, store ynabvault.Store) (vaultSettings, error) {
+	var v vaultSettings
+	data, err := store.Get(ctx, vaultSettingsFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return v, nil
+	}
+	if err != nil {
+		return v, fmt.Errorf("read %s: %w: %w", vaultSettingsFile, ynabvault.ErrBackend, err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&v); err != nil && !errors.Is(err, io.EOF) {
+		return v, fmt.Errorf("parse %s: %w: %w", vaultSettingsFile, ynabvault.ErrCorrupt, err)
+	}
+	return v, nil
+}
+
+// retention returns the vault's default retention schedule
+func (v vaultSettings) retention() retention {
+	return retention{Daily: v.KeepDaily, Weekly: v.KeepWeekly, Monthly: v.KeepMonthly}
+}
+
+// apply fills in backup options that neither flags nor the config file set.
+// The layout is not a default but a property of the vault: a different one
+// set locally is an error rather than a second layout mixed into the vault.
+func (v vaultSettings) apply(o *backupOptions) error {
+	if v.Layout != "" {
+		if o.layout != "" && o.layout != v.Layout {
+			return fmt.Errorf("layout %q conflicts with layout %q in %s", o.layout, v.Layout, vaultSettingsFile)
+		}
+		o.layout = v.Layout
+	}
+	if o.resources == "" && v.Resources != nil {
+		o.resources = strings.Join(v.Resources, ",")
+	}
+	if o.recipients == nil && v.EncryptRecipients != nil {
+		o.recipients = v.EncryptRecipients
+	}
+	if o.maxSize == "" {
+		o.maxSize = v.MaxBudgetSize
+	}
+	if !o.retention.enabled() {
+		o.retention = v.retention()
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// TestVaultSettings loads vault.yaml and fills only unset backup options
+func TestVaultSettings(t *testing.T) {
+	ctx := t.Context()
+	store := ynabvault.DirStore(t.TempDir())
+	if v, err := loadVaultSettings(ctx, store); err != nil || !reflect.DeepEqual(v, vaultSettings{}) {
+		t.Fatalf("loadVaultSettings without a file = %+v, %v", v, err)
+	}
+	if err := store.Put(ctx, vaultSettingsFile, []byte("resources: [accounts]\nkeep_daily: 7\nmax_budget_size: 50M\n")); err != nil {
+		t.Fatal(err)
+	}
+	v, err := loadVaultSettings(ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var opts backupOptions
+	if err := v.apply(&opts); err != nil {
+		t.Fatal(err)
+	}
+	if want := (backupOptions{resources: "accounts", maxSize: "50M", retention: retention{Daily: 7}}); !reflect.DeepEqual(opts, want) {
+		t.Errorf("applied to empty options = %+v; want %+v", opts, want)
+	}
+	// Flags and the config file win
+	opts = backupOptions{resources: "payees", retention: retention{Weekly: 4}}
+	if err := v.apply(&opts); err != nil {
+		t.Fatal(err)
+	}
+	if opts.resources != "payees" || opts.retention != (retention{Weekly: 4}) {
+		t.Errorf("vault settings overrode explicit options: %+v", opts)
+	}
+
+	// The vault's layout is adopted, and a different local one refused
+	v = vaultSettings{Layout: ynabvault.LayoutNested}
+	for _, tc := range []struct {
+		layout, want string
+		wantErr      bool
+	}{
+		{"", ynabvault.LayoutNested, false},
+		{ynabvault.LayoutNested, ynabvault.LayoutNested, false},
+		{ynabvault.LayoutFlat, ynabvault.LayoutFlat, true},
+	} {
+		opts := backupOptions{layout: tc.layout}
+		if err := v.apply(&opts); (err != nil) != tc.wantErr || opts.layout != tc.want {
+			t.Errorf("apply with layout %q = %q, %v; want %q, error %v", tc.layout, opts.layout, err, tc.want, tc.wantErr)
+		}
+	}
+
+	if err := store.Put(ctx, vaultSettingsFile, []byte("token: secret\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadVaultSettings(ctx, store); !errors.Is(err, ynabvault.ErrCorrupt) {
+		t.Errorf("vault.yaml with an unknown key = %v; want ErrCorrupt", err)
+	}
+}
+
+// TestVaultSettingsCommands backs up and prunes with the vault's defaults
+func TestVaultSettingsCommands(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			_, _ = io.WriteString(w, `{"data":{"budgets":[{"id":"b1","name":"B","last_modified_on":"2025-01-03T00:00:00Z"}]}}`)
+		case "/b1/accounts":
+			_, _ = io.WriteString(w, `{"data":{"accounts":[]}}`)
+		default:
+			_, _ = io.WriteString(w, `{"data":{"budget":{"id":"b1"}}}`)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	files := map[string]string{
+		vaultSettingsFile:            "resources: [accounts]\nkeep_daily: 2\n",
+		"B_b1_20250101T000000Z.json": "{}",
+		"B_b1_20250102T000000Z.json": "{}",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("YNAB_BEARER_TOKEN", "tok")
+	var stderr bytes.Buffer
+	if code := runCLI([]string{"backup", "--url", srv.URL, "--output", dir}, io.Discard, &stderr); code != 0 {
+		t.Fatalf("backup exit code = %d; stderr: %s", code, stderr.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "B_b1", "accounts_20250103T000000Z.json")); err != nil {
+		t.Errorf("vault resources not backed up: %v", err)
+	}
+	// keep_daily: 2 pruned the oldest snapshot after the backup
+	if _, err := os.Stat(filepath.Join(dir, "B_b1_20250101T000000Z.json")); !os.IsNotExist(err) {
+		t.Errorf("vault retention not applied after backup: %v", err)
+	}
+
+	var stdout strings.Builder
+	if code := runCLI([]string{"prune", "--output", dir, "--dry-run"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("prune exit code = %d; stderr: %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "Kept 2 of 2 snapshots") {
+		t.Errorf("prune with vault retention:\n%s", stdout.String())
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, vaultSettingsFile), []byte("layout: nested\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stderr.Reset()
+	if code := runCLI([]string{"backup", "--url", srv.URL, "--output", dir, "--layout", "flat"}, io.Discard, &stderr); code != 2 {
+		t.Errorf("backup with a conflicting layout exit code = %d; want 2", code)
+	}
+	if !strings.Contains(stderr.String(), `conflicts with layout "nested"`) {
+		t.Errorf("stderr = %s", stderr.String())
+	}
+}
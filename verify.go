@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+	"golang.org/x/sync/errgroup"
+)
+
+// verifyResult is the outcome of checking one snapshot
+type verifyResult struct {
+	Snap snapshotInfo
+	Err  error
+	// Unpinned counts files a deep check found without a manifest hash
+	Unpinned int
+}
+
+// verifySnapshots checks snaps with up to concurrency workers; results keep
+// the order of snaps. A non-nil manifest makes the check deep.
+func verifySnapshots(ctx context.Context, store ynabvault.Store, snaps []snapshotInfo, ids []age.Identity, m *ynabvault.Manifest, concurrency int) []verifyResult {
+	results := make([]verifyResult, len(snaps))
+	var g errgroup.Group
+	g.SetLimit(max(concurrency, 1))
+	for i, s := range snaps {
+		g.Go(func() error {
+			results[i] = verifySnapshot(ctx, store, s, ids, m)
+			return nil
+		})
+	}
+	_ = g.Wait()
+	return results
+}
+
+// verifySnapshot reads one snapshot, decrypting it when needed, and checks
+// its contents. With a manifest it also compares the decrypted content with
+// the hash pinned at backup time and does the same for the snapshot's
+// sub-resource files, proving the whole pipeline round-trips losslessly.
+func verifySnapshot(ctx context.Context, store ynabvault.Store, snap snapshotInfo, ids []age.Identity, m *ynabvault.Manifest) verifyResult {
+	r := verifyResult{Snap: snap}
+	data, err := readPlain(ctx, store, snap.File, ids)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	if _, r.Err = verifyBudget(data, snap.ID); r.Err != nil || m == nil {
+		return r
+	}
+	if r.Err = r.pinned(m, snap.File, data); r.Err != nil {
+		return r
+	}
+	resources, err := snapshotResources(ctx, store, snap)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	for _, name := range resources {
+		data, err := readPlain(ctx, store, name, ids)
+		if err == nil && !json.Valid(data) {
+			err = fmt.Errorf("%w: invalid JSON", ynabvault.ErrCorrupt)
+		}
+		if err == nil {
+			err = r.pinned(m, name, data)
+		}
+		if err != nil {
+			r.Err = fmt.Errorf("%s: %w", name, err)
+			return r
+		}
+	}
+	return r
+}
+
+// budgetLists are the entity lists of a full budget export, with the field
+// that keys their entries and whether every export has them
+var budgetLists = []struct {
+	name, key string
+	required  bool
+}{
+	{"accounts", "id", true},
+	{"months", "month", true},
+	{"transactions", "id", true},
+	{"payees", "id", false},
+	{"payee_locations", "id", false},
+	{"category_groups", "id", false},
+	{"categories", "id", false},
+	{"subtransactions", "id", false},
+	{"scheduled_transactions", "id", false},
+	{"scheduled_subtransactions", "id", false},
+}
+
+// checkBudgetShape checks a decoded budget against the shape of YNAB's
+// budget export: the lists it has are lists of objects with their key, and
+// transactions have a date and an integer amount. A snapshot that was cut
+// short or mangled on its way to storage but is still valid JSON fails
+// here rather than during a restore.
+func checkBudgetShape(budget map[string]interface{}) error {
+	for _, list := range budgetLists {
+		v, ok := budget[list.name]
+		if !ok {
+			if list.required {
+				return fmt.Errorf("%w: data.budget.%s is missing", ynabvault.ErrCorrupt, list.name)
+			}
+			continue
+		}
+		items, ok := v.([]interface{})
+		if !ok {
+			return fmt.Errorf("%w: data.budget.%s is not a list", ynabvault.ErrCorrupt, list.name)
+		}
+		for j, item := range items {
+			obj, ok := item.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%w: data.budget.%s[%d] is not an object", ynabvault.ErrCorrupt, list.name, j)
+			}
+			if key, _ := obj[list.key].(string); key == "" {
+				return fmt.Errorf("%w: data.budget.%s[%d] has no %s", ynabvault.ErrCorrupt, list.name, j, list.key)
+			}
+			if list.name != "transactions" && list.name != "subtransactions" {
+				continue
+			}
+			if n, ok := obj["amount"].(json.Number); !ok || strings.ContainsAny(n.String(), ".eE") {
+				return fmt.Errorf("%w: data.budget.%s[%d] has no integer amount", ynabvault.ErrCorrupt, list.name, j)
+			}
+			if date, _ := obj["date"].(string); list.name == "transactions" && date == "" {
+				return fmt.Errorf("%w: data.budget.%s[%d] has no date", ynabvault.ErrCorrupt, list.name, j)
+			}
+		}
+	}
+	return nil
+}
+
+// pinned checks data against the manifest, counting files without a pin
+func (r *verifyResult) pinned(m *ynabvault.Manifest, name string, data []byte) error {
+	err := m.Check(name, data)
+	if errors.Is(err, ynabvault.ErrNotPinned) {
+		r.Unpinned++
+		return nil
+	}
+	return err
+}
+
+// readPlain reads a stored file, decrypting it when its name says it is encrypted
+func readPlain(ctx context.Context, store ynabvault.Store, name string, ids []age.Identity) ([]byte, error) {
+	data, err := store.Get(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ynabvault.ErrBackend, err)
+	}
+	return ynabvault.OpenStored(data, ids)
+}
+
+// selectSnapshots narrows snaps to those modified within newest of now (when
+// non-zero), then to a random fraction sample in (0,1] of the rest
+func selectSnapshots(snaps []snapshotInfo, now time.Time, newest time.Duration, sample float64) []snapshotInfo {
+	var out []snapshotInfo
+	for _, s := range snaps {
+		if newest == 0 || !s.Time.Before(now.Add(-newest)) {
+			out = append(out, s)
+		}
+	}
+	if sample <= 0 || sample >= 1 || len(out) == 0 {
+		return out
+	}
+	n := max(int(math.Ceil(sample*float64(len(out)))), 1)
+	picked := make([]snapshotInfo, 0, n)
+	for _, i := range rand.Perm(len(out))[:n] {
+		picked = append(picked, out[i])
+	}
+	return picked
+}
+
+// parseSample parses a --sample value such as "10%"
+func parseSample(s string) (float64, error) {
+	if s == "" {
+		return 1, nil
+	}
+	num, ok := strings.CutSuffix(strings.TrimSpace(s), "%")
+	if !ok {
+		return 0, fmt.Errorf("invalid --sample %q: want a percentage such as 10%%", s)
+	}
+	p, err := strconv.ParseFloat(num, 64)
+	if err != nil || p <= 0 || p > 100 {
+		return 0, fmt.Errorf("invalid --sample %q: want a percentage between 0 and 100", s)
+	}
+	return p / 100, nil
+}
+
+// parseAge parses a duration that may also use d (days) and w (weeks), e.g. "30d"
+func parseAge(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if num, ok := strings.CutSuffix(s, suffix); ok {
+			n, err := strconv.Atoi(num)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid duration %q", s)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d, nil
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"github.com/bad33ndj3/ynabvault/pkg/ynabvault"
+)
+
+// TestParseSampleAndAge covers the --sample and --newest syntaxes
+func TestParseSampleAndAge(t *testing.T) {
+	for in, want := range map[string]float64{"": 1, "10%": 0.1, "100%": 1, "2.5%": 0.025} {
+		if got, err := parseSample(in); err != nil || got != want {
+			t.Errorf("parseSample(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"10", "0%", "150%", "x%"} {
+		if _, err := parseSample(bad); err == nil {
+			t.Errorf("parseSample(%q) succeeded", bad)
+		}
+	}
+	for in, want := range map[string]time.Duration{"": 0, "30d": 30 * 24 * time.Hour, "2w": 14 * 24 * time.Hour, "12h": 12 * time.Hour} {
+		if got, err := parseAge(in); err != nil || got != want {
+			t.Errorf("parseAge(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"d", "-1d", "soon", "0s"} {
+		if _, err := parseAge(bad); err == nil {
+			t.Errorf("parseAge(%q) succeeded", bad)
+		}
+	}
+}
+
+// TestSelectSnapshots filters by age before sampling
+func TestSelectSnapshots(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	var snaps []snapshotInfo
+	for i := 0; i < 20; i++ {
+		snaps = append(snaps, snapshotInfo{ID: fmt.Sprint(i), Time: now.Add(-time.Duration(i) * 24 * time.Hour)})
+	}
+	if got := selectSnapshots(snaps, now, 0, 1); len(got) != 20 {
+		t.Errorf("no filters selected %d; want 20", len(got))
+	}
+	if got := selectSnapshots(snaps, now, 10*24*time.Hour, 1); len(got) != 11 {
+		t.Errorf("--newest 10d selected %d; want 11", len(got))
+	}
+	got := selectSnapshots(snaps, now, 0, 0.1)
+	if len(got) != 2 {
+		t.Fatalf("--sample 10%% selected %d; want 2", len(got))
+	}
+	if got[0].ID == got[1].ID {
+		t.Error("sample picked the same snapshot twice")
+	}
+	if got := selectSnapshots(snaps[:3], now, 0, 0.01); len(got) != 1 {
+		t.Errorf("tiny sample selected %d; want at least 1", len(got))
+	}
+}
+
+// TestCheckBudgetShape accepts YNAB's budget export shape and names the
+// first place a snapshot departs from it
+func TestCheckBudgetShape(t *testing.T) {
+	tests := []struct {
+		name   string
+		budget string
+		want   string
+	}{
+		{"complete", `{"accounts":[{"id":"a1"}],"months":[{"month":"2025-01-01"}],"payees":[],
+			"transactions":[{"id":"t1","date":"2025-01-02","amount":-1000}],"subtransactions":[{"id":"s1","amount":-500}]}`, ""},
+		{"missing months", `{"accounts":[],"transactions":[]}`, "data.budget.months is missing"},
+		{"missing transactions", `{"accounts":[],"months":[]}`, "data.budget.transactions is missing"},
+		{"not a list", `{"accounts":{},"months":[],"transactions":[]}`, "data.budget.accounts is not a list"},
+		{"not an object", `{"accounts":[],"months":[],"transactions":[],"payees":[null]}`, "data.budget.payees[0] is not an object"},
+		{"no id", `{"accounts":[{"name":"Checking"}],"months":[],"transactions":[]}`, "data.budget.accounts[0] has no id"},
+		{"no month", `{"accounts":[],"months":[{"income":0}],"transactions":[]}`, "data.budget.months[0] has no month"},
+		{"fractional amount", `{"accounts":[],"months":[],"transactions":[{"id":"t1","date":"2025-01-02","amount":1.5}]}`, "data.budget.transactions[0] has no integer amount"},
+		{"no date", `{"accounts":[],"months":[],"transactions":[{"id":"t1","amount":1}]}`, "data.budget.transactions[0] has no date"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			env, err := ynabvault.DecodeEnvelope([]byte(`{"data":{"budget":` + tc.budget + `}}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = checkBudgetShape(env.Data.Budget)
+			if tc.want == "" {
+				if err != nil {
+					t.Errorf("err = %v; want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, ynabvault.ErrCorrupt) || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("err = %v; want ErrCorrupt with %q", err, tc.want)
+			}
+		})
+	}
+}
+
+// TestVerifyCommand reports broken snapshots among good ones
+func TestVerifyCommand(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"A_a1_20250101T000000Z.json": `{"data":{"budget":{"id":"a1","accounts":[],"months":[],"transactions":[]}}}`,
+		"A_a1_20250102T000000Z.json": `{"data":{"budget":{"id":"a1","accounts":[],"months":[],"transactions":[]}}}`,
+		"B_b1_20250101T000000Z.json": `{"data":{"budget":{"id":"other"}}}`,
+		"C_c1_20250101T000000Z.json": `{"data":`,
+		"D_d1_20250101T000000Z.json": `{"data":{"budget":{"id":"d1","accounts":[]}}}`,
+		"e1_2025-01-01.json":         `{"data":{"budget":{"id":"e1"}}}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var stdout bytes.Buffer
+	if code := runCLI([]string{"verify", "--output", dir, "--concurrency", "3"}, &stdout, io.Discard); code != exitCorrupt {
+		t.Errorf("exit code = %d; want %d", code, exitCorrupt)
+	}
+	out := stdout.String()
+	for _, want := range []string{"FAIL\tB_b1_20250101T000000Z.json", "FAIL\tC_c1_20250101T000000Z.json", "FAIL\tD_d1_20250101T000000Z.json", "Verified 5 of 5 snapshots, 3 failed", "UNKNOWN\te1_2025-01-01.json", "1 files were not verified"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+
+	if err := os.Remove(filepath.Join(dir, "B_b1_20250101T000000Z.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "C_c1_20250101T000000Z.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "D_d1_20250101T000000Z.json")); err != nil {
+		t.Fatal(err)
+	}
+	stdout.Reset()
+	if code := runCLI([]string{"verify", "--output", dir, "--sample", "50%"}, &stdout, io.Discard); code != 0 {
+		t.Errorf("exit code = %d; want 0\n%s", code, stdout.String())
+	}
+	if !strings.Contains(stdout.String(), "Verified 1 of 2 snapshots, 0 failed") {
+		t.Errorf("unexpected output:\n%s", stdout.String())
+	}
+	if code := runCLI([]string{"verify", "--output", dir, "--newest", "soon"}, io.Discard, io.Discard); code != 2 {
+		t.Errorf("invalid --newest exit code = %d; want 2", code)
+	}
+}
+
+// TestMixedVault reads plain and compressed snapshots of one budget alike
+func TestMixedVault(t *testing.T) {
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, _ = io.WriteString(zw, `{"data":{"budget":{"id":"b1","accounts":[{"id":"a2","name":"Savings"}],"months":[],"transactions":[]}}}`)
+	_ = zw.Close()
+	files := map[string][]byte{
+		"Home_b1_20250101T000000Z.json":    []byte(`{"data":{"budget":{"id":"b1","accounts":[{"id":"a1","name":"Checking"}],"months":[],"transactions":[]}}}`),
+		"Home_b1_20250102T000000Z.json.gz": buf.Bytes(),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snaps, err := listSnapshots(t.Context(), ynabvault.DirStore(dir))
+	if err != nil || len(snaps) != 2 {
+		t.Fatalf("listSnapshots = %v, %v; want both snapshots", snaps, err)
+	}
+	var stdout, stderr strings.Builder
+	if code := runCLI([]string{"diff", "--output", dir, "--budget", "Home"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("diff exit code = %d; stderr: %s", code, stderr.String())
+	}
+	if out := stdout.String(); !strings.Contains(out, "Savings") || !strings.Contains(out, "Checking") {
+		t.Errorf("diff across plain and gzip snapshots:\n%s", out)
+	}
+	if code := runCLI([]string{"verify", "--output", dir}, &stdout, &stderr); code != 0 {
+		t.Errorf("verify exit code = %d; stderr: %s", code, stderr.String())
+	}
+}
+
+// TestPinnedRoundTrip backs up an encrypted vault and proves it with
+// verify --deep and dr-test, then catches content swapped behind the pipeline
+func TestPinnedRoundTrip(t *testing.T) {
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "key.txt")
+	if err := os.WriteFile(keyFile, []byte(id.String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			_, _ = io.WriteString(w, `{"data":{"budgets":[{"id":"b1","name":"Budget","last_modified_on":"2025-01-01T00:00:00Z"}]}}`)
+		case "/b1/accounts":
+			_, _ = io.WriteString(w, `{"data":{"accounts":[]}}`)
+		default:
+			_, _ = io.WriteString(w, `{"data":{"budget":{"id":"b1","accounts":[],"months":[],"transactions":[]},"server_knowledge":1}}`)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	cfg := ynabvault.Config{Token: "tok", BaseURL: srv.URL, OutputDir: dir, Client: srv.Client(),
+		Resources: []string{"accounts"}, Recipients: []age.Recipient{id.Recipient()}}
+	if _, err := ynabvault.Run(t.Context(), cfg); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	m, err := ynabvault.LoadManifest(t.Context(), ynabvault.DirStore(dir))
+	if err != nil || len(m.Files) != 2 {
+		t.Fatalf("manifest after backup = %v, %v; want 2 pins", m, err)
+	}
+
+	var stdout strings.Builder
+	if code := runCLI([]string{"verify", "--output", dir, "--identity", keyFile, "--deep"}, &stdout, io.Discard); code != 0 {
+		t.Fatalf("verify --deep exit code = %d\n%s", code, stdout.String())
+	}
+	stdout.Reset()
+	if code := runCLI([]string{"dr-test", "--output", dir, "--identity", keyFile}, &stdout, io.Discard); code != 0 || !strings.Contains(stdout.String(), "ok (matches") {
+		t.Fatalf("dr-test exit code = %d\n%s", code, stdout.String())
+	}
+
+	// A well-formed, correctly encrypted file that is not what was backed up
+	swapped, err := ynabvault.Encrypt([]byte(`{"data":{"accounts":[{"id":"x"}]}}`), []age.Recipient{id.Recipient()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resource := filepath.Join(dir, "Budget_b1", "accounts_20250101T000000Z.json.age")
+	if err := os.WriteFile(resource, swapped, 0644); err != nil {
+		t.Fatal(err)
+	}
+	stdout.Reset()
+	if code := runCLI([]string{"verify", "--output", dir, "--identity", keyFile}, &stdout, io.Discard); code != 0 {
+		t.Errorf("shallow verify exit code = %d; want 0\n%s", code, stdout.String())
+	}
+	stdout.Reset()
+	if code := runCLI([]string{"verify", "--output", dir, "--identity", keyFile, "--deep"}, &stdout, io.Discard); code != exitCorrupt || !strings.Contains(stdout.String(), "content hash") {
+		t.Errorf("verify --deep of a swapped file exit code = %d; want %d\n%s", code, exitCorrupt, stdout.String())
+	}
+
+	// A pinned file that disappeared is reported too
+	if err := os.Remove(resource); err != nil {
+		t.Fatal(err)
+	}
+	stdout.Reset()
+	if code := runCLI([]string{"verify", "--output", dir, "--identity", keyFile, "--deep"}, &stdout, io.Discard); code != exitCorrupt || !strings.Contains(stdout.String(), "MISSING\tBudget_b1/accounts_20250101T000000Z.json.age") {
+		t.Errorf("verify --deep of a deleted file exit code = %d; want %d\n%s", code, exitCorrupt, stdout.String())
+	}
+}